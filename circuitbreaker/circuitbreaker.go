@@ -6,7 +6,9 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,6 +17,28 @@ var (
 	ErrCircuitBreakerTimeout  = errors.New("circuit breaker timeout")
 )
 
+// breakerError is ErrCircuitBreakerOpen or ErrCircuitBreakerTimeout along with how
+// long the caller should back off, for RetryAfter
+type breakerError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *breakerError) Error() string { return e.err.Error() }
+
+func (e *breakerError) Unwrap() error { return e.err }
+
+// RetryAfter returns how long a caller whose call err was rejected or timed out by a
+// breaker should wait before retrying: until the breaker lets probes through if it is
+// open, and its ResetTimeout otherwise. ok is false for errors from anywhere else.
+func RetryAfter(err error) (wait time.Duration, ok bool) {
+	var breakerErr *breakerError
+	if !errors.As(err, &breakerErr) {
+		return 0, false
+	}
+	return breakerErr.retryAfter, true
+}
+
 // State represents the current state of the circuit breaker
 type State int
 
@@ -43,6 +67,17 @@ type Config struct {
 	ResetTimeout    time.Duration // Time to wait before transitioning to half-open
 	FailureTimeout  time.Duration // Timeout for individual calls
 	MaxRequests     int           // Maximum requests allowed in half-open state
+
+	// SuccessRatio is the fraction of the MaxRequests half-open probes that must
+	// succeed to close the breaker. It reopens as soon as the ratio becomes
+	// unreachable. Zero means 1, where any failed probe reopens the breaker.
+	SuccessRatio float64
+
+	// IsFailure decides whether an error returned by fn counts against the breaker.
+	// Errors it rejects are passed back to the caller without being recorded as either
+	// failure or success, e.g. ones caused by load on the caller's side rather than by
+	// the dependency. Nil counts every error. Exceeding FailureTimeout always counts.
+	IsFailure func(error) bool
 }
 
 // DefaultConfig returns a default circuit breaker configuration
@@ -52,6 +87,7 @@ func DefaultConfig() Config {
 		ResetTimeout:    30 * time.Second,
 		FailureTimeout:  10 * time.Second,
 		MaxRequests:     3,
+		SuccessRatio:    1,
 	}
 }
 
@@ -61,48 +97,97 @@ type CircuitBreaker struct {
 	state        State
 	failures     int
 	requests     int
+	successes    int
 	lastFailTime time.Time
 	mu           sync.RWMutex
+
+	// abandoned counts calls still running after Execute stopped waiting for them
+	abandoned atomic.Int64
 }
 
 // New creates a new circuit breaker with the given configuration
 func New(config Config) *CircuitBreaker {
+	if config.SuccessRatio <= 0 || config.SuccessRatio > 1 {
+		config.SuccessRatio = 1
+	}
 	return &CircuitBreaker{
 		config: config,
 		state:  StateClosed,
 	}
 }
 
-// Execute runs the given function with circuit breaker protection
+// Execute runs the given function with circuit breaker protection. Only failures and
+// timeouts of fn count against the breaker: if ctx is cancelled or expires first, the
+// caller gave up, so ctx.Err() is returned without recording anything.
+//
+// fn must honor the context it is given. Execute returns as soon as that context is
+// done, but it can't stop fn, so a call that ignores cancellation keeps its goroutine
+// alive until it returns on its own. Such calls are counted in Stats().Abandoned.
 func (cb *CircuitBreaker) Execute(ctx context.Context, fn func(context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if !cb.allowRequest() {
-		return ErrCircuitBreakerOpen
+		return cb.backOff(ErrCircuitBreakerOpen)
 	}
 
 	// Create timeout context
 	timeoutCtx, cancel := context.WithTimeout(ctx, cb.config.FailureTimeout)
 	defer cancel()
 
-	// Execute with timeout
+	// Execute with timeout. done is buffered so fn's goroutine can always finish, even
+	// after Execute has stopped waiting for it.
 	done := make(chan error, 1)
+	// Whichever of fn returning or the timeout happens first sets settled, so an
+	// abandoned call is counted exactly once and uncounted when it finally returns.
+	var settled atomic.Bool
 	go func() {
-		done <- fn(timeoutCtx)
+		err := fn(timeoutCtx)
+		if settled.Swap(true) {
+			cb.abandoned.Add(-1)
+		}
+		done <- err
 	}()
 
 	select {
 	case err := <-done:
 		if err != nil {
+			// fn typically fails with the context's error once the caller gives up
+			if ctx.Err() != nil {
+				return err
+			}
+			if timeoutCtx.Err() == nil && cb.config.IsFailure != nil && !cb.config.IsFailure(err) {
+				return err
+			}
 			cb.recordFailure()
 			return err
 		}
 		cb.recordSuccess()
 		return nil
 	case <-timeoutCtx.Done():
+		if !settled.Swap(true) {
+			cb.abandoned.Add(1)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		cb.recordFailure()
-		return ErrCircuitBreakerTimeout
+		return cb.backOff(ErrCircuitBreakerTimeout)
 	}
 }
 
+// backOff wraps err with the time until the breaker is next worth trying
+func (cb *CircuitBreaker) backOff(err error) error {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+
+	wait := cb.config.ResetTimeout
+	if cb.state == StateOpen {
+		wait -= time.Since(cb.lastFailTime)
+	}
+	return &breakerError{err: err, retryAfter: max(wait, 0)}
+}
+
 // allowRequest checks if a request should be allowed through the circuit breaker
 func (cb *CircuitBreaker) allowRequest() bool {
 	cb.mu.Lock()
@@ -117,6 +202,7 @@ func (cb *CircuitBreaker) allowRequest() bool {
 		if now.Sub(cb.lastFailTime) > cb.config.ResetTimeout {
 			cb.state = StateHalfOpen
 			cb.requests = 0
+			cb.successes = 0
 			slog.Info("Circuit breaker transitioning to half-open state")
 			return true
 		}
@@ -136,12 +222,8 @@ func (cb *CircuitBreaker) recordSuccess() {
 	switch cb.state {
 	case StateHalfOpen:
 		cb.requests++
-		if cb.requests >= cb.config.MaxRequests {
-			cb.state = StateClosed
-			cb.failures = 0
-			cb.requests = 0
-			slog.Info("Circuit breaker transitioning to closed state")
-		}
+		cb.successes++
+		cb.evaluateProbes()
 	case StateClosed:
 		cb.failures = 0
 	}
@@ -164,8 +246,70 @@ func (cb *CircuitBreaker) recordFailure() {
 				"max_failures", cb.config.MaxFailures)
 		}
 	case StateHalfOpen:
+		cb.requests++
+		cb.evaluateProbes()
+	}
+}
+
+// requiredSuccesses is how many of the half-open probes must succeed to close
+func (cb *CircuitBreaker) requiredSuccesses() int {
+	// The epsilon keeps float error from rounding e.g. 0.8*10 up to 9
+	return int(math.Ceil(cb.config.SuccessRatio*float64(cb.config.MaxRequests) - 1e-9))
+}
+
+// evaluateProbes closes the breaker once all half-open probes have completed with
+// enough successes, and reopens it as soon as too many have failed for that to
+// happen; callers must hold mu
+func (cb *CircuitBreaker) evaluateProbes() {
+	required := cb.requiredSuccesses()
+	failed := cb.requests - cb.successes
+
+	switch {
+	case failed > cb.config.MaxRequests-required:
+		cb.state = StateOpen
+		cb.requests = 0
+		cb.successes = 0
+		slog.Warn("Circuit breaker opening from half-open state due to failure",
+			"failed_probes", failed,
+			"required_successes", required)
+	case cb.requests >= cb.config.MaxRequests && cb.successes >= required:
+		cb.state = StateClosed
+		cb.failures = 0
+		cb.requests = 0
+		cb.successes = 0
+		slog.Info("Circuit breaker transitioning to closed state")
+	}
+}
+
+// Trip forces the breaker open, e.g. to fast-fail database calls while draining for
+// maintenance. The open period is timed from now, so the breaker moves to half-open
+// after ResetTimeout exactly as it does after an automatic trip.
+func (cb *CircuitBreaker) Trip() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.lastFailTime = time.Now()
+	cb.requests = 0
+	cb.successes = 0
+	if cb.state != StateOpen {
 		cb.state = StateOpen
-		slog.Warn("Circuit breaker opening from half-open state due to failure")
+		slog.Warn("Circuit breaker opening due to manual trip")
+	}
+}
+
+// Reset forces the breaker closed with its failure count cleared, e.g. to end a
+// manual Trip once maintenance is done instead of waiting out ResetTimeout. Calls
+// still in flight record their outcome against the closed breaker as usual.
+func (cb *CircuitBreaker) Reset() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	cb.requests = 0
+	cb.successes = 0
+	if cb.state != StateClosed {
+		cb.state = StateClosed
+		slog.Info("Circuit breaker closing due to manual reset")
 	}
 }
 
@@ -176,15 +320,40 @@ func (cb *CircuitBreaker) GetState() State {
 	return cb.state
 }
 
-// GetStats returns statistics about the circuit breaker
-func (cb *CircuitBreaker) GetStats() map[string]interface{} {
+// Stats is a snapshot of the circuit breaker's counters
+type Stats struct {
+	State       string    `json:"state"`
+	Failures    int       `json:"failures"`
+	Requests    int       `json:"requests"`
+	LastFailure time.Time `json:"last_failure"`
+	// Abandoned counts timed-out calls whose fn hasn't returned yet
+	Abandoned int64 `json:"abandoned"`
+}
+
+// Stats returns statistics about the circuit breaker
+func (cb *CircuitBreaker) Stats() Stats {
 	cb.mu.RLock()
 	defer cb.mu.RUnlock()
 
+	return Stats{
+		State:       cb.state.String(),
+		Failures:    cb.failures,
+		Requests:    cb.requests,
+		LastFailure: cb.lastFailTime,
+		Abandoned:   cb.abandoned.Load(),
+	}
+}
+
+// GetStats returns statistics about the circuit breaker as a map.
+//
+// Deprecated: use Stats, whose fields are typed.
+func (cb *CircuitBreaker) GetStats() map[string]interface{} {
+	stats := cb.Stats()
 	return map[string]interface{}{
-		"state":         cb.state.String(),
-		"failures":      cb.failures,
-		"requests":      cb.requests,
-		"last_failure":  cb.lastFailTime,
+		"state":        stats.State,
+		"failures":     stats.Failures,
+		"requests":     stats.Requests,
+		"last_failure": stats.LastFailure,
+		"abandoned":    stats.Abandoned,
 	}
-}
\ No newline at end of file
+}
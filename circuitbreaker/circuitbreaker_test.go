@@ -0,0 +1,314 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func succeed(context.Context) error { return nil }
+
+func TestTripFastFailsRequests(t *testing.T) {
+	cb := New(DefaultConfig())
+
+	cb.Trip()
+
+	if cb.GetState() != StateOpen {
+		t.Fatalf("state = %v, expected open", cb.GetState())
+	}
+	called := false
+	err := cb.Execute(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrCircuitBreakerOpen) {
+		t.Errorf("Execute() error = %v, expected ErrCircuitBreakerOpen", err)
+	}
+	if called {
+		t.Error("Execute() ran the operation while tripped")
+	}
+}
+
+func TestResetClosesTrippedBreaker(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxFailures = 2
+	cb := New(cfg)
+
+	cb.Execute(context.Background(), func(context.Context) error { return errors.New("boom") })
+	cb.Trip()
+	cb.Reset()
+
+	if cb.GetState() != StateClosed {
+		t.Fatalf("state = %v, expected closed", cb.GetState())
+	}
+	if failures := cb.Stats().Failures; failures != 0 {
+		t.Errorf("failures = %d, expected 0 after reset", failures)
+	}
+	if err := cb.Execute(context.Background(), succeed); err != nil {
+		t.Errorf("Execute() after reset error = %v, expected the call to run", err)
+	}
+
+	// The earlier failure no longer counts, so one more leaves it closed
+	cb.Execute(context.Background(), func(context.Context) error { return errors.New("boom") })
+	if cb.GetState() != StateClosed {
+		t.Errorf("state = %v, expected closed after a single failure", cb.GetState())
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ResetTimeout = 10 * time.Second
+	cb := New(cfg)
+	cb.Trip()
+
+	err := cb.Execute(context.Background(), succeed)
+	wait, ok := RetryAfter(err)
+	if !ok || wait <= 9*time.Second || wait > cfg.ResetTimeout {
+		t.Errorf("RetryAfter(%v) = %v, %v, expected just under %v", err, wait, ok, cfg.ResetTimeout)
+	}
+	if _, ok := RetryAfter(errors.New("connection refused")); ok {
+		t.Error("RetryAfter() reported a wait for an error not from a breaker")
+	}
+}
+
+func TestTripRecoversThroughHalfOpen(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ResetTimeout = 10 * time.Millisecond
+	cfg.MaxRequests = 1
+	cb := New(cfg)
+
+	cb.Trip()
+	time.Sleep(2 * cfg.ResetTimeout)
+
+	if err := cb.Execute(context.Background(), succeed); err != nil {
+		t.Fatalf("Execute() after reset timeout error = %v, expected the half-open probe to run", err)
+	}
+	if cb.GetState() != StateClosed {
+		t.Errorf("state = %v, expected closed after a successful probe", cb.GetState())
+	}
+}
+
+func TestTripWhileOpenRestartsTimeout(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ResetTimeout = 50 * time.Millisecond
+	cb := New(cfg)
+
+	cb.Trip()
+	time.Sleep(40 * time.Millisecond)
+	cb.Trip()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := cb.Execute(context.Background(), succeed); !errors.Is(err, ErrCircuitBreakerOpen) {
+		t.Errorf("Execute() error = %v, expected the second trip to extend the open period", err)
+	}
+}
+
+func TestHalfOpenSuccessRatio(t *testing.T) {
+	errProbe := errors.New("probe failed")
+
+	tests := []struct {
+		name     string
+		ratio    float64
+		probes   []bool // true for success
+		expected State
+	}{
+		{"default closes after a perfect streak", 0, []bool{true, true, true, true, true, true, true, true, true, true}, StateClosed},
+		{"default reopens on a single failure", 0, []bool{true, true, false}, StateOpen},
+		{"ratio tolerates scattered failures", 0.8, []bool{true, false, true, true, true, false, true, true, true, true}, StateClosed},
+		{"ratio reopens once unreachable", 0.8, []bool{false, true, false, true, false}, StateOpen},
+		{"ratio waits for every probe", 0.8, []bool{true, true, true, true, true, true, true, true}, StateHalfOpen},
+		{"ratio of exactly the threshold", 0.8, []bool{false, false, true, true, true, true, true, true, true, true}, StateClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := New(Config{
+				MaxFailures:    1,
+				ResetTimeout:   time.Millisecond,
+				FailureTimeout: time.Second,
+				MaxRequests:    10,
+				SuccessRatio:   tt.ratio,
+			})
+			cb.Trip()
+			time.Sleep(5 * time.Millisecond)
+
+			for i, success := range tt.probes {
+				err := cb.Execute(context.Background(), func(context.Context) error {
+					if success {
+						return nil
+					}
+					return errProbe
+				})
+				if errors.Is(err, ErrCircuitBreakerOpen) {
+					t.Fatalf("probe %d was rejected, expected the breaker to stay half-open", i)
+				}
+			}
+
+			if got := cb.GetState(); got != tt.expected {
+				t.Errorf("state = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExecuteParentCancellationIsNotAFailure(t *testing.T) {
+	cb := New(DefaultConfig())
+
+	t.Run("cancelled while running", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{})
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		err := cb.Execute(ctx, func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Execute() error = %v, expected context.Canceled", err)
+		}
+	})
+
+	t.Run("cancelled while fn ignores the context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		release := make(chan struct{})
+		defer close(release)
+		go cancel()
+
+		err := cb.Execute(ctx, func(context.Context) error {
+			<-release
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Execute() error = %v, expected context.Canceled", err)
+		}
+	})
+
+	t.Run("already cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		called := false
+		err := cb.Execute(ctx, func(context.Context) error {
+			called = true
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) || called {
+			t.Errorf("Execute() error = %v, called = %v, expected context.Canceled without running fn", err, called)
+		}
+	})
+
+	if failures := cb.Stats().Failures; failures != 0 {
+		t.Errorf("failures = %v, expected cancellations not to count", failures)
+	}
+}
+
+func TestExecuteTimeoutIsAFailure(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.FailureTimeout = 10 * time.Millisecond
+	cb := New(cfg)
+
+	err := cb.Execute(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, ErrCircuitBreakerTimeout) && !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Execute() error = %v, expected a timeout", err)
+	}
+	if failures := cb.Stats().Failures; failures != 1 {
+		t.Errorf("failures = %v, expected 1", failures)
+	}
+}
+
+func TestExecuteIsFailure(t *testing.T) {
+	overloaded := errors.New("overloaded")
+	cfg := DefaultConfig()
+	cfg.MaxFailures = 2
+	cfg.IsFailure = func(err error) bool { return !errors.Is(err, overloaded) }
+	cb := New(cfg)
+
+	for range 2 * cfg.MaxFailures {
+		if err := cb.Execute(context.Background(), func(context.Context) error { return overloaded }); !errors.Is(err, overloaded) {
+			t.Fatalf("Execute() error = %v, expected the caller's error back", err)
+		}
+	}
+	if stats := cb.Stats(); stats.State != StateClosed.String() || stats.Failures != 0 {
+		t.Fatalf("stats = %+v after rejected errors, expected closed with no failures", stats)
+	}
+
+	for range cfg.MaxFailures {
+		cb.Execute(context.Background(), func(context.Context) error { return errors.New("connection refused") })
+	}
+	if cb.GetState() != StateOpen {
+		t.Errorf("state = %v after %d counted failures, expected open", cb.GetState(), cfg.MaxFailures)
+	}
+}
+
+func TestExecuteTimeoutDoesNotLeakGoroutines(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxFailures = 1000
+	cfg.FailureTimeout = time.Millisecond
+	cb := New(cfg)
+
+	// fn ignores its context, so every call outlives Execute until release closes
+	release := make(chan struct{})
+	const calls = 100
+	for range calls {
+		err := cb.Execute(context.Background(), func(context.Context) error {
+			<-release
+			return nil
+		})
+		if !errors.Is(err, ErrCircuitBreakerTimeout) {
+			t.Fatalf("Execute() error = %v, expected ErrCircuitBreakerTimeout", err)
+		}
+	}
+	if abandoned := cb.Stats().Abandoned; abandoned != calls {
+		t.Errorf("abandoned = %v, expected %d", abandoned, calls)
+	}
+
+	close(release)
+	goleak.VerifyNone(t)
+	if abandoned := cb.Stats().Abandoned; abandoned != 0 {
+		t.Errorf("abandoned = %v after the calls returned, expected 0", abandoned)
+	}
+}
+
+func TestStats(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxFailures = 3
+	cb := New(cfg)
+
+	if stats := cb.Stats(); stats != (Stats{State: "closed"}) {
+		t.Errorf("Stats() = %+v, expected a zeroed closed breaker", stats)
+	}
+
+	fail := func(context.Context) error { return errors.New("boom") }
+	before := time.Now()
+	cb.Execute(context.Background(), fail)
+	cb.Execute(context.Background(), fail)
+
+	stats := cb.Stats()
+	if stats.State != "closed" || stats.Failures != 2 || stats.Requests != 0 {
+		t.Errorf("Stats() = %+v, expected closed with 2 failures", stats)
+	}
+	if stats.LastFailure.Before(before) {
+		t.Errorf("LastFailure = %v, expected after %v", stats.LastFailure, before)
+	}
+
+	cb.Execute(context.Background(), fail)
+	if stats := cb.Stats(); stats.State != "open" || stats.Failures != 3 {
+		t.Errorf("Stats() = %+v, expected open with 3 failures", stats)
+	}
+
+	// The deprecated map mirrors the struct
+	legacy := cb.GetStats()
+	if legacy["state"] != "open" || legacy["failures"] != 3 {
+		t.Errorf("GetStats() = %v, expected open with 3 failures", legacy)
+	}
+}
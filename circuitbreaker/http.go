@@ -0,0 +1,113 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ServerError is the failure recorded for a 5xx response. The response itself is still
+// returned to the caller, as http.Client does for any status; ServerError only tells
+// the breaker the call failed.
+type ServerError struct {
+	StatusCode int
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server responded %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// HTTPClient returns a copy of base whose round trips run through cb. Transport errors,
+// 5xx responses and calls exceeding the breaker's FailureTimeout count as failures;
+// 4xx responses are the caller's mistake, not the server's, and count as successes.
+// While the breaker is open requests fail fast with an error wrapping
+// ErrCircuitBreakerOpen. A nil base stands for http.DefaultClient.
+//
+// FailureTimeout bounds the wait for response headers only; reading the body is
+// limited by the request's context and base's Timeout as usual.
+func HTTPClient(cb *CircuitBreaker, base *http.Client) *http.Client {
+	if base == nil {
+		base = http.DefaultClient
+	}
+	client := *base
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	client.Transport = &breakerTransport{cb: cb, base: transport}
+	return &client
+}
+
+// breakerTransport is an http.RoundTripper that guards base with a circuit breaker
+type breakerTransport struct {
+	cb   *CircuitBreaker
+	base http.RoundTripper
+}
+
+// RoundTrip sends req through the breaker. The round trip gets its own context, which
+// Execute's timeout cancels only until the headers arrive, so the body stays readable
+// after Execute returns; it is cancelled for good when the body is closed.
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+
+	// Execute may stop waiting before the round trip finishes, so the response is
+	// handed over under a lock and closed by whichever side is left holding it
+	var (
+		mu        sync.Mutex
+		response  *http.Response
+		abandoned bool
+	)
+	err := t.cb.Execute(req.Context(), func(callCtx context.Context) error {
+		stop := context.AfterFunc(callCtx, cancel)
+		resp, err := t.base.RoundTrip(req.WithContext(ctx))
+		stop()
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if abandoned {
+			resp.Body.Close()
+			return ctx.Err()
+		}
+		response = resp
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return &ServerError{StatusCode: resp.StatusCode}
+		}
+		return nil
+	})
+
+	var serverErr *ServerError
+	if err == nil || errors.As(err, &serverErr) {
+		mu.Lock()
+		resp := response
+		mu.Unlock()
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	}
+
+	mu.Lock()
+	abandoned = true
+	if response != nil {
+		response.Body.Close()
+	}
+	mu.Unlock()
+	cancel()
+	return nil, err
+}
+
+// cancelOnClose releases the round trip's context once the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
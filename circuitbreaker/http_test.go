@@ -0,0 +1,122 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientOpensOnServerErrors(t *testing.T) {
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxFailures = 3
+	cb := New(cfg)
+	client := HTTPClient(cb, srv.Client())
+
+	for i := range cfg.MaxFailures {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("request %d: Get() error = %v, expected the 503 response", i+1, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable || len(body) == 0 {
+			t.Errorf("request %d: status = %d with %d body bytes, expected 503 with a body", i+1, resp.StatusCode, len(body))
+		}
+	}
+
+	if cb.GetState() != StateOpen {
+		t.Fatalf("state = %v after %d server errors, expected open", cb.GetState(), cfg.MaxFailures)
+	}
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrCircuitBreakerOpen) {
+		t.Errorf("Get() error = %v, expected ErrCircuitBreakerOpen", err)
+	}
+	if got := hits.Load(); got != int64(cfg.MaxFailures) {
+		t.Errorf("server saw %d requests, expected %d: an open breaker must not reach it", got, cfg.MaxFailures)
+	}
+}
+
+func TestHTTPClientClientErrorsAreNotFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxFailures = 2
+	cb := New(cfg)
+	client := HTTPClient(cb, srv.Client())
+
+	for range 2 * cfg.MaxFailures {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("status = %d, expected 404", resp.StatusCode)
+		}
+	}
+	if cb.GetState() != StateClosed {
+		t.Errorf("state = %v after 404s, expected closed", cb.GetState())
+	}
+}
+
+func TestHTTPClientTimeoutIsAFailure(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	cfg := DefaultConfig()
+	cfg.MaxFailures = 1
+	cfg.FailureTimeout = 20 * time.Millisecond
+	cb := New(cfg)
+	client := HTTPClient(cb, srv.Client())
+
+	if _, err := client.Get(srv.URL); !errors.Is(err, ErrCircuitBreakerTimeout) {
+		t.Errorf("Get() error = %v, expected ErrCircuitBreakerTimeout", err)
+	}
+	if cb.GetState() != StateOpen {
+		t.Errorf("state = %v after a timeout, expected open", cb.GetState())
+	}
+}
+
+func TestHTTPClientSlowBodyOutlivesFailureTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "done")
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.FailureTimeout = 20 * time.Millisecond
+	client := HTTPClient(New(cfg), srv.Client())
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != "done" {
+		t.Errorf("body = %q, %v; expected the whole body after the headers arrived in time", body, err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"htmx-learn/config"
+	"htmx-learn/logging"
+)
+
+// newLogOutput returns where logs are written: standard output or error, or the file
+// named by LOG_OUTPUT, rotated once it reaches LOG_MAX_SIZE_MB. Rotated files are
+// kept according to LOG_MAX_BACKUPS and LOG_MAX_AGE_DAYS, zero meaning no limit.
+func newLogOutput(cfg *config.Config) io.Writer {
+	switch cfg.LogOutput {
+	case "", "stdout":
+		return os.Stdout
+	case "stderr":
+		return os.Stderr
+	default:
+		return &lumberjack.Logger{
+			Filename:   cfg.LogOutput,
+			MaxSize:    cfg.LogMaxSizeMB,
+			MaxAge:     cfg.LogMaxAgeDays,
+			MaxBackups: cfg.LogMaxBackups,
+			LocalTime:  true,
+		}
+	}
+}
+
+// newLogger builds the application logger writing to w in the configured format,
+// along with the switch that changes its level and format at runtime. Records logged
+// with a request's context carry its request ID, client IP and route.
+func newLogger(cfg *config.Config, w io.Writer) (*slog.Logger, *logging.Switch) {
+	logs := logging.NewSwitch(w, cfg.LogFormat, parseLogLevel(cfg.LogLevel))
+	return slog.New(logging.NewHandler(logs.Handler())), logs
+}
+
+// cycleLogLevelOnSignal moves to the next log level whenever sig arrives, from debug
+// through error and back, so debug logging can be turned on during an incident
+// without a restart or an admin token
+func cycleLogLevelOnSignal(logs *logging.Switch, sig os.Signal) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig)
+	go func() {
+		for range signals {
+			// Logged at the new level itself, which is always written
+			level := logs.CycleLevel()
+			slog.Log(context.Background(), level, "Log level changed", "level", level)
+		}
+	}()
+}
+
+// rotateLogOnSignal starts a new log file whenever sig arrives, so external tools such
+// as logrotate can ask for rotation too. It does nothing unless logs go to a file,
+// leaving sig's default behavior alone.
+func rotateLogOnSignal(w io.Writer, sig os.Signal) {
+	file, ok := w.(*lumberjack.Logger)
+	if !ok {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig)
+	go func() {
+		for range signals {
+			if err := file.Rotate(); err != nil {
+				slog.Error("Failed to rotate log file", "path", file.Filename, "error", err)
+			}
+		}
+	}()
+}
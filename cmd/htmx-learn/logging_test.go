@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"htmx-learn/config"
+)
+
+func TestLogOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	cfg := &config.Config{LogOutput: path, LogFormat: "json", LogLevel: "info", LogMaxSizeMB: 1}
+
+	output := newLogOutput(cfg)
+	logger, _ := newLogger(cfg, output)
+	logger.Info("written to file", "answer", 42)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading log file: %v", err)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("decoding log entry %q: %v", data, err)
+	}
+	if entry["msg"] != "written to file" || entry["answer"] != float64(42) {
+		t.Errorf("log entry = %v, expected the message and its attribute", entry)
+	}
+}
+
+func TestLogOutputStandardStreams(t *testing.T) {
+	for output, expected := range map[string]*os.File{"": os.Stdout, "stdout": os.Stdout, "stderr": os.Stderr} {
+		if w := newLogOutput(&config.Config{LogOutput: output}); w != expected {
+			t.Errorf("newLogOutput(%q) = %v, expected %s", output, w, expected.Name())
+		}
+	}
+}
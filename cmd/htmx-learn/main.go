@@ -2,17 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
-	"time"
+	// DISPLAY_TIMEZONE and the tz parameter of /api/time must resolve zone names even
+	// in images without a system time zone database
+	_ "time/tzdata"
 
 	"htmx-learn/config"
 	"htmx-learn/db"
 	"htmx-learn/handlers"
+	"htmx-learn/metrics"
 	"htmx-learn/middleware"
+	"htmx-learn/static"
+	"htmx-learn/validation"
+	"htmx-learn/version"
 )
 
 func main() {
@@ -24,114 +33,182 @@ func main() {
 	}
 	
 	// Initialize structured logging
-	var logger *slog.Logger
-	if cfg.LogFormat == "json" {
-		logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-			Level: parseLogLevel(cfg.LogLevel),
-		}))
-	} else {
-		logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-			Level: parseLogLevel(cfg.LogLevel),
-		}))
-	}
+	logOutput := newLogOutput(cfg)
+	logger, logs := newLogger(cfg, logOutput)
 	slog.SetDefault(logger)
+	// SIGHUP starts a new log file, the convention logrotate's postrotate scripts expect
+	rotateLogOnSignal(logOutput, syscall.SIGHUP)
+	// SIGUSR2 cycles the log level; SIGUSR1 is taken by maintenance mode
+	cycleLogLevelOnSignal(logs, syscall.SIGUSR2)
 	
 	slog.Info("Starting HTMX learning application",
-		"version", "1.0.0",
+		"version", version.Version,
+		"commit", version.Get().Commit,
 		"environment", cfg.Environment,
 		"port", cfg.Port)
 
-	// Initialize database with pool configuration
-	database, err := db.New(cfg.DatabaseURL, cfg.MaxConnections, cfg.MinConnections)
-	if err != nil {
-		slog.Error("Failed to initialize database", "error", err)
-		os.Exit(1)
+	// Configure optional validation rules
+	if cfg.ProfanityWordsFile != "" {
+		words, err := os.ReadFile(cfg.ProfanityWordsFile)
+		if err != nil {
+			slog.Error("Failed to read profanity word list", "path", cfg.ProfanityWordsFile, "error", err)
+			os.Exit(1)
+		}
+		validation.SetProfanityWords(validation.ParseWordList(string(words)))
 	}
-	defer database.Close()
+	validation.EnableProfanityFilter(cfg.FilterProfanity)
 
-	// Initialize database schema
-	ctx := context.Background()
-	if err := database.InitSchema(ctx); err != nil {
-		slog.Error("Failed to initialize database schema", "error", err)
-		os.Exit(1)
+	// The SPA fallback is useless without a page to fall back to
+	if cfg.StaticSPAFallback {
+		if _, err := fs.Stat(static.FS(cfg.StaticFromDisk, cfg.StaticDir), static.IndexFile); err != nil {
+			slog.Error("STATIC_SPA_FALLBACK is enabled but the static assets have no index page",
+				"file", static.IndexFile, "error", err)
+			os.Exit(1)
+		}
 	}
 
-	// Initialize handlers with database and configuration
-	h := handlers.New(database, cfg)
-
-	mux := http.NewServeMux()
-
-	// Static file serving
-	fileServer := http.FileServer(http.Dir("./static/"))
-	mux.Handle("GET /static/", http.StripPrefix("/static/", fileServer))
-
-	// Page routes
-	mux.HandleFunc("GET /", h.Home)
-	mux.HandleFunc("GET /counter", h.CounterPage)
-	mux.HandleFunc("GET /dynamic", h.DynamicPage)
-
-	// API routes for counter
-	mux.HandleFunc("POST /counter/increment", h.CounterIncrement)
-	mux.HandleFunc("POST /counter/decrement", h.CounterDecrement)
-	mux.HandleFunc("POST /counter/reset", h.CounterReset)
-
-	// API routes for dynamic content
-	mux.HandleFunc("GET /api/time", h.GetTime)
-	mux.HandleFunc("GET /api/users", h.GetUsers)
-	mux.HandleFunc("GET /api/users/paginated", h.GetUsersPaginated)
-	mux.HandleFunc("POST /api/users", h.CreateUser)
-	mux.HandleFunc("DELETE /api/users/{id}", h.DeleteUser)
-	mux.HandleFunc("POST /api/search", h.SearchUsers)
-	mux.HandleFunc("POST /api/search/paginated", h.SearchUsersPaginated)
+	// Initialize database with pool configuration. With DB_CONNECT_RETRY the server
+	// starts even if the database is down and reports not-ready until it connects.
+	retryCtx, stopRetry := context.WithCancel(context.Background())
+	defer stopRetry()
+
+	dbOptions := db.Options{
+		URL:              cfg.DatabaseURL,
+		ReplicaURL:       cfg.ReplicaURL,
+		MaxConns:         cfg.MaxConnections,
+		MinConns:         cfg.MinConnections,
+		QueryTimeout:     cfg.QueryTimeout,
+		StatementTimeout: cfg.StatementTimeout,
+		ApplicationName:  cfg.DBApplicationName,
+		SearchPath:       cfg.DBSearchPath,
+		CountCacheTTL:    cfg.CountCacheTTL,
+		CountMode:        cfg.CountMode,
+	}
 	
-	// Health check routes
-	mux.HandleFunc("GET /health", h.HealthCheck)
-	mux.HandleFunc("GET /health/ready", h.ReadinessCheck)
-	mux.HandleFunc("GET /health/live", h.LivenessCheck)
+	var database *db.DB
+	if cfg.DBConnectRetry {
+		database, err = db.Open(dbOptions)
+		if err != nil {
+			slog.Error("Failed to initialize database", "error", err)
+			os.Exit(1)
+		}
+		go func() {
+			err := database.ConnectWithRetry(retryCtx, cfg.SchemaPath, db.DefaultBackoff)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				slog.Error("Failed to initialize database schema", "error", err)
+				os.Exit(1)
+			}
+		}()
+	} else {
+		database, err = db.New(dbOptions)
+		if err != nil {
+			slog.Error("Failed to initialize database", "error", err)
+			os.Exit(1)
+		}
+
+		// Initialize database schema
+		if err := database.InitSchema(context.Background(), cfg.SchemaPath); err != nil {
+			slog.Error("Failed to initialize database schema", "error", err)
+			os.Exit(1)
+		}
+	}
+	defer database.Close()
+
+	// Initialize handlers with database and configuration
+	h := handlers.New(database, cfg, handlers.RenderOptionsFor(cfg))
+	metrics.Registry.MustRegister(h.HealthCollector())
+
+	// Count in-flight requests so shutdown can report what it's waiting on
+	requests := new(middleware.RequestTracker)
+
+	mux := newRouter(h, cfg, requests, logs)
 
 	// Apply middleware with configuration
-	handler := middleware.Recovery(
-		middleware.Logger(
-			middleware.SecurityHeaders(
-				middleware.ConfigurableCORS(cfg.AllowedOrigins,
-					middleware.RateLimit(cfg,
-						mux),
+	handler := requests.Track(middleware.RequestID(middleware.Recovery(
+		middleware.Logger(cfg,
+			middleware.SecurityHeaders(cfg.SecurityHeadersSlimPaths,
+				middleware.ConfigurableCORS(cfg,
+					middleware.Maintenance(h.InMaintenance, cfg.MaintenanceExemptPaths, http.HandlerFunc(h.MaintenancePage),
+						middleware.RateLimit(cfg,
+							middleware.LoadShed(database.PoolUsage, cfg.LoadShedPoolPercent, cfg.RateLimitExemptPaths,
+								middleware.TrailingSlash(cfg.TrailingSlash, cfg.TrailingSlashExemptPaths,
+									middleware.Coalesce(cfg, mux)))),
+					),
 				),
 			),
 		),
-	)
-
-	server := &http.Server{
-		Addr:         cfg.GetServerAddress(),
-		Handler:      handler,
-		ReadTimeout:  cfg.ReadTimeout,
-		WriteTimeout: cfg.WriteTimeout,
-		IdleTimeout:  cfg.IdleTimeout,
-	}
+	)))
 
-	// Start server in a goroutine
+	server := newServer(cfg, handler)
+	// SSE streams never finish on their own, so end them as soon as shutdown starts
+	// rather than letting them hold the whole grace window
+	server.RegisterOnShutdown(h.Drain)
+
+	// Start server in a goroutine. It serves HTTPS itself only when given a
+	// certificate; otherwise TLS, if any, is terminated by a proxy in front of it.
 	go func() {
-		slog.Info("Server starting", "address", server.Addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Info("Server starting", "address", server.Addr, "tls", cfg.TLSEnabled(), "h2c", cfg.H2C)
+		var err error
+		if cfg.TLSEnabled() {
+			err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			slog.Error("Server failed to start", "error", err)
 			os.Exit(1)
 		}
 	}()
 
+	// A standalone HTTPS server also answers plain HTTP, sending visitors to HTTPS
+	var redirectServer *http.Server
+	if cfg.AutoRedirectHTTP {
+		redirectServer = &http.Server{
+			Addr:         ":" + strings.TrimPrefix(cfg.HTTPRedirectPort, ":"),
+			Handler:      httpsRedirect(cfg.Port),
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			IdleTimeout:  cfg.IdleTimeout,
+		}
+		go func() {
+			slog.Info("HTTP redirect server starting", "address", redirectServer.Addr)
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("HTTP redirect server failed to start", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// SIGUSR1 toggles maintenance mode, e.g. around a deploy or migration
+	toggle := make(chan os.Signal, 1)
+	signal.Notify(toggle, syscall.SIGUSR1)
+	go func() {
+		for range toggle {
+			h.SetMaintenance(!h.InMaintenance())
+		}
+	}()
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	slog.Info("Shutting down server...")
+	slog.Info("Shutting down server...",
+		"active_requests", requests.Active(),
+		"grace_window", cfg.ShutdownTimeout)
+	stopRetry()
 
 	// Create a deadline to wait for
-	shutdownTimeout := 30 * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
 	// Attempt graceful shutdown
-	if err := server.Shutdown(ctx); err != nil {
-		slog.Error("Server forced to shutdown", "error", err)
+	if redirectServer != nil {
+		if err := redirectServer.Shutdown(ctx); err != nil {
+			slog.Error("HTTP redirect server forced to shutdown", "error", err)
+		}
+	}
+	if err := drain(ctx, server, requests); err != nil {
+		slog.Error("Server forced to shutdown", "error", err, "active_requests", requests.Active())
 		os.Exit(1)
 	}
 
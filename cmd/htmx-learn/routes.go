@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"htmx-learn/config"
+	"htmx-learn/handlers"
+	"htmx-learn/logging"
+	"htmx-learn/metrics"
+	"htmx-learn/middleware"
+	"htmx-learn/router"
+	"htmx-learn/static"
+)
+
+// newRouter registers every application route on a router that records them. logs
+// may be nil, leaving out the endpoint that changes logging at runtime.
+func newRouter(h *handlers.Handlers, cfg *config.Config, requests *middleware.RequestTracker, logs *logging.Switch) *router.Router {
+	mux := router.New()
+
+	// Static file serving
+	assets := static.FS(cfg.StaticFromDisk, cfg.StaticDir)
+	fileServer := static.Handler(assets, cfg.StaticMaxAge, !cfg.StaticFromDisk)
+	mux.Handle("GET /static/", http.StripPrefix("/static/", fileServer))
+
+	// Well-known files browsers and crawlers ask for
+	mux.HandleFunc("GET /favicon.ico", h.Favicon)
+	mux.HandleFunc("GET /robots.txt", h.Robots)
+
+	// Page routes
+	mux.HandleFunc("GET /{$}", h.Home)
+	mux.HandleFunc("GET /counter", h.CounterPage)
+	mux.HandleFunc("GET /dynamic", h.DynamicPage)
+
+	// API routes for counter
+	mux.HandleFunc("POST /counter/increment", h.CounterIncrement)
+	mux.HandleFunc("POST /counter/decrement", h.CounterDecrement)
+	mux.HandleFunc("POST /counter/reset", h.CounterReset)
+	mux.HandleFunc("GET /counter/history", h.CounterHistory)
+	mux.HandleFunc("GET /counter/events", h.CounterEvents)
+
+	// API routes for dynamic content
+	mux.HandleFunc("GET /api/time", h.GetTime)
+	mux.HandleFunc("GET /api/users", h.GetUsers)
+	mux.HandleFunc("GET /api/users/paginated", h.GetUsersPaginated)
+	mux.HandleFunc("GET /api/users/events", h.UserEvents)
+	mux.HandleFunc("POST /api/users", h.CreateUser)
+	mux.HandleFunc("POST /api/users/import", h.ImportUsers)
+	mux.HandleFunc("GET /api/users/export", h.ExportUsers)
+	mux.HandleFunc("DELETE /api/users/{id}", h.DeleteUser)
+	mux.HandleFunc("POST /api/search", h.SearchUsers)
+	mux.HandleFunc("POST /api/search/paginated", h.SearchUsersPaginated)
+
+	// Health check and version routes
+	mux.HandleFunc("GET /health", h.HealthCheck)
+	mux.HandleFunc("GET /health/ready", h.ReadinessCheck)
+	mux.HandleFunc("GET /health/live", h.LivenessCheck)
+	mux.HandleFunc("GET /version", h.Version)
+
+	// Prometheus metrics
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	// Debug routes
+	if cfg.Debug {
+		mux.HandleFunc("GET /debug/routes", h.DebugRoutes(mux))
+	}
+	// Pool and request statistics reveal capacity details, so they're never exposed in production
+	if !cfg.IsProduction() {
+		mux.HandleFunc("GET /debug/pool", h.DebugPool)
+		mux.HandleFunc("GET /debug/requests", h.DebugRequests(requests))
+	}
+
+	// Admin routes exist only when a token is configured to protect them
+	if cfg.AdminToken != "" {
+		mux.Handle("POST /admin/maintenance", middleware.RequireToken(cfg.AdminToken, http.HandlerFunc(h.AdminMaintenance)))
+		mux.Handle("POST /admin/circuit-breaker/trip", middleware.RequireToken(cfg.AdminToken, http.HandlerFunc(h.AdminTripCircuitBreaker)))
+		mux.Handle("POST /admin/circuit-breaker/reset", middleware.RequireToken(cfg.AdminToken, http.HandlerFunc(h.AdminResetCircuitBreaker)))
+		if logs != nil {
+			mux.Handle("POST /admin/log-level", middleware.RequireToken(cfg.AdminToken, h.AdminLogLevel(logs)))
+		}
+
+		// Demo data has no place in a production database
+		if !cfg.IsProduction() {
+			mux.Handle("POST /admin/seed", middleware.RequireToken(cfg.AdminToken, http.HandlerFunc(h.AdminSeed)))
+		}
+	}
+
+	// Unknown paths get the not-found page, or a JSON error for API clients, unless the
+	// SPA fallback hands them to index.html. Registered routes, including /static/, are
+	// more specific and always win over both, so a missing static file still gets the
+	// file server's own 404.
+	mux.NotFound = http.HandlerFunc(h.NotFound)
+	// Known paths requested with the wrong method get a 405 in the same style, with
+	// an Allow header listing the methods their routes accept
+	mux.MethodNotAllowed = http.HandlerFunc(h.MethodNotAllowed)
+	if cfg.StaticSPAFallback {
+		// Registered for every method: as "GET /" it would make ServeMux answer any
+		// other method on an unknown path with a 405 instead of the not-found response
+		mux.Handle("/", spaFallback(static.IndexFallback(assets), mux.NotFound))
+	}
+
+	return mux
+}
+
+// spaFallback serves index for GET and HEAD requests to unknown paths outside the API.
+// API paths and every other method keep going to notFound so clients can tell a bad
+// endpoint from a page.
+func spaFallback(index, notFound http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead ||
+			r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/") {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		index.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"htmx-learn/config"
+	"htmx-learn/handlers"
+	"htmx-learn/logging"
+	"htmx-learn/middleware"
+	"htmx-learn/router"
+	"htmx-learn/static"
+)
+
+func TestDebugRoutes(t *testing.T) {
+	cfg := &config.Config{Debug: true}
+	mux := newRouter(handlers.New(nil, cfg, handlers.RenderOptions{}), cfg, new(middleware.RequestTracker), nil)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/routes", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, expected 200", rec.Code)
+	}
+
+	var body struct {
+		Routes []router.Route `json:"routes"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	expected := []router.Route{
+		{Method: "GET", Path: "/api/users"},
+		{Method: "POST", Path: "/api/users"},
+		{Method: "POST", Path: "/counter/increment"},
+		{Method: "GET", Path: "/debug/routes"},
+	}
+	for _, want := range expected {
+		found := false
+		for _, route := range body.Routes {
+			if route.Method == want.Method && route.Path == want.Path {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("route %s %s not listed", want.Method, want.Path)
+		}
+	}
+}
+
+func TestDebugRoutesDisabled(t *testing.T) {
+	cfg := &config.Config{}
+	mux := newRouter(handlers.New(nil, cfg, handlers.RenderOptions{}), cfg, new(middleware.RequestTracker), nil)
+
+	for _, route := range mux.Routes() {
+		if route.Path == "/debug/routes" {
+			t.Fatal("/debug/routes must not be registered when DEBUG is off")
+		}
+	}
+}
+
+func TestDebugPoolGatedByEnvironment(t *testing.T) {
+	tests := []struct {
+		environment string
+		registered  bool
+	}{
+		{"development", true},
+		{"staging", true},
+		{"production", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.environment, func(t *testing.T) {
+			cfg := &config.Config{Environment: tt.environment}
+			mux := newRouter(handlers.New(nil, cfg, handlers.RenderOptions{}), cfg, new(middleware.RequestTracker), nil)
+
+			found := false
+			for _, route := range mux.Routes() {
+				if route.Path == "/debug/pool" {
+					found = true
+				}
+			}
+			if found != tt.registered {
+				t.Errorf("/debug/pool registered = %v, expected %v", found, tt.registered)
+			}
+		})
+	}
+}
+
+func TestSPAFallback(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, static.IndexFile), []byte("spa shell"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		fallback       bool
+		method         string
+		path           string
+		expectedStatus int
+		expectedIndex  bool
+	}{
+		{"client route", true, http.MethodGet, "/settings/profile", http.StatusOK, true},
+		{"unknown api path", true, http.MethodGet, "/api/nope", http.StatusNotFound, false},
+		{"post to unknown api path", true, http.MethodPost, "/api/nope", http.StatusNotFound, false},
+		{"post to unknown page", true, http.MethodPost, "/settings/profile", http.StatusNotFound, false},
+		{"missing static asset", true, http.MethodGet, "/static/missing.css", http.StatusNotFound, false},
+		{"registered route wins", true, http.MethodGet, "/health/live", http.StatusOK, false},
+		{"fallback disabled", false, http.MethodGet, "/settings/profile", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{StaticFromDisk: true, StaticDir: dir, StaticSPAFallback: tt.fallback}
+			mux := newRouter(handlers.New(nil, cfg, handlers.RenderOptions{}), cfg, new(middleware.RequestTracker), nil)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Accept", "application/json")
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expectedStatus)
+			}
+			if isIndex := rec.Body.String() == "spa shell"; isIndex != tt.expectedIndex {
+				t.Errorf("served index = %v, expected %v", isIndex, tt.expectedIndex)
+			}
+			if strings.HasPrefix(tt.path, "/api/") && !strings.Contains(rec.Body.String(), "not_found") {
+				t.Errorf("body = %q, expected the JSON not_found error", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestUnknownRouteNotFound(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{StaticFromDisk: true, StaticDir: dir}
+	mux := newRouter(handlers.New(nil, cfg, handlers.RenderOptions{}), cfg, new(middleware.RequestTracker), nil)
+
+	tests := []struct {
+		name                string
+		path                string
+		accept              string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"browser", "/no/such/page", "text/html,application/xhtml+xml", "text/html", "Page not found"},
+		{"json client", "/no/such/page", "application/json", "application/json", `{"code":"not_found","errors":["Not found"]}`},
+		{"api path", "/api/nope", "", "application/json", `{"code":"not_found","errors":["Not found"]}`},
+		{"missing static file", "/static/missing.css", "text/html", "text/plain", "404 page not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("status = %d, expected 404", rec.Code)
+			}
+			if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, tt.expectedContentType) {
+				t.Errorf("Content-Type = %q, expected %s", contentType, tt.expectedContentType)
+			}
+			if !strings.Contains(rec.Body.String(), tt.expectedBody) {
+				t.Errorf("body %q does not contain %q", rec.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	cfg := &config.Config{}
+	mux := newRouter(handlers.New(nil, cfg, handlers.RenderOptions{}), cfg, new(middleware.RequestTracker), nil)
+
+	tests := []struct {
+		name                string
+		method              string
+		path                string
+		accept              string
+		expectedAllow       string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"counter action from browser", http.MethodDelete, "/counter/increment", "text/html", "POST", "text/html", "Method not allowed"},
+		{"counter action as json", http.MethodDelete, "/counter/increment", "application/json", "POST", "application/json", `{"code":"method_not_allowed","errors":["Method not allowed"],"allowed":["POST"]}`},
+		{"api path", http.MethodPut, "/api/users", "", "GET, HEAD, POST", "application/json", `"allowed":["GET","HEAD","POST"]`},
+		{"health probe", http.MethodPost, "/health", "", "GET, HEAD", "text/html", "Allowed methods: GET, HEAD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("status = %d, expected 405", rec.Code)
+			}
+			if allow := rec.Header().Get("Allow"); allow != tt.expectedAllow {
+				t.Errorf("Allow = %q, expected %q", allow, tt.expectedAllow)
+			}
+			if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, tt.expectedContentType) {
+				t.Errorf("Content-Type = %q, expected %s", contentType, tt.expectedContentType)
+			}
+			if !strings.Contains(rec.Body.String(), tt.expectedBody) {
+				t.Errorf("body %q does not contain %q", rec.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesRequireToken(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef"
+
+	unconfigured := &config.Config{}
+	for _, route := range newRouter(handlers.New(nil, unconfigured, handlers.RenderOptions{}), unconfigured, new(middleware.RequestTracker), nil).Routes() {
+		if route.Path == "/admin/maintenance" {
+			t.Fatal("/admin/maintenance must not be registered without ADMIN_TOKEN")
+		}
+	}
+
+	cfg := &config.Config{AdminToken: token}
+	mux := newRouter(handlers.New(nil, cfg, handlers.RenderOptions{}), cfg, new(middleware.RequestTracker), nil)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/maintenance?enabled=true", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status %d, expected 401", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/maintenance?enabled=true", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("with token: status %d, expected 200", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/circuit-breaker/reset", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("circuit breaker reset without token: status %d, expected 401", rec.Code)
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef"
+	cfg := &config.Config{AdminToken: token}
+	logs := logging.NewSwitch(io.Discard, logging.FormatJSON, slog.LevelInfo)
+	mux := newRouter(handlers.New(nil, cfg, handlers.RenderOptions{}), cfg, new(middleware.RequestTracker), logs)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedLevel  slog.Level
+		expectedFormat string
+	}{
+		{"bad level changes nothing", "level=verbose&format=text", http.StatusBadRequest, slog.LevelInfo, logging.FormatJSON},
+		{"bad format changes nothing", "level=debug&format=xml", http.StatusBadRequest, slog.LevelInfo, logging.FormatJSON},
+		{"level only", "level=debug", http.StatusOK, slog.LevelDebug, logging.FormatJSON},
+		{"format only", "format=text", http.StatusOK, slog.LevelDebug, logging.FormatText},
+		{"both", "level=warn&format=json", http.StatusOK, slog.LevelWarn, logging.FormatJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/log-level?"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expectedStatus)
+			}
+			if logs.Level() != tt.expectedLevel || logs.Format() != tt.expectedFormat {
+				t.Errorf("logging = %v %s, expected %v %s", logs.Level(), logs.Format(), tt.expectedLevel, tt.expectedFormat)
+			}
+		})
+	}
+}
+
+func TestSeedRouteIsDevelopmentOnly(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef"
+
+	for _, tt := range []struct {
+		environment string
+		registered  bool
+	}{
+		{"development", true},
+		{"production", false},
+	} {
+		t.Run(tt.environment, func(t *testing.T) {
+			cfg := &config.Config{AdminToken: token, Environment: tt.environment}
+			registered := false
+			for _, route := range newRouter(handlers.New(nil, cfg, handlers.RenderOptions{}), cfg, new(middleware.RequestTracker), nil).Routes() {
+				if route.Path == "/admin/seed" {
+					registered = true
+				}
+			}
+			if registered != tt.registered {
+				t.Errorf("/admin/seed registered = %v, expected %v", registered, tt.registered)
+			}
+		})
+	}
+}
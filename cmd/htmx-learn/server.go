@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"htmx-learn/config"
+	"htmx-learn/middleware"
+)
+
+// drainProgressInterval is how often shutdown reports the requests it's still waiting on
+const drainProgressInterval = 5 * time.Second
+
+// newServer builds the application's HTTP server.
+//
+// With H2C enabled the listener also accepts HTTP/2 without TLS, for proxies that
+// multiplex many small HTMX requests over one cleartext connection. The server speaks
+// it natively rather than through a handler wrapper, so the read, write and idle
+// timeouts and graceful shutdown cover HTTP/2 connections exactly as they do HTTP/1.1
+// ones. Since each HTTP/2 stream is a request, ReadTimeout and WriteTimeout bound
+// every stream separately, while IdleTimeout closes a connection once no stream has
+// been active for that long, which is HTTP/2's equivalent of keep-alive.
+func newServer(cfg *config.Config, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:           cfg.GetServerAddress(),
+		Handler:        handler,
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
+		IdleTimeout:    cfg.IdleTimeout,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+	}
+
+	if cfg.TLSEnabled() {
+		server.TLSConfig = newTLSConfig(cfg)
+	}
+
+	if cfg.H2C {
+		// Setting Protocols replaces the defaults, so HTTP/1.1 and HTTP/2 over TLS
+		// have to be listed again
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetHTTP2(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return server
+}
+
+// drain gracefully shuts server down, logging how many requests are still in flight
+// until they finish or ctx expires. It returns Shutdown's error, which is ctx's error
+// when the grace window ran out first.
+func drain(ctx context.Context, server *http.Server, requests *middleware.RequestTracker) error {
+	done := make(chan error, 1)
+	go func() { done <- server.Shutdown(ctx) }()
+
+	progress := time.NewTicker(drainProgressInterval)
+	defer progress.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-progress.C:
+			slog.Info("Waiting for in-flight requests", "active_requests", requests.Active())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"htmx-learn/config"
+)
+
+func TestNewServerH2C(t *testing.T) {
+	tests := []struct {
+		name         string
+		h2c          bool
+		clientHTTP1  bool
+		expectedHTTP int // 0 when the request should fail
+	}{
+		{"h2c client", true, false, 2},
+		{"http/1.1 client still served", true, true, 1},
+		{"h2c client rejected when disabled", false, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Port: "0", MaxHeaderBytes: 1 << 20, H2C: tt.h2c}
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+			srv := httptest.NewUnstartedServer(handler)
+			srv.Config = newServer(cfg, handler)
+			srv.Start()
+			defer srv.Close()
+
+			// With HTTP/1.1 off, the client speaks HTTP/2 with prior knowledge
+			protocols := new(http.Protocols)
+			protocols.SetHTTP1(tt.clientHTTP1)
+			protocols.SetUnencryptedHTTP2(!tt.clientHTTP1)
+			client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+			resp, err := client.Get(srv.URL)
+			if tt.expectedHTTP == 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Errorf("request succeeded over %s, expected cleartext HTTP/2 to be refused", resp.Proto)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.ProtoMajor != tt.expectedHTTP {
+				t.Errorf("served over %s, expected HTTP/%d", resp.Proto, tt.expectedHTTP)
+			}
+		})
+	}
+}
+
+func TestNewServerMaxHeaderBytes(t *testing.T) {
+	server := newServer(&config.Config{Port: "8080", MaxHeaderBytes: 8 << 10}, http.NotFoundHandler())
+	if server.MaxHeaderBytes != 8<<10 {
+		t.Errorf("MaxHeaderBytes = %d, expected %d", server.MaxHeaderBytes, 8<<10)
+	}
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		minVersion    string
+		modernCiphers bool
+		clientMax     uint16
+		clientSuites  []uint16
+		expectError   bool
+	}{
+		{"tls 1.2 by default", "", false, tls.VersionTLS12, nil, false},
+		{"tls 1.2 client refused by a 1.3 minimum", "1.3", false, tls.VersionTLS12, nil, true},
+		{"tls 1.3 client with a 1.3 minimum", "1.3", false, tls.VersionTLS13, nil, false},
+		{"legacy cipher allowed by default", "1.2", false, tls.VersionTLS12, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA}, false},
+		{"legacy cipher refused with modern ciphers", "1.2", true, tls.VersionTLS12, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA}, true},
+		{"modern cipher with modern ciphers", "1.2", true, tls.VersionTLS12, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Port:             "0",
+				MaxHeaderBytes:   1 << 20,
+				TLSCertFile:      "cert.pem",
+				TLSKeyFile:       "key.pem",
+				TLSMinVersion:    tt.minVersion,
+				TLSModernCiphers: tt.modernCiphers,
+			}
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+			// httptest supplies its own certificate on top of the server's TLS settings
+			srv := httptest.NewUnstartedServer(handler)
+			srv.Config = newServer(cfg, handler)
+			srv.TLS = srv.Config.TLSConfig
+			// Refused handshakes are expected, not worth logging
+			srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+			srv.StartTLS()
+			defer srv.Close()
+
+			transport := srv.Client().Transport.(*http.Transport)
+			transport.TLSClientConfig.MaxVersion = tt.clientMax
+			transport.TLSClientConfig.CipherSuites = tt.clientSuites
+
+			resp, err := srv.Client().Get(srv.URL)
+			if tt.expectError {
+				if err == nil {
+					resp.Body.Close()
+					t.Errorf("handshake succeeded with %s, expected it to be refused", tls.VersionName(resp.TLS.Version))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestNewServerWithoutTLS(t *testing.T) {
+	if server := newServer(&config.Config{Port: "8080", TLSMinVersion: "1.3"}, http.NotFoundHandler()); server.TLSConfig != nil {
+		t.Errorf("TLSConfig = %+v, expected none when TLS is disabled", server.TLSConfig)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"htmx-learn/config"
+)
+
+// modernCipherSuites are the TLS 1.2 suites TLS_MODERN_CIPHERS allows: ECDHE key
+// exchange for forward secrecy with AEAD encryption only. TLS 1.3 suites aren't
+// configurable and are all modern.
+var modernCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// newTLSConfig returns the TLS settings for serving HTTPS directly: TLS_MIN_VERSION
+// as the oldest version accepted and, with TLS_MODERN_CIPHERS, only modernCipherSuites.
+// The list includes TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, which HTTP/2 requires.
+func newTLSConfig(cfg *config.Config) *tls.Config {
+	tlsConfig := &tls.Config{MinVersion: cfg.TLSVersion()}
+	if cfg.TLSModernCiphers {
+		tlsConfig.CipherSuites = modernCipherSuites
+	}
+	return tlsConfig
+}
+
+// httpsRedirect sends plain HTTP requests to the same host and path over HTTPS on
+// httpsPort, which is left out of the URL when it is the default 443. GET and HEAD
+// get a 301; other methods get a 308 so they are replayed with their body.
+func httpsRedirect(httpsPort string) http.Handler {
+	httpsPort = strings.TrimPrefix(httpsPort, ":")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			// An IPv6 Host is bracketed even without a port; they are put back below
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		if host == "" {
+			http.Error(w, "Host header required", http.StatusBadRequest)
+			return
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			// A bare IPv6 literal still needs its brackets
+			host = "[" + host + "]"
+		}
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		name             string
+		httpsPort        string
+		method           string
+		target           string
+		host             string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"default port", "443", http.MethodGet, "/counter?x=1", "example.com", http.StatusMovedPermanently, "https://example.com/counter?x=1"},
+		{"custom port", "8443", http.MethodGet, "/", "example.com", http.StatusMovedPermanently, "https://example.com:8443/"},
+		{"port with colon", ":8443", http.MethodGet, "/", "example.com:80", http.StatusMovedPermanently, "https://example.com:8443/"},
+		{"host port replaced", "443", http.MethodGet, "/", "example.com:8080", http.StatusMovedPermanently, "https://example.com/"},
+		{"post keeps method", "443", http.MethodPost, "/api/users", "example.com", http.StatusPermanentRedirect, "https://example.com/api/users"},
+		{"ipv6 host", "443", http.MethodGet, "/", "[::1]:80", http.StatusMovedPermanently, "https://[::1]/"},
+		{"ipv6 host without port", "443", http.MethodGet, "/", "[::1]", http.StatusMovedPermanently, "https://[::1]/"},
+		{"ipv6 host without port to custom port", "8443", http.MethodGet, "/", "[::1]", http.StatusMovedPermanently, "https://[::1]:8443/"},
+		{"missing host", "443", http.MethodGet, "/", "", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			httpsRedirect(tt.httpsPort).ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expectedStatus)
+			}
+			if location := rec.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("Location = %q, expected %q", location, tt.expectedLocation)
+			}
+		})
+	}
+}
@@ -2,13 +2,30 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net/netip"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// Bounds for MAX_HEADER_BYTES: below 4 KiB ordinary browser requests with cookies get
+// rejected, and above 16 MiB a handful of clients could exhaust memory
+const (
+	minHeaderBytes = 4 << 10
+	maxHeaderBytes = 16 << 20
+)
+
+// tlsVersions maps the accepted TLS_MIN_VERSION values to crypto/tls constants. Older
+// versions are deliberately absent.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
 // Config holds all application configuration
 type Config struct {
 	// Server configuration
@@ -18,29 +35,139 @@ type Config struct {
 	WriteTimeout time.Duration `env:"WRITE_TIMEOUT"`
 	IdleTimeout  time.Duration `env:"IDLE_TIMEOUT"`
 	
+	// ShutdownTimeout is the grace window in-flight requests get to finish on shutdown
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT"`
+	
+	// Protocol configuration
+	MaxHeaderBytes int  `env:"MAX_HEADER_BYTES"`
+	H2C            bool `env:"H2C"`
+	
+	// Form limits: the largest form body and the most values a form may carry, 0
+	// leaving each to net/http's defaults
+	FormMaxBytes  int64 `env:"FORM_MAX_BYTES"`
+	FormMaxFields int   `env:"FORM_MAX_FIELDS"`
+	
+	// TLS configuration (plain HTTP unless both files are set)
+	TLSCertFile      string `env:"TLS_CERT_FILE"`
+	TLSKeyFile       string `env:"TLS_KEY_FILE"`
+	AutoRedirectHTTP bool   `env:"AUTO_REDIRECT_HTTP"`
+	HTTPRedirectPort string `env:"HTTP_REDIRECT_PORT"`
+	TLSMinVersion    string `env:"TLS_MIN_VERSION"`
+	TLSModernCiphers bool   `env:"TLS_MODERN_CIPHERS"`
+	
 	// Database configuration
 	DatabaseURL     string `env:"DATABASE_URL"`
+	ReplicaURL      string `env:"REPLICA_URL"`
 	MaxConnections  int32  `env:"DB_MAX_CONNECTIONS"`
 	MinConnections  int32  `env:"DB_MIN_CONNECTIONS"`
 	ConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME"`
+	QueryTimeout    time.Duration `env:"DB_QUERY_TIMEOUT"`
+	SchemaPath      string        `env:"SCHEMA_PATH"`
+	UserCacheTTL    time.Duration `env:"USER_CACHE_TTL"`
+	DBConnectRetry  bool          `env:"DB_CONNECT_RETRY"`
+	
+	// UserCountCoalesce makes concurrent user counts share one query
+	UserCountCoalesce bool `env:"USER_COUNT_COALESCE"`
+	
+	// ReadOnly refuses every write to users and the counter while reads carry on
+	ReadOnly bool `env:"READ_ONLY"`
+	
+	// Totals of paginated listings: how long to cache them, and whether large
+	// unfiltered ones are counted or estimated
+	CountCacheTTL time.Duration `env:"COUNT_CACHE_TTL"`
+	CountMode     string        `env:"COUNT_MODE"`
+	
+	// Session settings for every connection. StatementTimeout is enforced by Postgres
+	// itself, so it also bounds statements that never see our query context, such as
+	// the streaming user export.
+	StatementTimeout  time.Duration `env:"DB_STATEMENT_TIMEOUT"`
+	DBApplicationName string        `env:"DB_APPLICATION_NAME"`
+	DBSearchPath      string        `env:"DB_SEARCH_PATH"`
 	
 	// Security configuration
-	AllowedOrigins []string `env:"ALLOWED_ORIGINS"`
-	TrustedProxies []string `env:"TRUSTED_PROXIES"`
-	SecretKey      string   `env:"SECRET_KEY"`
+	AllowedOrigins     []string `env:"ALLOWED_ORIGINS"`
+	CORSAllowedMethods []string `env:"CORS_ALLOWED_METHODS"`
+	CORSAllowedHeaders []string `env:"CORS_ALLOWED_HEADERS"`
+	TrustedProxies     []string `env:"TRUSTED_PROXIES"`
+	SecretKey          string   `env:"SECRET_KEY"`
+	AdminToken         string   `env:"ADMIN_TOKEN"`
 	
 	// Logging configuration
-	LogLevel  string `env:"LOG_LEVEL"`
-	LogFormat string `env:"LOG_FORMAT"`
+	LogLevel        string   `env:"LOG_LEVEL"`
+	LogFormat       string   `env:"LOG_FORMAT"`
+	LogHeaders      []string `env:"LOG_HEADERS"`
+	LogRedactFields []string `env:"LOG_REDACT_FIELDS"`
+	
+	// Log destination: "stdout", "stderr" or a file path. Files rotate at LogMaxSizeMB
+	// and old ones are pruned by count and age in days, zero keeping them all.
+	LogOutput     string `env:"LOG_OUTPUT"`
+	LogMaxSizeMB  int    `env:"LOG_MAX_SIZE_MB"`
+	LogMaxAgeDays int    `env:"LOG_MAX_AGE_DAYS"`
+	LogMaxBackups int    `env:"LOG_MAX_BACKUPS"`
 	
 	// Rate limiting configuration
-	RateLimit         int           `env:"RATE_LIMIT"`
-	RateLimitWindow   time.Duration `env:"RATE_LIMIT_WINDOW"`
-	RateLimitBurst    int           `env:"RATE_LIMIT_BURST"`
+	RateLimit            int           `env:"RATE_LIMIT"`
+	RateLimitWindow      time.Duration `env:"RATE_LIMIT_WINDOW"`
+	RateLimitBurst       int           `env:"RATE_LIMIT_BURST"`
+	RateLimitExemptPaths []string      `env:"RATE_LIMIT_EXEMPT_PATHS"`
+	RateLimitGlobal      int           `env:"RATE_LIMIT_GLOBAL"`
+	RateLimitByUser      bool          `env:"RATE_LIMIT_BY_USER"`
+	LoadShedPoolPercent  int           `env:"LOAD_SHED_POOL_PERCENT"`
+	
+	// Request coalescing configuration
+	CoalescePaths  []string      `env:"COALESCE_PATHS"`
+	CoalesceWindow time.Duration `env:"COALESCE_WINDOW"`
+	
+	// Search cache configuration: repeated typeahead queries from one client are
+	// answered from a bounded LRU for SearchCacheTTL
+	SearchCacheTTL  time.Duration `env:"SEARCH_CACHE_TTL"`
+	SearchCacheSize int           `env:"SEARCH_CACHE_SIZE"`
+	
+	// Routing configuration
+	TrailingSlash            string   `env:"TRAILING_SLASH"`
+	TrailingSlashExemptPaths []string `env:"TRAILING_SLASH_EXEMPT_PATHS"`
+	
+	// Validation configuration
+	FilterProfanity    bool   `env:"FILTER_PROFANITY"`
+	ProfanityWordsFile string `env:"PROFANITY_WORDS_FILE"`
+	
+	// Static asset configuration
+	StaticFromDisk    bool          `env:"STATIC_FROM_DISK"`
+	StaticDir         string        `env:"STATIC_DIR"`
+	StaticMaxAge      time.Duration `env:"STATIC_MAX_AGE"`
+	StaticSPAFallback bool          `env:"STATIC_SPA_FALLBACK"`
+	
+	// Time demo configuration. DisplayTimezone is an IANA name such as "Europe/Paris"
+	// and DisplayTimeFormat a Go reference-time layout, the default one when empty.
+	TimeMaxAge        time.Duration `env:"TIME_MAX_AGE"`
+	DisplayTimezone   string        `env:"DISPLAY_TIMEZONE"`
+	DisplayTimeFormat string        `env:"DISPLAY_TIME_FORMAT"`
 	
 	// Application configuration
-	Environment string `env:"ENVIRONMENT"`
-	Debug       bool   `env:"DEBUG"`
+	Environment    string `env:"ENVIRONMENT"`
+	Debug          bool   `env:"DEBUG"`
+	RobotsPolicy   string `env:"ROBOTS_POLICY"`
+	UsersListLimit int    `env:"USERS_LIST_LIMIT"`
+	
+	// MinifyHTML strips comments and formatting whitespace from rendered HTML
+	MinifyHTML bool `env:"MINIFY_HTML"`
+	
+	// PaginationMaxOffset bounds how deep paginated listings go; deeper pages are
+	// rejected rather than making Postgres skip that many rows
+	PaginationMaxOffset int `env:"PAGINATION_MAX_OFFSET"`
+
+	// Maintenance mode configuration
+	MaintenanceMode        bool     `env:"MAINTENANCE_MODE"`
+	MaintenanceExemptPaths []string `env:"MAINTENANCE_EXEMPT_PATHS"`
+	
+	// SecurityHeadersSlimPaths are path prefixes answering with JSON or metrics rather
+	// than pages, which get only the security headers that matter outside a document
+	SecurityHeadersSlimPaths []string `env:"SECURITY_HEADERS_SLIM_PATHS"`
+	
+	// Health check configuration. The runtime check reports memory, goroutines and GC
+	// and is degraded above HealthMaxGoroutines (0 for no ceiling).
+	HealthRuntime       bool `env:"HEALTH_RUNTIME"`
+	HealthMaxGoroutines int  `env:"HEALTH_MAX_GOROUTINES"`
 }
 
 // Load loads configuration from environment variables with sensible defaults
@@ -53,30 +180,134 @@ func Load() (*Config, error) {
 		WriteTimeout: parseDuration("write_timeout", getEnv("WRITE_TIMEOUT", "15s")),
 		IdleTimeout:  parseDuration("idle_timeout", getEnv("IDLE_TIMEOUT", "60s")),
 		
+		ShutdownTimeout: parseDuration("SHUTDOWN_TIMEOUT", getEnv("SHUTDOWN_TIMEOUT", "30s")),
+		
+		// Protocol defaults (net/http's 1 MiB header limit, HTTP/1.1 unless TLS negotiates HTTP/2)
+		MaxHeaderBytes: parseInt("MAX_HEADER_BYTES", getEnv("MAX_HEADER_BYTES", "1048576")),
+		H2C:            parseBool("H2C", getEnv("H2C", "false")),
+		
+		// Form defaults (the app's forms are a few short fields)
+		FormMaxBytes:  int64(parseInt("FORM_MAX_BYTES", getEnv("FORM_MAX_BYTES", "65536"))),
+		FormMaxFields: parseInt("FORM_MAX_FIELDS", getEnv("FORM_MAX_FIELDS", "100")),
+		
+		// TLS defaults (off: local development and deployments behind a TLS proxy)
+		TLSCertFile:      getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:       getEnv("TLS_KEY_FILE", ""),
+		AutoRedirectHTTP: parseBool("AUTO_REDIRECT_HTTP", getEnv("AUTO_REDIRECT_HTTP", "false")),
+		HTTPRedirectPort: getEnv("HTTP_REDIRECT_PORT", "80"),
+		TLSMinVersion:    getEnv("TLS_MIN_VERSION", "1.2"),
+		TLSModernCiphers: parseBool("TLS_MODERN_CIPHERS", getEnv("TLS_MODERN_CIPHERS", "false")),
+		
 		// Database defaults
 		DatabaseURL:     getRequiredEnv("DATABASE_URL"),
+		ReplicaURL:      getEnv("REPLICA_URL", ""),
 		MaxConnections:  int32(parseInt("DB_MAX_CONNECTIONS", getEnv("DB_MAX_CONNECTIONS", "10"))),
 		MinConnections:  int32(parseInt("DB_MIN_CONNECTIONS", getEnv("DB_MIN_CONNECTIONS", "2"))),
 		ConnMaxLifetime: parseDuration("db_conn_max_lifetime", getEnv("DB_CONN_MAX_LIFETIME", "1h")),
+		QueryTimeout:    parseDuration("DB_QUERY_TIMEOUT", getEnv("DB_QUERY_TIMEOUT", "5s")),
+		SchemaPath:      getEnv("SCHEMA_PATH", "db/schema.sql"),
+		UserCacheTTL:    parseDuration("USER_CACHE_TTL", getEnv("USER_CACHE_TTL", "0s")),
+		DBConnectRetry:  parseBool("DB_CONNECT_RETRY", getEnv("DB_CONNECT_RETRY", "false")),
+		
+		UserCountCoalesce: parseBool("USER_COUNT_COALESCE", getEnv("USER_COUNT_COALESCE", "false")),
+		
+		ReadOnly: parseBool("READ_ONLY", getEnv("READ_ONLY", "false")),
+		
+		CountCacheTTL: parseDuration("COUNT_CACHE_TTL", getEnv("COUNT_CACHE_TTL", "0s")),
+		CountMode:     getEnv("COUNT_MODE", "exact"),
+		
+		// Server-side backstop, well above DB_QUERY_TIMEOUT so only runaways hit it
+		StatementTimeout:  parseDuration("DB_STATEMENT_TIMEOUT", getEnv("DB_STATEMENT_TIMEOUT", "60s")),
+		DBApplicationName: getEnv("DB_APPLICATION_NAME", "htmx-learn"),
+		DBSearchPath:      getEnv("DB_SEARCH_PATH", ""),
 		
 		// Security defaults
-		AllowedOrigins: parseStringSlice(getEnv("ALLOWED_ORIGINS", "http://localhost:8080,https://localhost:8080")),
-		TrustedProxies: parseStringSlice(getEnv("TRUSTED_PROXIES", "127.0.0.1,::1")),
-		SecretKey:      getRequiredEnv("SECRET_KEY"),
+		AllowedOrigins:     parseStringSlice(getEnv("ALLOWED_ORIGINS", "http://localhost:8080,https://localhost:8080")),
+		CORSAllowedMethods: parseStringSlice(getEnv("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE")),
+		// htmx sends its HX-* headers on every request, so cross-origin HTMX calls need them
+		CORSAllowedHeaders: parseStringSlice(getEnv("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-Requested-With,X-Request-ID,X-Pagination-Mode,HX-Request,HX-Target,HX-Trigger,HX-Trigger-Name,HX-Current-URL,HX-Boosted,HX-Prompt")),
+		TrustedProxies:     parseStringSlice(getEnv("TRUSTED_PROXIES", "127.0.0.1,::1")),
+		SecretKey:          getRequiredEnv("SECRET_KEY"),
+		AdminToken:         getEnv("ADMIN_TOKEN", ""),
 		
 		// Logging defaults
-		LogLevel:  getEnv("LOG_LEVEL", "info"),
-		LogFormat: getEnv("LOG_FORMAT", "json"),
+		LogLevel:        getEnv("LOG_LEVEL", "info"),
+		LogFormat:       getEnv("LOG_FORMAT", "json"),
+		LogHeaders:      parseStringSlice(getEnv("LOG_HEADERS", "")),
+		LogRedactFields: parseStringSlice(getEnv("LOG_REDACT_FIELDS", "password,secret,token")),
+		
+		// Log destination defaults (containers collect standard output)
+		LogOutput:     getEnv("LOG_OUTPUT", "stdout"),
+		LogMaxSizeMB:  parseInt("LOG_MAX_SIZE_MB", getEnv("LOG_MAX_SIZE_MB", "100")),
+		LogMaxAgeDays: parseInt("LOG_MAX_AGE_DAYS", getEnv("LOG_MAX_AGE_DAYS", "0")),
+		LogMaxBackups: parseInt("LOG_MAX_BACKUPS", getEnv("LOG_MAX_BACKUPS", "0")),
 		
 		// Rate limiting defaults
-		RateLimit:       parseInt("RATE_LIMIT", getEnv("RATE_LIMIT", "100")),
-		RateLimitWindow: parseDuration("rate_limit_window", getEnv("RATE_LIMIT_WINDOW", "1m")),
-		RateLimitBurst:  parseInt("RATE_LIMIT_BURST", getEnv("RATE_LIMIT_BURST", "20")),
+		RateLimit:            parseInt("RATE_LIMIT", getEnv("RATE_LIMIT", "100")),
+		RateLimitWindow:      parseDuration("rate_limit_window", getEnv("RATE_LIMIT_WINDOW", "1m")),
+		RateLimitBurst:       parseInt("RATE_LIMIT_BURST", getEnv("RATE_LIMIT_BURST", "20")),
+		RateLimitExemptPaths: parseStringSlice(getEnv("RATE_LIMIT_EXEMPT_PATHS", "/health,/static")),
+		RateLimitGlobal:      parseInt("RATE_LIMIT_GLOBAL", getEnv("RATE_LIMIT_GLOBAL", "0")),
+		RateLimitByUser:      parseBool("RATE_LIMIT_BY_USER", getEnv("RATE_LIMIT_BY_USER", "true")),
+		LoadShedPoolPercent:  parseInt("LOAD_SHED_POOL_PERCENT", getEnv("LOAD_SHED_POOL_PERCENT", "0")),
+		
+		// Request coalescing defaults (disabled unless paths are listed)
+		CoalescePaths:  parseStringSlice(getEnv("COALESCE_PATHS", "")),
+		CoalesceWindow: parseDuration("COALESCE_WINDOW", getEnv("COALESCE_WINDOW", "0s")),
+		
+		// Search cache defaults (long enough to absorb a burst of keystrokes)
+		SearchCacheTTL:  parseDuration("SEARCH_CACHE_TTL", getEnv("SEARCH_CACHE_TTL", "2s")),
+		SearchCacheSize: parseInt("SEARCH_CACHE_SIZE", getEnv("SEARCH_CACHE_SIZE", "1000")),
+		
+		// Routing defaults (the static file server's prefix legitimately ends in a slash)
+		TrailingSlash:            strings.ToLower(getEnv("TRAILING_SLASH", "redirect")),
+		TrailingSlashExemptPaths: parseStringSlice(getEnv("TRAILING_SLASH_EXEMPT_PATHS", "/static")),
+		
+		// Validation defaults
+		FilterProfanity:    parseBool("FILTER_PROFANITY", getEnv("FILTER_PROFANITY", "false")),
+		ProfanityWordsFile: getEnv("PROFANITY_WORDS_FILE", ""),
+		
+		// Static asset defaults (embedded unless serving from disk for development)
+		StaticFromDisk:    parseBool("STATIC_FROM_DISK", getEnv("STATIC_FROM_DISK", "false")),
+		StaticDir:         getEnv("STATIC_DIR", "static"),
+		StaticMaxAge:      parseDuration("STATIC_MAX_AGE", getEnv("STATIC_MAX_AGE", "24h")),
+		StaticSPAFallback: parseBool("STATIC_SPA_FALLBACK", getEnv("STATIC_SPA_FALLBACK", "false")),
+		
+		// Time demo defaults (uncached so the live clock keeps ticking)
+		TimeMaxAge:        parseDuration("TIME_MAX_AGE", getEnv("TIME_MAX_AGE", "0s")),
+		DisplayTimezone:   getEnv("DISPLAY_TIMEZONE", "Local"),
+		DisplayTimeFormat: getEnv("DISPLAY_TIME_FORMAT", "2006-01-02 15:04:05 MST"),
 		
 		// Application defaults
-		Environment: getEnv("ENVIRONMENT", "development"),
-		Debug:       parseBool("DEBUG", getEnv("DEBUG", "false")),
+		Environment:    getEnv("ENVIRONMENT", "development"),
+		Debug:          parseBool("DEBUG", getEnv("DEBUG", "false")),
+		UsersListLimit: parseInt("USERS_LIST_LIMIT", getEnv("USERS_LIST_LIMIT", "500")),
+		
+		// A thousand default-sized pages
+		PaginationMaxOffset: parseInt("PAGINATION_MAX_OFFSET", getEnv("PAGINATION_MAX_OFFSET", "10000")),
+		
+		// Maintenance defaults (health checks, admin endpoints and page assets stay up)
+		MaintenanceMode:        parseBool("MAINTENANCE_MODE", getEnv("MAINTENANCE_MODE", "false")),
+		MaintenanceExemptPaths: parseStringSlice(getEnv("MAINTENANCE_EXEMPT_PATHS", "/health,/admin,/static")),
+		
+		// Endpoints that never serve HTML (/api is left out: without HX-Request its
+		// fragment routes render full pages)
+		SecurityHeadersSlimPaths: parseStringSlice(getEnv("SECURITY_HEADERS_SLIM_PATHS", "/health,/metrics,/version,/admin,/debug")),
+		
+		// Health check defaults (a lean payload; the ceiling is far above normal load)
+		HealthRuntime:       parseBool("HEALTH_RUNTIME", getEnv("HEALTH_RUNTIME", "false")),
+		HealthMaxGoroutines: parseInt("HEALTH_MAX_GOROUTINES", getEnv("HEALTH_MAX_GOROUTINES", "10000")),
+	}
+	
+	// Crawlers are only welcome in production unless told otherwise
+	defaultRobots := "disallow"
+	if config.IsProduction() {
+		defaultRobots = "allow"
 	}
+	config.RobotsPolicy = strings.ToLower(getEnv("ROBOTS_POLICY", defaultRobots))
+	
+	// Payload size matters in production; elsewhere readable output helps debugging
+	config.MinifyHTML = parseBool("MINIFY_HTML", getEnv("MINIFY_HTML", strconv.FormatBool(config.IsProduction())))
 	
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("configuration validation failed: %w", err)
@@ -99,14 +330,174 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("SECRET_KEY must be at least 32 characters long")
 	}
 	
+	if c.AdminToken != "" && len(c.AdminToken) < 32 {
+		return fmt.Errorf("ADMIN_TOKEN must be at least 32 characters long")
+	}
+	
+	if c.MaxHeaderBytes < minHeaderBytes || c.MaxHeaderBytes > maxHeaderBytes {
+		return fmt.Errorf("MAX_HEADER_BYTES must be between %d and %d", minHeaderBytes, maxHeaderBytes)
+	}
+	
+	if c.FormMaxBytes < 0 || c.FormMaxFields < 0 {
+		return fmt.Errorf("FORM_MAX_BYTES and FORM_MAX_FIELDS must not be negative")
+	}
+	
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	
+	if c.LogToFile() {
+		if c.LogMaxSizeMB < 1 {
+			return fmt.Errorf("LOG_MAX_SIZE_MB must be at least 1")
+		}
+		if c.LogMaxAgeDays < 0 || c.LogMaxBackups < 0 {
+			return fmt.Errorf("LOG_MAX_AGE_DAYS and LOG_MAX_BACKUPS must not be negative")
+		}
+		if err := checkWritable(c.LogOutput); err != nil {
+			return fmt.Errorf("LOG_OUTPUT must be a writable file: %w", err)
+		}
+	}
+	
+	if c.TLSEnabled() {
+		if err := checkReadable(c.TLSCertFile); err != nil {
+			return fmt.Errorf("TLS_CERT_FILE must be a readable file: %w", err)
+		}
+		if err := checkReadable(c.TLSKeyFile); err != nil {
+			return fmt.Errorf("TLS_KEY_FILE must be a readable file: %w", err)
+		}
+	}
+	
+	if _, ok := tlsVersions[c.TLSMinVersion]; !ok && c.TLSMinVersion != "" {
+		return fmt.Errorf("TLS_MIN_VERSION must be 1.2 or 1.3")
+	}
+	
+	if c.AutoRedirectHTTP && !c.TLSEnabled() {
+		return fmt.Errorf("AUTO_REDIRECT_HTTP requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	
 	if c.MaxConnections < c.MinConnections {
 		return fmt.Errorf("DB_MAX_CONNECTIONS must be greater than DB_MIN_CONNECTIONS")
 	}
+
+	if c.QueryTimeout < 0 {
+		return fmt.Errorf("DB_QUERY_TIMEOUT must not be negative")
+	}
+	
+	// Postgres counts statement_timeout in whole milliseconds, and 0 would disable it
+	if c.StatementTimeout < time.Millisecond {
+		return fmt.Errorf("DB_STATEMENT_TIMEOUT must be at least 1ms")
+	}
+	
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("SHUTDOWN_TIMEOUT must not be negative")
+	}
+	
+	if c.RobotsPolicy != "allow" && c.RobotsPolicy != "disallow" {
+		return fmt.Errorf("ROBOTS_POLICY must be allow or disallow")
+	}
+	
+	if c.UsersListLimit < 1 {
+		return fmt.Errorf("USERS_LIST_LIMIT must be at least 1")
+	}
+	
+	if c.PaginationMaxOffset < 0 {
+		return fmt.Errorf("PAGINATION_MAX_OFFSET must not be negative")
+	}
+	
+	if c.CountCacheTTL < 0 {
+		return fmt.Errorf("COUNT_CACHE_TTL must not be negative")
+	}
+	
+	// Empty, as in a Config built by hand, counts exactly
+	switch c.CountMode {
+	case "", "exact", "estimate":
+	default:
+		return fmt.Errorf("COUNT_MODE must be exact or estimate")
+	}
+	
+	if c.UserCacheTTL < 0 {
+		return fmt.Errorf("USER_CACHE_TTL must not be negative")
+	}
+	
+	if c.TimeMaxAge < 0 {
+		return fmt.Errorf("TIME_MAX_AGE must not be negative")
+	}
+	
+	if _, err := time.LoadLocation(c.DisplayTimezone); err != nil {
+		return fmt.Errorf("DISPLAY_TIMEZONE %q must be an IANA time zone name: %w", c.DisplayTimezone, err)
+	}
+	
+	if c.DisplayTimeFormat != "" && !validTimeLayout(c.DisplayTimeFormat) {
+		return fmt.Errorf("DISPLAY_TIME_FORMAT %q must be a Go time layout such as \"2006-01-02 15:04:05 MST\"", c.DisplayTimeFormat)
+	}
+	
+	if c.StaticMaxAge < 0 {
+		return fmt.Errorf("STATIC_MAX_AGE must not be negative")
+	}
+	
+	if c.StaticFromDisk {
+		info, err := os.Stat(c.StaticDir)
+		if err != nil || !info.IsDir() {
+			return fmt.Errorf("STATIC_DIR %q must be an existing directory when STATIC_FROM_DISK is enabled", c.StaticDir)
+		}
+	}
+	
+	if c.RateLimit <= 0 {
+		return fmt.Errorf("RATE_LIMIT must be positive")
+	}
+	
+	if c.RateLimitWindow <= 0 {
+		return fmt.Errorf("RATE_LIMIT_WINDOW must be positive")
+	}
+	
+	if c.RateLimitBurst < 1 {
+		return fmt.Errorf("RATE_LIMIT_BURST must be at least 1")
+	}
+	
+	if c.RateLimitGlobal < 0 {
+		return fmt.Errorf("RATE_LIMIT_GLOBAL must not be negative")
+	}
+	
+	if c.LoadShedPoolPercent < 0 || c.LoadShedPoolPercent > 100 {
+		return fmt.Errorf("LOAD_SHED_POOL_PERCENT must be between 0 and 100")
+	}
+	
+	if c.CoalesceWindow < 0 {
+		return fmt.Errorf("COALESCE_WINDOW must not be negative")
+	}
+	
+	if c.HealthMaxGoroutines < 0 {
+		return fmt.Errorf("HEALTH_MAX_GOROUTINES must not be negative")
+	}
+	
+	if c.SearchCacheTTL < 0 {
+		return fmt.Errorf("SEARCH_CACHE_TTL must not be negative")
+	}
+	
+	if c.SearchCacheTTL > 0 && c.SearchCacheSize < 1 {
+		return fmt.Errorf("SEARCH_CACHE_SIZE must be at least 1 when SEARCH_CACHE_TTL is set")
+	}
+	
+	for _, proxy := range c.TrustedProxies {
+		if !validTrustedProxy(proxy) {
+			return fmt.Errorf("TRUSTED_PROXIES entry %q must be an IP address or CIDR range", proxy)
+		}
+	}
+	
+	if c.TrailingSlash != "redirect" && c.TrailingSlash != "rewrite" && c.TrailingSlash != "off" {
+		return fmt.Errorf("TRAILING_SLASH must be redirect, rewrite or off")
+	}
 	
 	if len(c.AllowedOrigins) == 0 {
 		return fmt.Errorf("ALLOWED_ORIGINS must be specified")
 	}
 	
+	// Any site could call a staging or production API with "*", so it is for local
+	// development only
+	if c.Environment != "development" && slices.Contains(c.AllowedOrigins, "*") {
+		return fmt.Errorf("ALLOWED_ORIGINS may only contain * in development")
+	}
+	
 	validEnvs := map[string]bool{"development": true, "staging": true, "production": true}
 	if !validEnvs[c.Environment] {
 		return fmt.Errorf("ENVIRONMENT must be one of: development, staging, production")
@@ -116,6 +507,33 @@ func (c *Config) Validate() error {
 }
 
 
+// IsProduction reports whether the app is running in the production environment
+func (c *Config) IsProduction() bool {
+	return c.Environment == "production"
+}
+
+// TLSVersion returns the crypto/tls constant for TLS_MIN_VERSION, TLS 1.2 when unset
+func (c *Config) TLSVersion() uint16 {
+	if version, ok := tlsVersions[c.TLSMinVersion]; ok {
+		return version
+	}
+	return tls.VersionTLS12
+}
+
+// TLSEnabled reports whether the server should serve HTTPS with its own certificate
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// LogToFile reports whether LOG_OUTPUT names a file rather than a standard stream
+func (c *Config) LogToFile() bool {
+	switch c.LogOutput {
+	case "", "stdout", "stderr":
+		return false
+	}
+	return true
+}
+
 // GetServerAddress returns the full server address
 func (c *Config) GetServerAddress() string {
 	if strings.HasPrefix(c.Port, ":") {
@@ -161,6 +579,50 @@ func parseDuration(key, value string) time.Duration {
 	panic(fmt.Sprintf("invalid duration value for %s: %s", key, value))
 }
 
+// validTimeLayout reports whether layout contains any element of Go's reference
+// time; a layout without one formats every time as itself
+func validTimeLayout(layout string) bool {
+	sample := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	return sample.Format(layout) != layout
+}
+
+// checkReadable reports why path can't be opened for reading as a regular file, if it can't
+func checkReadable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	return nil
+}
+
+// checkWritable reports why path can't be opened for appending, creating it if
+// missing, if it can't
+func checkWritable(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// validTrustedProxy reports whether proxy is an IP address or a CIDR range
+func validTrustedProxy(proxy string) bool {
+	if _, err := netip.ParsePrefix(proxy); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(proxy)
+	return err == nil
+}
+
 func parseStringSlice(value string) []string {
 	if value == "" {
 		return []string{}
@@ -0,0 +1,392 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRobotsPolicyDefault(t *testing.T) {
+	tests := []struct {
+		environment string
+		override    string
+		expected    string
+	}{
+		{"development", "", "disallow"},
+		{"staging", "", "disallow"},
+		{"production", "", "allow"},
+		{"production", "DISALLOW", "disallow"},
+		{"staging", "allow", "allow"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.environment+"/"+tt.override, func(t *testing.T) {
+			t.Setenv("DATABASE_URL", "postgres://localhost/test")
+			t.Setenv("SECRET_KEY", "0123456789abcdef0123456789abcdef")
+			t.Setenv("ENVIRONMENT", tt.environment)
+			t.Setenv("ROBOTS_POLICY", tt.override)
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() unexpected error: %v", err)
+			}
+			if cfg.RobotsPolicy != tt.expected {
+				t.Errorf("RobotsPolicy = %q, expected %q", cfg.RobotsPolicy, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMinifyHTMLDefault(t *testing.T) {
+	tests := []struct {
+		environment string
+		override    string
+		expected    bool
+	}{
+		{"development", "", false},
+		{"production", "", true},
+		{"production", "false", false},
+		{"staging", "true", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.environment+"/"+tt.override, func(t *testing.T) {
+			t.Setenv("DATABASE_URL", "postgres://localhost/test")
+			t.Setenv("SECRET_KEY", "0123456789abcdef0123456789abcdef")
+			t.Setenv("ENVIRONMENT", tt.environment)
+			t.Setenv("MINIFY_HTML", tt.override)
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() unexpected error: %v", err)
+			}
+			if cfg.MinifyHTML != tt.expected {
+				t.Errorf("MinifyHTML = %v, expected %v", cfg.MinifyHTML, tt.expected)
+			}
+		})
+	}
+}
+
+// validConfig returns a configuration that passes Validate, so each test only has to
+// set what it exercises
+func validConfig() *Config {
+	return &Config{
+		DatabaseURL:      "postgres://localhost/test",
+		SecretKey:        "0123456789abcdef0123456789abcdef",
+		AllowedOrigins:   []string{"http://localhost:8080"},
+		Environment:      "development",
+		RobotsPolicy:     "disallow",
+		TrailingSlash:    "redirect",
+		UsersListLimit:   500,
+		MaxHeaderBytes:   1 << 20,
+		RateLimit:        100,
+		RateLimitWindow:  time.Minute,
+		RateLimitBurst:   20,
+		StatementTimeout: time.Minute,
+	}
+}
+
+func TestValidateStaticDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		fromDisk    bool
+		staticDir   string
+		expectError bool
+	}{
+		{"existing directory", true, dir, false},
+		{"missing directory", true, filepath.Join(dir, "missing"), true},
+		{"file instead of directory", true, file, true},
+		{"embedded ignores directory", false, filepath.Join(dir, "missing"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.StaticFromDisk = tt.fromDisk
+			cfg.StaticDir = tt.staticDir
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateWildcardOrigin(t *testing.T) {
+	for _, tt := range []struct {
+		environment string
+		expectError bool
+	}{
+		{"development", false},
+		{"staging", true},
+		{"production", true},
+	} {
+		t.Run(tt.environment, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.AllowedOrigins = []string{"https://app.example.com", "*"}
+			cfg.Environment = tt.environment
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		proxies     []string
+		expectError bool
+	}{
+		{"addresses", []string{"127.0.0.1", "::1"}, false},
+		{"cidr ranges", []string{"10.0.0.0/8", "fd00::/8"}, false},
+		{"hostname", []string{"proxy.internal"}, true},
+		{"bad range", []string{"10.0.0.0/33"}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.TrustedProxies = tt.proxies
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateTrailingSlash(t *testing.T) {
+	for mode, expectError := range map[string]bool{"redirect": false, "rewrite": false, "off": false, "": true, "strip": true} {
+		cfg := validConfig()
+		cfg.TrailingSlash = mode
+		if err := cfg.Validate(); (err != nil) != expectError {
+			t.Errorf("Validate() with TRAILING_SLASH=%q error = %v, expectError %v", mode, err, expectError)
+		}
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	key := filepath.Join(dir, "key.pem")
+	for _, file := range []string{cert, key} {
+		if err := os.WriteFile(file, []byte("pem"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		certFile     string
+		keyFile      string
+		autoRedirect bool
+		expectError  bool
+	}{
+		{"plain http", "", "", false, false},
+		{"tls", cert, key, false, false},
+		{"tls with redirect", cert, key, true, false},
+		{"cert without key", cert, "", false, true},
+		{"key without cert", "", key, false, true},
+		{"missing cert", filepath.Join(dir, "missing.pem"), key, false, true},
+		{"directory as key", cert, dir, false, true},
+		{"redirect without tls", "", "", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.TLSCertFile = tt.certFile
+			cfg.TLSKeyFile = tt.keyFile
+			cfg.AutoRedirectHTTP = tt.autoRedirect
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       int
+		window      time.Duration
+		burst       int
+		expectError bool
+	}{
+		{"defaults", 100, time.Minute, 20, false},
+		{"burst of one", 100, time.Minute, 1, false},
+		{"zero limit", 0, time.Minute, 20, true},
+		{"negative limit", -1, time.Minute, 20, true},
+		{"zero window", 100, 0, 20, true},
+		{"negative window", 100, -time.Minute, 20, true},
+		{"zero burst", 100, time.Minute, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.RateLimit = tt.limit
+			cfg.RateLimitWindow = tt.window
+			cfg.RateLimitBurst = tt.burst
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateLoadShedPoolPercent(t *testing.T) {
+	tests := []struct {
+		name        string
+		percent     int
+		expectError bool
+	}{
+		{"disabled", 0, false},
+		{"high-water mark", 90, false},
+		{"only when exhausted", 100, false},
+		{"negative", -1, true},
+		{"above 100", 101, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.LoadShedPoolPercent = tt.percent
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsZeroRateLimitWindow(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("SECRET_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("RATE_LIMIT_WINDOW", "0s")
+
+	if _, err := Load(); err == nil {
+		t.Fatal("Load() accepted RATE_LIMIT_WINDOW=0s, expected an error")
+	}
+}
+
+func TestValidateDisplayTime(t *testing.T) {
+	tests := []struct {
+		name        string
+		timezone    string
+		format      string
+		expectError bool
+	}{
+		{"server zone", "Local", "2006-01-02 15:04:05 MST", false},
+		{"iana zone", "Europe/Paris", "15:04", false},
+		{"default format", "UTC", "", false},
+		{"unknown zone", "Europe/Atlantis", "15:04", true},
+		{"abbreviation", "PST", "15:04", true},
+		{"layout without time", "UTC", "YYYY-MM-DD", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.DisplayTimezone = tt.timezone
+			cfg.DisplayTimeFormat = tt.format
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateTLSMinVersion(t *testing.T) {
+	for version, expectError := range map[string]bool{"": false, "1.2": false, "1.3": false, "1.1": true, "1.0": true, "TLS1.3": true} {
+		cfg := validConfig()
+		cfg.TLSMinVersion = version
+		if err := cfg.Validate(); (err != nil) != expectError {
+			t.Errorf("Validate() with TLS_MIN_VERSION=%q error = %v, expectError %v", version, err, expectError)
+		}
+	}
+}
+
+func TestValidateLogOutput(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name        string
+		output      string
+		maxSizeMB   int
+		expectError bool
+	}{
+		{"stdout", "stdout", 0, false},
+		{"stderr", "stderr", 0, false},
+		{"new file", filepath.Join(dir, "app.log"), 100, false},
+		{"missing directory", filepath.Join(dir, "missing", "app.log"), 100, true},
+		{"directory", dir, 100, true},
+		{"file without a rotation size", filepath.Join(dir, "other.log"), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.LogOutput = tt.output
+			cfg.LogMaxSizeMB = tt.maxSizeMB
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateStatementTimeout(t *testing.T) {
+	for timeout, expectError := range map[time.Duration]bool{0: true, -time.Second: true, time.Microsecond: true, time.Millisecond: false, time.Minute: false} {
+		cfg := validConfig()
+		cfg.StatementTimeout = timeout
+		if err := cfg.Validate(); (err != nil) != expectError {
+			t.Errorf("Validate() with DB_STATEMENT_TIMEOUT=%v error = %v, expectError %v", timeout, err, expectError)
+		}
+	}
+}
+
+func TestValidateFormLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxBytes    int64
+		maxFields   int
+		expectError bool
+	}{
+		{"defaults", 65536, 100, false},
+		{"disabled", 0, 0, false},
+		{"negative bytes", -1, 100, true},
+		{"negative fields", 65536, -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.FormMaxBytes = tt.maxBytes
+			cfg.FormMaxFields = tt.maxFields
+			if err := cfg.Validate(); (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestCORSAllowedHeadersDefault(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	t.Setenv("SECRET_KEY", "0123456789abcdef0123456789abcdef")
+	t.Setenv("ENVIRONMENT", "development")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	// The headers htmx and this app's pages send, which a cross-origin preflight asks for
+	for _, header := range []string{"HX-Request", "HX-Target", "HX-Trigger", "HX-Current-URL", "X-Request-ID", "X-Pagination-Mode"} {
+		if !slices.Contains(cfg.CORSAllowedHeaders, header) {
+			t.Errorf("CORSAllowedHeaders = %v, expected it to include %s", cfg.CORSAllowedHeaders, header)
+		}
+	}
+}
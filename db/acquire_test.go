@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"htmx-learn/circuitbreaker"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// fakePostgres accepts connections and completes the startup handshake, then ignores
+// everything sent to it. That is enough for the pool to hand out connections, which
+// tests hold to saturate it. It returns the URL to connect to.
+func fakePostgres(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				backend := pgproto3.NewBackend(conn, conn)
+				if _, err := backend.ReceiveStartupMessage(); err != nil {
+					return
+				}
+				backend.Send(&pgproto3.AuthenticationOk{})
+				backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+				backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+				if err := backend.Flush(); err != nil {
+					return
+				}
+				for {
+					if _, err := backend.Receive(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return "postgres://user@" + ln.Addr().String() + "/app?sslmode=disable"
+}
+
+func TestPoolExhaustion(t *testing.T) {
+	db, err := Open(Options{URL: fakePostgres(t), MaxConns: 1, QueryTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	held, err := Acquire(context.Background(), db.Pool)
+	if err != nil {
+		t.Fatalf("Acquire() on an idle pool error = %v", err)
+	}
+
+	t.Run("acquire", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, err := Acquire(ctx, db.Pool); !errors.Is(err, ErrPoolExhausted) {
+			t.Errorf("Acquire() on a saturated pool error = %v, expected ErrPoolExhausted", err)
+		}
+	})
+
+	t.Run("cancelled caller", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := Acquire(ctx, db.Pool); err == nil || errors.Is(err, ErrPoolExhausted) {
+			t.Errorf("Acquire() with a cancelled context error = %v, expected cancellation, not exhaustion", err)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		_, err := NewUserStore(db).Count(context.Background())
+		if !errors.Is(err, ErrPoolExhausted) || errors.Is(err, ErrQueryTimeout) {
+			t.Errorf("Count() on a saturated pool error = %v, expected ErrPoolExhausted rather than a query timeout", err)
+		}
+	})
+
+	t.Run("breaker", func(t *testing.T) {
+		for range 2 * circuitbreaker.DefaultConfig().MaxFailures {
+			db.ExecuteWithCircuitBreaker(context.Background(), func(ctx context.Context) error {
+				_, err := NewUserStore(db).Count(ctx)
+				return err
+			})
+		}
+		if stats := db.CircuitBreaker.Stats(); stats.State != circuitbreaker.StateClosed.String() || stats.Failures != 0 {
+			t.Errorf("breaker = %+v after exhausted-pool errors, expected closed with no failures", stats)
+		}
+	})
+
+	held.Release()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := Acquire(ctx, db.Pool)
+	if err != nil {
+		t.Fatalf("Acquire() after release error = %v", err)
+	}
+	conn.Release()
+}
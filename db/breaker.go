@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"htmx-learn/circuitbreaker"
+	"github.com/jackc/pgx/v5"
+)
+
+// The stores send every statement through run, runRead or runTx. A store bound to a
+// querier, such as a transaction or a test fake, uses it directly; otherwise the
+// statement goes to a pool through that pool's circuit breaker, so once the database
+// keeps failing, store calls fail fast with circuitbreaker.ErrCircuitBreakerOpen
+// instead of queueing on it. Callbacks must be done with their querier when they
+// return: the breaker cancels the context they were given then.
+
+// run runs fn against q, or else against the primary pool
+func (db *DB) run(ctx context.Context, q Querier, fn func(context.Context, Querier) error) error {
+	if q != nil {
+		return db.query(ctx, q, fn)
+	}
+	return db.ExecuteWithCircuitBreaker(ctx, func(ctx context.Context) error {
+		return db.query(ctx, db.Pool, fn)
+	})
+}
+
+// runRead runs the read-only fn against q, or else against the replica through its own
+// breaker when one is configured. Once the replica's breaker opens, reads fall back to
+// the primary until it lets calls through again.
+func (db *DB) runRead(ctx context.Context, q Querier, fn func(context.Context, Querier) error) error {
+	if q != nil || db.Replica == nil {
+		return db.run(ctx, q, fn)
+	}
+
+	err := db.ReplicaCircuitBreaker.Execute(ctx, func(ctx context.Context) error {
+		return db.query(ctx, db.Replica, fn)
+	})
+	if errors.Is(err, circuitbreaker.ErrCircuitBreakerOpen) {
+		return db.run(ctx, nil, fn)
+	}
+	return err
+}
+
+// runTx runs fn inside a transaction, begun from q when it can start one (a savepoint
+// when q is a transaction), or else from the primary pool
+func (db *DB) runTx(ctx context.Context, q Querier, fn func(context.Context, pgx.Tx) error) error {
+	if _, ok := q.(txBeginner); !ok {
+		q = nil
+	}
+	return db.run(ctx, q, func(ctx context.Context, q Querier) error {
+		return withTx(ctx, q.(txBeginner), func(tx pgx.Tx) error {
+			return fn(ctx, tx)
+		})
+	})
+}
+
+// query runs fn against q with the per-statement deadline, converting its error with
+// queryError so the breaker can tell an exhausted pool from a failing database
+func (db *DB) query(ctx context.Context, q Querier, fn func(context.Context, Querier) error) error {
+	ctx, cancel := db.queryContext(ctx)
+	defer cancel()
+
+	return queryError(ctx, fn(ctx, q))
+}
+
+// queryRows starts a read-only query, on the replica like runRead, whose rows are read
+// after the breaker's call returns, for streaming them with no time limit. On a pool
+// the query also runs exempt from the statement_timeout session setting, see
+// queryUnbounded; within a caller's transaction it stays bounded by it. Like
+// HTTPClient's response bodies, the query runs in its own context, which the breaker's
+// timeout cancels only until the query has started, and which is cancelled for good
+// once the rows are closed.
+func (db *DB) queryRows(ctx context.Context, q Querier, sql string, args ...any) (pgx.Rows, error) {
+	if q != nil {
+		return q.Query(ctx, sql, args...)
+	}
+	if db.Replica != nil {
+		rows, err := breakerRows(ctx, db.ReplicaCircuitBreaker, db.Replica, sql, args)
+		if !errors.Is(err, circuitbreaker.ErrCircuitBreakerOpen) {
+			return rows, err
+		}
+	}
+	return breakerRows(ctx, db.CircuitBreaker, db.Pool, sql, args)
+}
+
+// breakerRows implements queryRows against a pool guarded by cb
+func breakerRows(ctx context.Context, cb *circuitbreaker.CircuitBreaker, q Querier, sql string, args []any) (pgx.Rows, error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+
+	// Execute may stop waiting before the query starts, so the rows are handed over
+	// under a lock and closed by whichever side is left holding them
+	var (
+		mu        sync.Mutex
+		rows      pgx.Rows
+		abandoned bool
+	)
+	err := cb.Execute(ctx, func(callCtx context.Context) error {
+		stop := context.AfterFunc(callCtx, cancel)
+		started, err := queryUnbounded(streamCtx, q, sql, args)
+		stop()
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if abandoned {
+			started.Close()
+			return streamCtx.Err()
+		}
+		rows = started
+		return nil
+	})
+	if err != nil {
+		mu.Lock()
+		abandoned = true
+		if rows != nil {
+			rows.Close()
+		}
+		mu.Unlock()
+		cancel()
+		return nil, err
+	}
+
+	return &cancelOnClose{Rows: rows, cancel: cancel}, nil
+}
+
+// queryUnbounded runs a query with statement_timeout disabled, in a transaction so
+// the SET LOCAL can't leak to the pooled connection's next user. The transaction
+// ends when the rows are closed.
+func queryUnbounded(ctx context.Context, q Querier, sql string, args []any) (pgx.Rows, error) {
+	b, ok := q.(txBeginner)
+	if !ok {
+		return q.Query(ctx, sql, args...)
+	}
+	tx, err := b.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+		tx.Rollback(context.WithoutCancel(ctx))
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		tx.Rollback(context.WithoutCancel(ctx))
+		return nil, err
+	}
+	return &rollbackOnClose{Rows: rows, tx: tx, ctx: context.WithoutCancel(ctx)}, nil
+}
+
+// rollbackOnClose ends queryUnbounded's transaction once its rows are closed. Rolling
+// back is enough since nothing was written.
+type rollbackOnClose struct {
+	pgx.Rows
+	tx  pgx.Tx
+	ctx context.Context
+}
+
+func (r *rollbackOnClose) Close() {
+	r.Rows.Close()
+	r.tx.Rollback(r.ctx)
+}
+
+// cancelOnClose releases a streaming query's context once its rows are closed
+type cancelOnClose struct {
+	pgx.Rows
+	cancel context.CancelFunc
+}
+
+func (r *cancelOnClose) Close() {
+	r.Rows.Close()
+	r.cancel()
+}
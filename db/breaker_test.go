@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"htmx-learn/circuitbreaker"
+	"htmx-learn/validation"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestBreakerConfigIsFailure(t *testing.T) {
+	isFailure := breakerConfig(Options{}).IsFailure
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"connection error", errors.New("connection refused"), true},
+		{"query timeout", fmt.Errorf("%w: %w", ErrQueryTimeout, context.DeadlineExceeded), true},
+		{"server shutting down", &pgconn.PgError{Code: "57P01"}, true},
+		{"pool exhausted", fmt.Errorf("%w: %w", ErrPoolExhausted, context.DeadlineExceeded), false},
+		{"no rows", pgx.ErrNoRows, false},
+		{"duplicate email", fmt.Errorf("inserting: %w", &pgconn.PgError{Code: uniqueViolation}), false},
+		{"invalid input", &pgconn.PgError{Code: "22P02"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isFailure(tt.err); got != tt.expected {
+				t.Errorf("IsFailure(%v) = %v, expected %v", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBreakerConfigOutlastsQueryTimeout(t *testing.T) {
+	if got := breakerConfig(Options{}).FailureTimeout; got != circuitbreaker.DefaultConfig().FailureTimeout {
+		t.Errorf("FailureTimeout = %v, expected the default without a query timeout", got)
+	}
+	if got := breakerConfig(Options{QueryTimeout: 30 * time.Second}).FailureTimeout; got <= 30*time.Second {
+		t.Errorf("FailureTimeout = %v, expected it to outlast a 30s query timeout", got)
+	}
+}
+
+func TestStoresFailFastWhileBreakerOpen(t *testing.T) {
+	database, err := Open(Options{URL: "postgres://user@127.0.0.1:1/app", MaxConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	database.CircuitBreaker.Trip()
+
+	ctx := context.Background()
+	users := NewUserStore(database)
+	counter := NewCounterStore(database)
+	calls := map[string]func() error{
+		"Count": func() error { _, err := users.Count(ctx); return err },
+		"GetAllPaginated": func() error {
+			_, err := users.GetAllPaginated(ctx, NewPaginationParams(1, 10), UserFilter{})
+			return err
+		},
+		"ForEach": func() error { return users.ForEach(ctx, func(*User) error { return nil }) },
+		"Add":     func() error { _, err := users.Add(ctx, "Ada", "ada@example.com"); return err },
+		"AddMany": func() error {
+			_, err := users.AddMany(ctx, []validation.UserInput{{Name: "Ada", Email: "ada@example.com"}})
+			return err
+		},
+		"Delete":    func() error { return users.Delete(ctx, 1) },
+		"Get":       func() error { _, err := counter.Get(ctx); return err },
+		"Increment": func() error { _, err := counter.Increment(ctx); return err },
+		"History":   func() error { _, err := counter.History(ctx, 10); return err },
+		"WithTx":    func() error { return database.WithTx(ctx, func(pgx.Tx) error { return nil }) },
+	}
+
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, circuitbreaker.ErrCircuitBreakerOpen) {
+			t.Errorf("%s() error = %v, expected ErrCircuitBreakerOpen", name, err)
+		}
+	}
+}
+
+func TestUnreachableDatabaseOpensBreaker(t *testing.T) {
+	database, err := Open(Options{URL: "postgres://user@127.0.0.1:1/app?connect_timeout=1", MaxConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	users := NewUserStore(database)
+	for range circuitbreaker.DefaultConfig().MaxFailures {
+		if _, err := users.Count(context.Background()); err == nil {
+			t.Fatal("Count() succeeded against an unreachable database")
+		}
+	}
+
+	if state := database.CircuitBreaker.GetState(); state != circuitbreaker.StateOpen {
+		t.Errorf("breaker state = %v after repeated connection failures, expected open", state)
+	}
+	if _, err := users.Count(context.Background()); !errors.Is(err, circuitbreaker.ErrCircuitBreakerOpen) {
+		t.Errorf("Count() error = %v, expected ErrCircuitBreakerOpen", err)
+	}
+}
+
+func TestPoolExhaustionDoesNotOpenBreaker(t *testing.T) {
+	database, err := Open(Options{URL: "postgres://user@127.0.0.1:1/app", MaxConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	exhausted := func(context.Context, Querier) error {
+		return fmt.Errorf("%w: %w", ErrPoolExhausted, context.DeadlineExceeded)
+	}
+	for range circuitbreaker.DefaultConfig().MaxFailures * 2 {
+		if err := database.run(context.Background(), nil, exhausted); !errors.Is(err, ErrPoolExhausted) {
+			t.Fatalf("run() error = %v, expected ErrPoolExhausted", err)
+		}
+	}
+	if state := database.CircuitBreaker.GetState(); state != circuitbreaker.StateClosed {
+		t.Errorf("breaker state = %v after an exhausted pool, expected closed", state)
+	}
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"htmx-learn/validation"
+)
+
+// CachingUserRepository decorates a UserRepository, caching GetAll, Count and the
+// unfiltered first page of GetAllPaginated, which backs the capped user list, for a
+// short TTL. Any write through the decorator invalidates the cache immediately, so
+// staleness is bounded by the TTL only for writes made elsewhere (e.g. another
+// instance). Other pages, filtered pages and searches always pass through.
+type CachingUserRepository struct {
+	UserRepository
+	ttl time.Duration
+	now func() time.Time
+
+	mu         sync.Mutex
+	generation uint64
+	all        []*User
+	allExpires time.Time
+	count      int
+	countValid time.Time
+	firstPage  *PaginatedResult[*User]
+	pageValid  time.Time
+}
+
+// NewCachingUserRepository wraps repo with a read cache that expires after ttl
+func NewCachingUserRepository(repo UserRepository, ttl time.Duration) *CachingUserRepository {
+	return &CachingUserRepository{
+		UserRepository: repo,
+		ttl:            ttl,
+		now:            time.Now,
+	}
+}
+
+// GetAll returns the cached user list, reloading it once the TTL has passed
+func (c *CachingUserRepository) GetAll(ctx context.Context) ([]*User, error) {
+	c.mu.Lock()
+	if c.all != nil && c.now().Before(c.allExpires) {
+		users := append([]*User(nil), c.all...)
+		c.mu.Unlock()
+		return users, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	users, err := c.UserRepository.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	// A write that landed while we were reading makes this result stale already
+	if generation == c.generation {
+		c.all = append(make([]*User, 0, len(users)), users...)
+		c.allExpires = c.now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+
+	return users, nil
+}
+
+// Count returns the cached number of users, reloading it once the TTL has passed
+func (c *CachingUserRepository) Count(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	if c.now().Before(c.countValid) {
+		count := c.count
+		c.mu.Unlock()
+		return count, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	count, err := c.UserRepository.Count(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	if generation == c.generation {
+		c.count = count
+		c.countValid = c.now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+
+	return count, nil
+}
+
+// GetAllPaginated returns the cached first page when no filter is set and the cached
+// page has the requested size, reloading it once the TTL has passed
+func (c *CachingUserRepository) GetAllPaginated(ctx context.Context, params PaginationParams, filter UserFilter) (*PaginatedResult[*User], error) {
+	if params.Page != 1 || !filter.CreatedAfter.IsZero() || !filter.CreatedBefore.IsZero() {
+		return c.UserRepository.GetAllPaginated(ctx, params, filter)
+	}
+
+	c.mu.Lock()
+	if c.firstPage != nil && c.firstPage.PageSize == params.PageSize && c.now().Before(c.pageValid) {
+		page := *c.firstPage
+		page.Data = append([]*User(nil), c.firstPage.Data...)
+		c.mu.Unlock()
+		return &page, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	page, err := c.UserRepository.GetAllPaginated(ctx, params, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if generation == c.generation {
+		cached := *page
+		cached.Data = append(make([]*User, 0, len(page.Data)), page.Data...)
+		c.firstPage = &cached
+		c.pageValid = c.now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+
+	return page, nil
+}
+
+// Add creates a user and invalidates the cache
+func (c *CachingUserRepository) Add(ctx context.Context, name, email string) (*User, error) {
+	defer c.invalidate()
+	return c.UserRepository.Add(ctx, name, email)
+}
+
+// AddMany creates users and invalidates the cache
+func (c *CachingUserRepository) AddMany(ctx context.Context, inputs []validation.UserInput) ([]*User, error) {
+	defer c.invalidate()
+	return c.UserRepository.AddMany(ctx, inputs)
+}
+
+// Delete removes a user and invalidates the cache
+func (c *CachingUserRepository) Delete(ctx context.Context, id int) error {
+	defer c.invalidate()
+	return c.UserRepository.Delete(ctx, id)
+}
+
+// invalidate drops cached reads. It runs even when a write fails, since a failed
+// write may still have partially reached the database.
+func (c *CachingUserRepository) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.all = nil
+	c.allExpires = time.Time{}
+	c.countValid = time.Time{}
+	c.firstPage = nil
+	c.pageValid = time.Time{}
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// countingUserStore records how many reads reach the underlying store
+type countingUserStore struct {
+	*MemoryUserStore
+	getAllCalls int
+	countCalls  int
+	pageCalls   int
+}
+
+func (cs *countingUserStore) GetAll(ctx context.Context) ([]*User, error) {
+	cs.getAllCalls++
+	return cs.MemoryUserStore.GetAll(ctx)
+}
+
+func (cs *countingUserStore) Count(ctx context.Context) (int, error) {
+	cs.countCalls++
+	return cs.MemoryUserStore.Count(ctx)
+}
+
+func (cs *countingUserStore) GetAllPaginated(ctx context.Context, params PaginationParams, filter UserFilter) (*PaginatedResult[*User], error) {
+	cs.pageCalls++
+	return cs.MemoryUserStore.GetAllPaginated(ctx, params, filter)
+}
+
+func newTestCache(ttl time.Duration) (*CachingUserRepository, *countingUserStore, *time.Time) {
+	backing := &countingUserStore{MemoryUserStore: NewMemoryUserStore()}
+	cache := NewCachingUserRepository(backing, ttl)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	return cache, backing, &now
+}
+
+func TestCachingUserRepositoryStalenessBoundedByTTL(t *testing.T) {
+	ctx := context.Background()
+	cache, backing, now := newTestCache(time.Minute)
+
+	if _, err := cache.GetAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write that bypasses the decorator, e.g. from another instance
+	if _, err := backing.Add(ctx, "Ann", "ann@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	*now = now.Add(59 * time.Second)
+	users, _ := cache.GetAll(ctx)
+	count, _ := cache.Count(ctx)
+	if len(users) != 0 {
+		t.Errorf("got %d users within the TTL, expected the cached empty list", len(users))
+	}
+	if backing.getAllCalls != 1 {
+		t.Errorf("GetAll reached the store %d times, expected 1", backing.getAllCalls)
+	}
+
+	*now = now.Add(2 * time.Second)
+	users, _ = cache.GetAll(ctx)
+	if len(users) != 1 {
+		t.Errorf("got %d users after the TTL, expected 1", len(users))
+	}
+	if backing.getAllCalls != 2 {
+		t.Errorf("GetAll reached the store %d times, expected 2", backing.getAllCalls)
+	}
+
+	// Count was first loaded after the out-of-band write, so it's already current
+	if count != 1 {
+		t.Errorf("Count() = %d, expected 1", count)
+	}
+}
+
+func TestCachingUserRepositoryWritesInvalidate(t *testing.T) {
+	ctx := context.Background()
+	cache, backing, _ := newTestCache(time.Hour)
+
+	cache.GetAll(ctx)
+	cache.Count(ctx)
+
+	user, err := cache.Add(ctx, "Ann", "ann@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users, _ := cache.GetAll(ctx); len(users) != 1 {
+		t.Errorf("got %d users after Add, expected 1", len(users))
+	}
+	if count, _ := cache.Count(ctx); count != 1 {
+		t.Errorf("Count() = %d after Add, expected 1", count)
+	}
+
+	if err := cache.Delete(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if users, _ := cache.GetAll(ctx); len(users) != 0 {
+		t.Errorf("got %d users after Delete, expected 0", len(users))
+	}
+	if count, _ := cache.Count(ctx); count != 0 {
+		t.Errorf("Count() = %d after Delete, expected 0", count)
+	}
+
+	if backing.getAllCalls != 3 || backing.countCalls != 3 {
+		t.Errorf("store reads: GetAll %d, Count %d; expected 3 each", backing.getAllCalls, backing.countCalls)
+	}
+}
+
+func TestCachingUserRepositoryFirstPage(t *testing.T) {
+	ctx := context.Background()
+	cache, backing, now := newTestCache(time.Minute)
+	for i := range 3 {
+		if _, err := backing.Add(ctx, "User", fmt.Sprintf("user%d@example.com", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := PaginationParams{Page: 1, PageSize: 2}
+	page, _ := cache.GetAllPaginated(ctx, first, UserFilter{})
+	page.Data[0] = nil // callers may modify what they get back
+	if page, _ = cache.GetAllPaginated(ctx, first, UserFilter{}); page.Total != 3 || len(page.Data) != 2 || page.Data[0] == nil {
+		t.Errorf("cached page = %+v, expected 2 of 3 users", page)
+	}
+	if backing.pageCalls != 1 {
+		t.Errorf("first page reached the store %d times, expected 1", backing.pageCalls)
+	}
+
+	// Other pages, sizes and filtered pages are never served from the cache
+	cache.GetAllPaginated(ctx, PaginationParams{Page: 2, PageSize: 2, Offset: 2}, UserFilter{})
+	cache.GetAllPaginated(ctx, PaginationParams{Page: 1, PageSize: 3}, UserFilter{})
+	cache.GetAllPaginated(ctx, first, UserFilter{CreatedAfter: *now})
+	if backing.pageCalls != 4 {
+		t.Errorf("store reads = %d, expected the uncached pages to pass through", backing.pageCalls)
+	}
+
+	if _, err := cache.Add(ctx, "Ann", "ann@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	cache.GetAllPaginated(ctx, PaginationParams{Page: 1, PageSize: 3}, UserFilter{})
+	if page, _ := cache.GetAllPaginated(ctx, first, UserFilter{}); page.Total != 4 {
+		t.Errorf("Total = %d after Add, expected 4", page.Total)
+	}
+}
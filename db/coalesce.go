@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CoalescingUserRepository decorates a UserRepository so concurrent Count calls share
+// one in-flight query: a burst of pollers refreshing the count badge costs a single
+// SELECT COUNT(*) instead of one each. Nothing is kept once the query finishes, so
+// errors are never reused and the next call queries again; pair it with
+// CachingUserRepository to also reuse finished results.
+type CoalescingUserRepository struct {
+	UserRepository
+	group singleflight.Group
+}
+
+// NewCoalescingUserRepository wraps repo, coalescing concurrent counts
+func NewCoalescingUserRepository(repo UserRepository) *CoalescingUserRepository {
+	return &CoalescingUserRepository{UserRepository: repo}
+}
+
+// Count joins the count already in flight, or starts one. The shared query is
+// detached from the caller that started it, so that caller going away doesn't fail
+// the others; each caller still stops waiting when its own context ends.
+func (c *CoalescingUserRepository) Count(ctx context.Context) (int, error) {
+	results := c.group.DoChan("count", func() (interface{}, error) {
+		return c.UserRepository.Count(context.WithoutCancel(ctx))
+	})
+
+	select {
+	case result := <-results:
+		if result.Err != nil {
+			return 0, result.Err
+		}
+		return result.Val.(int), nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
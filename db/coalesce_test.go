@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+)
+
+// blockingCountStore holds every Count until release is closed, then fails with err
+// if set
+type blockingCountStore struct {
+	*MemoryUserStore
+	release chan struct{}
+	err     error
+	calls   atomic.Int32
+}
+
+func (s *blockingCountStore) Count(ctx context.Context) (int, error) {
+	s.calls.Add(1)
+	<-s.release
+	if s.err != nil {
+		return 0, s.err
+	}
+	return s.MemoryUserStore.Count(ctx)
+}
+
+// countConcurrently fires n Count calls at repo once all of them are waiting,
+// returning their results
+func countConcurrently(t *testing.T, repo UserRepository, store *blockingCountStore, n int) ([]int, []error) {
+	t.Helper()
+	counts := make([]int, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counts[i], errs[i] = repo.Count(context.Background())
+		}()
+	}
+
+	// Every caller is now blocked, either in the store or waiting on the shared query
+	synctest.Wait()
+	if got := store.calls.Load(); got != 1 {
+		t.Errorf("%d concurrent counts ran %d queries, expected 1", n, got)
+	}
+	close(store.release)
+	wg.Wait()
+	return counts, errs
+}
+
+func TestCoalescingUserRepositorySharesCount(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		store := &blockingCountStore{MemoryUserStore: NewMemoryUserStore(), release: make(chan struct{})}
+		for _, name := range []string{"Ann", "Bob", "Cat"} {
+			if _, err := store.Add(context.Background(), name, name+"@example.com"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		repo := NewCoalescingUserRepository(store)
+
+		counts, errs := countConcurrently(t, repo, store, 50)
+		for i := range counts {
+			if counts[i] != 3 || errs[i] != nil {
+				t.Fatalf("caller %d got %d, %v; expected 3", i, counts[i], errs[i])
+			}
+		}
+	})
+}
+
+func TestCoalescingUserRepositoryDoesNotKeepErrors(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		failure := errors.New("connection reset")
+		store := &blockingCountStore{MemoryUserStore: NewMemoryUserStore(), release: make(chan struct{}), err: failure}
+		repo := NewCoalescingUserRepository(store)
+
+		_, errs := countConcurrently(t, repo, store, 10)
+		for i, err := range errs {
+			if !errors.Is(err, failure) {
+				t.Fatalf("caller %d got error %v, expected the shared failure", i, err)
+			}
+		}
+
+		store.err = nil
+		if _, err := repo.Count(context.Background()); err != nil {
+			t.Errorf("Count() after a failure = %v, expected a fresh query to succeed", err)
+		}
+		if got := store.calls.Load(); got != 2 {
+			t.Errorf("store saw %d queries, expected the failure not to be reused", got)
+		}
+	})
+}
+
+func TestCoalescingUserRepositoryCallerCancellation(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		store := &blockingCountStore{MemoryUserStore: NewMemoryUserStore(), release: make(chan struct{})}
+		repo := NewCoalescingUserRepository(store)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		leader := make(chan error, 1)
+		go func() {
+			_, err := repo.Count(ctx)
+			leader <- err
+		}()
+		synctest.Wait()
+
+		follower := make(chan error, 1)
+		go func() {
+			_, err := repo.Count(context.Background())
+			follower <- err
+		}()
+		synctest.Wait()
+
+		// The caller that started the query leaving must not fail the one still waiting
+		cancel()
+		if err := <-leader; !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled caller got %v, expected context.Canceled", err)
+		}
+		close(store.release)
+		if err := <-follower; err != nil {
+			t.Errorf("waiting caller got %v, expected the shared count", err)
+		}
+	})
+}
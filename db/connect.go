@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Backoff bounds the delay between connection attempts; it doubles after each failure
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// DefaultBackoff retries quickly at first and settles at twice a minute
+var DefaultBackoff = Backoff{Initial: time.Second, Max: 30 * time.Second}
+
+// next returns the delay to use after waiting delay
+func (b Backoff) next(delay time.Duration) time.Duration {
+	return min(delay*2, b.Max)
+}
+
+// ConnectWithRetry waits for the database to come up and applies the schema at path,
+// retrying with backoff until it succeeds or ctx is cancelled. It lets the server start
+// during a database outage and report not-ready until Ready turns true. A schema file
+// that can't be loaded is a configuration problem and is returned without retrying.
+func (db *DB) ConnectWithRetry(ctx context.Context, path string, backoff Backoff) error {
+	schemaSQL, err := loadSchema(path)
+	if err != nil {
+		return err
+	}
+
+	delay := backoff.Initial
+	for attempt := 1; ; attempt++ {
+		err := db.Ping(ctx)
+		if err == nil {
+			err = db.applySchema(ctx, schemaSQL)
+		}
+		if err == nil {
+			slog.Info("Database connected", "attempts", attempt)
+			return nil
+		}
+
+		slog.Warn("Database not available, retrying", "attempt", attempt, "retry_in", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = backoff.next(delay)
+	}
+}
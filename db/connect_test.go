@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffNext(t *testing.T) {
+	backoff := Backoff{Initial: time.Second, Max: 5 * time.Second}
+
+	var delays []time.Duration
+	delay := backoff.Initial
+	for range 5 {
+		delays = append(delays, delay)
+		delay = backoff.next(delay)
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i := range expected {
+		if delays[i] != expected[i] {
+			t.Errorf("delay %d = %v, expected %v", i, delays[i], expected[i])
+		}
+	}
+}
+
+func TestConnectWithRetryUnreachable(t *testing.T) {
+	// Nothing listens on port 1, so every ping fails fast
+	db, err := Open(Options{URL: "postgres://user@127.0.0.1:1/app?connect_timeout=1", MaxConns: 2})
+	if err != nil {
+		t.Fatalf("Open() should not contact the database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err = db.ConnectWithRetry(ctx, DefaultSchemaPath, Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ConnectWithRetry() error = %v, expected context.DeadlineExceeded", err)
+	}
+	if db.Ready() {
+		t.Error("Ready() = true before the schema was applied")
+	}
+}
+
+func TestConnectWithRetryBadSchemaPath(t *testing.T) {
+	db, err := Open(Options{URL: "postgres://user@127.0.0.1:1/app", MaxConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.ConnectWithRetry(context.Background(), "does/not/exist.sql", DefaultBackoff)
+	if err == nil {
+		t.Error("ConnectWithRetry() should fail immediately on a missing schema file")
+	}
+}
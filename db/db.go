@@ -2,90 +2,332 @@ package db
 
 import (
 	"context"
+	_ "embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"time"
 
 	"htmx-learn/circuitbreaker"
+	"htmx-learn/metrics"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrQueryTimeout is returned when a single statement exceeds the configured query timeout.
+// It is deliberately distinct from pgx.ErrNoRows so callers and the circuit breaker treat
+// it as a failure rather than an empty result.
+var ErrQueryTimeout = errors.New("database query timed out")
+
+// ErrPoolExhausted is returned when the caller's deadline passed while waiting for a
+// pool connection because every connection was in use. That is load on this instance
+// rather than a database outage, so the circuit breakers don't count it and health
+// checks report it as degraded.
+var ErrPoolExhausted = errors.New("database connection pool exhausted")
+
+// ErrDuplicateEmail is returned when creating a user whose email is already taken
+var ErrDuplicateEmail = errors.New("a user with this email already exists")
+
+// uniqueViolation is PostgreSQL's SQLSTATE for a unique constraint violation
+const uniqueViolation = "23505"
+
+// userWriteError maps a unique violation on users to ErrDuplicateEmail, since email
+// is the only unique user column
+func userWriteError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: %w", ErrDuplicateEmail, err)
+	}
+	return err
+}
+
 // DB holds the database connection pool and circuit breaker
 type DB struct {
 	*pgxpool.Pool
 	CircuitBreaker *circuitbreaker.CircuitBreaker
+
+	// Replica serves the user stores' read-only queries when a replica URL is configured,
+	// guarded by its own breaker; nil sends every query to the primary Pool. Replication
+	// is asynchronous, so a user just created may briefly be missing from replica reads.
+	Replica               *pgxpool.Pool
+	ReplicaCircuitBreaker *circuitbreaker.CircuitBreaker
+
+	// QueryTimeout bounds each individual statement issued by the stores (0 disables)
+	QueryTimeout time.Duration
+
+	// totals caches the totals of paginated user listings (nil disables), and
+	// estimateTotals takes large unfiltered totals from planner statistics
+	totals         *totalCache
+	estimateTotals bool
+
+	ready atomic.Bool
 }
 
-// New creates a new database connection pool with configurable pool settings
-func New(databaseURL string, maxConns, minConns int32) (*DB, error) {
-	config, err := pgxpool.ParseConfig(databaseURL)
+// Options configures the database connection pools
+type Options struct {
+	URL          string
+	ReplicaURL   string // optional read replica
+	MaxConns     int32
+	MinConns     int32
+	QueryTimeout time.Duration
+	// Session settings applied to every connection; zero values leave the server's
+	// defaults. ApplicationName identifies us in pg_stat_activity.
+	StatementTimeout time.Duration
+	ApplicationName  string
+	SearchPath       string
+	// DataTypes names custom Postgres types, such as enums or composites, to load and
+	// register on every connection so they scan into Go values
+	DataTypes []string
+
+	// CountCacheTTL caches the totals of paginated user listings per filter set (0
+	// disables); CountMode is CountModeExact or CountModeEstimate
+	CountCacheTTL time.Duration
+	CountMode     string
+}
+
+// New creates the connection pools with configurable pool settings and verifies the
+// databases are reachable
+func New(opts Options) (*DB, error) {
+	db, err := Open(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse database URL: %w", err)
+		return nil, err
 	}
 
-	// Set connection pool settings
-	config.MaxConns = maxConns
-	config.MinConns = minConns
-
 	// Use context with timeout for initialization
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	pool, err := pgxpool.NewWithConfig(ctx, config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create connection pool: %w", err)
-	}
-
 	// Test the connection
-	if err := pool.Ping(ctx); err != nil {
+	if err := db.Ping(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
+	if db.Replica != nil {
+		if err := db.Replica.Ping(ctx); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to ping replica database: %w", err)
+		}
+	}
+
+	return db, nil
+}
 
-	// Initialize circuit breaker
-	cb := circuitbreaker.New(circuitbreaker.DefaultConfig())
+// Open creates the connection pools without checking that the databases are reachable;
+// connections are established lazily, so it only fails on invalid configuration
+func Open(opts Options) (*DB, error) {
+	pool, err := newPool(opts.URL, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	return &DB{
+	db := &DB{
 		Pool:           pool,
-		CircuitBreaker: cb,
-	}, nil
+		CircuitBreaker: circuitbreaker.New(breakerConfig(opts)),
+		QueryTimeout:   opts.QueryTimeout,
+		totals:         newTotalCache(opts.CountCacheTTL),
+		estimateTotals: opts.CountMode == CountModeEstimate,
+	}
+
+	if opts.ReplicaURL != "" {
+		replica, err := newPool(opts.ReplicaURL, opts)
+		if err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("replica: %w", err)
+		}
+		db.Replica = replica
+		db.ReplicaCircuitBreaker = circuitbreaker.New(breakerConfig(opts))
+	}
+
+	return db, nil
+}
+
+// breakerConfig is the circuit breaker configuration for a pool. Waiting out a busy
+// pool says nothing about the database's health, and neither does a missing row or a
+// statement the database rejected, such as a duplicate email, so those don't count as
+// failures. A statement running into QueryTimeout should fail as ErrQueryTimeout, so
+// the breaker waits a little longer than that before giving up on it.
+func breakerConfig(opts Options) circuitbreaker.Config {
+	cfg := circuitbreaker.DefaultConfig()
+	cfg.IsFailure = func(err error) bool {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			return !rejectedStatement(pgErr)
+		}
+		return !errors.Is(err, ErrPoolExhausted) && !errors.Is(err, pgx.ErrNoRows)
+	}
+	if opts.QueryTimeout > 0 {
+		cfg.FailureTimeout = max(cfg.FailureTimeout, opts.QueryTimeout+time.Second)
+	}
+	return cfg
+}
+
+// rejectedStatement reports whether the database refused a statement because of the
+// data it was given (SQLSTATE classes 22 and 23) rather than because it is unwell
+func rejectedStatement(pgErr *pgconn.PgError) bool {
+	class := pgErr.Code[:min(2, len(pgErr.Code))]
+	return class == "22" || class == "23"
+}
+
+// Acquire takes a connection from pool like pgxpool.Pool.Acquire, but reports running
+// out of time while every connection was in use as ErrPoolExhausted
+func Acquire(ctx context.Context, pool *pgxpool.Pool) (*pgxpool.Conn, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil && poolExhausted(pool, err) {
+		return nil, fmt.Errorf("%w: %w", ErrPoolExhausted, err)
+	}
+	return conn, err
+}
+
+// poolExhausted reports whether err, from acquiring a connection from pool, is a
+// deadline that passed while every connection was in use. A cancelled caller, or a
+// deadline passing while connecting, is not exhaustion.
+func poolExhausted(pool *pgxpool.Pool, err error) bool {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	stat := pool.Stat()
+	return stat.AcquiredConns() >= stat.MaxConns()
+}
+
+// newPool creates a connection pool for databaseURL using the pool settings in opts
+func newPool(databaseURL string, opts Options) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database URL: %w", err)
+	}
+
+	// Set connection pool settings
+	config.MaxConns = opts.MaxConns
+	config.MinConns = opts.MinConns
+	config.ConnConfig.Tracer = &acquireTracer{wait: metrics.DBPoolAcquireWait}
+	config.AfterConnect = afterConnect(opts)
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+	return pool, nil
+}
+
+// Ready reports whether the schema has been applied and the database can serve requests
+func (db *DB) Ready() bool {
+	return db.ready.Load()
+}
+
+// queryContext derives a child context carrying the per-statement deadline so a stuck
+// query is cancelled at the pgx level instead of consuming the circuit breaker's budget.
+// It also lets queryError tell a pool that ran out of connections from a slow query.
+func (db *DB) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = trackAcquire(ctx)
+	if db.QueryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, db.QueryTimeout)
+}
+
+// queryError converts errors caused by an expired query context into ErrQueryTimeout,
+// or into ErrPoolExhausted when the time ran out waiting for a connection
+func queryError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if acquireExhausted(ctx) {
+		return fmt.Errorf("%w: %w", ErrPoolExhausted, err)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || pgconn.Timeout(err) {
+		return fmt.Errorf("%w: %w", ErrQueryTimeout, err)
+	}
+	return err
 }
 
 const (
 	// Maximum schema file size (1MB) to prevent memory exhaustion
 	maxSchemaFileSize = 1024 * 1024
+
+	// DefaultSchemaPath is where the schema lives relative to the repo root
+	DefaultSchemaPath = "db/schema.sql"
 )
 
-// InitSchema initializes the database schema with size limits for security
-func (db *DB) InitSchema(ctx context.Context) error {
+// embeddedSchema is compiled in so the binary can initialize the database from any directory
+//
+//go:embed schema.sql
+var embeddedSchema string
+
+// InitSchema applies the schema at path, with size limits for security, and marks the
+// database ready
+func (db *DB) InitSchema(ctx context.Context, path string) error {
+	schemaSQL, err := loadSchema(path)
+	if err != nil {
+		return err
+	}
+
+	return db.applySchema(ctx, schemaSQL)
+}
+
+// applySchema executes schemaSQL, prepares the hot-path statements and marks the
+// database ready
+func (db *DB) applySchema(ctx context.Context, schemaSQL string) error {
+	if _, err := db.Exec(ctx, schemaSQL); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+
+	// Only a warm-up, so a failure costs the first requests some latency and no more
+	if err := db.PrepareStatements(ctx); err != nil {
+		slog.Warn("Failed to prepare statements", "error", err)
+	}
+
+	db.ready.Store(true)
+	return nil
+}
+
+// loadSchema reads the schema at path. If the default path is missing, which is what
+// happens when the binary runs outside the repo root, the embedded copy is used instead;
+// a missing explicitly configured path is an error naming where it looked.
+func loadSchema(path string) (string, error) {
 	// Check file size before reading to prevent memory exhaustion attacks
-	fileInfo, err := os.Stat("db/schema.sql")
+	fileInfo, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if path == DefaultSchemaPath {
+			return embeddedSchema, nil
+		}
+		absPath, absErr := filepath.Abs(path)
+		if absErr != nil {
+			absPath = path
+		}
+		return "", fmt.Errorf("schema file not found at %s: set SCHEMA_PATH to the location of schema.sql", absPath)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to stat schema file: %w", err)
+		return "", fmt.Errorf("failed to stat schema file: %w", err)
 	}
 
 	if fileInfo.Size() > maxSchemaFileSize {
-		return fmt.Errorf("schema file too large: %d bytes (max %d bytes)", 
+		return "", fmt.Errorf("schema file too large: %d bytes (max %d bytes)", 
 			fileInfo.Size(), maxSchemaFileSize)
 	}
 
-	schemaSQL, err := os.ReadFile("db/schema.sql")
+	schemaSQL, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to read schema file: %w", err)
+		return "", fmt.Errorf("failed to read schema file: %w", err)
 	}
 
-	if _, err := db.Exec(ctx, string(schemaSQL)); err != nil {
-		return fmt.Errorf("failed to execute schema: %w", err)
-	}
-
-	return nil
+	return string(schemaSQL), nil
 }
 
-// ExecuteWithCircuitBreaker executes a database operation with circuit breaker protection
+// ExecuteWithCircuitBreaker executes a database operation with circuit breaker protection.
+// The stores run every query on the primary pool through it.
 func (db *DB) ExecuteWithCircuitBreaker(ctx context.Context, operation func(context.Context) error) error {
 	return db.CircuitBreaker.Execute(ctx, operation)
 }
 
-// Close closes the database connection pool
+// Close closes the database connection pools
 func (db *DB) Close() {
 	db.Pool.Close()
+	if db.Replica != nil {
+		db.Replica.Close()
+	}
 }
\ No newline at end of file
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"htmx-learn/circuitbreaker"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestQueryContext(t *testing.T) {
+	t.Run("timeout disabled", func(t *testing.T) {
+		db := &DB{}
+		ctx, cancel := db.queryContext(context.Background())
+		defer cancel()
+
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("expected no deadline when QueryTimeout is 0")
+		}
+	})
+
+	t.Run("timeout configured", func(t *testing.T) {
+		db := &DB{QueryTimeout: time.Second}
+		ctx, cancel := db.queryContext(context.Background())
+		defer cancel()
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatal("expected a deadline when QueryTimeout is set")
+		}
+		if remaining := time.Until(deadline); remaining > time.Second {
+			t.Errorf("deadline %v exceeds the configured timeout", remaining)
+		}
+	})
+}
+
+func TestQueryError(t *testing.T) {
+	t.Run("nil error", func(t *testing.T) {
+		if err := queryError(context.Background(), nil); err != nil {
+			t.Errorf("queryError(nil) = %v, expected nil", err)
+		}
+	})
+
+	t.Run("expired query context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+		<-ctx.Done()
+
+		err := queryError(ctx, ctx.Err())
+		if !errors.Is(err, ErrQueryTimeout) {
+			t.Errorf("expected ErrQueryTimeout, got %v", err)
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			t.Error("timeout error must not be reported as pgx.ErrNoRows")
+		}
+	})
+
+	t.Run("no rows is preserved", func(t *testing.T) {
+		err := queryError(context.Background(), pgx.ErrNoRows)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected pgx.ErrNoRows, got %v", err)
+		}
+		if errors.Is(err, ErrQueryTimeout) {
+			t.Error("pgx.ErrNoRows must not be reported as a timeout")
+		}
+	})
+}
+
+func TestLoadSchema(t *testing.T) {
+	t.Run("configured file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "schema.sql")
+		if err := os.WriteFile(path, []byte("SELECT 1;"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		schema, err := loadSchema(path)
+		if err != nil {
+			t.Fatalf("loadSchema() unexpected error: %v", err)
+		}
+		if schema != "SELECT 1;" {
+			t.Errorf("loadSchema() = %q, expected file contents", schema)
+		}
+	})
+
+	t.Run("missing default path falls back to embedded schema", func(t *testing.T) {
+		// Tests run from the db directory, where db/schema.sql doesn't resolve
+		schema, err := loadSchema(DefaultSchemaPath)
+		if err != nil {
+			t.Fatalf("loadSchema() unexpected error: %v", err)
+		}
+		if !strings.Contains(schema, "CREATE TABLE IF NOT EXISTS users") {
+			t.Error("expected the embedded schema")
+		}
+	})
+
+	t.Run("missing configured path names the absolute path", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := loadSchema(filepath.Join(dir, "missing.sql"))
+		if err == nil {
+			t.Fatal("expected an error for a missing schema file")
+		}
+		if !strings.Contains(err.Error(), filepath.Join(dir, "missing.sql")) {
+			t.Errorf("error %q does not name the absolute path", err)
+		}
+	})
+
+	t.Run("oversized file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "schema.sql")
+		if err := os.WriteFile(path, make([]byte, maxSchemaFileSize+1), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := loadSchema(path); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("loadSchema() error = %v, expected size limit error", err)
+		}
+	})
+}
+
+func TestUserWriteError(t *testing.T) {
+	duplicate := &pgconn.PgError{Code: uniqueViolation, ConstraintName: "users_email_key"}
+	if err := userWriteError(duplicate); !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("unique violation mapped to %v, expected ErrDuplicateEmail", err)
+	}
+
+	other := &pgconn.PgError{Code: "23502"}
+	if err := userWriteError(other); errors.Is(err, ErrDuplicateEmail) {
+		t.Error("not-null violation must not be reported as a duplicate email")
+	}
+}
+
+func TestReplicaReadRouting(t *testing.T) {
+	db, err := Open(Options{
+		URL:        "postgres://user@127.0.0.1:1/app",
+		ReplicaURL: "postgres://user@127.0.0.1:2/app",
+		MaxConns:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.ReplicaCircuitBreaker == db.CircuitBreaker {
+		t.Fatal("the replica should have its own circuit breaker")
+	}
+
+	ctx := context.Background()
+	users := NewUserStore(db)
+
+	// With the primary tripped, reads that still reach a database went to the replica
+	db.CircuitBreaker.Trip()
+	for range circuitbreaker.DefaultConfig().MaxFailures {
+		if _, err := users.Count(ctx); err == nil || errors.Is(err, circuitbreaker.ErrCircuitBreakerOpen) {
+			t.Fatalf("Count() error = %v, expected the replica's connection error", err)
+		}
+	}
+	if state := db.ReplicaCircuitBreaker.GetState(); state != circuitbreaker.StateOpen {
+		t.Fatalf("replica breaker state = %v after repeated failures, expected open", state)
+	}
+	if failures := db.CircuitBreaker.Stats().Failures; failures != 0 {
+		t.Errorf("primary breaker failures = %d, expected replica failures not to count", failures)
+	}
+
+	// Now reads fall back to the primary, whose breaker answers for them
+	if _, err := users.Count(ctx); !errors.Is(err, circuitbreaker.ErrCircuitBreakerOpen) {
+		t.Errorf("Count() error = %v, expected the primary's ErrCircuitBreakerOpen", err)
+	}
+	if err := users.ForEach(ctx, func(*User) error { return nil }); !errors.Is(err, circuitbreaker.ErrCircuitBreakerOpen) {
+		t.Errorf("ForEach() error = %v, expected the primary's ErrCircuitBreakerOpen", err)
+	}
+}
+
+func TestReplicaTripFallsBackToPrimary(t *testing.T) {
+	db, err := Open(Options{
+		URL:        "postgres://user@127.0.0.1:1/app",
+		ReplicaURL: "postgres://user@127.0.0.1:2/app",
+		MaxConns:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.ReplicaCircuitBreaker.Trip()
+	if _, err := NewUserStore(db).Count(context.Background()); err == nil {
+		t.Fatal("Count() succeeded against an unreachable primary")
+	}
+	if failures := db.CircuitBreaker.Stats().Failures; failures != 1 {
+		t.Errorf("primary breaker failures = %d, expected the read to have gone to the primary", failures)
+	}
+	if db.CircuitBreaker.GetState() != circuitbreaker.StateClosed {
+		t.Error("tripping the replica breaker should not affect the primary")
+	}
+}
+
+func TestOpenInvalidReplicaURL(t *testing.T) {
+	_, err := Open(Options{URL: "postgres://user@127.0.0.1:1/app", ReplicaURL: "://bad", MaxConns: 2})
+	if err == nil || !strings.Contains(err.Error(), "replica") {
+		t.Errorf("Open() error = %v, expected a replica configuration error", err)
+	}
+}
+
+func TestSessionParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []sessionParam
+	}{
+		{"unset leaves the server defaults", Options{}, nil},
+		{
+			"all settings", Options{ApplicationName: "htmx-learn", StatementTimeout: 30 * time.Second, SearchPath: "app, public"},
+			[]sessionParam{{"application_name", "htmx-learn"}, {"statement_timeout", "30000"}, {"search_path", "app, public"}},
+		},
+		{"fractional milliseconds round up", Options{StatementTimeout: 1500 * time.Microsecond}, []sessionParam{{"statement_timeout", "2"}}},
+		{"below a millisecond stays enabled", Options{StatementTimeout: time.Microsecond}, []sessionParam{{"statement_timeout", "1"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sessionParams(tt.opts); !slices.Equal(got, tt.expected) {
+				t.Errorf("sessionParams() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOpenInstallsAfterConnect(t *testing.T) {
+	db, err := Open(Options{URL: "postgres://user@127.0.0.1:1/app", ReplicaURL: "postgres://user@127.0.0.1:2/app", MaxConns: 2, ApplicationName: "htmx-learn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for name, pool := range map[string]*pgxpool.Pool{"primary": db.Pool, "replica": db.Replica} {
+		if pool.Config().AfterConnect == nil {
+			t.Errorf("%s pool has no AfterConnect hook", name)
+		}
+	}
+}
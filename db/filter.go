@@ -0,0 +1,105 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UserFilter narrows user listings to a creation time window. A zero bound is open.
+type UserFilter struct {
+	// CreatedAfter is inclusive: users created at exactly this instant match
+	CreatedAfter time.Time
+	// CreatedBefore is exclusive so consecutive windows never overlap
+	CreatedBefore time.Time
+}
+
+// Matches reports whether createdAt falls inside the window
+func (f UserFilter) Matches(createdAt time.Time) bool {
+	if !f.CreatedAfter.IsZero() && createdAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !createdAt.Before(f.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// filterColumns are the columns whereBuilder accepts in predicates
+var filterColumns = map[string]bool{"name": true, "email": true, "created_at": true}
+
+// filterOperators are the comparisons whereBuilder accepts
+var filterOperators = map[string]bool{"=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// searchColumns are the columns a search term is matched against
+var searchColumns = []string{"name", "email"}
+
+// whereBuilder composes the WHERE clause of a user query. Columns and operators come
+// from whitelists and every value is bound to a numbered placeholder, so caller input
+// never reaches the SQL text. Predicates are ANDed in the order they're added.
+type whereBuilder struct {
+	conds []string
+	args  []any
+}
+
+// bind adds value to the arguments and returns its placeholder
+func (b *whereBuilder) bind(value any) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// mustFilterColumn panics unless column is whitelisted; only code, never user input,
+// chooses columns, so an unknown one is a programming error
+func mustFilterColumn(column string) {
+	if !filterColumns[column] {
+		panic(fmt.Sprintf("db: column %q is not filterable", column))
+	}
+}
+
+// compare adds "column op value"
+func (b *whereBuilder) compare(column, op string, value any) *whereBuilder {
+	mustFilterColumn(column)
+	if !filterOperators[op] {
+		panic(fmt.Sprintf("db: operator %q is not allowed in filters", op))
+	}
+	b.conds = append(b.conds, column+" "+op+" "+b.bind(value))
+	return b
+}
+
+// contains adds a case-insensitive match of text anywhere in any of columns. LIKE
+// wildcards in text match literally, and the columns share one placeholder.
+func (b *whereBuilder) contains(text string, columns ...string) *whereBuilder {
+	placeholder := b.bind(containsPattern(text))
+	matches := make([]string, len(columns))
+	for i, column := range columns {
+		mustFilterColumn(column)
+		matches[i] = column + " ILIKE " + placeholder + ` ESCAPE '\'`
+	}
+	b.conds = append(b.conds, "("+strings.Join(matches, " OR ")+")")
+	return b
+}
+
+// matchesWords adds a full-text match of every word in text against search_vector
+func (b *whereBuilder) matchesWords(text string) *whereBuilder {
+	b.conds = append(b.conds, "search_vector @@ plainto_tsquery('simple', "+b.bind(text)+")")
+	return b
+}
+
+// applyFilters adds f's predicates
+func (b *whereBuilder) applyFilters(f UserFilter) *whereBuilder {
+	if !f.CreatedAfter.IsZero() {
+		b.compare("created_at", ">=", f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		b.compare("created_at", "<", f.CreatedBefore)
+	}
+	return b
+}
+
+// where returns the predicates joined into a WHERE clause, or "" when there are none
+func (b *whereBuilder) where() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUserFilterMatches(t *testing.T) {
+	after := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		filter    UserFilter
+		createdAt time.Time
+		expected  bool
+	}{
+		{"open filter", UserFilter{}, after, true},
+		{"exactly at after is included", UserFilter{CreatedAfter: after}, after, true},
+		{"just before after is excluded", UserFilter{CreatedAfter: after}, after.Add(-time.Nanosecond), false},
+		{"exactly at before is excluded", UserFilter{CreatedBefore: before}, before, false},
+		{"just before before is included", UserFilter{CreatedBefore: before}, before.Add(-time.Nanosecond), true},
+		{"inside window", UserFilter{CreatedAfter: after, CreatedBefore: before}, after.Add(time.Hour), true},
+		{"empty window", UserFilter{CreatedAfter: after, CreatedBefore: after}, after, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(tt.createdAt); got != tt.expected {
+				t.Errorf("Matches(%v) = %v, expected %v", tt.createdAt, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWhereBuilder(t *testing.T) {
+	after := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		builder       *whereBuilder
+		expectedWhere string
+		expectedArgs  []any
+	}{
+		{"no filters", new(whereBuilder).applyFilters(UserFilter{}), "", nil},
+		{
+			"after only",
+			new(whereBuilder).applyFilters(UserFilter{CreatedAfter: after}),
+			" WHERE created_at >= $1",
+			[]any{after},
+		},
+		{
+			"before only",
+			new(whereBuilder).applyFilters(UserFilter{CreatedBefore: before}),
+			" WHERE created_at < $1",
+			[]any{before},
+		},
+		{
+			"search term alone",
+			new(whereBuilder).contains("jo", searchColumns...),
+			` WHERE (name ILIKE $1 ESCAPE '\' OR email ILIKE $1 ESCAPE '\')`,
+			[]any{"%jo%"},
+		},
+		{
+			"search term escapes wildcards",
+			new(whereBuilder).contains("50%_off", "name"),
+			` WHERE (name ILIKE $1 ESCAPE '\')`,
+			[]any{`%50\%\_off%`},
+		},
+		{
+			"both bounds after a search term",
+			new(whereBuilder).contains("jo", searchColumns...).applyFilters(UserFilter{CreatedAfter: after, CreatedBefore: before}),
+			` WHERE (name ILIKE $1 ESCAPE '\' OR email ILIKE $1 ESCAPE '\') AND created_at >= $2 AND created_at < $3`,
+			[]any{"%jo%", after, before},
+		},
+		{
+			"full-text words with a bound",
+			new(whereBuilder).matchesWords("jane smith").applyFilters(UserFilter{CreatedBefore: before}),
+			" WHERE search_vector @@ plainto_tsquery('simple', $1) AND created_at < $2",
+			[]any{"jane smith", before},
+		},
+		{
+			"explicit comparison",
+			new(whereBuilder).compare("email", "=", "jane@example.com"),
+			" WHERE email = $1",
+			[]any{"jane@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.builder.where(); got != tt.expectedWhere {
+				t.Errorf("where = %q, expected %q", got, tt.expectedWhere)
+			}
+			if !reflect.DeepEqual(tt.builder.args, tt.expectedArgs) {
+				t.Errorf("args = %v, expected %v", tt.builder.args, tt.expectedArgs)
+			}
+		})
+	}
+}
+
+func TestWhereBuilderRejectsUnlistedSQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(b *whereBuilder)
+	}{
+		{"unknown column", func(b *whereBuilder) { b.compare("password_hash", "=", "x") }},
+		{"injected column", func(b *whereBuilder) { b.compare("name = name OR 1", "=", 1) }},
+		{"unknown operator", func(b *whereBuilder) { b.compare("name", "<> '' OR 1 =", 1) }},
+		{"unknown search column", func(b *whereBuilder) { b.contains("jo", "name", "secret") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			tt.build(&whereBuilder{})
+		})
+	}
+}
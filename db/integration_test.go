@@ -0,0 +1,406 @@
+//go:build integration
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+// postgresImage matches the PostgreSQL version docker-compose.yml runs
+const postgresImage = "postgres:16-alpine"
+
+// containerURL is the connection URL of the PostgreSQL container TestMain starts, and
+// containerErr why it couldn't be started, e.g. because Docker isn't available
+var (
+	containerURL string
+	containerErr error
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runWithPostgres(m))
+}
+
+// runWithPostgres starts a PostgreSQL container for the integration tests, runs them
+// and removes the container. Without Docker the tests still run, and skip themselves.
+func runWithPostgres(m *testing.M) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	container, err := startPostgres(ctx)
+	if err != nil {
+		containerErr = err
+		return m.Run()
+	}
+	defer func() {
+		if err := testcontainers.TerminateContainer(container); err != nil {
+			log.Printf("failed to remove the PostgreSQL container: %v", err)
+		}
+	}()
+
+	containerURL, containerErr = container.ConnectionString(ctx, "sslmode=disable")
+	return m.Run()
+}
+
+// startPostgres starts the PostgreSQL container. testcontainers panics when it can't
+// find a Docker host at all, which is reported like any other failure to start.
+func startPostgres(ctx context.Context) (container *postgres.PostgresContainer, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("no Docker host: %v", r)
+		}
+	}()
+
+	return postgres.Run(ctx, postgresImage,
+		postgres.WithDatabase("htmx_learn"),
+		postgres.WithUsername("user"),
+		postgres.WithPassword("password"),
+		postgres.BasicWaitStrategies(),
+	)
+}
+
+// integrationURL returns the URL of the PostgreSQL container, skipping t when there is none
+func integrationURL(t *testing.T) string {
+	t.Helper()
+	if containerErr != nil {
+		t.Skipf("PostgreSQL container unavailable: %v", containerErr)
+	}
+	return containerURL
+}
+
+// newIntegrationDB connects to the PostgreSQL container and applies the schema inside
+// a throwaway PostgreSQL schema, so the tests don't see each other's tables. The
+// sample users the schema inserts are removed.
+func newIntegrationDB(t *testing.T) *DB {
+	t.Helper()
+	databaseURL := integrationURL(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	admin, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close(ctx)
+
+	schema := fmt.Sprintf("integration_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		conn, err := pgx.Connect(ctx, databaseURL)
+		if err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+			return
+		}
+		defer conn.Close(ctx)
+		if _, err := conn.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	// pgx sends unrecognised URL parameters as session settings
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	db, err := New(Options{URL: u.String(), MaxConns: 4, QueryTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	if err := db.InitSchema(ctx, DefaultSchemaPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, "TRUNCATE users"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestIntegrationUserStore(t *testing.T) {
+	db := newIntegrationDB(t)
+	store := NewUserStore(db)
+	ctx := context.Background()
+
+	jane, err := store.Add(ctx, "Jane Smith", "jane@example.com")
+	if err != nil {
+		t.Fatalf("Add() unexpected error: %v", err)
+	}
+	if jane.ID == 0 || jane.Name != "Jane Smith" || jane.Email != "jane@example.com" || jane.CreatedAt.IsZero() {
+		t.Errorf("Add() = %+v, expected the columns scanned in order", jane)
+	}
+
+	if _, err := store.Add(ctx, "Other Jane", "jane@example.com"); !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("Add() duplicate error = %v, expected ErrDuplicateEmail", err)
+	}
+
+	t.Run("search is case-insensitive", func(t *testing.T) {
+		for _, query := range []string{"jane", "SMITH", "Example.COM"} {
+			users, err := store.Search(ctx, query)
+			if err != nil {
+				t.Fatalf("Search(%q) unexpected error: %v", query, err)
+			}
+			if len(users) != 1 || users[0].ID != jane.ID {
+				t.Errorf("Search(%q) = %v, expected [Jane Smith]", query, names(users))
+			}
+		}
+	})
+
+	t.Run("search treats wildcards literally", func(t *testing.T) {
+		users, err := store.Search(ctx, "j_ne")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 0 {
+			t.Errorf("Search(%q) = %v, expected no matches", "j_ne", names(users))
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := store.Delete(ctx, jane.ID); err != nil {
+			t.Fatalf("Delete() unexpected error: %v", err)
+		}
+		if err := store.Delete(ctx, jane.ID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("Delete() of a missing user error = %v, expected pgx.ErrNoRows", err)
+		}
+		if count, err := store.Count(ctx); err != nil || count != 0 {
+			t.Errorf("Count() = %d, %v, expected 0", count, err)
+		}
+	})
+}
+
+func TestIntegrationPagination(t *testing.T) {
+	db := newIntegrationDB(t)
+	store := NewUserStore(db)
+	ctx := context.Background()
+
+	const total = 25
+	for i := range total {
+		if _, err := store.Add(ctx, fmt.Sprintf("User %02d", i), fmt.Sprintf("user%02d@example.com", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count, err := store.Count(ctx); err != nil || count != total {
+		t.Fatalf("Count() = %d, %v, expected %d", count, err, total)
+	}
+
+	// Walking every page must visit each user exactly once, newest first
+	seen := make(map[int]bool)
+	var previous *User
+	for page := 1; page <= 3; page++ {
+		result, err := store.GetAllPaginated(ctx, NewPaginationParams(page, 10), UserFilter{})
+		if err != nil {
+			t.Fatalf("GetAllPaginated(page %d) unexpected error: %v", page, err)
+		}
+		if result.Total != total || result.TotalPages != 3 {
+			t.Errorf("page %d has total %d over %d pages, expected 25 over 3", page, result.Total, result.TotalPages)
+		}
+		if expected := min(10, total-(page-1)*10); len(result.Data) != expected {
+			t.Errorf("page %d has %d users, expected %d", page, len(result.Data), expected)
+		}
+		for _, user := range result.Data {
+			if seen[user.ID] {
+				t.Errorf("user %d appears on more than one page", user.ID)
+			}
+			seen[user.ID] = true
+			if previous != nil && user.CreatedAt.After(previous.CreatedAt) {
+				t.Errorf("user %d is newer than user %d before it", user.ID, previous.ID)
+			}
+			previous = user
+		}
+	}
+	if len(seen) != total {
+		t.Errorf("pages covered %d users, expected %d", len(seen), total)
+	}
+
+	t.Run("search paginates", func(t *testing.T) {
+		// Matches "User 10" through "User 19"
+		result, err := store.SearchPaginated(ctx, "USER 1", NewPaginationParams(2, 4), UserFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Total != 10 || len(result.Data) != 4 {
+			t.Errorf("SearchPaginated() = %d users of %d, expected 4 of 10", len(result.Data), result.Total)
+		}
+	})
+}
+
+func TestIntegrationSearchRanked(t *testing.T) {
+	checkSearchRanked(t, NewUserStore(newIntegrationDB(t)))
+}
+
+func TestIntegrationCounterDecrementIfPositive(t *testing.T) {
+	db := newIntegrationDB(t)
+	store := NewCounterStore(db)
+	ctx := context.Background()
+
+	if _, err := store.Set(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if count, changed, err := store.DecrementIfPositive(ctx); err != nil || count != 0 || !changed {
+		t.Errorf("DecrementIfPositive() at 1 = %d, %v, %v, expected 0, true", count, changed, err)
+	}
+	if count, changed, err := store.DecrementIfPositive(ctx); err != nil || count != 0 || changed {
+		t.Errorf("DecrementIfPositive() at 0 = %d, %v, %v, expected 0, false", count, changed, err)
+	}
+
+	events, err := store.History(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || events[0].Operation != "decrement" || events[0].Value != 0 {
+		t.Errorf("latest history event = %+v, expected the one real decrement", events)
+	}
+	if len(events) > 1 && events[1].Operation != "set" {
+		t.Errorf("history = %+v, expected the no-op decrement to go unrecorded", events)
+	}
+}
+
+func TestIntegrationCounterWithoutRow(t *testing.T) {
+	db := newIntegrationDB(t)
+	store := NewCounterStore(db)
+	ctx := context.Background()
+
+	// A fresh database whose seed row never made it in, or was deleted
+	if _, err := db.Exec(ctx, "DELETE FROM counter_state"); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, err := store.Get(ctx); err != nil || count != 0 {
+		t.Errorf("Get() without a row = %d, %v, expected 0", count, err)
+	}
+	if count, err := store.Increment(ctx); err != nil || count != 1 {
+		t.Errorf("Increment() without a row = %d, %v, expected 1", count, err)
+	}
+	if count, err := store.Get(ctx); err != nil || count != 1 {
+		t.Errorf("Get() after Increment() = %d, %v, expected 1", count, err)
+	}
+
+	events, err := store.History(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Delta != 1 || events[0].Value != 1 {
+		t.Errorf("History() = %+v, expected one increment from 0 to 1", events)
+	}
+
+	if _, err := db.Exec(ctx, "DELETE FROM counter_state"); err != nil {
+		t.Fatal(err)
+	}
+	if count, changed, err := store.DecrementIfPositive(ctx); err != nil || count != 0 || changed {
+		t.Errorf("DecrementIfPositive() without a row = %d, %v, %v, expected 0, false", count, changed, err)
+	}
+}
+
+func TestIntegrationStatementTimeout(t *testing.T) {
+	databaseURL := integrationURL(t)
+	db, err := New(Options{URL: databaseURL, MaxConns: 1, StatementTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// No context deadline: only Postgres can stop this statement early
+	start := time.Now()
+	_, err = db.Exec(context.Background(), "SELECT pg_sleep(5)")
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "57014" {
+		t.Fatalf("Exec() error = %v, expected query_canceled (57014) from statement_timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("slow query ran for %v, expected it cancelled after about 100ms", elapsed)
+	}
+}
+
+func TestIntegrationStreamingIgnoresStatementTimeout(t *testing.T) {
+	databaseURL := integrationURL(t)
+	db, err := New(Options{URL: databaseURL, MaxConns: 1, StatementTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	rows, err := db.queryRows(ctx, nil, "SELECT pg_sleep(0.5)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		t.Fatalf("streaming query error = %v, expected it exempt from statement_timeout", err)
+	}
+
+	// The only connection goes back to the pool with the session's timeout intact
+	var got string
+	if err := db.Pool.QueryRow(ctx, "SELECT current_setting('statement_timeout')").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != "100ms" {
+		t.Errorf("statement_timeout after streaming = %q, expected 100ms", got)
+	}
+}
+
+func TestIntegrationSessionParams(t *testing.T) {
+	databaseURL := integrationURL(t)
+	db, err := New(Options{
+		URL:              databaseURL,
+		MaxConns:         2,
+		StatementTimeout: 45 * time.Second,
+		ApplicationName:  "htmx-learn-test",
+		SearchPath:       "public",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	// Hold one connection so the next acquire opens a second: both must be prepared
+	first, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Release()
+	second, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Release()
+
+	expected := map[string]string{"application_name": "htmx-learn-test", "statement_timeout": "45s", "search_path": "public"}
+	for i, conn := range []*pgxpool.Conn{first, second} {
+		for name, value := range expected {
+			var got string
+			if err := conn.QueryRow(ctx, "SELECT current_setting($1)", name).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != value {
+				t.Errorf("connection %d: %s = %q, expected %q", i+1, name, got, value)
+			}
+		}
+	}
+}
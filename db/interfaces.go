@@ -2,16 +2,24 @@
 // for the HTMX learning application using PostgreSQL with pgx driver.
 package db
 
-import "context"
+import (
+	"context"
+
+	"htmx-learn/validation"
+)
 
 // UserRepository defines the interface for user data operations
 type UserRepository interface {
 	GetAll(ctx context.Context) ([]*User, error)
-	GetAllPaginated(ctx context.Context, params PaginationParams) (*PaginatedResult[*User], error)
+	ForEach(ctx context.Context, fn func(*User) error) error
+	GetAllPaginated(ctx context.Context, params PaginationParams, filter UserFilter) (*PaginatedResult[*User], error)
 	Add(ctx context.Context, name, email string) (*User, error)
+	AddMany(ctx context.Context, inputs []validation.UserInput) ([]*User, error)
 	Delete(ctx context.Context, id int) error
 	Search(ctx context.Context, query string) ([]*User, error)
-	SearchPaginated(ctx context.Context, query string, params PaginationParams) (*PaginatedResult[*User], error)
+	SearchPaginated(ctx context.Context, query string, params PaginationParams, filter UserFilter) (*PaginatedResult[*User], error)
+	SearchRanked(ctx context.Context, query string, params PaginationParams, filter UserFilter) (*PaginatedResult[*User], error)
+	Count(ctx context.Context) (int, error)
 }
 
 // CounterRepository defines the interface for counter state operations
@@ -19,11 +27,19 @@ type CounterRepository interface {
 	Get(ctx context.Context) (int, error)
 	Increment(ctx context.Context) (int, error)
 	Decrement(ctx context.Context) (int, error)
+	DecrementIfPositive(ctx context.Context) (int, bool, error)
 	Reset(ctx context.Context) (int, error)
+	Set(ctx context.Context, value int) (int, error)
+	History(ctx context.Context, limit int) ([]CounterEvent, error)
 }
 
 // Ensure our concrete types implement the interfaces at compile time
 var (
 	_ UserRepository    = (*UserStore)(nil)
 	_ CounterRepository = (*CounterStore)(nil)
+	_ UserRepository    = (*MemoryUserStore)(nil)
+	_ UserRepository    = (*CachingUserRepository)(nil)
+	_ CounterRepository = (*MemoryCounterStore)(nil)
+	_ UserRepository    = (*ReadOnlyUserRepository)(nil)
+	_ CounterRepository = (*ReadOnlyCounterRepository)(nil)
 )
\ No newline at end of file
@@ -0,0 +1,318 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+
+	"htmx-learn/validation"
+)
+
+// MemoryUserStore is an in-memory UserRepository for tests and for exercising
+// handlers without PostgreSQL. Users are returned newest first, like UserStore.
+type MemoryUserStore struct {
+	mu     sync.Mutex
+	users  []*User
+	nextID int
+}
+
+// NewMemoryUserStore creates an empty MemoryUserStore
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{nextID: 1}
+}
+
+// GetAll retrieves all users
+func (ms *MemoryUserStore) GetAll(ctx context.Context) ([]*User, error) {
+	return ms.filter(func(*User) bool { return true }), nil
+}
+
+// ForEach calls fn for every user, newest first, stopping at the first error from fn
+// or between batches once ctx is done, like UserStore.ForEach
+func (ms *MemoryUserStore) ForEach(ctx context.Context, fn func(*User) error) error {
+	for n, user := range ms.filter(func(*User) bool { return true }) {
+		if n > 0 && n%forEachBatchSize == 0 {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("stopped streaming users: %w", err)
+			}
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllPaginated retrieves a page of users within filter
+func (ms *MemoryUserStore) GetAllPaginated(ctx context.Context, params PaginationParams, filter UserFilter) (*PaginatedResult[*User], error) {
+	return paginate(ms.filter(func(u *User) bool { return filter.Matches(u.CreatedAt) }), params), nil
+}
+
+// Add creates a new user, enforcing unique emails like the users table
+func (ms *MemoryUserStore) Add(ctx context.Context, name, email string) (*User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.emailTaken(email) {
+		return nil, ErrDuplicateEmail
+	}
+	return ms.add(name, email), nil
+}
+
+// AddMany creates all users or none of them
+func (ms *MemoryUserStore) AddMany(ctx context.Context, inputs []validation.UserInput) ([]*User, error) {
+	if err := validateUserInputs(inputs); err != nil {
+		return nil, err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	seen := make(map[string]bool, len(inputs))
+	for _, input := range inputs {
+		if seen[input.Email] || ms.emailTaken(input.Email) {
+			return nil, ErrDuplicateEmail
+		}
+		seen[input.Email] = true
+	}
+
+	users := make([]*User, 0, len(inputs))
+	for _, input := range inputs {
+		users = append(users, ms.add(input.Name, input.Email))
+	}
+	return users, nil
+}
+
+// Delete removes a user by ID, returning pgx.ErrNoRows if it doesn't exist
+func (ms *MemoryUserStore) Delete(ctx context.Context, id int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for i, user := range ms.users {
+		if user.ID == id {
+			ms.users = append(ms.users[:i], ms.users[i+1:]...)
+			return nil
+		}
+	}
+	return pgx.ErrNoRows
+}
+
+// Search finds users by name or email, case-insensitively
+func (ms *MemoryUserStore) Search(ctx context.Context, query string) ([]*User, error) {
+	return ms.filter(matchesQuery(query)), nil
+}
+
+// SearchPaginated finds a page of users by name or email within filter
+func (ms *MemoryUserStore) SearchPaginated(ctx context.Context, query string, params PaginationParams, filter UserFilter) (*PaginatedResult[*User], error) {
+	matches := matchesQuery(query)
+	return paginate(ms.filter(func(u *User) bool { return matches(u) && filter.Matches(u.CreatedAt) }), params), nil
+}
+
+// SearchRanked finds a page of users containing every word of query within filter,
+// most occurrences first
+func (ms *MemoryUserStore) SearchRanked(ctx context.Context, query string, params PaginationParams, filter UserFilter) (*PaginatedResult[*User], error) {
+	rank := rankQuery(query)
+	users := ms.filter(func(u *User) bool { return rank(u) > 0 && filter.Matches(u.CreatedAt) })
+	// Stable, so equally ranked users stay newest first like the created_at tiebreak
+	sort.SliceStable(users, func(i, j int) bool { return rank(users[i]) > rank(users[j]) })
+	return paginate(users, params), nil
+}
+
+// Count returns the number of users
+func (ms *MemoryUserStore) Count(ctx context.Context) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.users), nil
+}
+
+// emailTaken reports whether a user already has email; callers must hold mu
+func (ms *MemoryUserStore) emailTaken(email string) bool {
+	for _, user := range ms.users {
+		if user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// add appends a user; callers must hold mu
+func (ms *MemoryUserStore) add(name, email string) *User {
+	now := time.Now()
+	user := &User{ID: ms.nextID, Name: name, Email: email, CreatedAt: now, UpdatedAt: now}
+	ms.nextID++
+	ms.users = append(ms.users, user)
+
+	copied := *user
+	return &copied
+}
+
+// filter returns copies of the users matching keep, newest first
+func (ms *MemoryUserStore) filter(keep func(*User) bool) []*User {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var users []*User
+	for i := len(ms.users) - 1; i >= 0; i-- {
+		if keep(ms.users[i]) {
+			copied := *ms.users[i]
+			users = append(users, &copied)
+		}
+	}
+	return users
+}
+
+// matchesQuery mirrors the ILIKE match used by UserStore.Search
+func matchesQuery(query string) func(*User) bool {
+	query = strings.ToLower(query)
+	return func(user *User) bool {
+		return strings.Contains(strings.ToLower(user.Name), query) ||
+			strings.Contains(strings.ToLower(user.Email), query)
+	}
+}
+
+// searchWords splits text into lowercase words, roughly like the 'simple' text search
+// configuration used for UserStore.SearchRanked. Its parser keeps an email address as
+// one word, so "jane@example.com" is found by the whole address but not by "jane".
+func searchWords(text string) []string {
+	notWord := func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }
+
+	var words []string
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		if email := strings.TrimFunc(field, notWord); strings.Contains(email, "@") {
+			words = append(words, email)
+			continue
+		}
+		words = append(words, strings.FieldsFunc(field, notWord)...)
+	}
+	return words
+}
+
+// rankQuery approximates ts_rank for plainto_tsquery: a user matches only if every
+// query word appears in their name or email, and ranks by total occurrences
+func rankQuery(query string) func(*User) int {
+	terms := searchWords(query)
+	return func(user *User) int {
+		if len(terms) == 0 {
+			return 0
+		}
+		counts := make(map[string]int)
+		for _, word := range searchWords(user.Name + " " + user.Email) {
+			counts[word]++
+		}
+
+		rank := 0
+		for _, term := range terms {
+			if counts[term] == 0 {
+				return 0
+			}
+			rank += counts[term]
+		}
+		return rank
+	}
+}
+
+// paginate slices users to the requested page, clamping like UserStore
+func paginate(users []*User, params PaginationParams) *PaginatedResult[*User] {
+	params, adjusted := params.clampToTotal(len(users))
+	start := min(params.Offset, len(users))
+	end := min(start+params.PageSize, len(users))
+
+	result := NewPaginatedResult(users[start:end], params, len(users))
+	result.PageAdjusted = adjusted
+	return result
+}
+
+// MemoryCounterStore is an in-memory CounterRepository for tests and for exercising
+// handlers without PostgreSQL
+type MemoryCounterStore struct {
+	mu      sync.Mutex
+	count   int
+	history []CounterEvent
+}
+
+// NewMemoryCounterStore creates a MemoryCounterStore starting at zero
+func NewMemoryCounterStore() *MemoryCounterStore {
+	return &MemoryCounterStore{}
+}
+
+// Get returns the current counter value
+func (ms *MemoryCounterStore) Get(ctx context.Context) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.count, nil
+}
+
+// Increment increases the counter by 1
+func (ms *MemoryCounterStore) Increment(ctx context.Context) (int, error) {
+	return ms.apply("increment", func(count int) int { return count + 1 }), nil
+}
+
+// Decrement decreases the counter by 1
+func (ms *MemoryCounterStore) Decrement(ctx context.Context) (int, error) {
+	return ms.apply("decrement", func(count int) int { return count - 1 }), nil
+}
+
+// DecrementIfPositive decreases the counter by 1 unless it is already zero or below,
+// reporting whether it changed
+func (ms *MemoryCounterStore) DecrementIfPositive(ctx context.Context) (int, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.count <= 0 {
+		return ms.count, false, nil
+	}
+	return ms.store("decrement", ms.count-1), true, nil
+}
+
+// Reset sets the counter to 0
+func (ms *MemoryCounterStore) Reset(ctx context.Context) (int, error) {
+	return ms.apply("reset", func(int) int { return 0 }), nil
+}
+
+// Set sets the counter to the given value
+func (ms *MemoryCounterStore) Set(ctx context.Context, value int) (int, error) {
+	return ms.apply("set", func(int) int { return value }), nil
+}
+
+// History returns the most recent counter changes, newest first
+func (ms *MemoryCounterStore) History(ctx context.Context, limit int) ([]CounterEvent, error) {
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	limit = min(limit, maxHistoryLimit, len(ms.history))
+
+	events := make([]CounterEvent, 0, limit)
+	for i := len(ms.history) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, ms.history[i])
+	}
+	return events, nil
+}
+
+// apply updates the counter and records the change
+func (ms *MemoryCounterStore) apply(operation string, update func(int) int) int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.store(operation, update(ms.count))
+}
+
+// store sets the counter to value and records the change. The caller must hold mu.
+func (ms *MemoryCounterStore) store(operation string, value int) int {
+	previous := ms.count
+	ms.count = value
+	ms.history = append(ms.history, CounterEvent{
+		ID:        int64(len(ms.history) + 1),
+		Operation: operation,
+		Delta:     ms.count - previous,
+		Value:     ms.count,
+		CreatedAt: time.Now(),
+	})
+	return ms.count
+}
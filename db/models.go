@@ -4,16 +4,27 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
+	"htmx-learn/validation"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 const (
 	// CounterID represents the single counter state record ID
 	counterID = 1
+
+	// Bounds for the number of counter history events returned at once
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+
+	// forEachBatchSize is how many rows ForEach streams between checks of its context
+	forEachBatchSize = 500
 )
 
 // User represents a user in the database
@@ -32,9 +43,19 @@ type CounterState struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// CounterEvent represents a single recorded change to the counter
+type CounterEvent struct {
+	ID        int64     `json:"id"`
+	Operation string    `json:"operation"`
+	Delta     int       `json:"delta"`
+	Value     int       `json:"value"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // UserStore provides database operations for users
 type UserStore struct {
 	db *DB
+	q  Querier
 }
 
 // NewUserStore creates a new UserStore
@@ -42,52 +63,183 @@ func NewUserStore(db *DB) *UserStore {
 	return &UserStore{db: db}
 }
 
+// WithTx returns a copy of the store whose operations run inside tx
+func (us *UserStore) WithTx(tx pgx.Tx) *UserStore {
+	return us.WithQuerier(tx)
+}
+
+// WithQuerier returns a copy of the store that sends every statement to q instead of
+// the pools, which lets tests substitute a fake. Operations that need a transaction
+// begin it from q when q implements Begin, and from the primary pool otherwise.
+func (us *UserStore) WithQuerier(q Querier) *UserStore {
+	return &UserStore{db: us.db, q: q}
+}
+
 // GetAll retrieves all users from the database
 func (us *UserStore) GetAll(ctx context.Context) ([]*User, error) {
-	query := "SELECT id, name, email, created_at, updated_at FROM users ORDER BY created_at DESC"
-	rows, err := us.db.Query(ctx, query)
+	users, err := us.list(ctx, &whereBuilder{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
+
+	return users, nil
+}
+
+// ForEach calls fn for every user, newest first, streaming rows from the database
+// instead of loading them all into memory. It stops at the first error from fn, and
+// between batches of rows once ctx is done, e.g. because the client went away; the
+// rows are then closed, which releases the pool connection. Unlike other reads it
+// isn't bounded by QueryTimeout or the statement_timeout session setting, since it
+// runs for as long as fn keeps up; a store bound to a transaction stays subject to
+// the latter.
+func (us *UserStore) ForEach(ctx context.Context, fn func(*User) error) error {
+	rows, err := us.db.queryRows(ctx, us.q, usersQuery(&whereBuilder{}))
+	if err != nil {
+		return fmt.Errorf("failed to query users: %w", err)
+	}
 	defer rows.Close()
 
-	var users []*User
-	for rows.Next() {
+	for n := 0; rows.Next(); n++ {
+		if n > 0 && n%forEachBatchSize == 0 {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("stopped streaming users: %w", err)
+			}
+		}
+
 		user := &User{}
 		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan user row: %w", err)
+			return fmt.Errorf("failed to scan user row: %w", err)
+		}
+		if err := fn(user); err != nil {
+			return err
 		}
-		users = append(users, user)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating user rows: %w", err)
+		return fmt.Errorf("error iterating user rows: %w", err)
 	}
 
-	return users, nil
+	return nil
 }
 
-
 // Add creates a new user in the database
 func (us *UserStore) Add(ctx context.Context, name, email string) (*User, error) {
-	query := "INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id, name, email, created_at, updated_at"
-	row := us.db.Pool.QueryRow(ctx, query, name, email)
-
 	user := &User{}
-	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	err := us.db.run(ctx, us.q, func(ctx context.Context, q Querier) error {
+		row := q.QueryRow(ctx, queryInsertUser, name, email)
+		return row.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	})
+	us.invalidateTotals()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user %s <%s>: %w", name, email, err)
+		return nil, fmt.Errorf("failed to create user %s <%s>: %w", name, email, userWriteError(err))
 	}
 
 	return user, nil
 }
 
 
+// maxRowsPerInsert keeps each multi-row INSERT well below PostgreSQL's 65535 bind parameter limit
+const maxRowsPerInsert = 1000
+
+// AddMany creates several users with multi-row INSERTs inside a single transaction, so the
+// batch is all-or-nothing. Every input is validated before the database is touched.
+func (us *UserStore) AddMany(ctx context.Context, inputs []validation.UserInput) ([]*User, error) {
+	if err := validateUserInputs(inputs); err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+
+	users := make([]*User, 0, len(inputs))
+	err := us.db.runTx(ctx, us.q, func(ctx context.Context, tx pgx.Tx) error {
+		for start := 0; start < len(inputs); start += maxRowsPerInsert {
+			end := min(start+maxRowsPerInsert, len(inputs))
+			inserted, err := insertUserChunk(ctx, tx, inputs[start:end])
+			if err != nil {
+				return err
+			}
+			users = append(users, inserted...)
+		}
+		return nil
+	})
+	us.invalidateTotals()
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert user batch: %w", userWriteError(err))
+	}
+
+	return users, nil
+}
+
+// insertUserChunk inserts a chunk of users with a single multi-row INSERT
+func insertUserChunk(ctx context.Context, q Querier, chunk []validation.UserInput) ([]*User, error) {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO users (name, email) VALUES ")
+	args := make([]any, 0, len(chunk)*2)
+	for i, input := range chunk {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "($%d, $%d)", i*2+1, i*2+2)
+		args = append(args, input.Name, input.Email)
+	}
+	sb.WriteString(" RETURNING " + userColumns)
+
+	rows, err := q.Query(ctx, sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*User, 0, len(chunk))
+	for rows.Next() {
+		user := &User{}
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan inserted user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// validateUserInputs validates every input and combines the failures into one ValidationErrors
+func validateUserInputs(inputs []validation.UserInput) error {
+	var errs validation.ValidationErrors
+	for i, input := range inputs {
+		err := validation.ValidateUser(input)
+		if err == nil {
+			continue
+		}
+
+		var fieldErrs validation.ValidationErrors
+		if !errors.As(err, &fieldErrs) {
+			return err
+		}
+		for _, fe := range fieldErrs {
+			errs = append(errs, validation.ValidationError{
+				Field:   fmt.Sprintf("users[%d].%s", i, fe.Field),
+				Message: fe.Message,
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
 // Delete removes a user from the database
 func (us *UserStore) Delete(ctx context.Context, id int) error {
-	query := "DELETE FROM users WHERE id = $1"
-	result, err := us.db.Exec(ctx, query, id)
+	var result pgconn.CommandTag
+	err := us.db.run(ctx, us.q, func(ctx context.Context, q Querier) error {
+		var err error
+		result, err = q.Exec(ctx, queryDeleteUser, id)
+		return err
+	})
+	us.invalidateTotals()
 	if err != nil {
 		return fmt.Errorf("failed to delete user ID %d: %w", id, err)
 	}
@@ -100,127 +252,161 @@ func (us *UserStore) Delete(ctx context.Context, id int) error {
 	return nil
 }
 
+// invalidateTotals drops the cached totals after a write. A store bound to a
+// transaction leaves that to DB.WithTx once the transaction ends: until the commit,
+// a concurrent count still sees the old rows and would cache them again.
+func (us *UserStore) invalidateTotals() {
+	if _, inTx := us.q.(pgx.Tx); inTx {
+		return
+	}
+	us.db.totals.invalidate()
+}
+
+// likeEscaper escapes the ILIKE wildcards and the escape character itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike backslash-escapes s for use in a LIKE pattern with ESCAPE '\'
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// containsPattern builds an ILIKE pattern matching query literally anywhere in a value,
+// so searching for "50%" or "first_name" doesn't turn into a wildcard match
+func containsPattern(query string) string {
+	return "%" + escapeLike(query) + "%"
+}
+
 // Search finds users by name or email
 func (us *UserStore) Search(ctx context.Context, query string) ([]*User, error) {
-	sqlQuery := `
-		SELECT id, name, email, created_at, updated_at 
-		FROM users 
-		WHERE name ILIKE $1 OR email ILIKE $1 
-		ORDER BY created_at DESC
-	`
-	searchTerm := "%" + strings.ToLower(query) + "%"
-	rows, err := us.db.Query(ctx, sqlQuery, searchTerm)
+	users, err := us.list(ctx, new(whereBuilder).contains(query, searchColumns...))
 	if err != nil {
 		return nil, fmt.Errorf("failed to search users with query '%s': %w", query, err)
 	}
-	defer rows.Close()
 
-	var users []*User
-	for rows.Next() {
-		user := &User{}
-		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan search result: %w", err)
-		}
-		users = append(users, user)
+	return users, nil
+}
+
+// SearchPaginated finds users by name or email with pagination, restricted to filter
+func (us *UserStore) SearchPaginated(ctx context.Context, query string, params PaginationParams, filter UserFilter) (*PaginatedResult[*User], error) {
+	b := new(whereBuilder).contains(query, searchColumns...).applyFilters(filter)
+	result, err := us.paginate(ctx, b, usersPageQuery(b), params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users with query '%s': %w", query, err)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating search results: %w", err)
+	return result, nil
+}
+
+// SearchRanked finds users whose name or email contains every word of query using
+// full-text search, ordering the best matches first. Unlike SearchPaginated, word
+// order doesn't matter, but words only match whole ("jo" doesn't find "john").
+func (us *UserStore) SearchRanked(ctx context.Context, query string, params PaginationParams, filter UserFilter) (*PaginatedResult[*User], error) {
+	// The words are bound first, so the ranking below can refer to them as $1
+	b := new(whereBuilder).matchesWords(query).applyFilters(filter)
+	sqlQuery := fmt.Sprintf(
+		"SELECT "+userColumns+" FROM users%s "+
+			"ORDER BY ts_rank(search_vector, plainto_tsquery('simple', $1)) DESC, created_at DESC LIMIT $%d OFFSET $%d",
+		b.where(), len(b.args)+1, len(b.args)+2,
+	)
+
+	result, err := us.paginate(ctx, b, sqlQuery, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank search users with query '%s': %w", query, err)
 	}
 
-	return users, nil
+	return result, nil
 }
 
-// SearchPaginated finds users by name or email with pagination
-func (us *UserStore) SearchPaginated(ctx context.Context, query string, params PaginationParams) (*PaginatedResult[*User], error) {
-	// First get the total count for search results
-	countQuery := `
-		SELECT COUNT(*) 
-		FROM users 
-		WHERE name ILIKE $1 OR email ILIKE $1
-	`
-	searchTerm := "%" + strings.ToLower(query) + "%"
-	row := us.db.Pool.QueryRow(ctx, countQuery, searchTerm)
-	
-	var total int
-	if err := row.Scan(&total); err != nil {
-		return nil, fmt.Errorf("failed to count search results for query '%s': %w", query, err)
-	}
-
-	// Get the paginated search results
-	sqlQuery := `
-		SELECT id, name, email, created_at, updated_at 
-		FROM users 
-		WHERE name ILIKE $1 OR email ILIKE $1 
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
-	`
-	rows, err := us.db.Query(ctx, sqlQuery, searchTerm, params.PageSize, params.Offset)
+// GetAllPaginated retrieves users with pagination, restricted to filter
+func (us *UserStore) GetAllPaginated(ctx context.Context, params PaginationParams, filter UserFilter) (*PaginatedResult[*User], error) {
+	b := new(whereBuilder).applyFilters(filter)
+	result, err := us.paginate(ctx, b, usersPageQuery(b), params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search users with query '%s': %w", query, err)
+		return nil, fmt.Errorf("failed to query paginated users: %w", err)
 	}
-	defer rows.Close()
 
+	return result, nil
+}
+
+// list returns every user matching b, newest first
+func (us *UserStore) list(ctx context.Context, b *whereBuilder) ([]*User, error) {
 	var users []*User
-	for rows.Next() {
-		user := &User{}
-		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	err := us.db.runRead(ctx, us.q, func(ctx context.Context, q Querier) error {
+		rows, err := q.Query(ctx, usersQuery(b), b.args...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan search result: %w", err)
+			return err
 		}
-		users = append(users, user)
-	}
+		defer rows.Close()
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating search results: %w", err)
-	}
-
-	result := NewPaginatedResult(users, params, total)
-	return result, nil
+		users, err = scanUsers(rows)
+		return err
+	})
+	return users, err
 }
 
-// GetAllPaginated retrieves users with pagination
-func (us *UserStore) GetAllPaginated(ctx context.Context, params PaginationParams) (*PaginatedResult[*User], error) {
-	// First get the total count
-	total, err := us.Count(ctx)
+// paginate counts the users matching b and fetches one page of them with pageQuery,
+// which must select from the same WHERE clause and take LIMIT and OFFSET after b's
+// arguments. The total is counted first so total_pages stays accurate under filters.
+func (us *UserStore) paginate(ctx context.Context, b *whereBuilder, pageQuery string, params PaginationParams) (*PaginatedResult[*User], error) {
+	total, err := us.total(ctx, b)
 	if err != nil {
-		return nil, fmt.Errorf("failed to count users for pagination: %w", err)
+		return nil, err
 	}
 
-	// Get the paginated data
-	query := "SELECT id, name, email, created_at, updated_at FROM users ORDER BY created_at DESC LIMIT $1 OFFSET $2"
-	rows, err := us.db.Query(ctx, query, params.PageSize, params.Offset)
+	// Overshooting the last page returns the last page rather than an empty one. An
+	// estimate may fall short of the real total, so it can't tell where the end is.
+	var adjusted bool
+	if !total.estimated {
+		params, adjusted = params.clampToTotal(total.total)
+	}
+
+	args := append(slices.Clip(b.args), params.PageSize, params.Offset)
+	var users []*User
+	err = us.db.runRead(ctx, us.q, func(ctx context.Context, q Querier) error {
+		rows, err := q.Query(ctx, pageQuery, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		users, err = scanUsers(rows)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to query paginated users: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
 
+	result := NewPaginatedResult(users, params, total.total)
+	result.PageAdjusted = adjusted
+	result.TotalEstimated = total.estimated
+	return result, nil
+}
+
+// scanUsers reads every remaining row of rows into users
+func scanUsers(rows pgx.Rows) ([]*User, error) {
 	var users []*User
 	for rows.Next() {
 		user := &User{}
 		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan paginated user row: %w", err)
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
 		}
 		users = append(users, user)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating paginated user rows: %w", err)
+		return nil, fmt.Errorf("error iterating user rows: %w", err)
 	}
 
-	result := NewPaginatedResult(users, params, total)
-	return result, nil
+	return users, nil
 }
 
 // Count returns the total number of users
 func (us *UserStore) Count(ctx context.Context) (int, error) {
-	query := "SELECT COUNT(*) FROM users"
-	row := us.db.Pool.QueryRow(ctx, query)
-
 	var count int
-	err := row.Scan(&count)
+	err := us.db.runRead(ctx, us.q, func(ctx context.Context, q Querier) error {
+		return q.QueryRow(ctx, queryCountUsers).Scan(&count)
+	})
 	if err != nil {
 		return 0, fmt.Errorf("failed to count users: %w", err)
 	}
@@ -231,6 +417,7 @@ func (us *UserStore) Count(ctx context.Context) (int, error) {
 // CounterStore provides database operations for counter state
 type CounterStore struct {
 	db *DB
+	q  Querier
 }
 
 // NewCounterStore creates a new CounterStore
@@ -238,13 +425,29 @@ func NewCounterStore(db *DB) *CounterStore {
 	return &CounterStore{db: db}
 }
 
-// Get retrieves the current counter value
-func (cs *CounterStore) Get(ctx context.Context) (int, error) {
-	query := "SELECT count FROM counter_state WHERE id = $1"
-	row := cs.db.Pool.QueryRow(ctx, query, counterID)
+// WithTx returns a copy of the store whose operations run inside tx
+func (cs *CounterStore) WithTx(tx pgx.Tx) *CounterStore {
+	return cs.WithQuerier(tx)
+}
+
+// WithQuerier returns a copy of the store that sends every statement to q instead of
+// the pools, which lets tests substitute a fake. Operations that need a transaction
+// begin it from q when q implements Begin, and from the primary pool otherwise.
+func (cs *CounterStore) WithQuerier(q Querier) *CounterStore {
+	return &CounterStore{db: cs.db, q: q}
+}
 
+// Get retrieves the current counter value. A missing counter row reads as 0; the
+// first change creates it.
+func (cs *CounterStore) Get(ctx context.Context) (int, error) {
 	var count int
-	err := row.Scan(&count)
+	err := cs.db.run(ctx, cs.q, func(ctx context.Context, q Querier) error {
+		err := q.QueryRow(ctx, queryGetCounter, counterID).Scan(&count)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
 	if err != nil {
 		return 0, fmt.Errorf("failed to get counter value: %w", err)
 	}
@@ -255,11 +458,7 @@ func (cs *CounterStore) Get(ctx context.Context) (int, error) {
 
 // Increment increases the counter by 1
 func (cs *CounterStore) Increment(ctx context.Context) (int, error) {
-	query := "UPDATE counter_state SET count = count + 1 WHERE id = $1 RETURNING count"
-	row := cs.db.Pool.QueryRow(ctx, query, counterID)
-
-	var count int
-	err := row.Scan(&count)
+	count, err := cs.mutate(ctx, "increment", queryIncrementCounter, counterID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to increment counter: %w", err)
 	}
@@ -269,11 +468,7 @@ func (cs *CounterStore) Increment(ctx context.Context) (int, error) {
 
 // Decrement decreases the counter by 1
 func (cs *CounterStore) Decrement(ctx context.Context) (int, error) {
-	query := "UPDATE counter_state SET count = count - 1 WHERE id = $1 RETURNING count"
-	row := cs.db.Pool.QueryRow(ctx, query, counterID)
-
-	var count int
-	err := row.Scan(&count)
+	count, err := cs.mutate(ctx, "decrement", queryDecrementCounter, counterID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to decrement counter: %w", err)
 	}
@@ -281,16 +476,115 @@ func (cs *CounterStore) Decrement(ctx context.Context) (int, error) {
 	return count, nil
 }
 
+// DecrementIfPositive decreases the counter by 1 unless it is already zero or below.
+// It returns the resulting value and whether it changed; a no-op isn't recorded in
+// the history.
+func (cs *CounterStore) DecrementIfPositive(ctx context.Context) (int, bool, error) {
+	var count int
+	changed := false
+	err := cs.db.runTx(ctx, cs.q, func(ctx context.Context, tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, queryEnsureCounter, counterID).Scan(&count); err != nil {
+			return err
+		}
+
+		err := tx.QueryRow(ctx, queryDecrementCounterIfPositive, counterID).Scan(&count)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Already at the floor; count still holds the locked value
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		changed = true
+		_, err = tx.Exec(ctx, queryInsertCounterHistory, "decrement", -1, count)
+		return err
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to decrement counter: %w", err)
+	}
+
+	return count, changed, nil
+}
+
 // Reset sets the counter to 0
 func (cs *CounterStore) Reset(ctx context.Context) (int, error) {
-	query := "UPDATE counter_state SET count = 0 WHERE id = $1 RETURNING count"
-	row := cs.db.Pool.QueryRow(ctx, query, counterID)
+	count, err := cs.mutate(ctx, "reset", queryResetCounter, counterID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset counter: %w", err)
+	}
+
+	return count, nil
+}
+
+// Set sets the counter to the given value
+func (cs *CounterStore) Set(ctx context.Context, value int) (int, error) {
+	count, err := cs.mutate(ctx, "set", querySetCounter, counterID, value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set counter to %d: %w", value, err)
+	}
 
+	return count, nil
+}
+
+// mutate applies an UPDATE ... RETURNING count statement and records the change in
+// counter_history within the same transaction, so state and history never diverge.
+// The counter row is created first if it's missing, so the counter heals itself.
+func (cs *CounterStore) mutate(ctx context.Context, operation, query string, args ...any) (int, error) {
 	var count int
-	err := row.Scan(&count)
+	err := cs.db.runTx(ctx, cs.q, func(ctx context.Context, tx pgx.Tx) error {
+		var previous int
+		row := tx.QueryRow(ctx, queryEnsureCounter, counterID)
+		if err := row.Scan(&previous); err != nil {
+			return err
+		}
+
+		if err := tx.QueryRow(ctx, query, args...).Scan(&count); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, queryInsertCounterHistory, operation, count-previous, count)
+		return err
+	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to reset counter: %w", err)
+		return 0, err
 	}
 
 	return count, nil
-}
\ No newline at end of file
+}
+
+// History returns the most recent counter changes, newest first
+func (cs *CounterStore) History(ctx context.Context, limit int) ([]CounterEvent, error) {
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	limit = min(limit, maxHistoryLimit)
+
+	var events []CounterEvent
+	err := cs.db.run(ctx, cs.q, func(ctx context.Context, q Querier) error {
+		rows, err := q.Query(ctx, queryCounterHistory, limit)
+		if err != nil {
+			return fmt.Errorf("failed to query counter history: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var event CounterEvent
+			err := rows.Scan(&event.ID, &event.Operation, &event.Delta, &event.Value, &event.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("failed to scan counter history row: %w", err)
+			}
+			events = append(events, event)
+		}
+
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating counter history rows: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,400 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"htmx-learn/validation"
+)
+
+func TestValidateUserInputs(t *testing.T) {
+	t.Run("all valid", func(t *testing.T) {
+		inputs := []validation.UserInput{
+			{Name: "John Doe", Email: "john@example.com"},
+			{Name: "Jane Smith", Email: "jane@example.com"},
+		}
+		if err := validateUserInputs(inputs); err != nil {
+			t.Errorf("validateUserInputs() unexpected error: %v", err)
+		}
+	})
+
+	t.Run("errors are combined across inputs", func(t *testing.T) {
+		inputs := []validation.UserInput{
+			{Name: "John Doe", Email: "john@example.com"},
+			{Name: "", Email: "jane@example.com"},
+			{Name: "Bob", Email: "not-an-email"},
+		}
+
+		err := validateUserInputs(inputs)
+		var errs validation.ValidationErrors
+		if !errors.As(err, &errs) {
+			t.Fatalf("expected ValidationErrors, got %v", err)
+		}
+		if len(errs) != 2 {
+			t.Fatalf("got %d errors, expected 2: %v", len(errs), errs)
+		}
+		if errs[0].Field != "users[1].name" {
+			t.Errorf("errs[0].Field = %q, expected %q", errs[0].Field, "users[1].name")
+		}
+		if errs[1].Field != "users[2].email" {
+			t.Errorf("errs[1].Field = %q, expected %q", errs[1].Field, "users[2].email")
+		}
+		if !strings.Contains(err.Error(), "email format is invalid") {
+			t.Errorf("error %q should mention the invalid email", err)
+		}
+	})
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"plain": "plain",
+		"a_b":   `a\_b`,
+		"100%":  `100\%`,
+		`C:\`:   `C:\\`,
+	}
+
+	for input, expected := range tests {
+		if got := escapeLike(input); got != expected {
+			t.Errorf("escapeLike(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestSearchSendsEscapedPattern(t *testing.T) {
+	// The escaped pattern only matches literally because the SQL names the escape
+	// character; the Postgres behaviour itself is covered by the integration tests
+	querier := &fakeQuerier{}
+	if _, err := NewUserStore(&DB{}).WithQuerier(querier).Search(context.Background(), "a_b%"); err != nil {
+		t.Fatalf("Search() unexpected error: %v", err)
+	}
+
+	for _, column := range searchColumns {
+		if match := column + ` ILIKE $1 ESCAPE '\'`; !strings.Contains(querier.sql, match) {
+			t.Errorf("Search() sent %q, expected it to contain %q", querier.sql, match)
+		}
+	}
+	if len(querier.args) == 0 || querier.args[0] != `%a\_b\%%` {
+		t.Errorf("Search() args = %v, expected the escaped pattern first", querier.args)
+	}
+}
+
+func TestContainsPattern(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"john", "%john%"},
+		{"50%", `%50\%%`},
+		{"first_name", `%first\_name%`},
+		{`back\slash`, `%back\\slash%`},
+		{`%_\`, `%\%\_\\%`},
+		{"", "%%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := containsPattern(tt.query); got != tt.expected {
+				t.Errorf("containsPattern(%q) = %q, expected %q", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+// checkSearchRanked adds a few users to store and checks SearchRanked's matching and
+// ordering. It runs against the memory store and, in the integration tests, against
+// PostgreSQL, so the fake is held to what the SQL really does.
+func checkSearchRanked(t *testing.T, store UserRepository) {
+	t.Helper()
+	ctx := context.Background()
+	for _, u := range [][2]string{
+		{"Smith Johnson", "sj@example.com"},
+		{"John Smith", "john.smith@example.com"},
+		{"Johnny Smithers", "johnny@example.com"},
+		{"Jane Doe", "jane@example.com"},
+	} {
+		if _, err := store.Add(ctx, u[0], u[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		// Whole words in any order
+		{"smith john", []string{"John Smith"}},
+		// Equal ranks are newest first
+		{"smith", []string{"John Smith", "Smith Johnson"}},
+		{"SMITHERS", []string{"Johnny Smithers"}},
+		// The parser keeps an email address as one word
+		{"john.smith@example.com", []string{"John Smith"}},
+		{"example", nil},
+		{"doe jane", []string{"Jane Doe"}},
+		{"nobody", nil},
+	}
+
+	for _, tt := range tests {
+		result, err := store.SearchRanked(ctx, tt.query, NewPaginationParams(1, 10), UserFilter{})
+		if err != nil {
+			t.Fatalf("SearchRanked(%q) unexpected error: %v", tt.query, err)
+		}
+		if got := names(result.Data); !slices.Equal(got, tt.expected) {
+			t.Errorf("SearchRanked(%q) = %v, expected %v", tt.query, got, tt.expected)
+		}
+	}
+}
+
+func TestSearchRankedVersusSubstring(t *testing.T) {
+	store := NewMemoryUserStore()
+	checkSearchRanked(t, store)
+
+	// Substring search instead needs the words adjacent and in order
+	substring, err := store.SearchPaginated(context.Background(), "smith john", NewPaginationParams(1, 10), UserFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(substring.Data) != 1 || substring.Data[0].Name != "Smith Johnson" {
+		t.Errorf("SearchPaginated() = %v, expected only Smith Johnson", names(substring.Data))
+	}
+}
+
+func names(users []*User) []string {
+	result := make([]string, len(users))
+	for i, user := range users {
+		result[i] = user.Name
+	}
+	return result
+}
+
+// fakeQuerier answers every statement with the same canned result, so store methods
+// can be tested without PostgreSQL
+type fakeQuerier struct {
+	rows [][]any           // returned by Query, and the first one by QueryRow
+	tag  pgconn.CommandTag // returned by Exec
+	err  error             // returned by every method
+
+	queried *fakeRows // the rows most recently returned by Query
+	sql     string    // the most recent statement
+	args    []any     // and its arguments
+}
+
+func (q *fakeQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	q.sql, q.args = sql, args
+	if q.err != nil {
+		return nil, q.err
+	}
+	q.queried = &fakeRows{rows: q.rows}
+	return q.queried, nil
+}
+
+func (q *fakeQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	q.sql, q.args = sql, args
+	if q.err != nil {
+		return fakeRow{err: q.err}
+	}
+	rows := &fakeRows{rows: q.rows}
+	if !rows.Next() {
+		return fakeRow{err: pgx.ErrNoRows}
+	}
+	return rows
+}
+
+func (q *fakeQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	q.sql, q.args = sql, args
+	return q.tag, q.err
+}
+
+// fakeRows iterates over canned rows. Only the methods used by the stores are implemented.
+type fakeRows struct {
+	pgx.Rows
+	rows   [][]any
+	next   int
+	closed bool
+}
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+// Scan assigns the current row's values to dest, failing like pgx does when a value
+// doesn't fit its destination
+func (r *fakeRows) Scan(dest ...any) error {
+	row := r.rows[r.next-1]
+	if len(row) != len(dest) {
+		return fmt.Errorf("row has %d values, scanning into %d", len(row), len(dest))
+	}
+	for i, value := range row {
+		target := reflect.ValueOf(dest[i]).Elem()
+		if !reflect.TypeOf(value).AssignableTo(target.Type()) {
+			return fmt.Errorf("cannot scan %T into %s", value, target.Type())
+		}
+		target.Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+func (r *fakeRows) Err() error { return nil }
+func (r *fakeRows) Close()     { r.closed = true }
+
+func TestUserStoreWithFakeQuerier(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	connErr := errors.New("connection reset by peer")
+
+	t.Run("scans rows", func(t *testing.T) {
+		store := NewUserStore(&DB{}).WithQuerier(&fakeQuerier{rows: [][]any{
+			{2, "Jane", "jane@example.com", created, created},
+			{1, "John", "john@example.com", created, created},
+		}})
+		users, err := store.GetAll(context.Background())
+		if err != nil {
+			t.Fatalf("GetAll() unexpected error: %v", err)
+		}
+		if got := names(users); len(got) != 2 || got[0] != "Jane" || got[1] != "John" {
+			t.Errorf("GetAll() = %v, expected [Jane John]", got)
+		}
+	})
+
+	t.Run("query errors are wrapped", func(t *testing.T) {
+		store := NewUserStore(&DB{}).WithQuerier(&fakeQuerier{err: connErr})
+		_, err := store.Search(context.Background(), "jo")
+		if !errors.Is(err, connErr) || !strings.Contains(err.Error(), "failed to search users") {
+			t.Errorf("Search() error = %v, expected it to wrap %v", err, connErr)
+		}
+	})
+
+	t.Run("scan failures are reported", func(t *testing.T) {
+		store := NewUserStore(&DB{}).WithQuerier(&fakeQuerier{rows: [][]any{
+			{"not an id", "Jane", "jane@example.com", created, created},
+		}})
+		_, err := store.GetAll(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "failed to scan user row") {
+			t.Errorf("GetAll() error = %v, expected a scan failure", err)
+		}
+	})
+
+	t.Run("duplicate email", func(t *testing.T) {
+		store := NewUserStore(&DB{}).WithQuerier(&fakeQuerier{err: &pgconn.PgError{Code: uniqueViolation}})
+		_, err := store.Add(context.Background(), "Jane", "jane@example.com")
+		if !errors.Is(err, ErrDuplicateEmail) {
+			t.Errorf("Add() error = %v, expected ErrDuplicateEmail", err)
+		}
+	})
+}
+
+func TestUserStoreForEachStopsWhenContextDone(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := make([][]any, 3*forEachBatchSize)
+	for i := range rows {
+		rows[i] = []any{i + 1, "User", fmt.Sprintf("user%d@example.com", i), created, created}
+	}
+	querier := &fakeQuerier{rows: rows}
+	store := NewUserStore(&DB{}).WithQuerier(querier)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	seen := 0
+	err := store.ForEach(ctx, func(*User) error {
+		// The client goes away while the first batch is being written
+		if seen++; seen == 10 {
+			cancel()
+		}
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ForEach() error = %v, expected context.Canceled", err)
+	}
+	if seen != forEachBatchSize {
+		t.Errorf("fn called %d times, expected the query to stop after the first batch of %d", seen, forEachBatchSize)
+	}
+	if !querier.queried.closed {
+		t.Error("rows were not closed, so the connection would not be released")
+	}
+}
+
+func TestUserStoreDeleteWithFakeQuerier(t *testing.T) {
+	connErr := errors.New("connection reset by peer")
+	tests := []struct {
+		name     string
+		querier  *fakeQuerier
+		expected error
+	}{
+		{"deleted", &fakeQuerier{tag: pgconn.NewCommandTag("DELETE 1")}, nil},
+		{"missing user", &fakeQuerier{tag: pgconn.NewCommandTag("DELETE 0")}, pgx.ErrNoRows},
+		{"connection error", &fakeQuerier{err: connErr}, connErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewUserStore(&DB{}).WithQuerier(tt.querier).Delete(context.Background(), 7)
+			if tt.expected == nil {
+				if err != nil {
+					t.Errorf("Delete() unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Delete() error = %v, expected %v", err, tt.expected)
+			}
+			// Handlers answer 404 for pgx.ErrNoRows, so other failures must not match it
+			if tt.expected != pgx.ErrNoRows && errors.Is(err, pgx.ErrNoRows) {
+				t.Errorf("Delete() error = %v must not be reported as a missing user", err)
+			}
+		})
+	}
+}
+
+func TestCounterStoreGetWithFakeQuerier(t *testing.T) {
+	store := NewCounterStore(&DB{})
+
+	count, err := store.WithQuerier(&fakeQuerier{rows: [][]any{{42}}}).Get(context.Background())
+	if err != nil || count != 42 {
+		t.Errorf("Get() = %d, %v, expected 42", count, err)
+	}
+
+	// A fresh database without the counter row reads as zero rather than failing
+	count, err = store.WithQuerier(&fakeQuerier{}).Get(context.Background())
+	if err != nil || count != 0 {
+		t.Errorf("Get() without a counter row = %d, %v, expected 0", count, err)
+	}
+
+	connErr := errors.New("connection reset by peer")
+	_, err = store.WithQuerier(&fakeQuerier{err: connErr}).Get(context.Background())
+	if !errors.Is(err, connErr) || !strings.Contains(err.Error(), "failed to get counter value") {
+		t.Errorf("Get() error = %v, expected a wrapped %v", err, connErr)
+	}
+}
+
+func TestMemoryCounterHistoryDuringWrites(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCounterStore()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			store.Increment(ctx)
+		}
+	}()
+	for range 100 {
+		if _, err := store.History(ctx, maxHistoryLimit); err != nil {
+			t.Fatalf("History() unexpected error: %v", err)
+		}
+	}
+	<-done
+
+	events, err := store.History(ctx, 1)
+	if err != nil || len(events) != 1 || events[0].Value != 100 {
+		t.Errorf("History(1) = %+v, %v, expected the increment to 100", events, err)
+	}
+}
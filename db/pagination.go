@@ -2,6 +2,11 @@
 // for the HTMX learning application using PostgreSQL with pgx driver.
 package db
 
+import (
+	"errors"
+	"fmt"
+)
+
 const (
 	// Default pagination settings
 	DefaultPageSize = 10
@@ -9,6 +14,12 @@ const (
 	MinPageSize     = 5
 )
 
+// ErrPageTooDeep is returned for a page whose offset is past the configured maximum.
+// Postgres must read and discard every row before an offset, so deep pages are
+// expensive; listings are ordered newest first, so clients walking that deep should
+// page with created_before set to the oldest created_at they have seen instead.
+var ErrPageTooDeep = errors.New("page too deep, use cursor pagination")
+
 // PaginationParams holds pagination parameters
 type PaginationParams struct {
 	Page     int `json:"page"`
@@ -25,6 +36,11 @@ type PaginatedResult[T any] struct {
 	TotalPages int `json:"total_pages"`
 	HasNext    bool `json:"has_next"`
 	HasPrev    bool `json:"has_prev"`
+	// PageAdjusted is set when the requested page was past the end and the last page was returned instead
+	PageAdjusted bool `json:"page_adjusted,omitempty"`
+	// TotalEstimated is set when Total, and so TotalPages and HasNext, come from the
+	// planner's statistics rather than a count
+	TotalEstimated bool `json:"total_estimated,omitempty"`
 }
 
 // NewPaginationParams creates validated pagination parameters
@@ -34,11 +50,14 @@ func NewPaginationParams(page, pageSize int) PaginationParams {
 		page = 1
 	}
 	
-	if pageSize < MinPageSize {
+	// A non-positive size means "unspecified"; otherwise sizes are clamped to
+	// [MinPageSize, MaxPageSize] at both ends
+	switch {
+	case pageSize <= 0:
 		pageSize = DefaultPageSize
-	}
-	
-	if pageSize > MaxPageSize {
+	case pageSize < MinPageSize:
+		pageSize = MinPageSize
+	case pageSize > MaxPageSize:
 		pageSize = MaxPageSize
 	}
 	
@@ -51,12 +70,37 @@ func NewPaginationParams(page, pageSize int) PaginationParams {
 	}
 }
 
+// CheckDepth returns an error wrapping ErrPageTooDeep when p starts past maxOffset
+// rows. A maxOffset of 0 allows any depth.
+func (p PaginationParams) CheckDepth(maxOffset int) error {
+	if maxOffset <= 0 || p.PageSize <= 0 {
+		return nil
+	}
+	// Compared in pages, since Offset overflows for absurd page numbers
+	if maxPage := maxOffset/p.PageSize + 1; p.Page > maxPage {
+		return fmt.Errorf("%w: page %d is past page %d, pass the created_at of the last user seen as created_before", ErrPageTooDeep, p.Page, maxPage)
+	}
+	return nil
+}
+
+// clampToTotal moves a page past the end of total items back to the last page
+// (page 1 for an empty set), reporting whether the page changed
+func (p PaginationParams) clampToTotal(total int) (PaginationParams, bool) {
+	if p.PageSize <= 0 {
+		return p, false
+	}
+	
+	lastPage := max(1, (total+p.PageSize-1)/p.PageSize)
+	if p.Page <= lastPage {
+		return p, false
+	}
+	return NewPaginationParams(lastPage, p.PageSize), true
+}
+
 // NewPaginatedResult creates a paginated result with metadata
 func NewPaginatedResult[T any](data []T, params PaginationParams, total int) *PaginatedResult[T] {
-	totalPages := (total + params.PageSize - 1) / params.PageSize // Ceiling division
-	if totalPages < 1 {
-		totalPages = 1
-	}
+	// Ceiling division; an empty collection has zero pages
+	totalPages := (total + params.PageSize - 1) / params.PageSize
 	
 	return &PaginatedResult[T]{
 		Data:       data,
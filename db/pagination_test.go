@@ -1,7 +1,13 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"testing"
+
+	"htmx-learn/validation"
 )
 
 func TestNewPaginationParams(t *testing.T) {
@@ -34,6 +40,30 @@ func TestNewPaginationParams(t *testing.T) {
 			page:           1,
 			pageSize:       3,
 			expectedPage:   1,
+			expectedSize:   MinPageSize,
+			expectedOffset: 0,
+		},
+		{
+			name:           "page size too small on later page",
+			page:           3,
+			pageSize:       1,
+			expectedPage:   3,
+			expectedSize:   MinPageSize,
+			expectedOffset: 2 * MinPageSize,
+		},
+		{
+			name:           "zero page size uses default",
+			page:           1,
+			pageSize:       0,
+			expectedPage:   1,
+			expectedSize:   DefaultPageSize,
+			expectedOffset: 0,
+		},
+		{
+			name:           "negative page size uses default",
+			page:           1,
+			pageSize:       -10,
+			expectedPage:   1,
 			expectedSize:   DefaultPageSize,
 			expectedOffset: 0,
 		},
@@ -164,8 +194,154 @@ func TestPaginatedResultEdgeCases(t *testing.T) {
 		if result.HasNext {
 			t.Error("HasNext = true, expected false for empty result")
 		}
-		if result.TotalPages != 1 {
-			t.Errorf("TotalPages = %d, expected 1 for empty result", result.TotalPages)
+		if result.TotalPages != 0 {
+			t.Errorf("TotalPages = %d, expected 0 for empty result", result.TotalPages)
 		}
 	})
-}
\ No newline at end of file
+}
+func TestClampToTotal(t *testing.T) {
+	tests := []struct {
+		name             string
+		page             int
+		total            int
+		expectedPage     int
+		expectedOffset   int
+		expectedAdjusted bool
+	}{
+		{"overshoot", 999, 25, 3, 20, true},
+		{"exact last page", 3, 25, 3, 20, false},
+		{"one past exact multiple", 4, 30, 3, 20, true},
+		{"within range", 2, 25, 2, 10, false},
+		{"empty table", 5, 0, 1, 0, true},
+		{"first page of empty table", 1, 0, 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, adjusted := NewPaginationParams(tt.page, 10).clampToTotal(tt.total)
+
+			if params.Page != tt.expectedPage {
+				t.Errorf("Page = %d, expected %d", params.Page, tt.expectedPage)
+			}
+			if params.Offset != tt.expectedOffset {
+				t.Errorf("Offset = %d, expected %d", params.Offset, tt.expectedOffset)
+			}
+			if adjusted != tt.expectedAdjusted {
+				t.Errorf("adjusted = %v, expected %v", adjusted, tt.expectedAdjusted)
+			}
+		})
+	}
+}
+
+func TestCheckDepth(t *testing.T) {
+	tests := []struct {
+		name        string
+		page        int
+		pageSize    int
+		maxOffset   int
+		expectError bool
+	}{
+		{"first page", 1, 10, 100, false},
+		{"last page at the limit", 11, 10, 100, false},
+		{"one page past the limit", 12, 10, 100, true},
+		{"limit inside a page", 3, 40, 100, false},
+		{"page after the one holding the limit", 4, 40, 100, true},
+		{"overflowing offset", math.MaxInt / 10, 100, 100, true},
+		{"unlimited", 1_000_000, 100, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewPaginationParams(tt.page, tt.pageSize).CheckDepth(tt.maxOffset)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("CheckDepth() error = %v, expectError %v", err, tt.expectError)
+			}
+			if err != nil && !errors.Is(err, ErrPageTooDeep) {
+				t.Errorf("CheckDepth() error = %v, expected ErrPageTooDeep", err)
+			}
+		})
+	}
+}
+
+func TestMemoryUserStorePaginationClamps(t *testing.T) {
+	store := NewMemoryUserStore()
+	for _, name := range []string{"Ann", "Bob", "Cat"} {
+		if _, err := store.Add(context.Background(), name, name+"@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := store.GetAllPaginated(context.Background(), NewPaginationParams(999, 5), UserFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Page != 1 || !result.PageAdjusted || len(result.Data) != 3 {
+		t.Errorf("got page %d (adjusted %v) with %d users, expected clamped page 1 with 3 users",
+			result.Page, result.PageAdjusted, len(result.Data))
+	}
+	if result.HasPrev || result.HasNext {
+		t.Errorf("HasPrev = %v, HasNext = %v, expected both false", result.HasPrev, result.HasNext)
+	}
+}
+
+// benchmarkUsers is the size of the dataset the store benchmarks page through
+const benchmarkUsers = 10000
+
+// seedMemoryStore returns a MemoryUserStore holding benchmarkUsers users
+func seedMemoryStore(b *testing.B) *MemoryUserStore {
+	b.Helper()
+	inputs := make([]validation.UserInput, benchmarkUsers)
+	for i := range inputs {
+		inputs[i] = validation.UserInput{
+			Name:  fmt.Sprintf("User %05d", i),
+			Email: fmt.Sprintf("user%05d@example.com", i),
+		}
+	}
+
+	store := NewMemoryUserStore()
+	if _, err := store.AddMany(context.Background(), inputs); err != nil {
+		b.Fatal(err)
+	}
+	return store
+}
+
+func BenchmarkNewPaginationParams(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		NewPaginationParams(42, 20)
+	}
+}
+
+func BenchmarkNewPaginatedResult(b *testing.B) {
+	users := make([]*User, 20)
+	params := NewPaginationParams(42, 20)
+	b.ReportAllocs()
+	for b.Loop() {
+		NewPaginatedResult(users, params, benchmarkUsers)
+	}
+}
+
+func BenchmarkMemoryGetAllPaginated(b *testing.B) {
+	store := seedMemoryStore(b)
+	ctx := context.Background()
+	params := NewPaginationParams(250, 20)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := store.GetAllPaginated(ctx, params, UserFilter{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemorySearchPaginated(b *testing.B) {
+	store := seedMemoryStore(b)
+	ctx := context.Background()
+	params := NewPaginationParams(5, 20)
+	b.ReportAllocs()
+	for b.Loop() {
+		// Matches the 1000 users numbered 01000-01999
+		if _, err := store.SearchPaginated(ctx, "user01", params, UserFilter{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
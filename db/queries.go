@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// userColumns is the column list every user query selects, in User field order
+const userColumns = "id, name, email, created_at, updated_at"
+
+// User queries
+const (
+	queryInsertUser = "INSERT INTO users (name, email) VALUES ($1, $2) RETURNING " + userColumns
+	queryDeleteUser = "DELETE FROM users WHERE id = $1"
+	queryCountUsers = "SELECT COUNT(*) FROM users"
+)
+
+// Counter queries
+const (
+	queryGetCounter       = "SELECT count FROM counter_state WHERE id = $1"
+	queryIncrementCounter = "UPDATE counter_state SET count = count + 1 WHERE id = $1 RETURNING count"
+	queryDecrementCounter = "UPDATE counter_state SET count = count - 1 WHERE id = $1 RETURNING count"
+	queryResetCounter     = "UPDATE counter_state SET count = 0 WHERE id = $1 RETURNING count"
+	querySetCounter       = "UPDATE counter_state SET count = $2 WHERE id = $1 RETURNING count"
+
+	// queryDecrementCounterIfPositive matches no row once the count is zero, so it never
+	// goes negative however many decrements race
+	queryDecrementCounterIfPositive = "UPDATE counter_state SET count = count - 1 WHERE id = $1 AND count > 0 RETURNING count"
+
+	// queryEnsureCounter locks the counter row and returns its count, first creating it
+	// at zero if it's missing, e.g. because the seed row was deleted. DO UPDATE rather
+	// than DO NOTHING is what makes an existing row come back locked and RETURNING it.
+	queryEnsureCounter = "INSERT INTO counter_state (id, count) VALUES ($1, 0) ON CONFLICT (id) DO UPDATE SET count = counter_state.count RETURNING count"
+
+	queryInsertCounterHistory = "INSERT INTO counter_history (operation, delta, value) VALUES ($1, $2, $3)"
+	queryCounterHistory       = "SELECT id, operation, delta, value, created_at FROM counter_history ORDER BY id DESC LIMIT $1"
+)
+
+// usersQuery selects every user matching b, newest first
+func usersQuery(b *whereBuilder) string {
+	return "SELECT " + userColumns + " FROM users" + b.where() + " ORDER BY created_at DESC"
+}
+
+// usersCountQuery counts the users matching b
+func usersCountQuery(b *whereBuilder) string {
+	return queryCountUsers + b.where()
+}
+
+// usersPageQuery selects a page of users matching b, with the LIMIT and OFFSET
+// placeholders numbered after b's arguments
+func usersPageQuery(b *whereBuilder) string {
+	return fmt.Sprintf("%s LIMIT $%d OFFSET $%d", usersQuery(b), len(b.args)+1, len(b.args)+2)
+}
+
+// preparedQueries are the hot-path statements PrepareStatements warms. The unfiltered
+// user page and count are what the user list issues most often.
+var preparedQueries = []string{
+	usersQuery(&whereBuilder{}),
+	queryInsertUser,
+	queryDeleteUser,
+	queryCountUsers,
+	usersQuery(new(whereBuilder).contains("", searchColumns...)),
+	usersPageQuery(&whereBuilder{}),
+	queryGetCounter,
+	queryEnsureCounter,
+	queryIncrementCounter,
+	queryDecrementCounter,
+	queryDecrementCounterIfPositive,
+	queryResetCounter,
+	querySetCounter,
+	queryInsertCounterHistory,
+	queryCounterHistory,
+}
+
+// PrepareStatements prepares preparedQueries on every idle connection in the pools, so
+// the first requests after startup don't pay to parse and plan them. Each statement is
+// named by its own SQL text, which makes pgx use it for any query with that text, so
+// callers don't refer to statements by name. Connections opened later prepare the
+// statements on first use through pgx's statement cache.
+func (db *DB) PrepareStatements(ctx context.Context) error {
+	if err := prepareOnIdle(ctx, db.Pool); err != nil {
+		return err
+	}
+	if db.Replica != nil {
+		if err := prepareOnIdle(ctx, db.Replica); err != nil {
+			return fmt.Errorf("replica: %w", err)
+		}
+	}
+	return nil
+}
+
+// prepareOnIdle prepares preparedQueries on each idle connection of pool
+func prepareOnIdle(ctx context.Context, pool *pgxpool.Pool) error {
+	conns := pool.AcquireAllIdle(ctx)
+	defer func() {
+		for _, conn := range conns {
+			conn.Release()
+		}
+	}()
+
+	for _, conn := range conns {
+		if err := prepareQueries(ctx, conn.Conn()); err != nil {
+			return err
+		}
+	}
+	slog.Debug("Prepared statements", "statements", len(preparedQueries), "connections", len(conns))
+	return nil
+}
+
+// prepareQueries prepares preparedQueries on conn
+func prepareQueries(ctx context.Context, conn *pgx.Conn) error {
+	for _, query := range preparedQueries {
+		if _, err := conn.Prepare(ctx, query, query); err != nil {
+			return fmt.Errorf("failed to prepare %q: %w", query, err)
+		}
+	}
+	return nil
+}
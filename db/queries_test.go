@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestPreparedQueriesAreUnique(t *testing.T) {
+	seen := make(map[string]bool, len(preparedQueries))
+	for _, query := range preparedQueries {
+		if seen[query] {
+			t.Errorf("%q is prepared twice", query)
+		}
+		seen[query] = true
+	}
+}
+
+// TestUnfilteredPageIsPrepared guards against the user list's page query drifting from
+// the prepared text, which would silently stop it from using the prepared statement
+func TestUnfilteredPageIsPrepared(t *testing.T) {
+	query := usersPageQuery(new(whereBuilder).applyFilters(UserFilter{}))
+
+	for _, prepared := range preparedQueries {
+		if prepared == query {
+			return
+		}
+	}
+	t.Errorf("unfiltered page query %q is not in preparedQueries", query)
+}
+
+func TestUsersPageQuery(t *testing.T) {
+	expected := "SELECT id, name, email, created_at, updated_at FROM users WHERE created_at >= $1 " +
+		"ORDER BY created_at DESC LIMIT $2 OFFSET $3"
+	b := new(whereBuilder).compare("created_at", ">=", time.Now())
+	if query := usersPageQuery(b); query != expected {
+		t.Errorf("usersPageQuery() = %q, expected %q", query, expected)
+	}
+}
+
+// BenchmarkPaginatedQuery compares the prepared user page query with parsing and
+// planning it on every call. It needs a database with the schema applied:
+//
+//	TEST_DATABASE_URL=postgres://... go test -run '^$' -bench PaginatedQuery ./db
+func BenchmarkPaginatedQuery(b *testing.B) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		b.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	query := usersPageQuery(&whereBuilder{})
+	run := func(b *testing.B, args ...any) {
+		for b.Loop() {
+			rows, err := conn.Query(ctx, query, args...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("prepared", func(b *testing.B) {
+		if err := prepareQueries(ctx, conn); err != nil {
+			b.Fatal(err)
+		}
+		run(b, 20, 0)
+	})
+	b.Run("ad-hoc", func(b *testing.B) {
+		// The simple protocol sends the statement as text every time, bypassing both the
+		// prepared statement and pgx's statement cache
+		run(b, pgx.QueryExecModeSimpleProtocol, 20, 0)
+	})
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"htmx-learn/validation"
+)
+
+// ErrReadOnly is returned by writes while the application is in read-only mode. They
+// are refused before reaching the database, so clients get a clear answer rather than
+// a permission error from a read-only role or replica.
+var ErrReadOnly = errors.New("the database is read-only, changes can't be saved right now")
+
+// ReadOnlyUserRepository decorates a UserRepository so every write fails with
+// ErrReadOnly while reads pass through, e.g. during a maintenance window or when
+// running against a replica
+type ReadOnlyUserRepository struct {
+	UserRepository
+}
+
+// NewReadOnlyUserRepository wraps repo, refusing its writes
+func NewReadOnlyUserRepository(repo UserRepository) *ReadOnlyUserRepository {
+	return &ReadOnlyUserRepository{UserRepository: repo}
+}
+
+// Add refuses to create a user
+func (r *ReadOnlyUserRepository) Add(ctx context.Context, name, email string) (*User, error) {
+	return nil, ErrReadOnly
+}
+
+// AddMany refuses to create users
+func (r *ReadOnlyUserRepository) AddMany(ctx context.Context, inputs []validation.UserInput) ([]*User, error) {
+	return nil, ErrReadOnly
+}
+
+// Delete refuses to delete a user
+func (r *ReadOnlyUserRepository) Delete(ctx context.Context, id int) error {
+	return ErrReadOnly
+}
+
+// ReadOnlyCounterRepository decorates a CounterRepository so every change to the
+// counter fails with ErrReadOnly while its value and history can still be read
+type ReadOnlyCounterRepository struct {
+	CounterRepository
+}
+
+// NewReadOnlyCounterRepository wraps repo, refusing its writes
+func NewReadOnlyCounterRepository(repo CounterRepository) *ReadOnlyCounterRepository {
+	return &ReadOnlyCounterRepository{CounterRepository: repo}
+}
+
+// Increment refuses to change the counter
+func (r *ReadOnlyCounterRepository) Increment(ctx context.Context) (int, error) {
+	return 0, ErrReadOnly
+}
+
+// Decrement refuses to change the counter
+func (r *ReadOnlyCounterRepository) Decrement(ctx context.Context) (int, error) {
+	return 0, ErrReadOnly
+}
+
+// DecrementIfPositive refuses to change the counter
+func (r *ReadOnlyCounterRepository) DecrementIfPositive(ctx context.Context) (int, bool, error) {
+	return 0, false, ErrReadOnly
+}
+
+// Reset refuses to change the counter
+func (r *ReadOnlyCounterRepository) Reset(ctx context.Context) (int, error) {
+	return 0, ErrReadOnly
+}
+
+// Set refuses to change the counter
+func (r *ReadOnlyCounterRepository) Set(ctx context.Context, value int) (int, error) {
+	return 0, ErrReadOnly
+}
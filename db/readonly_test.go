@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"htmx-learn/validation"
+)
+
+func TestReadOnlyUserRepository(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryUserStore()
+	existing, err := store.Add(ctx, "Ada", "ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewReadOnlyUserRepository(store)
+
+	writes := map[string]func() error{
+		"Add": func() error {
+			_, err := repo.Add(ctx, "Grace", "grace@example.com")
+			return err
+		},
+		"AddMany": func() error {
+			_, err := repo.AddMany(ctx, []validation.UserInput{{Name: "Grace", Email: "grace@example.com"}})
+			return err
+		},
+		"Delete": func() error { return repo.Delete(ctx, existing.ID) },
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s() error = %v, expected ErrReadOnly", name, err)
+		}
+	}
+
+	users, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll() unexpected error: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != existing.ID {
+		t.Errorf("GetAll() = %d users, expected only the user created before going read-only", len(users))
+	}
+	if count, err := repo.Count(ctx); err != nil || count != 1 {
+		t.Errorf("Count() = %d, %v, expected 1", count, err)
+	}
+}
+
+func TestReadOnlyCounterRepository(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCounterStore()
+	if _, err := store.Set(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewReadOnlyCounterRepository(store)
+
+	writes := map[string]func() error{
+		"Increment": func() error { _, err := repo.Increment(ctx); return err },
+		"Decrement": func() error { _, err := repo.Decrement(ctx); return err },
+		"DecrementIfPositive": func() error {
+			_, changed, err := repo.DecrementIfPositive(ctx)
+			if changed {
+				t.Error("DecrementIfPositive() reported a change")
+			}
+			return err
+		},
+		"Reset": func() error { _, err := repo.Reset(ctx); return err },
+		"Set":   func() error { _, err := repo.Set(ctx, 10); return err },
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s() error = %v, expected ErrReadOnly", name, err)
+		}
+	}
+
+	if count, err := repo.Get(ctx); err != nil || count != 3 {
+		t.Errorf("Get() = %d, %v, expected the unchanged 3", count, err)
+	}
+	if _, err := repo.History(ctx, 10); err != nil {
+		t.Errorf("History() unexpected error: %v", err)
+	}
+}
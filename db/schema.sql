@@ -17,6 +17,15 @@ CREATE TABLE IF NOT EXISTS counter_state (
     updated_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- Audit log of counter changes, written in the same transaction as counter_state
+CREATE TABLE IF NOT EXISTS counter_history (
+    id BIGSERIAL PRIMARY KEY,
+    operation VARCHAR(32) NOT NULL,
+    delta INTEGER NOT NULL,
+    value INTEGER NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
 -- Insert initial counter state
 INSERT INTO counter_state (id, count) VALUES (1, 0) ON CONFLICT (id) DO NOTHING;
 
@@ -31,6 +40,12 @@ ON CONFLICT (email) DO NOTHING;
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_users_name ON users(name);
 
+-- Full-text search over name and email, used by ranked search (search_mode=fts).
+-- The 'simple' configuration skips stemming, which suits names and addresses.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', name || ' ' || email)) STORED;
+CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN (search_vector);
+
 -- Function to update updated_at timestamp
 CREATE OR REPLACE FUNCTION update_updated_at_column()
 RETURNS TRIGGER AS $$
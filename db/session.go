@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// sessionParam is a Postgres setting applied to every new connection
+type sessionParam struct {
+	name  string
+	value string
+}
+
+// sessionParams returns the settings opts asks for, skipping unset ones so the
+// server's defaults apply
+func sessionParams(opts Options) []sessionParam {
+	var params []sessionParam
+	if opts.ApplicationName != "" {
+		params = append(params, sessionParam{"application_name", opts.ApplicationName})
+	}
+	if opts.StatementTimeout > 0 {
+		params = append(params, sessionParam{"statement_timeout", statementTimeoutParam(opts.StatementTimeout)})
+	}
+	if opts.SearchPath != "" {
+		params = append(params, sessionParam{"search_path", opts.SearchPath})
+	}
+	return params
+}
+
+// statementTimeoutParam formats d as the whole milliseconds statement_timeout takes,
+// rounding up so a sub-millisecond timeout doesn't become 0, which disables it
+func statementTimeoutParam(d time.Duration) string {
+	ms := (d + time.Millisecond - 1) / time.Millisecond
+	return strconv.FormatInt(int64(ms), 10)
+}
+
+// afterConnect returns the pool's AfterConnect hook, which prepares each new
+// connection before it is first used: it applies the session settings in one round
+// trip, with the values bound as parameters, and registers opts.DataTypes. Settings
+// are applied here rather than as startup parameters so they also survive poolers
+// such as PgBouncer, which drop unknown startup parameters.
+func afterConnect(opts Options) func(context.Context, *pgx.Conn) error {
+	params := sessionParams(opts)
+	var query string
+	var args []any
+	if len(params) > 0 {
+		calls := make([]string, len(params))
+		for i, param := range params {
+			calls[i] = fmt.Sprintf("set_config($%d, $%d, false)", 2*i+1, 2*i+2)
+			args = append(args, param.name, param.value)
+		}
+		query = "SELECT " + strings.Join(calls, ", ")
+	}
+
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		if query != "" {
+			if _, err := conn.Exec(ctx, query, args...); err != nil {
+				return fmt.Errorf("failed to apply session settings: %w", err)
+			}
+		}
+		if len(opts.DataTypes) > 0 {
+			types, err := conn.LoadTypes(ctx, opts.DataTypes)
+			if err != nil {
+				return fmt.Errorf("failed to load data types: %w", err)
+			}
+			conn.TypeMap().RegisterTypes(types)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,60 @@
+package db
+
+import "github.com/jackc/pgx/v5/pgxpool"
+
+// PoolStats is a stable JSON snapshot of the connection pool, suitable for charting
+// over time. Fields are only ever added, never renamed.
+type PoolStats struct {
+	TotalConns              int32   `json:"total_conns"`
+	IdleConns               int32   `json:"idle_conns"`
+	AcquiredConns           int32   `json:"acquired_conns"`
+	ConstructingConns       int32   `json:"constructing_conns"`
+	MaxConns                int32   `json:"max_conns"`
+	AcquireCount            int64   `json:"acquire_count"`
+	AcquireDurationSeconds  float64 `json:"acquire_duration_seconds"`
+	EmptyAcquireCount       int64   `json:"empty_acquire_count"`
+	EmptyAcquireWaitSeconds float64 `json:"empty_acquire_wait_seconds"`
+	CanceledAcquireCount    int64   `json:"canceled_acquire_count"`
+	NewConnsCount           int64   `json:"new_conns_count"`
+	MaxLifetimeDestroyCount int64   `json:"max_lifetime_destroy_count"`
+	MaxIdleDestroyCount     int64   `json:"max_idle_destroy_count"`
+}
+
+// newPoolStats converts a pgxpool snapshot into PoolStats
+func newPoolStats(s *pgxpool.Stat) PoolStats {
+	return PoolStats{
+		TotalConns:              s.TotalConns(),
+		IdleConns:               s.IdleConns(),
+		AcquiredConns:           s.AcquiredConns(),
+		ConstructingConns:       s.ConstructingConns(),
+		MaxConns:                s.MaxConns(),
+		AcquireCount:            s.AcquireCount(),
+		AcquireDurationSeconds:  s.AcquireDuration().Seconds(),
+		EmptyAcquireCount:       s.EmptyAcquireCount(),
+		EmptyAcquireWaitSeconds: s.EmptyAcquireWaitTime().Seconds(),
+		CanceledAcquireCount:    s.CanceledAcquireCount(),
+		NewConnsCount:           s.NewConnsCount(),
+		MaxLifetimeDestroyCount: s.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     s.MaxIdleDestroyCount(),
+	}
+}
+
+// PoolStats returns a snapshot of the connection pool
+func (db *DB) PoolStats() PoolStats {
+	return newPoolStats(db.Pool.Stat())
+}
+
+// PoolUsage returns the percentage of the primary pool's connections currently
+// acquired, from 0 to 100
+func (db *DB) PoolUsage() int {
+	s := db.Pool.Stat()
+	return poolUsage(s.AcquiredConns(), s.MaxConns())
+}
+
+// poolUsage returns acquired as a percentage of max
+func poolUsage(acquired, max int32) int {
+	if max <= 0 {
+		return 0
+	}
+	return int(int64(acquired) * 100 / int64(max))
+}
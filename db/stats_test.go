@@ -0,0 +1,61 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestPoolStatsJSONIsStable guards the payload shape that dashboards chart against
+func TestPoolStatsJSONIsStable(t *testing.T) {
+	data, err := json.Marshal(PoolStats{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"total_conns", "idle_conns", "acquired_conns", "constructing_conns", "max_conns",
+		"acquire_count", "acquire_duration_seconds", "empty_acquire_count",
+		"empty_acquire_wait_seconds", "canceled_acquire_count", "new_conns_count",
+		"max_lifetime_destroy_count", "max_idle_destroy_count",
+	}
+	got := make(map[string]bool, len(fields))
+	for name := range fields {
+		got[name] = true
+	}
+	want := make(map[string]bool, len(expected))
+	for _, name := range expected {
+		want[name] = true
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PoolStats fields = %v, expected %v", got, want)
+	}
+}
+
+func TestPoolUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		acquired int32
+		max      int32
+		expected int
+	}{
+		{"idle", 0, 10, 0},
+		{"partly used", 3, 4, 75},
+		{"rounds down", 2, 3, 66},
+		{"exhausted", 10, 10, 100},
+		{"no connections allowed", 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := poolUsage(tt.acquired, tt.max); got != tt.expected {
+				t.Errorf("poolUsage(%d, %d) = %d, expected %d", tt.acquired, tt.max, got, tt.expected)
+			}
+		})
+	}
+}
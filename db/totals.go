@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Count modes for the totals of paginated user listings
+const (
+	// CountModeExact counts matching users with COUNT(*)
+	CountModeExact = "exact"
+	// CountModeEstimate takes the unfiltered total from the planner's statistics in
+	// pg_class.reltuples, which costs nothing however large the table grows but lags
+	// behind writes until the next ANALYZE. Filtered totals are still counted.
+	CountModeEstimate = "estimate"
+)
+
+// exactCountBelow is the estimated table size under which estimate mode counts
+// exactly anyway: small tables are cheap to count, and an estimate that is off by a
+// few rows is conspicuous when there are only a few pages
+const exactCountBelow = 10000
+
+// maxCachedTotals bounds the totals cache, since every distinct search adds an entry
+const maxCachedTotals = 1000
+
+// queryEstimateUsers reads the planner's row estimate for users; it is -1 until the
+// table has been analyzed
+const queryEstimateUsers = "SELECT reltuples::bigint FROM pg_class WHERE oid = 'users'::regclass"
+
+// cachedTotal is a cached total and whether it is an estimate
+type cachedTotal struct {
+	total     int
+	estimated bool
+	expires   time.Time
+}
+
+// totalCache remembers the totals of paginated listings per filter set for a short
+// TTL, so paging through a stable result set counts it once rather than on every
+// page. A nil *totalCache caches nothing.
+type totalCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu         sync.Mutex
+	generation uint64
+	entries    map[string]cachedTotal
+}
+
+// newTotalCache returns a cache keeping totals for ttl, or nil when ttl disables it
+func newTotalCache(ttl time.Duration) *totalCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &totalCache{ttl: ttl, now: time.Now, entries: make(map[string]cachedTotal)}
+}
+
+// get returns the unexpired total cached for key
+func (c *totalCache) get(key string) (cachedTotal, bool) {
+	if c == nil {
+		return cachedTotal{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !c.now().Before(entry.expires) {
+		return cachedTotal{}, false
+	}
+	return entry, true
+}
+
+// currentGeneration returns the generation to pass to put for a total about to be
+// counted
+func (c *totalCache) currentGeneration() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put caches entry for key unless a write invalidated the cache since generation,
+// which would make the total stale already
+func (c *totalCache) put(key string, entry cachedTotal, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	now := c.now()
+	if len(c.entries) >= maxCachedTotals {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		// Still full of live entries: start over rather than track recency
+		if len(c.entries) >= maxCachedTotals {
+			clear(c.entries)
+		}
+	}
+	entry.expires = now.Add(c.ttl)
+	c.entries[key] = entry
+}
+
+// invalidate drops every cached total, for when users change
+func (c *totalCache) invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	clear(c.entries)
+}
+
+// totalKey identifies the filter set b selects
+func totalKey(b *whereBuilder) string {
+	var key strings.Builder
+	key.WriteString(b.where())
+	for _, arg := range b.args {
+		fmt.Fprintf(&key, "\x00%v", arg)
+	}
+	return key.String()
+}
+
+// total returns the number of users matching b for a page of them, and whether it is
+// an estimate. Totals are cached when the store has a cache, except inside a
+// transaction, which has to see its own writes.
+func (us *UserStore) total(ctx context.Context, b *whereBuilder) (cachedTotal, error) {
+	cache := us.db.totals
+	if _, inTx := us.q.(pgx.Tx); inTx {
+		cache = nil
+	}
+
+	key := totalKey(b)
+	if total, ok := cache.get(key); ok {
+		return total, nil
+	}
+	generation := cache.currentGeneration()
+
+	total, err := us.countTotal(ctx, b)
+	if err != nil {
+		return cachedTotal{}, err
+	}
+	cache.put(key, total, generation)
+	return total, nil
+}
+
+// countTotal queries the number of users matching b, estimating it in estimate mode
+// when b has no conditions and the table is large
+func (us *UserStore) countTotal(ctx context.Context, b *whereBuilder) (cachedTotal, error) {
+	var total cachedTotal
+	err := us.db.runRead(ctx, us.q, func(ctx context.Context, q Querier) error {
+		if us.db.estimateTotals && len(b.conds) == 0 {
+			var estimate int
+			if err := q.QueryRow(ctx, queryEstimateUsers).Scan(&estimate); err != nil {
+				return fmt.Errorf("failed to estimate users: %w", err)
+			}
+			if estimate >= exactCountBelow {
+				total = cachedTotal{total: estimate, estimated: true}
+				return nil
+			}
+		}
+
+		if err := q.QueryRow(ctx, usersCountQuery(b), b.args...).Scan(&total.total); err != nil {
+			return fmt.Errorf("failed to count users: %w", err)
+		}
+		return nil
+	})
+	return total, err
+}
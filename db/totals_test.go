@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// totalsQuerier answers counts and estimates with fixed numbers and pages with no
+// rows, counting the count and estimate queries it sees
+type totalsQuerier struct {
+	count, estimate   int
+	counts, estimates int
+}
+
+func (q *totalsQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+func (q *totalsQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	value := q.count
+	switch {
+	case sql == queryEstimateUsers:
+		q.estimates++
+		value = q.estimate
+	case strings.HasPrefix(sql, queryCountUsers):
+		q.counts++
+	}
+	rows := &fakeRows{rows: [][]any{{value}}}
+	rows.Next()
+	return rows
+}
+
+func (q *totalsQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.NewCommandTag("DELETE 1"), nil
+}
+
+func TestPaginatedTotalsCached(t *testing.T) {
+	ctx := context.Background()
+	totals := newTotalCache(time.Minute)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	totals.now = func() time.Time { return now }
+	q := &totalsQuerier{count: 42}
+	store := NewUserStore(&DB{totals: totals}).WithQuerier(q)
+	filtered := UserFilter{CreatedAfter: now.Add(-time.Hour)}
+
+	steps := []struct {
+		name   string
+		before func()
+		filter UserFilter
+		page   int
+		counts int
+	}{
+		{name: "first page counts", page: 1, counts: 1},
+		{name: "next pages reuse the total", page: 2, counts: 1},
+		{name: "last page reuses the total", page: 5, counts: 1},
+		{name: "another filter counts", filter: filtered, page: 1, counts: 2},
+		{name: "same filter reuses its total", filter: filtered, page: 2, counts: 2},
+		{
+			name: "deleting invalidates", page: 2, counts: 3,
+			before: func() { store.Delete(ctx, 1) },
+		},
+		{
+			name: "expired total counts again", page: 3, counts: 4,
+			before: func() { now = now.Add(time.Minute) },
+		},
+	}
+
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		result, err := store.GetAllPaginated(ctx, NewPaginationParams(step.page, 10), step.filter)
+		if err != nil {
+			t.Fatalf("%s: GetAllPaginated() error = %v", step.name, err)
+		}
+		if result.Total != 42 || result.TotalEstimated {
+			t.Errorf("%s: total = %d (estimated %v), expected an exact 42", step.name, result.Total, result.TotalEstimated)
+		}
+		if q.counts != step.counts {
+			t.Errorf("%s: %d counts ran, expected %d", step.name, q.counts, step.counts)
+		}
+	}
+}
+
+func TestTransactionWritesInvalidateTotalsWhenDone(t *testing.T) {
+	database, err := Open(Options{URL: "postgres://user@127.0.0.1:1/app", MaxConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	database.totals = newTotalCache(time.Minute)
+	ctx := context.Background()
+
+	// Before the commit a concurrent count would still see the deleted row, so the
+	// write inside the transaction must not start a new generation yet
+	tx := &fakeTx{db: &fakeDatabase{users: map[int]bool{1: true}}}
+	if err := NewUserStore(database).WithTx(tx).Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := database.totals.currentGeneration(); got != 0 {
+		t.Errorf("generation = %d after a write inside a transaction, expected 0", got)
+	}
+
+	database.WithTx(ctx, func(pgx.Tx) error { return nil })
+	if got := database.totals.currentGeneration(); got != 1 {
+		t.Errorf("generation = %d after WithTx returned, expected 1", got)
+	}
+}
+
+func TestPaginatedTotalsUncached(t *testing.T) {
+	q := &totalsQuerier{count: 42}
+	store := NewUserStore(&DB{}).WithQuerier(q)
+
+	for page := 1; page <= 3; page++ {
+		if _, err := store.GetAllPaginated(context.Background(), NewPaginationParams(page, 10), UserFilter{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.counts != 3 {
+		t.Errorf("%d counts ran for 3 pages without a cache, expected 3", q.counts)
+	}
+}
+
+func TestPaginatedTotalsEstimated(t *testing.T) {
+	tests := []struct {
+		name              string
+		estimate          int
+		filter            UserFilter
+		expectedTotal     int
+		expectedEstimated bool
+		expectedCounts    int
+	}{
+		{"large table is estimated", 250_000, UserFilter{}, 250_000, true, 0},
+		{"small table is counted", exactCountBelow - 1, UserFilter{}, 42, false, 1},
+		{"never analyzed is counted", -1, UserFilter{}, 42, false, 1},
+		{"filters are counted", 250_000, UserFilter{CreatedBefore: time.Now()}, 42, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &totalsQuerier{count: 42, estimate: tt.estimate}
+			store := NewUserStore(&DB{estimateTotals: true}).WithQuerier(q)
+
+			// Far past the counted total, which is only clamped when exact
+			result, err := store.GetAllPaginated(context.Background(), NewPaginationParams(100, 10), tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Total != tt.expectedTotal || result.TotalEstimated != tt.expectedEstimated {
+				t.Errorf("total = %d (estimated %v), expected %d (estimated %v)", result.Total, result.TotalEstimated, tt.expectedTotal, tt.expectedEstimated)
+			}
+			if q.counts != tt.expectedCounts {
+				t.Errorf("%d counts ran, expected %d", q.counts, tt.expectedCounts)
+			}
+			if result.PageAdjusted == tt.expectedEstimated {
+				t.Errorf("page_adjusted = %v, expected clamping only for exact totals", result.PageAdjusted)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// slowAcquireThreshold is the wait above which an acquisition is logged at debug level
+const slowAcquireThreshold = 100 * time.Millisecond
+
+type acquireStartKey struct{}
+
+type acquireOutcomeKey struct{}
+
+// acquireOutcome is where the tracer notes that acquiring a connection for a query
+// failed on an exhausted pool. The error pgx returns is just the context's, so this
+// is the only way to tell waiting for a connection from waiting for the query.
+type acquireOutcome struct {
+	exhausted atomic.Bool
+}
+
+// trackAcquire returns a copy of ctx in which the tracer records acquisition outcomes
+func trackAcquire(ctx context.Context) context.Context {
+	return context.WithValue(ctx, acquireOutcomeKey{}, &acquireOutcome{})
+}
+
+// acquireExhausted reports whether a query run with ctx, from trackAcquire, failed to
+// get a connection because the pool was exhausted
+func acquireExhausted(ctx context.Context) bool {
+	outcome, ok := ctx.Value(acquireOutcomeKey{}).(*acquireOutcome)
+	return ok && outcome.exhausted.Load()
+}
+
+// acquireTracer measures how long callers wait for a pool connection. pgxpool
+// discovers it through ConnConfig.Tracer, so it also has to be a (no-op) QueryTracer.
+type acquireTracer struct {
+	wait prometheus.Observer
+}
+
+func (t *acquireTracer) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return context.WithValue(ctx, acquireStartKey{}, time.Now())
+}
+
+func (t *acquireTracer) TraceAcquireEnd(ctx context.Context, pool *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	if data.Err != nil && poolExhausted(pool, data.Err) {
+		if outcome, ok := ctx.Value(acquireOutcomeKey{}).(*acquireOutcome); ok {
+			outcome.exhausted.Store(true)
+		}
+	}
+
+	start, ok := ctx.Value(acquireStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+
+	waited := time.Since(start)
+	t.wait.Observe(waited.Seconds())
+	if waited >= slowAcquireThreshold {
+		slog.DebugContext(ctx, "Slow connection acquisition", "waited", waited, "error", data.Err)
+	}
+}
+
+func (t *acquireTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	return ctx
+}
+
+func (t *acquireTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
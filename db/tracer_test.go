@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestAcquireTracerObservesWait(t *testing.T) {
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_acquire_wait_seconds"})
+	tracer := &acquireTracer{wait: hist}
+
+	// With the pool exhausted, callers block between start and end until a
+	// connection is released; simulate that wait
+	const waited = 20 * time.Millisecond
+	for range 3 {
+		ctx := tracer.TraceAcquireStart(context.Background(), nil, pgxpool.TraceAcquireStartData{})
+		time.Sleep(waited)
+		tracer.TraceAcquireEnd(ctx, nil, pgxpool.TraceAcquireEndData{})
+	}
+
+	var m dto.Metric
+	if err := hist.Write(&m); err != nil {
+		t.Fatalf("reading histogram: %v", err)
+	}
+	if got := m.GetHistogram().GetSampleCount(); got != 3 {
+		t.Errorf("sample count = %d, expected 3", got)
+	}
+	if got := m.GetHistogram().GetSampleSum(); got < 3*waited.Seconds() {
+		t.Errorf("sample sum = %fs, expected at least %fs", got, 3*waited.Seconds())
+	}
+}
+
+func TestAcquireTracerIgnoresUntracedContext(t *testing.T) {
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_acquire_wait_seconds"})
+	tracer := &acquireTracer{wait: hist}
+
+	tracer.TraceAcquireEnd(context.Background(), nil, pgxpool.TraceAcquireEndData{})
+
+	var m dto.Metric
+	if err := hist.Write(&m); err != nil {
+		t.Fatalf("reading histogram: %v", err)
+	}
+	if got := m.GetHistogram().GetSampleCount(); got != 0 {
+		t.Errorf("sample count = %d, expected 0", got)
+	}
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier is the subset of pgx query methods used by the stores. Both *pgxpool.Pool
+// and pgx.Tx satisfy it, so store methods run unchanged inside a transaction, and
+// tests can bind a store to a fake with WithQuerier.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// txBeginner starts transactions. *pgxpool.Pool begins a real transaction while
+// pgx.Tx begins a savepoint, so nested use composes naturally.
+type txBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// WithTx runs fn inside a transaction, committing when fn returns nil and rolling back
+// when it returns an error or panics. The transaction runs through the circuit breaker
+// like any store call, so it fails fast while the breaker is open and must finish
+// within the breaker's timeout. Bind stores to the transaction with WithTx to compose
+// operations atomically:
+//
+//	err := database.WithTx(ctx, func(tx pgx.Tx) error {
+//		if _, err := users.WithTx(tx).Add(ctx, name, email); err != nil {
+//			return err
+//		}
+//		_, err := counter.WithTx(tx).Increment(ctx)
+//		return err
+//	})
+func (db *DB) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	err := db.ExecuteWithCircuitBreaker(ctx, func(ctx context.Context) error {
+		return withTx(ctx, db.Pool, fn)
+	})
+	// Stores bound to the transaction leave the cached totals alone, since their
+	// writes only become visible to other counts now
+	db.totals.invalidate()
+	return err
+}
+
+// withTx implements WithTx against any transaction starter
+func withTx(ctx context.Context, b txBeginner, fn func(tx pgx.Tx) error) error {
+	tx, err := b.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil && !errors.Is(rbErr, pgx.ErrTxClosed) {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeDatabase holds committed state for the transaction tests
+type fakeDatabase struct {
+	users   map[int]bool
+	counter int
+	history []int
+}
+
+// fakeTx buffers writes until Commit so rollback behaviour can be observed.
+// Only the methods used by the stores are implemented.
+type fakeTx struct {
+	pgx.Tx
+	db         *fakeDatabase
+	pending    []func(*fakeDatabase)
+	closed     bool
+	committed  bool
+	rolledBack bool
+	failUpdate bool
+}
+
+func (tx *fakeTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeSavepoint{fakeTx: tx, mark: len(tx.pending)}, nil
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	switch {
+	case strings.HasPrefix(sql, "DELETE FROM users"):
+		id := args[0].(int)
+		tx.pending = append(tx.pending, func(db *fakeDatabase) { delete(db.users, id) })
+		return pgconn.NewCommandTag("DELETE 1"), nil
+	case strings.HasPrefix(sql, "INSERT INTO counter_history"):
+		delta := args[1].(int)
+		tx.pending = append(tx.pending, func(db *fakeDatabase) { db.history = append(db.history, delta) })
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	}
+	return pgconn.CommandTag{}, fmt.Errorf("unexpected statement %q", sql)
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	switch {
+	case strings.HasPrefix(sql, "INSERT INTO counter_state"):
+		return fakeRow{value: tx.db.counter}
+	case strings.HasPrefix(sql, "UPDATE counter_state"):
+		if tx.failUpdate {
+			return fakeRow{err: errors.New("counter update failed")}
+		}
+		next := tx.db.counter + 1
+		tx.pending = append(tx.pending, func(db *fakeDatabase) { db.counter = next })
+		return fakeRow{value: next}
+	}
+	return fakeRow{err: fmt.Errorf("unexpected query %q", sql)}
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	if tx.closed {
+		return pgx.ErrTxClosed
+	}
+	for _, apply := range tx.pending {
+		apply(tx.db)
+	}
+	tx.closed, tx.committed = true, true
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	if tx.closed {
+		return pgx.ErrTxClosed
+	}
+	tx.pending = nil
+	tx.closed, tx.rolledBack = true, true
+	return nil
+}
+
+// fakeSavepoint mimics a nested transaction started from a fakeTx
+type fakeSavepoint struct {
+	*fakeTx
+	mark   int
+	closed bool
+}
+
+func (sp *fakeSavepoint) Commit(ctx context.Context) error {
+	sp.closed = true
+	return nil
+}
+
+func (sp *fakeSavepoint) Rollback(ctx context.Context) error {
+	if sp.closed {
+		return pgx.ErrTxClosed
+	}
+	sp.pending = sp.pending[:sp.mark]
+	sp.closed = true
+	return nil
+}
+
+type fakeRow struct {
+	value int
+	err   error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*int) = r.value
+	return nil
+}
+
+type fakeBeginner struct {
+	tx *fakeTx
+}
+
+func (b *fakeBeginner) Begin(ctx context.Context) (pgx.Tx, error) {
+	return b.tx, nil
+}
+
+// deleteUserAndIncrement composes two store operations in one transaction
+func deleteUserAndIncrement(tx pgx.Tx) error {
+	ctx := context.Background()
+	database := &DB{}
+	if err := NewUserStore(database).WithTx(tx).Delete(ctx, 1); err != nil {
+		return err
+	}
+	_, err := NewCounterStore(database).WithTx(tx).Increment(ctx)
+	return err
+}
+
+func TestWithTxCommit(t *testing.T) {
+	db := &fakeDatabase{users: map[int]bool{1: true}}
+	tx := &fakeTx{db: db}
+
+	if err := withTx(context.Background(), &fakeBeginner{tx: tx}, deleteUserAndIncrement); err != nil {
+		t.Fatalf("withTx() unexpected error: %v", err)
+	}
+
+	if !tx.committed {
+		t.Error("transaction was not committed")
+	}
+	if db.users[1] {
+		t.Error("user 1 should have been deleted")
+	}
+	if db.counter != 1 {
+		t.Errorf("counter = %d, expected 1", db.counter)
+	}
+	if len(db.history) != 1 || db.history[0] != 1 {
+		t.Errorf("history = %v, expected a single +1 event", db.history)
+	}
+}
+
+func TestWithTxRollbackOnError(t *testing.T) {
+	db := &fakeDatabase{users: map[int]bool{1: true}}
+	tx := &fakeTx{db: db, failUpdate: true}
+
+	err := withTx(context.Background(), &fakeBeginner{tx: tx}, deleteUserAndIncrement)
+	if err == nil {
+		t.Fatal("withTx() expected error from the failing counter update")
+	}
+
+	if !tx.rolledBack || tx.committed {
+		t.Error("transaction should have been rolled back, not committed")
+	}
+	if !db.users[1] {
+		t.Error("partial write: user 1 was deleted despite the rollback")
+	}
+	if db.counter != 0 {
+		t.Errorf("counter = %d, expected 0 after rollback", db.counter)
+	}
+	if len(db.history) != 0 {
+		t.Errorf("history = %v, expected no events after rollback", db.history)
+	}
+}
+
+func TestWithTxRollbackOnPanic(t *testing.T) {
+	db := &fakeDatabase{users: map[int]bool{1: true}}
+	tx := &fakeTx{db: db}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected the panic to propagate")
+		}
+		if !tx.rolledBack {
+			t.Error("transaction should have been rolled back on panic")
+		}
+		if !db.users[1] {
+			t.Error("partial write: user 1 was deleted despite the panic")
+		}
+	}()
+
+	withTx(context.Background(), &fakeBeginner{tx: tx}, func(tx pgx.Tx) error {
+		NewUserStore(&DB{}).WithTx(tx).Delete(context.Background(), 1)
+		panic("boom")
+	})
+}
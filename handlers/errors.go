@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"htmx-learn/circuitbreaker"
+	"htmx-learn/db"
+	"htmx-learn/templates/components"
+)
+
+// Machine-readable error codes, sent to JSON clients alongside the message
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeDuplicateEmail   = "duplicate_email"
+	CodePageTooDeep      = "page_too_deep"
+	CodeRequestTooLarge  = "request_too_large"
+	CodeReadOnly         = "read_only"
+	CodeMaintenance      = "maintenance"
+	CodeOverloaded       = "overloaded"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+)
+
+// errorBody is the JSON envelope of every error response: a code from the list above
+// and one or more messages. Allowed is only set on a 405, listing the methods the
+// path accepts like the Allow header does.
+type errorBody struct {
+	Code    string   `json:"code"`
+	Errors  []string `json:"errors"`
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+// AppError is an error that knows how to be reported: the HTTP status, a stable code
+// for API clients, and a message safe to show to users. The wrapped cause is logged
+// but never sent.
+type AppError struct {
+	Status  int
+	Code    string
+	Message string
+	Err     error
+	// RetryAfter, when positive, is sent as Retry-After, rounded up to whole seconds
+	RetryAfter time.Duration
+}
+
+func (e *AppError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// badRequest is an AppError for input the client must fix
+func badRequest(message string) *AppError {
+	return &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: message}
+}
+
+// notFound is an AppError for a missing resource, wrapping the lookup's error
+func notFound(message string, err error) *AppError {
+	return &AppError{Status: http.StatusNotFound, Code: CodeNotFound, Message: message, Err: err}
+}
+
+// asAppError returns the AppError err carries, mapping the sentinels handlers commonly
+// see to their responses. Anything else is an internal error whose details stay in
+// the log.
+func asAppError(err error) *AppError {
+	var appErr *AppError
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.Is(err, pgx.ErrNoRows):
+		return notFound("Not found", err)
+	case errors.Is(err, db.ErrDuplicateEmail):
+		return &AppError{Status: http.StatusConflict, Code: CodeDuplicateEmail, Message: db.ErrDuplicateEmail.Error(), Err: err}
+	case errors.Is(err, db.ErrPageTooDeep):
+		// CheckDepth's message explains how to page deeper instead
+		return &AppError{Status: http.StatusBadRequest, Code: CodePageTooDeep, Message: err.Error()}
+	case errors.Is(err, db.ErrReadOnly):
+		// Writes are off on purpose, not failing, so the message says so
+		return &AppError{Status: http.StatusServiceUnavailable, Code: CodeReadOnly, Message: db.ErrReadOnly.Error(), Err: err}
+	case errors.Is(err, db.ErrPoolExhausted):
+		// Temporary overload, so the client is asked to retry shortly
+		return &AppError{
+			Status: http.StatusServiceUnavailable, Code: CodeOverloaded,
+			Message: "Service temporarily overloaded", Err: err, RetryAfter: time.Second,
+		}
+	case errors.Is(err, circuitbreaker.ErrCircuitBreakerOpen), errors.Is(err, circuitbreaker.ErrCircuitBreakerTimeout):
+		// The database is being shielded rather than broken, so clients should back off
+		// until the breaker lets calls through again
+		retryAfter, ok := circuitbreaker.RetryAfter(err)
+		if !ok {
+			retryAfter = circuitbreaker.DefaultConfig().ResetTimeout
+		}
+		return &AppError{
+			Status: http.StatusServiceUnavailable, Code: CodeUnavailable,
+			Message: "Service temporarily unavailable", Err: err, RetryAfter: max(retryAfter, time.Second),
+		}
+	default:
+		return &AppError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Internal server error", Err: err}
+	}
+}
+
+// errorsTarget is the layout's container for errors that don't belong to a form
+const errorsTarget = "#errors"
+
+// writeError is the one place handlers turn an error into a response. err is an
+// AppError or is mapped to one by asAppError; handlers wrap other errors with what
+// they were doing, which is logged. Clients that asked for or sent JSON get the
+// errorBody envelope, {"code": ..., "errors": [message]}; HTMX requests get
+// a FormError retargeted into the layout's error container, since the layout only
+// swaps error responses that carry HX-Retarget; everyone else gets plain text.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	appErr := asAppError(err)
+
+	attrs := []any{"path", r.URL.Path, "status", appErr.Status, "code", appErr.Code, "error", err}
+	switch {
+	case appErr.Status == http.StatusServiceUnavailable:
+		slog.WarnContext(r.Context(), "Handler error", attrs...)
+	case appErr.Status >= http.StatusInternalServerError:
+		slog.ErrorContext(r.Context(), "Handler error", attrs...)
+	default:
+		slog.DebugContext(r.Context(), "Request rejected", attrs...)
+	}
+
+	if appErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(appErr.RetryAfter.Seconds()))))
+	}
+	if wantsJSON(r) || hasJSONBody(r) {
+		writeJSONErrors(w, appErr.Status, appErr.Code, []string{appErr.Message})
+		return
+	}
+	if isHTMX(r) {
+		w.Header().Set("HX-Retarget", errorsTarget)
+		w.Header().Set("HX-Reswap", "innerHTML")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(appErr.Status)
+		if err := components.FormError([]string{appErr.Message}).Render(r.Context(), w); err != nil {
+			slog.ErrorContext(r.Context(), "Error rendering error message", "path", r.URL.Path, "error", err)
+		}
+		return
+	}
+	http.Error(w, appErr.Message, appErr.Status)
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+
+	"htmx-learn/circuitbreaker"
+	"htmx-learn/db"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name               string
+		err                error
+		expectedStatus     int
+		expectedCode       string
+		expectedMessage    string
+		expectedRetryAfter string
+	}{
+		{"app error", badRequest("floor must be 0"), http.StatusBadRequest, CodeInvalidRequest, "floor must be 0", ""},
+		{"wrapped app error", fmt.Errorf("deleting user: %w", notFound("User not found", pgx.ErrNoRows)), http.StatusNotFound, CodeNotFound, "User not found", ""},
+		{"no rows", fmt.Errorf("getting user: %w", pgx.ErrNoRows), http.StatusNotFound, CodeNotFound, "Not found", ""},
+		{"duplicate email", fmt.Errorf("creating user: %w", db.ErrDuplicateEmail), http.StatusConflict, CodeDuplicateEmail, db.ErrDuplicateEmail.Error(), ""},
+		{"page too deep", db.NewPaginationParams(5000, 10).CheckDepth(100), http.StatusBadRequest, CodePageTooDeep, "page too deep, use cursor pagination", ""},
+		{"read-only", fmt.Errorf("incrementing counter: %w", db.ErrReadOnly), http.StatusServiceUnavailable, CodeReadOnly, db.ErrReadOnly.Error(), ""},
+		{"pool exhausted", fmt.Errorf("getting users: %w", db.ErrPoolExhausted), http.StatusServiceUnavailable, CodeOverloaded, "Service temporarily overloaded", "1"},
+		{"circuit breaker open", circuitbreaker.ErrCircuitBreakerOpen, http.StatusServiceUnavailable, CodeUnavailable, "Service temporarily unavailable", "30"},
+		{"circuit breaker timeout", fmt.Errorf("getting users: %w", circuitbreaker.ErrCircuitBreakerTimeout), http.StatusServiceUnavailable, CodeUnavailable, "Service temporarily unavailable", "30"},
+		{"anything else", errors.New("connection reset by peer"), http.StatusInternalServerError, CodeInternal, "Internal server error", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, format := range []string{"text", "htmx", "json"} {
+				req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+				switch format {
+				case "htmx":
+					req.Header.Set("HX-Request", "true")
+				case "json":
+					req.Header.Set("Accept", "application/json")
+				}
+				rec := httptest.NewRecorder()
+
+				writeError(rec, req, tt.err)
+
+				if rec.Code != tt.expectedStatus {
+					t.Errorf("%s: status = %d, expected %d", format, rec.Code, tt.expectedStatus)
+				}
+				if got := rec.Header().Get("Retry-After"); got != tt.expectedRetryAfter {
+					t.Errorf("%s: Retry-After = %q, expected %q", format, got, tt.expectedRetryAfter)
+				}
+				if format == "htmx" {
+					// Swapped into the layout's error container instead of the request's target
+					if got := rec.Header().Get("HX-Retarget"); got != errorsTarget {
+						t.Errorf("htmx: HX-Retarget = %q, expected %q", got, errorsTarget)
+					}
+					if body := html.UnescapeString(rec.Body.String()); !strings.Contains(body, `role="alert"`) || !strings.Contains(body, tt.expectedMessage) {
+						t.Errorf("htmx: body = %q, expected a FormError with %q", body, tt.expectedMessage)
+					}
+					continue
+				}
+				if format == "text" {
+					if body := rec.Body.String(); !strings.Contains(body, tt.expectedMessage) {
+						t.Errorf("text: body = %q, expected it to contain %q", body, tt.expectedMessage)
+					}
+					continue
+				}
+
+				var body struct {
+					Code   string   `json:"code"`
+					Errors []string `json:"errors"`
+				}
+				if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+					t.Fatalf("json: decoding body: %v", err)
+				}
+				if body.Code != tt.expectedCode || len(body.Errors) != 1 || !strings.Contains(body.Errors[0], tt.expectedMessage) {
+					t.Errorf("json: body = %+v, expected code %q and message %q", body, tt.expectedCode, tt.expectedMessage)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenCircuitBreakerIsServiceUnavailable(t *testing.T) {
+	database, err := db.Open(db.Options{URL: "postgres://user@127.0.0.1:1/app", MaxConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	h := newTestHandlers(t, 0)
+	h.userStore = db.NewUserStore(database)
+
+	list := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/paginated", nil)
+		req.Header.Set("HX-Request", "true")
+		rec := httptest.NewRecorder()
+		h.GetUsersPaginated(rec, req)
+		return rec
+	}
+
+	// The database is unreachable, so listings fail until the breaker opens
+	for range circuitbreaker.DefaultConfig().MaxFailures {
+		if rec := list(); rec.Code != http.StatusInternalServerError {
+			t.Fatalf("closed breaker: status = %d, expected 500 from the connection error", rec.Code)
+		}
+	}
+
+	rec := list()
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("open breaker: status = %d, expected 503", rec.Code)
+	}
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil || retryAfter <= 0 || retryAfter > 30 {
+		t.Errorf("open breaker: Retry-After = %q, expected up to the 30s reset timeout", rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestWriteErrorHidesCause(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	rec := httptest.NewRecorder()
+
+	writeError(rec, req, fmt.Errorf("getting users: %w", errors.New(`relation "users" does not exist`)))
+
+	if strings.Contains(rec.Body.String(), "users") {
+		t.Errorf("body = %q, expected the cause to stay out of the response", rec.Body.String())
+	}
+}
+
+func TestDeleteUserStatusCodes(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             string
+		expectedStatus int
+	}{
+		{"existing user", "1", http.StatusOK},
+		{"missing user", "999", http.StatusNotFound},
+		{"malformed id", "abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, 2)
+			req := httptest.NewRequest(http.MethodDelete, "/api/users/"+tt.id, nil)
+			req.SetPathValue("id", tt.id)
+			rec := httptest.NewRecorder()
+
+			h.DeleteUser(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("status = %d, expected %d (body %q)", rec.Code, tt.expectedStatus, rec.Body.String())
+			}
+		})
+	}
+}
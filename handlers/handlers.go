@@ -1,19 +1,46 @@
 package handlers
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"htmx-learn/circuitbreaker"
 	"htmx-learn/config"
 	"htmx-learn/db"
+	"htmx-learn/logging"
+	"htmx-learn/middleware"
+	"htmx-learn/router"
+	"htmx-learn/static"
 	"htmx-learn/templates/components"
 	"htmx-learn/templates/pages"
 	"htmx-learn/validation"
+	"htmx-learn/version"
+	"github.com/a-h/templ"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// paginationModeHeader selects how paginated HTMX responses are navigated
+	paginationModeHeader   = "X-Pagination-Mode"
+	paginationModeInfinite = "infinite"
+
+	// searchModeFTS selects ranked full-text search instead of substring matching
+	searchModeFTS = "fts"
 )
 
 type Handlers struct {
@@ -21,19 +48,69 @@ type Handlers struct {
 	userStore    db.UserRepository
 	config       *config.Config
 	database     *db.DB
+	counterHub   *hub
+	userHub      *hub
+	maintenance  atomic.Bool
+	render       RenderOptions
+	now          func() time.Time
+	location     *time.Location
+	searchCache  *searchCache
+	clientIPs    *middleware.ClientIPResolver
+	// formRedactor masks sensitive fields wherever form data is logged
+	formRedactor *middleware.FormRedactor
+	// draining is closed by Drain to tell long-lived streams the server is stopping
+	draining  chan struct{}
+	drainOnce sync.Once
+	// checkDatabase pings a pool for the health checks; tests substitute it
+	checkDatabase func(context.Context, *pgxpool.Pool) error
 }
 
-func New(database *db.DB, cfg *config.Config) *Handlers {
-	return &Handlers{
-		counterStore: db.NewCounterStore(database),
-		userStore:    db.NewUserStore(database),
+func New(database *db.DB, cfg *config.Config, render RenderOptions) *Handlers {
+	var userStore db.UserRepository = db.NewUserStore(database)
+	// Coalescing sits under the cache, so concurrent cache misses share one query
+	if cfg.UserCountCoalesce {
+		userStore = db.NewCoalescingUserRepository(userStore)
+	}
+	if cfg.UserCacheTTL > 0 {
+		userStore = db.NewCachingUserRepository(userStore, cfg.UserCacheTTL)
+	}
+	var counterStore db.CounterRepository = db.NewCounterStore(database)
+	// Read-only mode sits outermost, so refused writes don't even invalidate the cache
+	if cfg.ReadOnly {
+		userStore = db.NewReadOnlyUserRepository(userStore)
+		counterStore = db.NewReadOnlyCounterRepository(counterStore)
+	}
+	
+	// Validate has already checked the name, so this only guards direct construction
+	location, err := time.LoadLocation(cfg.DisplayTimezone)
+	if err != nil {
+		slog.Warn("Invalid display time zone, using local time", "timezone", cfg.DisplayTimezone, "error", err)
+		location = time.Local
+	}
+	
+	h := &Handlers{
+		counterStore: counterStore,
+		userStore:    userStore,
 		config:       cfg,
 		database:     database,
+		counterHub:   newHub(),
+		userHub:      newHub(),
+		render:       render,
+		now:          time.Now,
+		location:     location,
+		searchCache:  newSearchCache(cfg.SearchCacheTTL, cfg.SearchCacheSize),
+		clientIPs:    middleware.NewClientIPResolver(cfg.TrustedProxies),
+		formRedactor: middleware.NewFormRedactor(cfg.LogRedactFields),
+		draining:     make(chan struct{}),
+	
+		checkDatabase: checkDatabaseHealth,
 	}
+	h.maintenance.Store(cfg.MaintenanceMode)
+	return h
 }
 
 func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, r, pages.Home())
+	h.renderTemplate(w, r, pages.Home())
 }
 
 func (h *Handlers) CounterPage(w http.ResponseWriter, r *http.Request) {
@@ -42,157 +119,460 @@ func (h *Handlers) CounterPage(w http.ResponseWriter, r *http.Request) {
 		slog.Error("Error getting counter", "error", err)
 		count = 0
 	}
-	renderTemplate(w, r, pages.CounterPage(count))
+	h.renderTemplate(w, r, pages.CounterPage(count))
 }
 
 func (h *Handlers) DynamicPage(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, r, pages.DynamicPage())
+	h.renderTemplate(w, r, pages.DynamicPage())
 }
 
 func (h *Handlers) CounterIncrement(w http.ResponseWriter, r *http.Request) {
 	count, err := h.counterStore.Increment(r.Context())
 	if err != nil {
-		handleError(w, "incrementing counter", err)
+		writeError(w, r, fmt.Errorf("incrementing counter: %w", err))
 		return
 	}
-	renderTemplate(w, r, components.CountDisplay(count))
+	h.publishCount(r.Context(), count)
+	h.renderTemplate(w, r, components.CountDisplay(count))
 }
 
+// CounterDecrement lowers the counter by one. With ?floor=0 it never goes below zero: a
+// decrement at zero changes nothing and answers with the unchanged count plus a
+// counterAtFloor HX-Trigger event, or {"count":0,"changed":false} for JSON clients.
 func (h *Handlers) CounterDecrement(w http.ResponseWriter, r *http.Request) {
-	count, err := h.counterStore.Decrement(r.Context())
+	if !r.URL.Query().Has("floor") {
+		count, err := h.counterStore.Decrement(r.Context())
+		if err != nil {
+			writeError(w, r, fmt.Errorf("decrementing counter: %w", err))
+			return
+		}
+		h.publishCount(r.Context(), count)
+		h.renderTemplate(w, r, components.CountDisplay(count))
+		return
+	}
+	
+	// Only zero is supported: the floor is enforced by the UPDATE itself
+	if r.URL.Query().Get("floor") != "0" {
+		writeError(w, r, badRequest("floor must be 0"))
+		return
+	}
+	
+	count, changed, err := h.counterStore.DecrementIfPositive(r.Context())
 	if err != nil {
-		handleError(w, "decrementing counter", err)
+		writeError(w, r, fmt.Errorf("decrementing counter: %w", err))
 		return
 	}
-	renderTemplate(w, r, components.CountDisplay(count))
+	if changed {
+		h.publishCount(r.Context(), count)
+	}
+	
+	if !isHTMX(r) && wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"count": count, "changed": changed})
+		return
+	}
+	if !changed {
+		setHXTrigger(w, "counterAtFloor", map[string]int{"floor": 0})
+	}
+	h.renderTemplate(w, r, components.CountDisplay(count))
 }
 
 func (h *Handlers) CounterReset(w http.ResponseWriter, r *http.Request) {
 	count, err := h.counterStore.Reset(r.Context())
 	if err != nil {
-		handleError(w, "resetting counter", err)
+		writeError(w, r, fmt.Errorf("resetting counter: %w", err))
 		return
 	}
-	renderTemplate(w, r, components.CountDisplay(count))
+	h.publishCount(r.Context(), count)
+	h.renderTemplate(w, r, components.CountDisplay(count))
 }
 
-func (h *Handlers) GetTime(w http.ResponseWriter, r *http.Request) {
-	currentTime := time.Now()
-	renderTemplate(w, r, components.TimeDisplay(currentTime))
+// CounterEvents streams the rendered count to SSE clients whenever it changes
+func (h *Handlers) CounterEvents(w http.ResponseWriter, r *http.Request) {
+	count, err := h.counterStore.Get(r.Context())
+	if err != nil {
+		writeError(w, r, fmt.Errorf("getting counter: %w", err))
+		return
+	}
+	
+	initial, err := countEvent(r.Context(), count)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("rendering counter: %w", err))
+		return
+	}
+	serveEvents(w, r, h.counterHub, h.draining, initial)
 }
 
-func (h *Handlers) GetUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.userStore.GetAll(r.Context())
+// publishCount notifies counter subscribers of a new value
+func (h *Handlers) publishCount(ctx context.Context, count int) {
+	e, err := countEvent(ctx, count)
 	if err != nil {
-		handleError(w, "getting users", err)
+		slog.Error("Error rendering counter event", "error", err)
 		return
 	}
+	h.counterHub.publish(e)
+}
+
+// UserEvents streams out-of-band user list changes to SSE clients
+func (h *Handlers) UserEvents(w http.ResponseWriter, r *http.Request) {
+	serveEvents(w, r, h.userHub, h.draining)
+}
+
+// publishUsers notifies user list subscribers with a rendered out-of-band fragment.
+// The users changed, so cached search results are dropped too.
+func (h *Handlers) publishUsers(ctx context.Context, fragment templ.Component) {
+	h.searchCache.purge()
+	e, err := renderEvent(ctx, "users", fragment)
+	if err != nil {
+		slog.Error("Error rendering user event", "error", err)
+		return
+	}
+	h.userHub.publish(e)
+}
+
+// CounterHistory renders the most recent counter changes
+func (h *Handlers) CounterHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil {
+			writeError(w, r, badRequest("Invalid limit"))
+			return
+		}
+		limit = l
+	}
 	
-	templateUsers := convertToTemplateUsers(users)
-	
-	for _, user := range templateUsers {
-		if err := components.UserCard(user).Render(r.Context(), w); err != nil {
-			slog.Error("Template rendering error", "error", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+	events, err := h.counterStore.History(r.Context(), limit)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("getting counter history: %w", err))
+		return
+	}
+	h.renderTemplate(w, r, components.CounterHistory(convertToTemplateCounterEvents(events)))
+}
+
+// defaultTimeFormat is how GetTime formats the time unless DISPLAY_TIME_FORMAT says otherwise
+const defaultTimeFormat = "2006-01-02 15:04:05 MST"
+
+// GetTime renders the server time in DISPLAY_TIMEZONE, or in the IANA zone named by
+// the tz query parameter, formatted with DISPLAY_TIME_FORMAT. Clients may cache it for
+// TIME_MAX_AGE: the time shown is rounded down to that interval, or to the second when
+// caching is off, and doubles as Last-Modified, so a client revalidating with
+// If-Modified-Since gets a 304 until the next interval begins, since the fragment
+// would be identical.
+func (h *Handlers) GetTime(w http.ResponseWriter, r *http.Request) {
+	location := h.location
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		requested, err := time.LoadLocation(tz)
+		if err != nil {
+			writeError(w, r, badRequest("tz must be an IANA time zone name such as Europe/Paris"))
 			return
 		}
+		location = requested
 	}
+	
+	maxAge := h.config.TimeMaxAge
+	currentTime := h.now().Truncate(max(maxAge, time.Second))
+	
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	w.Header().Set("Last-Modified", currentTime.UTC().Format(http.TimeFormat))
+	if notModifiedSince(r, currentTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	layout := cmp.Or(h.config.DisplayTimeFormat, defaultTimeFormat)
+	h.renderTemplate(w, r, components.TimeDisplay(currentTime.In(location), layout))
+}
+
+// defaultUsersListLimit caps GetUsers when the configuration doesn't
+const defaultUsersListLimit = 500
+
+// GetUsers renders the newest users as cards, at most USERS_LIST_LIMIT of them.
+// X-Total-Count reports how many users exist, and when some were left out a Link
+// header points clients at the paginated endpoint.
+func (h *Handlers) GetUsers(w http.ResponseWriter, r *http.Request) {
+	limit := h.config.UsersListLimit
+	if limit <= 0 {
+		limit = defaultUsersListLimit
+	}
+	
+	result, err := h.userStore.GetAllPaginated(r.Context(), db.PaginationParams{Page: 1, PageSize: limit}, db.UserFilter{})
+	if err != nil {
+		writeError(w, r, fmt.Errorf("getting users: %w", err))
+		return
+	}
+	
+	w.Header().Set("X-Total-Count", strconv.Itoa(result.Total))
+	if result.HasNext {
+		first := h.absoluteURL(r, "/api/users/paginated", url.Values{
+			"page":      {"1"},
+			"page_size": {strconv.Itoa(db.MaxPageSize)},
+		})
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="first"`, first))
+	}
+	
+	h.renderTemplate(w, r, components.UserCards(convertToTemplateUsers(result.Data)))
 }
 
+// CreateUser adds a user from the HTMX form, or from a JSON body for API clients
 func (h *Handlers) CreateUser(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+	if hasJSONBody(r) {
+		h.createUserJSON(w, r)
+		return
+	}
+	
+	if !h.parseForm(w, r) {
 		return
 	}
 	
 	// Sanitize and validate input
 	input := validation.UserInput{
-		Name:  validation.SanitizeInput(r.FormValue("user-name")),
+		Name:  validation.NormalizeName(r.FormValue("user-name")),
 		Email: validation.SanitizeInput(r.FormValue("user-email")),
 	}
 	
 	if err := validation.ValidateUser(input); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.respondValidationError(w, r, "#form-errors", err)
 		return
 	}
 	
 	user, err := h.userStore.Add(r.Context(), input.Name, input.Email)
 	if err != nil {
-		handleError(w, "creating user", err)
+		if errors.Is(err, db.ErrDuplicateEmail) {
+			h.respondFormError(w, r, "#form-errors", http.StatusConflict, CodeDuplicateEmail, []string{db.ErrDuplicateEmail.Error()})
+			return
+		}
+		if errors.Is(err, db.ErrReadOnly) {
+			h.respondFormError(w, r, "#form-errors", http.StatusServiceUnavailable, CodeReadOnly, []string{db.ErrReadOnly.Error()})
+			return
+		}
+		writeError(w, r, fmt.Errorf("creating user: %w", err))
 		return
 	}
 	
 	templateUser := convertToTemplateUser(user)
-	renderTemplate(w, r, components.UserCard(templateUser))
+	h.publishUsers(r.Context(), components.UserAdded(templateUser))
+	setHXTrigger(w, "userCreated", map[string]int{"id": user.ID})
+	h.renderTemplate(w, r, components.UserCard(templateUser))
+}
+
+const (
+	// maxImportSize bounds CSV uploads so a single import can't exhaust memory
+	maxImportSize = 5 << 20
+	// maxImportRows bounds the number of users created by a single CSV import
+	maxImportRows = 10000
+	// exportFlushRows is how many CSV rows ExportUsers buffers before flushing
+	exportFlushRows = 500
+)
+
+// ImportUsers creates users in bulk from an uploaded name,email CSV file
+func (h *Handlers) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		if isClientAbort(r, err) {
+			slog.InfoContext(r.Context(), "Client aborted CSV upload", "error", err)
+			return
+		}
+		writeError(w, r, badRequest("Invalid upload"))
+		return
+	}
+	
+	file, _, err := r.FormFile("users-csv")
+	if err != nil {
+		writeError(w, r, badRequest("CSV file is required"))
+		return
+	}
+	defer file.Close()
+	
+	inputs, err := parseUserCSV(file)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
+	
+	users, err := h.userStore.AddMany(r.Context(), inputs)
+	if err != nil {
+		var validationErrs validation.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			h.respondFormError(w, r, "#import-result", http.StatusBadRequest, CodeInvalidRequest, validationMessages(err))
+			return
+		}
+		if errors.Is(err, db.ErrDuplicateEmail) {
+			h.respondFormError(w, r, "#import-result", http.StatusConflict, CodeDuplicateEmail, []string{db.ErrDuplicateEmail.Error()})
+			return
+		}
+		if errors.Is(err, db.ErrReadOnly) {
+			h.respondFormError(w, r, "#import-result", http.StatusServiceUnavailable, CodeReadOnly, []string{db.ErrReadOnly.Error()})
+			return
+		}
+		writeError(w, r, fmt.Errorf("importing users: %w", err))
+		return
+	}
+	
+	h.searchCache.purge()
+	h.renderTemplate(w, r, components.ImportSummary(len(users)))
+}
+
+// ExportUsers streams every user as a name,email CSV download that ImportUsers accepts.
+// Rows are flushed in batches, and the export stops as soon as the client disconnects
+// so an abandoned download doesn't keep querying Postgres or writing to a dead
+// connection. A failure after rows were sent aborts the response, so the download
+// visibly fails instead of ending cleanly as a truncated file.
+func (h *Handlers) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="users.csv"`)
+	
+	out := csv.NewWriter(w)
+	out.Write([]string{"name", "email"})
+	rows := 0
+	err := h.userStore.ForEach(r.Context(), func(user *db.User) error {
+		out.Write([]string{user.Name, user.Email})
+		if rows++; rows%exportFlushRows != 0 {
+			return nil
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	})
+	if r.Context().Err() != nil {
+		slog.DebugContext(r.Context(), "Client disconnected during user export", "rows", rows, "error", err)
+		return
+	}
+	if err != nil {
+		// Before the first user only the buffered header row exists, so nothing has
+		// reached the client and the error can still be reported properly
+		if rows == 0 {
+			writeError(w, r, fmt.Errorf("exporting users: %w", err))
+			return
+		}
+		// Rows may already have gone out with a 200, so resetting the connection is how
+		// the client learns the file is incomplete. Recovery lets this panic through.
+		slog.ErrorContext(r.Context(), "Error exporting users", "rows", rows, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+	
+	out.Flush()
+	if err := out.Error(); err != nil {
+		slog.DebugContext(r.Context(), "Error writing user export", "rows", rows, "error", err)
+	}
 }
 
 func (h *Handlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeError(w, r, badRequest("Invalid user ID"))
 		return
 	}
 	
 	err = h.userStore.Delete(r.Context(), id)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			http.Error(w, "User not found", http.StatusNotFound)
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, r, notFound("User not found", err))
 			return
 		}
-		handleError(w, "deleting user", err)
+		writeError(w, r, fmt.Errorf("deleting user: %w", err))
 		return
 	}
 	
+	h.publishUsers(r.Context(), components.UserRemoved(id))
+	setHXTrigger(w, "userDeleted", map[string]int{"id": id})
 	w.WriteHeader(http.StatusOK)
 }
 
 func (h *Handlers) SearchUsers(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+	w.Header().Add("Vary", "HX-Request")
+	if !isHTMX(r) {
+		h.renderTemplate(w, r, pages.DynamicPage())
+		return
+	}
+
+	if !h.parseForm(w, r) {
 		return
 	}
 	
 	// Sanitize search query
-	query := validation.SanitizeInput(r.FormValue("search"))
-	users, err := h.userStore.Search(r.Context(), query)
+	query := validation.SanitizeSearchQuery(r.FormValue("search"))
+	
+	users, err := h.searchUsers(r, query)
 	if err != nil {
-		handleError(w, "searching users", err)
+		writeError(w, r, fmt.Errorf("searching users: %w", err))
 		return
 	}
 	
 	templateUsers := convertToTemplateUsers(users)
-	renderTemplate(w, r, components.SearchResults(templateUsers))
+	h.renderTemplate(w, r, components.SearchResults(templateUsers))
+}
+
+// PaginationLinks holds absolute URLs for navigating a paginated JSON response.
+// Prev and Next are omitted at the ends of the result set.
+type PaginationLinks struct {
+	First string `json:"first"`
+	Last  string `json:"last"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+}
+
+// paginatedUsersResponse is the JSON representation of a page of users
+type paginatedUsersResponse struct {
+	*db.PaginatedResult[*db.User]
+	Links PaginationLinks `json:"links"`
 }
 
+// Page sizes of the paginated listings when the client doesn't pass page_size
+const (
+	usersPageSize = db.DefaultPageSize
+	// Search results are skimmed for one match, so a short page is enough
+	searchPageSize = db.MinPageSize
+)
+
 // GetUsersPaginated handles paginated user listing - reverted to original approach
 func (h *Handlers) GetUsersPaginated(w http.ResponseWriter, r *http.Request) {
 	// Parse pagination parameters
-	params, err := parsePaginationParams(r)
+	params, err := parsePaginationParams(r, usersPageSize, h.config.PaginationMaxOffset)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
 		return
 	}
 
 	// Get paginated users
-	result, err := h.userStore.GetAllPaginated(r.Context(), params)
+	result, err := h.userStore.GetAllPaginated(r.Context(), params, filter)
 	if err != nil {
-		handleError(w, "getting paginated users", err)
+		writeError(w, r, fmt.Errorf("getting paginated users: %w", err))
 		return
 	}
 
 	templateUsers := convertToTemplateUsers(result.Data)
 
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "HX-Request")
+	w.Header().Add("Vary", paginationModeHeader)
+
+	// API consumers get the page as JSON with navigation links
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(paginatedUsersResponse{
+			PaginatedResult: result,
+			Links:           h.paginationLinks(r, result.Page, result.TotalPages, result.HasPrev, result.HasNext),
+		})
+		return
+	}
+
 	// For HTMX requests, return just the user cards and pagination
-	if r.Header.Get("HX-Request") == "true" {
+	if isHTMX(r) {
 		// Render user cards
-		for _, user := range templateUsers {
-			if err := components.UserCard(user).Render(r.Context(), w); err != nil {
-				slog.Error("Template rendering error", "error", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
-		}
+		h.renderTemplate(w, r, components.UserCards(templateUsers))
 		
 		// Render pagination component
 		paginationData := components.PaginationData{
@@ -202,51 +582,85 @@ func (h *Handlers) GetUsersPaginated(w http.ResponseWriter, r *http.Request) {
 			HasNext:     result.HasNext,
 			BaseURL:     "/api/users/paginated",
 			SearchQuery: "",
+			PageSize:    result.PageSize,
+			// Already validated by parseUserFilter, so passed on as the client sent them
+			CreatedAfter:  listingValue(r, "created_after"),
+			CreatedBefore: listingValue(r, "created_before"),
+		}
+		
+		// Infinite scroll appends the next chunk behind a sentinel instead of page links
+		if r.Header.Get(paginationModeHeader) == paginationModeInfinite {
+			if result.HasNext {
+				h.renderTemplate(w, r, components.InfiniteScrollSentinel(paginationData))
+			}
+			return
 		}
-		renderTemplate(w, r, components.Pagination(paginationData))
+		h.renderTemplate(w, r, components.Pagination(paginationData))
 		return
 	}
 
 	// For non-HTMX requests, render the full page
-	renderTemplate(w, r, pages.DynamicPage())
+	h.renderTemplate(w, r, pages.DynamicPage())
 }
 
 // SearchUsersPaginated handles paginated user search
 func (h *Handlers) SearchUsersPaginated(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+	w.Header().Add("Vary", "HX-Request")
+	if !isHTMX(r) {
+		h.renderTemplate(w, r, pages.DynamicPage())
+		return
+	}
+
+	if !h.parseForm(w, r) {
 		return
 	}
 
 	// Parse pagination parameters
-	params, err := parsePaginationParams(r)
+	params, err := parsePaginationParams(r, searchPageSize, h.config.PaginationMaxOffset)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
 	// Sanitize search query
-	query := validation.SanitizeInput(r.FormValue("search"))
+	query := validation.SanitizeSearchQuery(r.FormValue("search"))
+	
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		writeError(w, r, badRequest(err.Error()))
+		return
+	}
 	
-	result, err := h.userStore.SearchPaginated(r.Context(), query, params)
+	search, searchMode := h.userStore.SearchPaginated, ""
+	if r.FormValue("search_mode") == searchModeFTS {
+		search, searchMode = h.userStore.SearchRanked, searchModeFTS
+	}
+	
+	result, err := search(r.Context(), query, params, filter)
 	if err != nil {
-		handleError(w, "searching users with pagination", err)
+		writeError(w, r, fmt.Errorf("searching users with pagination: %w", err))
 		return
 	}
 
 	templateUsers := convertToTemplateUsers(result.Data)
-	renderTemplate(w, r, components.SearchResults(templateUsers))
+	h.renderTemplate(w, r, components.SearchResults(templateUsers))
 	
 	// Also render pagination component for search results
 	paginationData := components.PaginationData{
-		CurrentPage: result.Page,
-		TotalPages:  result.TotalPages,
-		HasPrev:     result.HasPrev,
-		HasNext:     result.HasNext,
-		BaseURL:     "/api/search/paginated",
-		SearchQuery: query,
+		CurrentPage:   result.Page,
+		TotalPages:    result.TotalPages,
+		HasPrev:       result.HasPrev,
+		HasNext:       result.HasNext,
+		BaseURL:       "/api/search/paginated",
+		SearchQuery:   query,
+		PageSize:      result.PageSize,
+		SearchMode:    searchMode,
+		CreatedAfter:  listingValue(r, "created_after"),
+		CreatedBefore: listingValue(r, "created_before"),
+		// The route only accepts POST
+		Post: true,
 	}
-	renderTemplate(w, r, components.Pagination(paginationData))
+	h.renderTemplate(w, r, components.Pagination(paginationData))
 }
 
 // HealthStatus represents the health status of the application
@@ -262,24 +676,52 @@ type Health struct {
 	Status  string        `json:"status"`
 	Message string        `json:"message,omitempty"`
 	Latency time.Duration `json:"latency"`
+	// Runtime is set on the runtime check only
+	Runtime *RuntimeStats `json:"runtime,omitempty"`
+}
+
+// RuntimeStats is the runtime check's snapshot of the Go runtime
+type RuntimeStats struct {
+	HeapAllocBytes uint64        `json:"heap_alloc_bytes"`
+	HeapSysBytes   uint64        `json:"heap_sys_bytes"`
+	Goroutines     int           `json:"goroutines"`
+	NumGC          uint32        `json:"num_gc"`
+	LastGCPause    time.Duration `json:"last_gc_pause"`
+	TotalGCPause   time.Duration `json:"total_gc_pause"`
 }
 
 // HealthCheck provides a health check endpoint
 func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	
+	status := h.healthStatus(r.Context())
+	
+	statusCode := http.StatusOK
+	if status.Status != "healthy" {
+		statusCode = http.StatusServiceUnavailable
+	}
+	
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(status)
+}
+
+// healthStatus runs every health check. It is the one source of the application's
+// health, behind both /health and the health gauges in /metrics.
+func (h *Handlers) healthStatus(ctx context.Context) HealthStatus {
 	checks := make(map[string]Health)
 	overallStatus := "healthy"
 	
 	// Database health check
 	dbStart := time.Now()
-	if err := h.checkDatabaseHealth(r.Context()); err != nil {
+	if err := h.checkDatabase(ctx, h.database.Pool); err != nil {
 		checks["database"] = Health{
-			Status:  "unhealthy",
+			Status:  databaseHealthStatus(err),
 			Message: err.Error(),
 			Latency: time.Since(dbStart),
 		}
-		overallStatus = "unhealthy"
+		if checks["database"].Status == "unhealthy" {
+			overallStatus = "unhealthy"
+		}
 	} else {
 		checks["database"] = Health{
 			Status:  "healthy",
@@ -287,28 +729,62 @@ func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	
-	status := HealthStatus{
-		Status:    overallStatus,
-		Timestamp: time.Now(),
-		Version:   "1.0.0",
-		Checks:    checks,
+	// Reads go to the replica when one is configured, but fall back to the primary once
+	// the replica's breaker opens, so a replica that is down only degrades the instance
+	if h.database.Replica != nil {
+		replicaStart := time.Now()
+		checks["replica"] = Health{Status: "healthy"}
+		if err := h.checkDatabase(ctx, h.database.Replica); err != nil {
+			checks["replica"] = Health{Status: "degraded", Message: err.Error()}
+		}
+		replica := checks["replica"]
+		replica.Latency = time.Since(replicaStart)
+		checks["replica"] = replica
 	}
 	
-	statusCode := http.StatusOK
-	if overallStatus != "healthy" {
-		statusCode = http.StatusServiceUnavailable
+	// A tripped breaker is reported but doesn't fail the check: it is already shedding
+	// load, and restarting the instance wouldn't help the database recover
+	breaker := h.database.CircuitBreaker.Stats()
+	checks["circuit_breaker"] = Health{Status: "healthy"}
+	if breaker.State != circuitbreaker.StateClosed.String() {
+		checks["circuit_breaker"] = Health{
+			Status:  "degraded",
+			Message: fmt.Sprintf("%s after %d failures", breaker.State, breaker.Failures),
+		}
 	}
 	
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(status)
+	// Like the breaker, a degraded runtime is a hint for whoever is debugging rather than
+	// a reason to take the instance out of rotation
+	if h.config.HealthRuntime {
+		checks["runtime"] = checkRuntimeHealth(h.config.HealthMaxGoroutines)
+	}
+	
+	return HealthStatus{
+		Status:    overallStatus,
+		Timestamp: time.Now(),
+		Version:   version.Version,
+		Checks:    checks,
+	}
 }
 
 // ReadinessCheck provides a readiness check endpoint
 func (h *Handlers) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	
-	// Check if all dependencies are ready
-	if err := h.checkDatabaseHealth(r.Context()); err != nil {
+	// The database may still be coming up when DB_CONNECT_RETRY started us without it
+	if !h.database.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":    "not ready",
+			"timestamp": time.Now(),
+			"error":     "database not connected yet",
+		})
+		return
+	}
+	
+	// Check if all dependencies are ready. A busy pool still serves requests, and
+	// taking the instance out of rotation would only push its load onto the others.
+	if err := h.checkDatabase(r.Context(), h.database.Pool); err != nil && !errors.Is(err, db.ErrPoolExhausted) {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":    "not ready",
@@ -325,6 +801,16 @@ func (h *Handlers) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// databaseHealthStatus classifies a failed database check: an exhausted pool is load
+// on this instance, so it is degraded, while anything else means the database is
+// unreachable or broken
+func databaseHealthStatus(err error) string {
+	if errors.Is(err, db.ErrPoolExhausted) {
+		return "degraded"
+	}
+	return "unhealthy"
+}
+
 // LivenessCheck provides a liveness check endpoint
 func (h *Handlers) LivenessCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -335,14 +821,277 @@ func (h *Handlers) LivenessCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// checkDatabaseHealth performs a simple database health check
-func (h *Handlers) checkDatabaseHealth(ctx context.Context) error {
+// DebugRoutes lists every registered route as JSON
+func (h *Handlers) DebugRoutes(rt *router.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"routes": rt.Routes(),
+		})
+	}
+}
+
+// Favicon serves the embedded site icon
+func (h *Handlers) Favicon(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/x-icon")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.config.StaticMaxAge.Seconds())))
+	http.ServeContent(w, r, "favicon.ico", time.Time{}, bytes.NewReader(static.Favicon))
+}
+
+// Robots serves robots.txt according to the configured policy. Even when crawling
+// is allowed, API and operational endpoints are kept out of search indexes.
+func (h *Handlers) Robots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	
+	if h.config.RobotsPolicy != "allow" {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /\n")
+		return
+	}
+	fmt.Fprint(w, "User-agent: *\nDisallow: /api/\nDisallow: /debug/\nDisallow: /health\nDisallow: /metrics\n")
+}
+
+// DebugPool reports live connection pool statistics as JSON
+func (h *Handlers) DebugPool(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.database.PoolStats())
+}
+
+// DebugRequests reports how many requests are in flight and how many SSE streams are
+// open, which is what a graceful shutdown waits on
+func (h *Handlers) DebugRequests(requests *middleware.RequestTracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active_requests": requests.Active(),
+			"sse_streams":     h.counterHub.len() + h.userHub.len(),
+			"draining":        h.Draining(),
+		})
+	}
+}
+
+// Drain tells every open SSE stream to finish so clients reconnect elsewhere instead of
+// holding the server's shutdown grace window. It is safe to call more than once.
+func (h *Handlers) Drain() {
+	h.drainOnce.Do(func() {
+		close(h.draining)
+		slog.Info("Draining SSE streams", "streams", h.counterHub.len()+h.userHub.len())
+	})
+}
+
+// Draining reports whether Drain has been called
+func (h *Handlers) Draining() bool {
+	select {
+	case <-h.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// maintenanceRetryAfter is the Retry-After hint, in seconds, sent while in maintenance
+const maintenanceRetryAfter = "300"
+
+// InMaintenance reports whether the site is in maintenance mode
+func (h *Handlers) InMaintenance() bool {
+	return h.maintenance.Load()
+}
+
+// SetMaintenance turns maintenance mode on or off
+func (h *Handlers) SetMaintenance(enabled bool) {
+	if h.maintenance.Swap(enabled) != enabled {
+		slog.Warn("Maintenance mode changed", "enabled", enabled)
+	}
+}
+
+// MaintenancePage tells clients the site is temporarily unavailable. HTMX won't swap
+// a 503 into the page, so a button pressed after maintenance began would seem to do
+// nothing; HTMX requests are redirected to reload their page, which shows this one.
+func (h *Handlers) MaintenancePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", maintenanceRetryAfter)
+	w.Header().Set("Cache-Control", "no-store")
+	
+	if isHTMX(r) {
+		hxRedirect(w, currentPage(r))
+	}
+	
+	if wantsJSON(r) {
+		writeJSONErrors(w, http.StatusServiceUnavailable, CodeMaintenance, []string{"Service under maintenance"})
+		return
+	}
+	
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	h.renderTemplate(w, r, pages.Maintenance())
+}
+
+// Version reports which build is running: its version, commit and build date
+func (h *Handlers) Version(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(version.Get())
+}
+
+// NotFound answers requests for paths no route matches: API paths and clients asking
+// for JSON get the not_found error envelope, browsers the not-found page
+func (h *Handlers) NotFound(w http.ResponseWriter, r *http.Request) {
+	if wantsJSON(r) || isAPIPath(r.URL.Path) {
+		writeJSONErrors(w, http.StatusNotFound, CodeNotFound, []string{"Not found"})
+		return
+	}
+	
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	h.renderTemplate(w, r, pages.NotFound())
+}
+
+// MethodNotAllowed answers requests for a known path with a method it doesn't accept.
+// The router has already set the Allow header; API paths and clients asking for JSON
+// get the method_not_allowed error envelope with the methods in allowed, browsers an
+// error page.
+func (h *Handlers) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	allow := w.Header().Get("Allow")
+	if wantsJSON(r) || isAPIPath(r.URL.Path) {
+		allowed := []string{}
+		for method := range strings.SplitSeq(allow, ",") {
+			if method = strings.TrimSpace(method); method != "" {
+				allowed = append(allowed, method)
+			}
+		}
+		writeJSONErrorBody(w, http.StatusMethodNotAllowed, errorBody{
+			Code:    CodeMethodNotAllowed,
+			Errors:  []string{"Method not allowed"},
+			Allowed: allowed,
+		})
+		return
+	}
+	
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	h.renderTemplate(w, r, pages.MethodNotAllowed(r.Method, allow))
+}
+
+// AdminMaintenance turns maintenance mode on or off according to the "enabled" form
+// value and reports the resulting state
+func (h *Handlers) AdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	if !h.parseForm(w, r) {
+		return
+	}
+	
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		writeError(w, r, badRequest("enabled must be true or false"))
+		return
+	}
+	h.SetMaintenance(enabled)
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"maintenance": h.InMaintenance()})
+}
+
+// AdminTripCircuitBreaker forces the database circuit breakers open, the replica's too
+// when one is configured, and reports their stats
+func (h *Handlers) AdminTripCircuitBreaker(w http.ResponseWriter, r *http.Request) {
+	h.database.CircuitBreaker.Trip()
+	if h.database.ReplicaCircuitBreaker != nil {
+		h.database.ReplicaCircuitBreaker.Trip()
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.breakerStats())
+}
+
+// AdminResetCircuitBreaker forces the database circuit breakers closed, the replica's
+// too when one is configured, and reports their stats
+func (h *Handlers) AdminResetCircuitBreaker(w http.ResponseWriter, r *http.Request) {
+	h.database.CircuitBreaker.Reset()
+	if h.database.ReplicaCircuitBreaker != nil {
+		h.database.ReplicaCircuitBreaker.Reset()
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.breakerStats())
+}
+
+// breakerStats reports each database circuit breaker's stats by the pool it guards
+func (h *Handlers) breakerStats() map[string]circuitbreaker.Stats {
+	stats := map[string]circuitbreaker.Stats{"primary": h.database.CircuitBreaker.Stats()}
+	if h.database.ReplicaCircuitBreaker != nil {
+		stats["replica"] = h.database.ReplicaCircuitBreaker.Stats()
+	}
+	return stats
+}
+
+// AdminLogLevel changes the log level (level=debug|info|warn|error) and/or format
+// (format=json|text) without a restart, and reports the resulting settings. Both are
+// checked before either changes, so a bad request changes nothing.
+func (h *Handlers) AdminLogLevel(logs *logging.Switch) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.parseForm(w, r) {
+			return
+		}
+	
+		level := logs.Level()
+		if value := r.FormValue("level"); value != "" {
+			if err := level.UnmarshalText([]byte(value)); err != nil {
+				writeError(w, r, badRequest("level must be debug, info, warn or error"))
+				return
+			}
+		}
+		format := cmp.Or(r.FormValue("format"), logs.Format())
+		if format != logging.FormatJSON && format != logging.FormatText {
+			writeError(w, r, badRequest("format must be json or text"))
+			return
+		}
+	
+		logs.SetLevel(level)
+		logs.SetFormat(format)
+		// Logged at warn so the change is recorded at any level short of error
+		slog.WarnContext(r.Context(), "Logging changed", "level", level, "format", format)
+	
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"level":  strings.ToLower(level.String()),
+			"format": format,
+		})
+	}
+}
+
+// checkRuntimeHealth reports heap, goroutine and GC figures, degraded when there are
+// more than maxGoroutines goroutines (0 for no ceiling). A steadily climbing count
+// usually means something leaks them, such as SSE subscriptions that never end.
+func checkRuntimeHealth(maxGoroutines int) Health {
+	start := time.Now()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := &RuntimeStats{
+		HeapAllocBytes: mem.HeapAlloc,
+		HeapSysBytes:   mem.HeapSys,
+		Goroutines:     runtime.NumGoroutine(),
+		NumGC:          mem.NumGC,
+		TotalGCPause:   time.Duration(mem.PauseTotalNs),
+	}
+	if mem.NumGC > 0 {
+		stats.LastGCPause = time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+	}
+
+	health := Health{Status: "healthy", Latency: time.Since(start), Runtime: stats}
+	if maxGoroutines > 0 && stats.Goroutines > maxGoroutines {
+		health.Status = "degraded"
+		health.Message = fmt.Sprintf("%d goroutines exceeds the ceiling of %d", stats.Goroutines, maxGoroutines)
+	}
+	return health
+}
+
+// checkDatabaseHealth performs a simple database health check against pool. An
+// exhausted pool is reported as db.ErrPoolExhausted.
+func checkDatabaseHealth(ctx context.Context, pool *pgxpool.Pool) error {
 	// Create a timeout context for the health check
 	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	
 	// Simple ping to check database connectivity
-	conn, err := h.database.Pool.Acquire(timeoutCtx)
+	conn, err := db.Acquire(timeoutCtx, pool)
 	if err != nil {
 		return err
 	}
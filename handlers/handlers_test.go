@@ -0,0 +1,1170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-h/templ"
+
+	"htmx-learn/circuitbreaker"
+	"htmx-learn/config"
+	"htmx-learn/db"
+	"htmx-learn/middleware"
+)
+
+// newTestHandlers returns handlers backed by in-memory stores seeded with n users
+func newTestHandlers(t *testing.T, n int) *Handlers {
+	t.Helper()
+
+	users := db.NewMemoryUserStore()
+	for i := range n {
+		if _, err := users.Add(context.Background(), fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@example.com", i)); err != nil {
+			t.Fatalf("seeding users: %v", err)
+		}
+	}
+
+	return &Handlers{
+		counterStore: db.NewMemoryCounterStore(),
+		userStore:    users,
+		config:       &config.Config{},
+		counterHub:   newHub(),
+		userHub:      newHub(),
+		clientIPs:    middleware.NewClientIPResolver(nil),
+		now:          time.Now,
+		location:     time.UTC,
+		draining:     make(chan struct{}),
+	}
+}
+
+func TestGetUsersPaginatedModes(t *testing.T) {
+	h := newTestHandlers(t, 12)
+
+	tests := []struct {
+		name           string
+		target         string
+		mode           string
+		expectSentinel bool
+		expectNumbered bool
+	}{
+		{"numbered by default", "/api/users/paginated?page=1&page_size=5", "", false, true},
+		{"infinite with more pages", "/api/users/paginated?page=1&page_size=5", "infinite", true, false},
+		{"infinite on last page", "/api/users/paginated?page=3&page_size=5", "infinite", false, false},
+		{"unknown mode falls back to numbered", "/api/users/paginated?page=1&page_size=5", "carousel", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("HX-Request", "true")
+			if tt.mode != "" {
+				req.Header.Set("X-Pagination-Mode", tt.mode)
+			}
+			rec := httptest.NewRecorder()
+
+			h.GetUsersPaginated(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, expected 200", rec.Code)
+			}
+			body := rec.Body.String()
+
+			if got := strings.Contains(body, `hx-trigger="revealed"`); got != tt.expectSentinel {
+				t.Errorf("sentinel present = %v, expected %v", got, tt.expectSentinel)
+			}
+			if tt.expectSentinel && !strings.Contains(body, "page=2&amp;page_size=5") {
+				t.Errorf("sentinel does not point at the next page: %s", body)
+			}
+			if got := strings.Contains(body, `id="pagination"`); got != tt.expectNumbered {
+				t.Errorf("numbered pagination present = %v, expected %v", got, tt.expectNumbered)
+			}
+			if !strings.Contains(body, "@example.com") {
+				t.Error("expected user cards in the response")
+			}
+			if vary := rec.Header().Values("Vary"); !slices.Contains(vary, "X-Pagination-Mode") {
+				t.Errorf("Vary = %v, expected it to include X-Pagination-Mode", vary)
+			}
+		})
+	}
+}
+
+func TestFragmentsDeclareHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		users int
+		serve func(h *Handlers, w http.ResponseWriter, r *http.Request)
+	}{
+		{"user list", 3, (*Handlers).GetUsers},
+		{"empty user list", 0, (*Handlers).GetUsers},
+		{"paginated cards", 3, (*Handlers).GetUsersPaginated},
+		{"template starting with text", 0, func(h *Handlers, w http.ResponseWriter, r *http.Request) {
+			h.renderTemplate(w, r, templ.Raw("plain words, then <b>markup</b>"))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, tt.users)
+			req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+			req.Header.Set("HX-Request", "true")
+			rec := httptest.NewRecorder()
+
+			tt.serve(h, rec, req)
+
+			if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+				t.Errorf("Content-Type = %q, expected text/html; charset=utf-8", got)
+			}
+		})
+	}
+}
+
+func TestSearchUsersPaginatedReadsPageFromBody(t *testing.T) {
+	h := newTestHandlers(t, 12)
+
+	tests := []struct {
+		name          string
+		query         string
+		form          url.Values
+		expectedCards int
+	}{
+		{"page in body", "", url.Values{"page": {"3"}, "page_size": {"5"}}, 2},
+		{"page in query", "?page=3&page_size=5", nil, 2},
+		{"body wins over query", "?page=1&page_size=5", url.Values{"page": {"3"}}, 2},
+		{"body and query combined", "?page=2", url.Values{"page_size": {"10"}}, 2},
+		{"neither uses the first page", "", nil, searchPageSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"search": {"user"}}
+			for key, values := range tt.form {
+				form[key] = values
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/search/paginated"+tt.query, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("HX-Request", "true")
+			rec := httptest.NewRecorder()
+
+			h.SearchUsersPaginated(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, expected 200", rec.Code)
+			}
+			if cards := strings.Count(rec.Body.String(), "data-user-id="); cards != tt.expectedCards {
+				t.Errorf("rendered %d cards, expected %d", cards, tt.expectedCards)
+			}
+		})
+	}
+}
+
+func TestSearchPaginationLinksPostSearchMode(t *testing.T) {
+	h := newTestHandlers(t, 12)
+	form := url.Values{"search": {"user"}, "search_mode": {searchModeFTS}}
+	req := httptest.NewRequest(http.MethodPost, "/api/search/paginated", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+	rec := httptest.NewRecorder()
+
+	h.SearchUsersPaginated(rec, req)
+
+	method, target, params := firstPageLink(t, rec.Body.String())
+	if method != "post" || target != "/api/search/paginated" {
+		t.Errorf("page link is hx-%s %q, expected hx-post to the POST-only search route", method, target)
+	}
+	expected := url.Values{"page": {"2"}, "page_size": {strconv.Itoa(searchPageSize)}, "search": {"user"}, "search_mode": {searchModeFTS}}
+	if !maps.EqualFunc(params, expected, slices.Equal) {
+		t.Errorf("page link hx-vals = %v, expected %v", params, expected)
+	}
+}
+
+// pageLinkPattern matches a page link's request attribute and any hx-vals after it
+var pageLinkPattern = regexp.MustCompile(`hx-(get|post)="([^"]*)"(?: hx-vals="([^"]*)")?`)
+
+// firstPageLink returns the method, path and parameters of the first page link in
+// body, taking the parameters from the URL of an hx-get or the hx-vals of an hx-post
+func firstPageLink(t *testing.T, body string) (method, path string, params url.Values) {
+	t.Helper()
+	match := pageLinkPattern.FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("no page link in %s", body)
+	}
+
+	link, err := url.Parse(html.UnescapeString(match[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params = link.Query()
+	if match[3] != "" {
+		var vals map[string]string
+		if err := json.Unmarshal([]byte(html.UnescapeString(match[3])), &vals); err != nil {
+			t.Fatalf("hx-vals: %v", err)
+		}
+		for key, value := range vals {
+			params.Set(key, value)
+		}
+	}
+	return match[1], link.Path, params
+}
+
+func TestPaginatedListingsKeepDateFilter(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		form          url.Values
+		serve         func(h *Handlers, w http.ResponseWriter, r *http.Request)
+		expectedCards int
+	}{
+		{
+			name:          "listing filter in query",
+			method:        http.MethodGet,
+			target:        "/api/users/paginated?page_size=5&created_after=" + url.QueryEscape(past),
+			serve:         (*Handlers).GetUsersPaginated,
+			expectedCards: 5,
+		},
+		{
+			name:          "search filter in body",
+			method:        http.MethodPost,
+			target:        "/api/search/paginated",
+			form:          url.Values{"search": {"user"}, "created_after": {past}},
+			serve:         (*Handlers).SearchUsersPaginated,
+			expectedCards: searchPageSize,
+		},
+		{
+			name:          "search filter in body excludes everyone",
+			method:        http.MethodPost,
+			target:        "/api/search/paginated",
+			form:          url.Values{"search": {"user"}, "created_after": {future}},
+			serve:         (*Handlers).SearchUsersPaginated,
+			expectedCards: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, 12)
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("HX-Request", "true")
+			rec := httptest.NewRecorder()
+
+			tt.serve(h, rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, expected 200 (body %q)", rec.Code, rec.Body.String())
+			}
+			body := rec.Body.String()
+			if cards := strings.Count(body, "data-user-id="); cards != tt.expectedCards {
+				t.Errorf("rendered %d cards, expected %d", cards, tt.expectedCards)
+			}
+			if tt.expectedCards == 0 {
+				return
+			}
+			if _, _, params := firstPageLink(t, body); params.Get("created_after") != past {
+				t.Errorf("page link parameters = %v, expected created_after %s", params, past)
+			}
+		})
+	}
+}
+
+func TestGetUsersPaginatedRejectsInvalidFilter(t *testing.T) {
+	h := newTestHandlers(t, 3)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/paginated?created_after=2025-02-01T00:00:00Z&created_before=2025-01-01T00:00:00Z", nil)
+	req.Header.Set("HX-Request", "true")
+	rec := httptest.NewRecorder()
+
+	h.GetUsersPaginated(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, expected 400", rec.Code)
+	}
+}
+
+func TestGetUsersPaginatedJSON(t *testing.T) {
+	h := newTestHandlers(t, 12)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api/users/paginated?page=3&page_size=5", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+
+	h.GetUsersPaginated(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, expected application/json", ct)
+	}
+
+	var body struct {
+		Data       []db.User         `json:"data"`
+		Total      int               `json:"total"`
+		TotalPages int               `json:"total_pages"`
+		Links      map[string]string `json:"links"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+
+	if len(body.Data) != 2 || body.Total != 12 || body.TotalPages != 3 {
+		t.Errorf("got %d users, total %d, %d pages; expected 2, 12, 3", len(body.Data), body.Total, body.TotalPages)
+	}
+	if _, ok := body.Links["next"]; ok {
+		t.Error("last page must not include a next link")
+	}
+	if got := body.Links["prev"]; got != "http://example.com/api/users/paginated?page=2&page_size=5" {
+		t.Errorf("prev link = %s", got)
+	}
+}
+
+func TestGetUsersPaginatedRejectsDeepPages(t *testing.T) {
+	h := newTestHandlers(t, 12)
+	h.config.PaginationMaxOffset = 100
+
+	tests := []struct {
+		query    string
+		expected int
+	}{
+		{"page=11&page_size=10", http.StatusOK},
+		{"page=12&page_size=10", http.StatusBadRequest},
+		{"page=1000000&page_size=100", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.GetUsersPaginated(rec, httptest.NewRequest(http.MethodGet, "/api/users/paginated?"+tt.query, nil))
+
+			if rec.Code != tt.expected {
+				t.Fatalf("status = %d, expected %d", rec.Code, tt.expected)
+			}
+			if tt.expected == http.StatusBadRequest && !strings.Contains(rec.Body.String(), "page too deep, use cursor pagination") {
+				t.Errorf("body = %q, expected it to point at cursor pagination", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRobots(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		disallowAll bool
+	}{
+		{"allow", "allow", false},
+		{"disallow", "disallow", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, 0)
+			h.config.RobotsPolicy = tt.policy
+
+			rec := httptest.NewRecorder()
+			h.Robots(rec, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+
+			body := rec.Body.String()
+			if got := strings.Contains(body, "Disallow: /\n"); got != tt.disallowAll {
+				t.Errorf("disallows everything = %v, expected %v:\n%s", got, tt.disallowAll, body)
+			}
+			if !tt.disallowAll && !strings.Contains(body, "Disallow: /api/") {
+				t.Errorf("allow policy should still keep /api/ out of indexes:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	h := newTestHandlers(t, 0)
+
+	rec := httptest.NewRecorder()
+	h.Favicon(rec, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, expected 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/x-icon" {
+		t.Errorf("Content-Type = %q, expected image/x-icon", ct)
+	}
+	// ICO files start with a reserved zero word followed by type 1
+	if !strings.HasPrefix(rec.Body.String(), "\x00\x00\x01\x00") {
+		t.Error("response is not an ICO file")
+	}
+}
+
+func TestCreateUserFormErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		form           string
+		headers        map[string]string
+		expectedCode   int
+		expectedType   string
+		expectInBody   string
+		expectRetarget bool
+	}{
+		{
+			name:           "htmx validation error",
+			form:           "user-name=&user-email=not-an-email",
+			headers:        map[string]string{"HX-Request": "true"},
+			expectedCode:   http.StatusBadRequest,
+			expectedType:   "text/html",
+			expectInBody:   `role="alert"`,
+			expectRetarget: true,
+		},
+		{
+			name:           "htmx duplicate email",
+			form:           "user-name=Someone+Else&user-email=user0%40example.com",
+			headers:        map[string]string{"HX-Request": "true"},
+			expectedCode:   http.StatusConflict,
+			expectedType:   "text/html",
+			expectInBody:   "already exists",
+			expectRetarget: true,
+		},
+		{
+			name:         "plain text validation error",
+			form:         "user-name=&user-email=not-an-email",
+			expectedCode: http.StatusBadRequest,
+			expectedType: "text/plain",
+			expectInBody: "name:",
+		},
+		{
+			name:         "json validation error keyed by field",
+			form:         "user-name=&user-email=not-an-email",
+			headers:      map[string]string{"Accept": "application/json"},
+			expectedCode: http.StatusBadRequest,
+			expectedType: "application/json",
+			expectInBody: `{"code":"invalid_request","errors":{"email":"email format is invalid","name":"name is required"}}`,
+		},
+		{
+			name:         "json duplicate email",
+			form:         "user-name=Someone+Else&user-email=user0%40example.com",
+			headers:      map[string]string{"Accept": "application/json"},
+			expectedCode: http.StatusConflict,
+			expectedType: "application/json",
+			expectInBody: `"errors"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, 1)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(tt.form))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+
+			h.CreateUser(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expectedCode)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.expectedType) {
+				t.Errorf("Content-Type = %q, expected %s", ct, tt.expectedType)
+			}
+			if !strings.Contains(rec.Body.String(), tt.expectInBody) {
+				t.Errorf("body %q does not contain %q", rec.Body.String(), tt.expectInBody)
+			}
+			if got := rec.Header().Get("HX-Retarget") == "#form-errors"; got != tt.expectRetarget {
+				t.Errorf("retargeted = %v, expected %v", got, tt.expectRetarget)
+			}
+		})
+	}
+}
+
+func TestSearchFragmentOrFullPage(t *testing.T) {
+	h := newTestHandlers(t, 3)
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		expectedPage bool
+	}{
+		{"htmx request gets fragment", map[string]string{"HX-Request": "true"}, false},
+		{"boosted request gets fragment", map[string]string{"HX-Boosted": "true"}, false},
+		{"plain navigation gets full page", nil, true},
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"/api/search":           h.SearchUsers,
+		"/api/search/paginated": h.SearchUsersPaginated,
+	}
+
+	for path, handler := range handlers {
+		for _, tt := range tests {
+			t.Run(path+" "+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("search=User"))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				for name, value := range tt.headers {
+					req.Header.Set(name, value)
+				}
+				rec := httptest.NewRecorder()
+
+				handler(rec, req)
+
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status = %d, expected %d", rec.Code, http.StatusOK)
+				}
+				body := rec.Body.String()
+				if isPage := strings.Contains(body, "Dynamic Content Examples"); isPage != tt.expectedPage {
+					t.Errorf("full page rendered = %v, expected %v", isPage, tt.expectedPage)
+				}
+				if !slices.Contains(rec.Header().Values("Vary"), "HX-Request") {
+					t.Errorf("Vary = %v, expected it to include HX-Request", rec.Header().Values("Vary"))
+				}
+			})
+		}
+	}
+}
+
+func TestHealthWhileDatabaseConnecting(t *testing.T) {
+	database, err := db.Open(db.Options{URL: "postgres://user@127.0.0.1:1/app", MaxConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	h := New(database, &config.Config{}, RenderOptions{})
+
+	live := httptest.NewRecorder()
+	h.LivenessCheck(live, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if live.Code != http.StatusOK {
+		t.Errorf("liveness status = %d, expected %d", live.Code, http.StatusOK)
+	}
+
+	ready := httptest.NewRecorder()
+	h.ReadinessCheck(ready, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if ready.Code != http.StatusServiceUnavailable {
+		t.Errorf("readiness status = %d, expected %d", ready.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHealthReportsTrippedCircuitBreaker(t *testing.T) {
+	database, err := db.Open(db.Options{URL: "postgres://user@127.0.0.1:1/app", MaxConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	h := New(database, &config.Config{}, RenderOptions{})
+	database.CircuitBreaker.Trip()
+
+	rec := httptest.NewRecorder()
+	h.HealthCheck(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var status HealthStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	breaker := status.Checks["circuit_breaker"]
+	if breaker.Status != "degraded" || !strings.Contains(breaker.Message, "open") {
+		t.Errorf("circuit_breaker check = %+v, expected degraded and open", breaker)
+	}
+}
+
+func TestHealthReportsUnreachableReplicaAsDegraded(t *testing.T) {
+	database, err := db.Open(db.Options{
+		URL:        "postgres://user@127.0.0.1:1/app",
+		ReplicaURL: "postgres://user@127.0.0.1:2/app",
+		MaxConns:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	h := New(database, &config.Config{}, RenderOptions{})
+
+	status := h.healthStatus(context.Background())
+	if replica := status.Checks["replica"]; replica.Status != "degraded" || replica.Message == "" {
+		t.Errorf("replica check = %+v, expected degraded with the connection error", replica)
+	}
+}
+
+func TestAdminTripCircuitBreakerTripsReplica(t *testing.T) {
+	database, err := db.Open(db.Options{
+		URL:        "postgres://user@127.0.0.1:1/app",
+		ReplicaURL: "postgres://user@127.0.0.1:2/app",
+		MaxConns:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	h := New(database, &config.Config{}, RenderOptions{})
+
+	rec := httptest.NewRecorder()
+	h.AdminTripCircuitBreaker(rec, httptest.NewRequest(http.MethodPost, "/admin/circuit-breaker/trip", nil))
+
+	var stats map[string]circuitbreaker.Stats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"primary", "replica"} {
+		if state := stats[name].State; state != circuitbreaker.StateOpen.String() {
+			t.Errorf("%s breaker state = %q, expected %q", name, state, circuitbreaker.StateOpen)
+		}
+	}
+	if state := database.ReplicaCircuitBreaker.GetState(); state != circuitbreaker.StateOpen {
+		t.Errorf("replica breaker state = %v, expected open", state)
+	}
+}
+
+func TestAdminResetCircuitBreaker(t *testing.T) {
+	database, err := db.Open(db.Options{
+		URL:        "postgres://user@127.0.0.1:1/app",
+		ReplicaURL: "postgres://user@127.0.0.1:2/app",
+		MaxConns:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	h := New(database, &config.Config{}, RenderOptions{})
+	database.CircuitBreaker.Trip()
+	database.ReplicaCircuitBreaker.Trip()
+
+	rec := httptest.NewRecorder()
+	h.AdminResetCircuitBreaker(rec, httptest.NewRequest(http.MethodPost, "/admin/circuit-breaker/reset", nil))
+
+	var stats map[string]circuitbreaker.Stats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"primary", "replica"} {
+		if state := stats[name].State; state != circuitbreaker.StateClosed.String() {
+			t.Errorf("%s breaker state = %q, expected %q", name, state, circuitbreaker.StateClosed)
+		}
+	}
+}
+
+func TestTrippedCircuitBreakerFailsStoreCalls(t *testing.T) {
+	database, err := db.Open(db.Options{URL: "postgres://user@127.0.0.1:1/app", MaxConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	h := New(database, &config.Config{}, RenderOptions{})
+	database.CircuitBreaker.Trip()
+
+	ctx := context.Background()
+	if _, err := h.userStore.GetAllPaginated(ctx, db.NewPaginationParams(1, 10), db.UserFilter{}); !errors.Is(err, circuitbreaker.ErrCircuitBreakerOpen) {
+		t.Errorf("GetAllPaginated() error = %v, expected ErrCircuitBreakerOpen", err)
+	}
+	if _, err := h.counterStore.Increment(ctx); !errors.Is(err, circuitbreaker.ErrCircuitBreakerOpen) {
+		t.Errorf("Increment() error = %v, expected ErrCircuitBreakerOpen", err)
+	}
+}
+
+func TestHealthRuntimeCheck(t *testing.T) {
+	database, err := db.Open(db.Options{URL: "postgres://user@127.0.0.1:1/app", MaxConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	tests := []struct {
+		name           string
+		cfg            config.Config
+		expectedStatus string
+	}{
+		{"disabled by default", config.Config{}, ""},
+		{"under the ceiling", config.Config{HealthRuntime: true, HealthMaxGoroutines: 1_000_000}, "healthy"},
+		{"no ceiling", config.Config{HealthRuntime: true}, "healthy"},
+		{"over the ceiling", config.Config{HealthRuntime: true, HealthMaxGoroutines: 1}, "degraded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(database, &tt.cfg, RenderOptions{})
+			runtime.GC()
+
+			rec := httptest.NewRecorder()
+			h.HealthCheck(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			var status HealthStatus
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+			check, ok := status.Checks["runtime"]
+			if tt.expectedStatus == "" {
+				if ok {
+					t.Errorf("runtime check = %+v, expected none without HEALTH_RUNTIME", check)
+				}
+				return
+			}
+			if check.Status != tt.expectedStatus {
+				t.Errorf("runtime status = %q (%s), expected %q", check.Status, check.Message, tt.expectedStatus)
+			}
+			stats := check.Runtime
+			if stats == nil {
+				t.Fatal("runtime check has no stats")
+			}
+			if stats.HeapAllocBytes == 0 || stats.HeapSysBytes == 0 || stats.Goroutines == 0 || stats.NumGC == 0 {
+				t.Errorf("runtime stats = %+v, expected heap, goroutine and GC figures", stats)
+			}
+			if stats.TotalGCPause < stats.LastGCPause {
+				t.Errorf("total GC pause %v is less than the last pause %v", stats.TotalGCPause, stats.LastGCPause)
+			}
+		})
+	}
+}
+
+func TestMaintenanceToggleAndPage(t *testing.T) {
+	h := newTestHandlers(t, 0)
+
+	toggle := func(value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader("enabled="+value))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.AdminMaintenance(rec, req)
+		return rec
+	}
+
+	if rec := toggle("true"); rec.Code != http.StatusOK || !h.InMaintenance() {
+		t.Fatalf("enabling maintenance: status %d, in maintenance %v", rec.Code, h.InMaintenance())
+	}
+
+	page := httptest.NewRecorder()
+	h.MaintenancePage(page, httptest.NewRequest(http.MethodGet, "/", nil))
+	if page.Code != http.StatusServiceUnavailable || page.Header().Get("Retry-After") == "" {
+		t.Errorf("page: status %d, Retry-After %q", page.Code, page.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(page.Body.String(), "maintenance") {
+		t.Error("page body does not mention maintenance")
+	}
+
+	api := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	req.Header.Set("Accept", "application/json")
+	h.MaintenancePage(api, req)
+	if !strings.HasPrefix(api.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("API client got Content-Type %q, expected JSON", api.Header().Get("Content-Type"))
+	}
+	var body errorBody
+	if err := json.NewDecoder(api.Body).Decode(&body); err != nil || body.Code != CodeMaintenance || len(body.Errors) != 1 {
+		t.Errorf("API client got body %+v (%v), expected the maintenance error envelope", body, err)
+	}
+
+	fragment := httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/counter/increment", nil)
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("HX-Current-URL", "http://example.com/counter")
+	h.MaintenancePage(fragment, req)
+	if got := fragment.Header().Get("HX-Redirect"); got != "/counter" {
+		t.Errorf("HTMX request got HX-Redirect %q, expected a reload of /counter", got)
+	}
+	if page.Header().Get("HX-Redirect") != "" {
+		t.Error("plain request got an HX-Redirect")
+	}
+
+	if rec := toggle("false"); rec.Code != http.StatusOK || h.InMaintenance() {
+		t.Errorf("disabling maintenance: status %d, in maintenance %v", rec.Code, h.InMaintenance())
+	}
+	if rec := toggle("maybe"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid value: status %d, expected 400", rec.Code)
+	}
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	h := newTestHandlers(t, 2)
+	h.userStore = db.NewReadOnlyUserRepository(h.userStore)
+	h.counterStore = db.NewReadOnlyCounterRepository(h.counterStore)
+
+	createForm := url.Values{"user-name": {"New User"}, "user-email": {"new@example.com"}}.Encode()
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		htmx           bool
+		serve          http.HandlerFunc
+		expectedStatus int
+		expectInBody   string
+		// expectRetarget is where HTMX is told to swap the refusal
+		expectRetarget string
+	}{
+		{"increment refused", http.MethodPost, "/counter/increment", "", false, h.CounterIncrement, http.StatusServiceUnavailable, "read-only", ""},
+		{"increment refused into the page errors", http.MethodPost, "/counter/increment", "", true, h.CounterIncrement, http.StatusServiceUnavailable, "read-only", "#errors"},
+		{"create refused into the form errors", http.MethodPost, "/api/users", createForm, true, h.CreateUser, http.StatusServiceUnavailable, "read-only", "#form-errors"},
+		{"create refused", http.MethodPost, "/api/users", createForm, false, h.CreateUser, http.StatusServiceUnavailable, "read-only", ""},
+		{"delete refused", http.MethodDelete, "/api/users/1", "", false, h.DeleteUser, http.StatusServiceUnavailable, "read-only", ""},
+		{"delete refused into the page errors", http.MethodDelete, "/api/users/1", "", true, h.DeleteUser, http.StatusServiceUnavailable, "read-only", "#errors"},
+		{"users still listed", http.MethodGet, "/api/users", "", false, h.GetUsers, http.StatusOK, "user1@example.com", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetPathValue("id", "1")
+			if tt.htmx {
+				req.Header.Set("HX-Request", "true")
+			}
+			rec := httptest.NewRecorder()
+
+			tt.serve(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expectedStatus)
+			}
+			if !strings.Contains(rec.Body.String(), tt.expectInBody) {
+				t.Errorf("body %q does not contain %q", rec.Body.String(), tt.expectInBody)
+			}
+			if got := rec.Header().Get("HX-Retarget"); got != tt.expectRetarget {
+				t.Errorf("HX-Retarget = %q, expected %q", got, tt.expectRetarget)
+			}
+		})
+	}
+}
+
+func TestExportUsers(t *testing.T) {
+	h := newTestHandlers(t, 3)
+
+	rec := httptest.NewRecorder()
+	h.ExportUsers(rec, httptest.NewRequest(http.MethodGet, "/api/users/export", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, expected 200", rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+		t.Errorf("Content-Type = %q, expected text/csv", contentType)
+	}
+
+	// The export must round-trip through the import format
+	inputs, err := parseUserCSV(rec.Body)
+	if err != nil {
+		t.Fatalf("export is not importable: %v", err)
+	}
+	if len(inputs) != 3 || inputs[0].Email != "user2@example.com" {
+		t.Errorf("exported %v, expected 3 users newest first", inputs)
+	}
+}
+
+// endlessUserRepository streams users until its context is done, recording whether the
+// stream was stopped by cancellation
+type endlessUserRepository struct {
+	db.UserRepository
+	streamed  int
+	cancelled bool
+}
+
+func (r *endlessUserRepository) ForEach(ctx context.Context, fn func(*db.User) error) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			r.cancelled = true
+			return err
+		}
+		r.streamed++
+		if err := fn(&db.User{ID: r.streamed, Name: "User", Email: fmt.Sprintf("user%d@example.com", r.streamed)}); err != nil {
+			return err
+		}
+	}
+}
+
+// disconnectingRecorder simulates a client that goes away once the first batch of the
+// response has been flushed to it
+type disconnectingRecorder struct {
+	*httptest.ResponseRecorder
+	disconnect context.CancelFunc
+}
+
+func (r *disconnectingRecorder) Flush() {
+	r.ResponseRecorder.Flush()
+	r.disconnect()
+}
+
+func TestExportUsersStopsWhenClientDisconnects(t *testing.T) {
+	repo := &endlessUserRepository{}
+	h := newTestHandlers(t, 0)
+	h.userStore = repo
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := &disconnectingRecorder{ResponseRecorder: httptest.NewRecorder(), disconnect: cancel}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ExportUsers(rec, httptest.NewRequest(http.MethodGet, "/api/users/export", nil).WithContext(ctx))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("export kept streaming after the client disconnected")
+	}
+	if !repo.cancelled {
+		t.Error("the query was not cancelled")
+	}
+	if repo.streamed != exportFlushRows {
+		t.Errorf("streamed %d users, expected to stop right after the first flush at %d", repo.streamed, exportFlushRows)
+	}
+}
+
+// failingUserRepository streams rows users and then fails, like a query killed midway
+type failingUserRepository struct {
+	db.UserRepository
+	rows int
+}
+
+func (r *failingUserRepository) ForEach(ctx context.Context, fn func(*db.User) error) error {
+	for i := range r.rows {
+		if err := fn(&db.User{ID: i + 1, Name: "User", Email: fmt.Sprintf("user%d@example.com", i+1)}); err != nil {
+			return err
+		}
+	}
+	return errors.New("canceling statement due to statement timeout")
+}
+
+func TestExportUsersFailingMidStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		rows        int
+		expectAbort bool
+	}{
+		{"before the first user", 0, false},
+		{"after rows were sent", exportFlushRows + 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, 0)
+			h.userStore = &failingUserRepository{rows: tt.rows}
+			rec := httptest.NewRecorder()
+
+			aborted := func() (aborted bool) {
+				defer func() {
+					if p := recover(); p != nil {
+						if p != http.ErrAbortHandler {
+							panic(p)
+						}
+						aborted = true
+					}
+				}()
+				h.ExportUsers(rec, httptest.NewRequest(http.MethodGet, "/api/users/export", nil))
+				return false
+			}()
+
+			if aborted != tt.expectAbort {
+				t.Errorf("aborted = %v, expected %v", aborted, tt.expectAbort)
+			}
+			if !tt.expectAbort && rec.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, expected the error to be reported with a 500", rec.Code)
+			}
+		})
+	}
+}
+
+func TestGetUsersCapped(t *testing.T) {
+	tests := []struct {
+		name          string
+		users         int
+		limit         int
+		expectedCards int
+		expectLink    bool
+	}{
+		{"more users than the cap", 12, 5, 5, true},
+		{"exactly the cap", 5, 5, 5, false},
+		{"fewer users than the cap", 3, 5, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, tt.users)
+			h.config.UsersListLimit = tt.limit
+
+			rec := httptest.NewRecorder()
+			h.GetUsers(rec, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, expected 200", rec.Code)
+			}
+			if cards := strings.Count(rec.Body.String(), "data-user-id="); cards != tt.expectedCards {
+				t.Errorf("rendered %d user cards, expected %d", cards, tt.expectedCards)
+			}
+			if total := rec.Header().Get("X-Total-Count"); total != strconv.Itoa(tt.users) {
+				t.Errorf("X-Total-Count = %q, expected %d", total, tt.users)
+			}
+
+			link := rec.Header().Get("Link")
+			expectedLink := `<http://example.com/api/users/paginated?page=1&page_size=100>; rel="first"`
+			if tt.expectLink && link != expectedLink {
+				t.Errorf("Link = %q, expected %q", link, expectedLink)
+			}
+			if !tt.expectLink && link != "" {
+				t.Errorf("Link = %q, expected none when every user fits", link)
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	h := newTestHandlers(t, 0)
+	rec := httptest.NewRecorder()
+	h.Version(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if body["version"] != "dev" || body["go_version"] == "" {
+		t.Errorf("body = %v, expected version dev and the Go version", body)
+	}
+}
+
+func TestCounterDecrementFloor(t *testing.T) {
+	h := newTestHandlers(t, 0)
+	ctx := context.Background()
+	if _, err := h.counterStore.Set(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	decrement := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		maps.Copy(req.Header, header)
+		rec := httptest.NewRecorder()
+		h.CounterDecrement(rec, req)
+		return rec
+	}
+
+	rec := decrement("/counter/decrement?floor=0", http.Header{"Hx-Request": {"true"}})
+	if body := strings.TrimSpace(rec.Body.String()); body != "0" || rec.Header().Get("HX-Trigger") != "" {
+		t.Errorf("decrement from 1 = %q with HX-Trigger %q, expected 0 and no trigger", body, rec.Header().Get("HX-Trigger"))
+	}
+
+	// At the floor nothing changes and nothing is recorded
+	rec = decrement("/counter/decrement?floor=0", http.Header{"Hx-Request": {"true"}})
+	if body := strings.TrimSpace(rec.Body.String()); body != "0" {
+		t.Errorf("decrement at the floor = %q, expected 0", body)
+	}
+	if trigger := rec.Header().Get("HX-Trigger"); trigger != `{"counterAtFloor":{"floor":0}}` {
+		t.Errorf("HX-Trigger = %q, expected counterAtFloor", trigger)
+	}
+
+	rec = decrement("/counter/decrement?floor=0", http.Header{"Accept": {"application/json"}})
+	var result struct {
+		Count   int  `json:"count"`
+		Changed bool `json:"changed"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decoding JSON response %q: %v", rec.Body.String(), err)
+	}
+	if result.Count != 0 || result.Changed {
+		t.Errorf("JSON decrement at the floor = %+v, expected count 0, unchanged", result)
+	}
+
+	if events, _ := h.counterStore.History(ctx, 0); len(events) != 2 {
+		t.Errorf("history has %d events, expected the set and one decrement", len(events))
+	}
+
+	if rec := decrement("/counter/decrement?floor=5", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("floor=5 status = %d, expected 400", rec.Code)
+	}
+
+	// Without a floor the counter still goes negative
+	if body := strings.TrimSpace(decrement("/counter/decrement", nil).Body.String()); body != "-1" {
+		t.Errorf("plain decrement at zero = %q, expected -1", body)
+	}
+}
+
+func TestGetTimeCaching(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 7, 500_000_000, time.UTC)
+	lastModified := func(tm time.Time) string { return tm.Format(http.TimeFormat) }
+
+	tests := []struct {
+		name                 string
+		maxAge               time.Duration
+		ifModifiedSince      string
+		expectedStatus       int
+		expectedCacheControl string
+		expectedLastModified string
+	}{
+		{"uncached by default", 0, "", http.StatusOK, "max-age=0", lastModified(now.Truncate(time.Second))},
+		{"same second is not modified", 0, lastModified(now.Truncate(time.Second)), http.StatusNotModified, "max-age=0", lastModified(now.Truncate(time.Second))},
+		{"earlier second is modified", 0, lastModified(now.Add(-time.Second)), http.StatusOK, "max-age=0", lastModified(now.Truncate(time.Second))},
+		{"max-age rounds the time down", 10 * time.Second, "", http.StatusOK, "max-age=10", lastModified(now.Truncate(10 * time.Second))},
+		{"revalidating within max-age", 10 * time.Second, lastModified(now.Add(-5 * time.Second)), http.StatusNotModified, "max-age=10", lastModified(now.Truncate(10 * time.Second))},
+		{"revalidating after max-age", 10 * time.Second, lastModified(now.Add(-10 * time.Second)), http.StatusOK, "max-age=10", lastModified(now.Truncate(10 * time.Second))},
+		{"malformed header is ignored", 0, "yesterday", http.StatusOK, "max-age=0", lastModified(now.Truncate(time.Second))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, 0)
+			h.config.TimeMaxAge = tt.maxAge
+			h.now = func() time.Time { return now }
+
+			req := httptest.NewRequest(http.MethodGet, "/api/time", nil)
+			if tt.ifModifiedSince != "" {
+				req.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+			rec := httptest.NewRecorder()
+			h.GetTime(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expectedStatus)
+			}
+			if cc := rec.Header().Get("Cache-Control"); cc != tt.expectedCacheControl {
+				t.Errorf("Cache-Control = %q, expected %q", cc, tt.expectedCacheControl)
+			}
+			if lm := rec.Header().Get("Last-Modified"); lm != tt.expectedLastModified {
+				t.Errorf("Last-Modified = %q, expected %q", lm, tt.expectedLastModified)
+			}
+			if tt.expectedStatus == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("304 response has a body: %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetTimeZone(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 7, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		location       *time.Location
+		format         string
+		target         string
+		expectedStatus int
+		expectedTime   string
+	}{
+		{"configured zone", time.UTC, "", "/api/time", http.StatusOK, "2025-06-01 12:00:07 UTC"},
+		{"tz parameter overrides", time.UTC, "", "/api/time?tz=Asia/Tokyo", http.StatusOK, "2025-06-01 21:00:07 JST"},
+		{"configured format", time.UTC, "15:04 on Jan 2", "/api/time?tz=America/New_York", http.StatusOK, "08:00 on Jun 1"},
+		{"unknown zone", time.UTC, "", "/api/time?tz=Mars/Olympus_Mons", http.StatusBadRequest, ""},
+		{"path in zone", time.UTC, "", "/api/time?tz=../../etc/passwd", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, 0)
+			h.location = tt.location
+			h.config.DisplayTimeFormat = tt.format
+			h.now = func() time.Time { return now }
+
+			rec := httptest.NewRecorder()
+			h.GetTime(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, expected %d", rec.Code, tt.expectedStatus)
+			}
+			if tt.expectedTime != "" && !strings.Contains(rec.Body.String(), tt.expectedTime) {
+				t.Errorf("body %q does not show %q", rec.Body.String(), tt.expectedTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"htmx-learn/circuitbreaker"
+)
+
+// breakerStates are the states exported for each circuit breaker, one series apiece
+var breakerStates = []circuitbreaker.State{circuitbreaker.StateClosed, circuitbreaker.StateOpen, circuitbreaker.StateHalfOpen}
+
+// healthCollector exports what /health reports as gauges, so alerting can use the
+// same checks as the probes without scraping JSON. The checks run on every scrape.
+type healthCollector struct {
+	h       *Handlers
+	health  *prometheus.Desc
+	breaker *prometheus.Desc
+}
+
+// HealthCollector returns a Prometheus collector for the application's health:
+// app_health is 1 for the overall status and each check that is healthy and 0
+// otherwise, and app_circuit_breaker_state is 1 for the state each breaker is in
+func (h *Handlers) HealthCollector() prometheus.Collector {
+	return &healthCollector{
+		h: h,
+		health: prometheus.NewDesc("app_health",
+			"Whether the application (check=\"overall\") or one of its health checks is healthy.",
+			[]string{"check"}, nil),
+		breaker: prometheus.NewDesc("app_circuit_breaker_state",
+			"Whether a database circuit breaker is in the given state.",
+			[]string{"breaker", "state"}, nil),
+	}
+}
+
+func (c *healthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.health
+	ch <- c.breaker
+}
+
+func (c *healthCollector) Collect(ch chan<- prometheus.Metric) {
+	status := c.h.healthStatus(context.Background())
+	ch <- prometheus.MustNewConstMetric(c.health, prometheus.GaugeValue, healthValue(status.Status), "overall")
+	for name, check := range status.Checks {
+		ch <- prometheus.MustNewConstMetric(c.health, prometheus.GaugeValue, healthValue(check.Status), name)
+	}
+
+	c.collectBreaker(ch, "primary", c.h.database.CircuitBreaker)
+	if c.h.database.ReplicaCircuitBreaker != nil {
+		c.collectBreaker(ch, "replica", c.h.database.ReplicaCircuitBreaker)
+	}
+}
+
+// collectBreaker sends one series per state, set to 1 for the state breaker is in
+func (c *healthCollector) collectBreaker(ch chan<- prometheus.Metric, name string, breaker *circuitbreaker.CircuitBreaker) {
+	current := breaker.GetState()
+	for _, state := range breakerStates {
+		value := 0.0
+		if state == current {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.breaker, prometheus.GaugeValue, value, name, state.String())
+	}
+}
+
+// healthValue is the gauge value of a health status
+func healthValue(status string) float64 {
+	if status == "healthy" {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"htmx-learn/config"
+	"htmx-learn/db"
+)
+
+func TestHealthCollector(t *testing.T) {
+	tests := []struct {
+		name     string
+		dbErr    error
+		trip     bool
+		expected string
+	}{
+		{
+			name: "healthy database",
+			expected: `
+# HELP app_health Whether the application (check="overall") or one of its health checks is healthy.
+# TYPE app_health gauge
+app_health{check="circuit_breaker"} 1
+app_health{check="database"} 1
+app_health{check="overall"} 1
+# HELP app_circuit_breaker_state Whether a database circuit breaker is in the given state.
+# TYPE app_circuit_breaker_state gauge
+app_circuit_breaker_state{breaker="primary",state="closed"} 1
+app_circuit_breaker_state{breaker="primary",state="half-open"} 0
+app_circuit_breaker_state{breaker="primary",state="open"} 0
+`,
+		},
+		{
+			name:  "unreachable database and tripped breaker",
+			dbErr: errors.New("connection refused"),
+			trip:  true,
+			expected: `
+# HELP app_health Whether the application (check="overall") or one of its health checks is healthy.
+# TYPE app_health gauge
+app_health{check="circuit_breaker"} 0
+app_health{check="database"} 0
+app_health{check="overall"} 0
+# HELP app_circuit_breaker_state Whether a database circuit breaker is in the given state.
+# TYPE app_circuit_breaker_state gauge
+app_circuit_breaker_state{breaker="primary",state="closed"} 0
+app_circuit_breaker_state{breaker="primary",state="half-open"} 0
+app_circuit_breaker_state{breaker="primary",state="open"} 1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, err := db.Open(db.Options{URL: "postgres://user@127.0.0.1:1/app", MaxConns: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer database.Close()
+			h := New(database, &config.Config{}, RenderOptions{})
+			h.checkDatabase = func(context.Context, *pgxpool.Pool) error { return tt.dbErr }
+			if tt.trip {
+				database.CircuitBreaker.Trip()
+			}
+
+			if err := testutil.CollectAndCompare(h.HealthCollector(), strings.NewReader(tt.expected)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
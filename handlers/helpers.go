@@ -2,27 +2,276 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"htmx-learn/db"
 	"htmx-learn/templates/components"
+	"htmx-learn/validation"
 	"github.com/a-h/templ"
 )
 
-// renderTemplate renders a templ component and handles errors consistently
-func renderTemplate(w http.ResponseWriter, r *http.Request, component templ.Component) {
-	if err := component.Render(r.Context(), w); err != nil {
-		slog.Error("Template rendering error", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+// renderTemplate renders a templ component and handles errors consistently. With
+// RenderOptions.Minify the output is buffered and minified before it is written.
+func (h *Handlers) renderTemplate(w http.ResponseWriter, r *http.Request, component templ.Component) {
+	setHTMLContentType(w)
+	if !h.render.Minify {
+		if err := component.Render(r.Context(), w); err != nil {
+			writeError(w, r, fmt.Errorf("rendering template: %w", err))
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := component.Render(r.Context(), &buf); err != nil {
+		writeError(w, r, fmt.Errorf("rendering template: %w", err))
+		return
+	}
+	minified := minifyHTML(buf.Bytes())
+	slog.DebugContext(r.Context(), "Minified HTML",
+		"path", r.URL.Path,
+		"bytes", buf.Len(),
+		"saved", buf.Len()-len(minified),
+	)
+	w.Write(minified)
+}
+
+// setHTMLContentType declares the response as UTF-8 HTML unless the handler already
+// chose a type, so fragments don't depend on content sniffing. A fragment starting
+// with text or a comment could otherwise be sniffed as plain text.
+func setHTMLContentType(w http.ResponseWriter) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+}
+
+// parseForm parses the request form, telling a client that disconnected mid-upload apart
+// from genuinely malformed data. Aborts are logged at info and get no error page since
+// nobody is listening; malformed bodies get a 400. Bodies over FORM_MAX_BYTES get a
+// 413, and forms with more than FORM_MAX_FIELDS values (counting query parameters and
+// repeated names) a 400, so a field bomb is turned away before handlers loop over it.
+// It reports whether to continue.
+func (h *Handlers) parseForm(w http.ResponseWriter, r *http.Request) bool {
+	if h.config.FormMaxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.config.FormMaxBytes)
+	}
+	err := r.ParseForm()
+	if err == nil {
+		return h.checkFormFields(w, r)
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, r, &AppError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    CodeRequestTooLarge,
+			Message: fmt.Sprintf("form body must not exceed %d bytes", tooLarge.Limit),
+			Err:     err,
+		})
+		return false
+	}
+
+	if isClientAbort(r, err) {
+		slog.InfoContext(r.Context(), "Client aborted request body",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"error", err,
+		)
+		return false
+	}
+
+	writeError(w, r, badRequest("Invalid form data"))
+	return false
+}
+
+// checkFormFields rejects a parsed form holding more than FORM_MAX_FIELDS values
+func (h *Handlers) checkFormFields(w http.ResponseWriter, r *http.Request) bool {
+	if h.config.FormMaxFields <= 0 {
+		return true
+	}
+	fields := 0
+	for _, values := range r.Form {
+		fields += len(values)
+	}
+	if fields > h.config.FormMaxFields {
+		writeError(w, r, badRequest(fmt.Sprintf("form must not have more than %d fields", h.config.FormMaxFields)))
+		return false
+	}
+	return true
+}
+
+// isClientAbort reports whether a body read error was caused by the client going away
+func isClientAbort(r *http.Request, err error) bool {
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(r.Context().Err(), context.Canceled)
+}
+
+// isHTMX reports whether r was issued by HTMX, either directly or through hx-boost.
+//
+// Handlers that return fragments follow one convention: HTMX requests get the bare
+// fragment, anything else (a deep link, a refresh, a form posted without JavaScript)
+// gets the full page the fragment lives on. Such handlers must also set
+// "Vary: HX-Request" so caches keep the two representations apart.
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true" || r.Header.Get("HX-Boosted") == "true"
+}
+
+// respondFormError reports problems the user can fix. HTMX requests get a FormError
+// fragment retargeted into target so it lands in an error container instead of
+// replacing the form or list; other clients get JSON, with code, or plain text.
+func (h *Handlers) respondFormError(w http.ResponseWriter, r *http.Request, target string, status int, code string, messages []string) {
+	slog.DebugContext(r.Context(), "Rejected form submission",
+		"path", r.URL.Path,
+		"status", status,
+		"errors", messages,
+		"form", h.formRedactor.Form(r.PostForm),
+	)
+
+	if isHTMX(r) {
+		w.Header().Set("HX-Retarget", target)
+		w.Header().Set("HX-Reswap", "innerHTML")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		h.renderTemplate(w, r, components.FormError(messages))
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSONErrors(w, status, code, messages)
+		return
+	}
+
+	http.Error(w, strings.Join(messages, "; "), status)
+}
+
+// respondValidationError reports invalid user input. JSON API clients get the
+// messages keyed by field so each can be attached to its input; HTMX and plain
+// clients get the same responses as respondFormError.
+func (h *Handlers) respondValidationError(w http.ResponseWriter, r *http.Request, target string, err error) {
+	var errs validation.ValidationErrors
+	if !isHTMX(r) && wantsJSON(r) && errors.As(err, &errs) {
+		writeJSONFieldErrors(w, errs)
+		return
 	}
+
+	h.respondFormError(w, r, target, http.StatusBadRequest, CodeInvalidRequest, validationMessages(err))
 }
 
-// handleError logs an error with context and sends an appropriate HTTP error response
-func handleError(w http.ResponseWriter, context string, err error) {
-	slog.Error("Handler error", "context", context, "error", err)
-	http.Error(w, "Internal server error", http.StatusInternalServerError)
+// notModifiedSince reports whether r's If-Modified-Since shows the client already has
+// the version last modified at modified. As in net/http, only GET and HEAD are
+// conditional and times are compared to the second, the header's resolution.
+func notModifiedSince(r *http.Request, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// setHXTrigger asks HTMX to fire event on the client with detail as the event detail.
+// Calling it again merges events into the same HX-Trigger header. It must be called
+// before the response is written.
+func setHXTrigger(w http.ResponseWriter, event string, detail any) {
+	events := make(map[string]any)
+	if existing := w.Header().Get("HX-Trigger"); existing != "" {
+		var previous map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(existing), &previous); err == nil {
+			for name, value := range previous {
+				events[name] = value
+			}
+		}
+	}
+	events[event] = detail
+
+	encoded, err := json.Marshal(events)
+	if err != nil {
+		slog.Error("Error encoding HX-Trigger", "event", event, "error", err)
+		return
+	}
+	w.Header().Set("HX-Trigger", string(encoded))
+}
+
+// HTMX doesn't surface 3xx redirects to the page: the XHR follows them and the result
+// is swapped like any response. Handlers navigate HTMX clients with response headers
+// instead, which must be set before the response is written:
+//
+//   - hxRedirect makes the browser load url as a full page, as if the user followed a
+//     link. Use it when the whole page has to change or be rebuilt, e.g. to leave the
+//     app for the maintenance page or after something that invalidates every fragment.
+//   - hxLocation navigates without a reload: HTMX fetches the path, swaps it into the
+//     target (the body by default) and pushes it onto the history. Use it to move
+//     between views of the app, where keeping the page's scripts and SSE streams alive
+//     is cheaper and smoother.
+
+// hxRedirect asks HTMX to load url as a full page
+func hxRedirect(w http.ResponseWriter, url string) {
+	w.Header().Set("HX-Redirect", url)
+}
+
+// hxLocationOptions is an HX-Location navigation: the path to fetch and, optionally,
+// where and how to swap it
+type hxLocationOptions struct {
+	Path   string `json:"path"`
+	Target string `json:"target,omitempty"`
+	Swap   string `json:"swap,omitempty"`
+	Select string `json:"select,omitempty"`
+	// Values are sent as request parameters
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// hxLocation asks HTMX to navigate to opts.Path without a full page load
+func hxLocation(w http.ResponseWriter, opts hxLocationOptions) {
+	// A bare path is the documented short form when nothing else is customized
+	if opts.Target == "" && opts.Swap == "" && opts.Select == "" && len(opts.Values) == 0 {
+		w.Header().Set("HX-Location", opts.Path)
+		return
+	}
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		slog.Error("Error encoding HX-Location", "path", opts.Path, "error", err)
+		return
+	}
+	w.Header().Set("HX-Location", string(encoded))
+}
+
+// currentPage returns the path and query of the page an HTMX request was issued from,
+// or "/" when unknown. Only those parts of the client-supplied HX-Current-URL are
+// kept, so redirecting to it can't send the browser to another site.
+func currentPage(r *http.Request) string {
+	current, err := url.Parse(r.Header.Get("HX-Current-URL"))
+	if err != nil || !strings.HasPrefix(current.Path, "/") || strings.HasPrefix(current.Path, "//") {
+		return "/"
+	}
+	return (&url.URL{Path: current.Path, RawQuery: current.RawQuery}).String()
+}
+
+// validationMessages flattens validation errors into one message per field
+func validationMessages(err error) []string {
+	var errs validation.ValidationErrors
+	if !errors.As(err, &errs) {
+		return []string{err.Error()}
+	}
+	
+	messages := make([]string, len(errs))
+	for i, fe := range errs {
+		messages[i] = fe.Error()
+	}
+	return messages
 }
 
 // convertToTemplateUsers converts database users to template users
@@ -51,13 +300,31 @@ func convertToTemplateUser(user *db.User) components.User {
 	}
 }
 
-// parsePaginationParams extracts and validates pagination parameters from request
-func parsePaginationParams(r *http.Request) (db.PaginationParams, error) {
-	pageStr := r.URL.Query().Get("page")
-	pageSizeStr := r.URL.Query().Get("page_size")
+// convertToTemplateCounterEvents converts database counter events to template events
+func convertToTemplateCounterEvents(events []db.CounterEvent) []components.CounterEvent {
+	result := make([]components.CounterEvent, len(events))
+	for i, event := range events {
+		result[i] = components.CounterEvent{
+			Operation: event.Operation,
+			Delta:     event.Delta,
+			Value:     event.Value,
+			CreatedAt: event.CreatedAt,
+		}
+	}
+	return result
+}
+
+// parsePaginationParams extracts and validates pagination parameters from request,
+// using defaultPageSize when the client doesn't give a valid page_size (it is clamped
+// like any other size) and rejecting pages that start more than maxOffset rows in.
+// page and page_size come from the form body when the handler has parsed one, so an
+// HTMX form can post them with the rest of its fields, and otherwise from the query.
+func parsePaginationParams(r *http.Request, defaultPageSize, maxOffset int) (db.PaginationParams, error) {
+	pageStr := listingValue(r, "page")
+	pageSizeStr := listingValue(r, "page_size")
 	
 	page := 1
-	pageSize := db.DefaultPageSize
+	pageSize := defaultPageSize
 	
 	if pageStr != "" {
 		if p, err := strconv.Atoi(pageStr); err == nil {
@@ -73,5 +340,135 @@ func parsePaginationParams(r *http.Request) (db.PaginationParams, error) {
 	
 	// Create validated pagination params
 	params := db.NewPaginationParams(page, pageSize)
+	if err := params.CheckDepth(maxOffset); err != nil {
+		return db.PaginationParams{}, err
+	}
 	return params, nil
-}
\ No newline at end of file
+}
+
+// listingValue returns the listing parameter key, such as page or created_after, from
+// the parsed form body, falling back to the query string when the body doesn't set it
+func listingValue(r *http.Request, key string) string {
+	if value := r.PostForm.Get(key); value != "" {
+		return value
+	}
+	return r.URL.Query().Get(key)
+}
+
+// wantsJSON reports whether the client listed application/json in its Accept header
+func wantsJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, _ := strings.Cut(mediaRange, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), "application/json") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isAPIPath reports whether path belongs to the JSON/fragment API under /api
+func isAPIPath(path string) bool {
+	return path == "/api" || strings.HasPrefix(path, "/api/")
+}
+
+// paginationLinks builds absolute first/last/prev/next URLs for the request's page
+func (h *Handlers) paginationLinks(r *http.Request, page, totalPages int, hasPrev, hasNext bool) PaginationLinks {
+	links := PaginationLinks{
+		First: h.pageURL(r, 1),
+		// An empty collection has no pages, but page 1 is still where it starts
+		Last: h.pageURL(r, max(totalPages, 1)),
+	}
+	if hasPrev {
+		links.Prev = h.pageURL(r, page-1)
+	}
+	if hasNext {
+		links.Next = h.pageURL(r, page+1)
+	}
+	return links
+}
+
+// pageURL returns the absolute request URL with its page parameter replaced,
+// keeping every other query parameter such as page_size and sort
+func (h *Handlers) pageURL(r *http.Request, page int) string {
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+	return h.absoluteURL(r, r.URL.Path, query)
+}
+
+// absoluteURL returns the URL for path and query on the host r was sent to, with the
+// scheme the client used, which a trusted proxy reports in X-Forwarded-Proto
+func (h *Handlers) absoluteURL(r *http.Request, path string, query url.Values) string {
+	u := url.URL{
+		Scheme:   h.clientIPs.Proto(r),
+		Host:     r.Host,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// parseUserFilter reads the optional created_after (inclusive) and created_before
+// (exclusive) RFC3339 bounds from the form body or query, rejecting malformed
+// timestamps and inverted windows
+func parseUserFilter(r *http.Request) (db.UserFilter, error) {
+	var filter db.UserFilter
+	
+	bounds := []struct {
+		param string
+		dest  *time.Time
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+	}
+	for _, b := range bounds {
+		value := listingValue(r, b.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return db.UserFilter{}, fmt.Errorf("%s must be an RFC3339 timestamp", b.param)
+		}
+		*b.dest = t
+	}
+	
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() && filter.CreatedAfter.After(filter.CreatedBefore) {
+		return db.UserFilter{}, errors.New("created_after must not be later than created_before")
+	}
+	return filter, nil
+}
+
+// parseUserCSV reads name,email records from a CSV upload, skipping an optional header row
+func parseUserCSV(r io.Reader) ([]validation.UserInput, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	var inputs []validation.UserInput
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		if line == 1 && strings.EqualFold(record[0], "name") && strings.EqualFold(record[1], "email") {
+			continue
+		}
+
+		if len(inputs) == maxImportRows {
+			return nil, fmt.Errorf("CSV contains more than %d users", maxImportRows)
+		}
+
+		inputs = append(inputs, validation.UserInput{
+			Name:  validation.NormalizeName(record[0]),
+			Email: validation.SanitizeInput(record[1]),
+		})
+	}
+
+	return inputs, nil
+}
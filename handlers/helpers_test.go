@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"htmx-learn/config"
+	"htmx-learn/db"
+	"htmx-learn/middleware"
+)
+
+func TestParseUserCSV(t *testing.T) {
+	t.Run("header row is skipped", func(t *testing.T) {
+		csv := "name,email\nJohn Doe,john@example.com\n  Jane Smith , jane@example.com\n"
+
+		inputs, err := parseUserCSV(strings.NewReader(csv))
+		if err != nil {
+			t.Fatalf("parseUserCSV() unexpected error: %v", err)
+		}
+		if len(inputs) != 2 {
+			t.Fatalf("got %d inputs, expected 2", len(inputs))
+		}
+		if inputs[1].Name != "Jane Smith" || inputs[1].Email != "jane@example.com" {
+			t.Errorf("inputs[1] = %+v, expected sanitized values", inputs[1])
+		}
+	})
+
+	t.Run("without header", func(t *testing.T) {
+		inputs, err := parseUserCSV(strings.NewReader("John Doe,john@example.com\n"))
+		if err != nil {
+			t.Fatalf("parseUserCSV() unexpected error: %v", err)
+		}
+		if len(inputs) != 1 || inputs[0].Name != "John Doe" {
+			t.Errorf("inputs = %+v, expected one John Doe record", inputs)
+		}
+	})
+
+	t.Run("wrong number of columns", func(t *testing.T) {
+		if _, err := parseUserCSV(strings.NewReader("John Doe\n")); err == nil {
+			t.Error("parseUserCSV() expected error for a single-column record")
+		}
+	})
+
+	t.Run("too many rows", func(t *testing.T) {
+		csv := strings.Repeat("John Doe,john@example.com\n", maxImportRows+1)
+		if _, err := parseUserCSV(strings.NewReader(csv)); err == nil {
+			t.Error("parseUserCSV() expected error above maxImportRows")
+		}
+	})
+}
+
+// truncatedBody yields some data and then fails as if the client hung up
+type truncatedBody struct {
+	data string
+	read bool
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.read {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b.read = true
+	return copy(p, b.data), nil
+}
+
+func TestParseFormBodyErrors(t *testing.T) {
+	h := &Handlers{config: &config.Config{}}
+
+	t.Run("truncated body is a client abort", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/users", &truncatedBody{data: "user-name=Jo"})
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+
+		if h.parseForm(rec, req) {
+			t.Fatal("parseForm() = true, expected false for a truncated body")
+		}
+		if rec.Code == http.StatusBadRequest || rec.Body.Len() != 0 {
+			t.Errorf("got %d %q, expected no error response for a client abort", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("malformed body is a bad request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader("user-name=%zz"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+
+		if h.parseForm(rec, req) {
+			t.Fatal("parseForm() = true, expected false for a malformed body")
+		}
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, expected 400", rec.Code)
+		}
+	})
+
+	t.Run("valid body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader("user-name=Jo"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if !h.parseForm(httptest.NewRecorder(), req) {
+			t.Fatal("parseForm() = false, expected true")
+		}
+		if req.FormValue("user-name") != "Jo" {
+			t.Errorf("user-name = %q, expected %q", req.FormValue("user-name"), "Jo")
+		}
+	})
+}
+
+func TestParseFormLimits(t *testing.T) {
+	h := &Handlers{config: &config.Config{FormMaxBytes: 64, FormMaxFields: 3}}
+
+	tests := []struct {
+		name           string
+		query          string
+		body           string
+		expectedOK     bool
+		expectedStatus int
+	}{
+		{"under the limits", "", "a=1&b=2", true, http.StatusOK},
+		{"at the field limit", "", "a=1&b=2&c=3", true, http.StatusOK},
+		{"too many fields", "", "a=1&b=2&c=3&d=4", false, http.StatusBadRequest},
+		{"repeated names count", "", "a=1&a=2&a=3&a=4", false, http.StatusBadRequest},
+		{"query parameters count", "?page=2&size=10", "a=1&b=2", false, http.StatusBadRequest},
+		{"body too large", "", "a=" + strings.Repeat("x", 100), false, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/users"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			if ok := h.parseForm(rec, req); ok != tt.expectedOK {
+				t.Fatalf("parseForm() = %v, expected %v", ok, tt.expectedOK)
+			}
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("status = %d, expected %d (body %q)", rec.Code, tt.expectedStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestParseUserFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		expectError bool
+	}{
+		{"no bounds", "", false},
+		{"after only", "created_after=2025-01-01T00:00:00Z", false},
+		{"equal bounds", "created_after=2025-01-01T00:00:00Z&created_before=2025-01-01T00:00:00Z", false},
+		{"offset timestamps", "created_after=2025-01-01T02:00:00%2B02:00&created_before=2025-01-01T00:00:00Z", false},
+		{"after later than before", "created_after=2025-02-01T00:00:00Z&created_before=2025-01-01T00:00:00Z", true},
+		{"date without time", "created_after=2025-01-01", true},
+		{"garbage", "created_before=yesterday", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/users/paginated?"+tt.query, nil)
+			_, err := parseUserFilter(req)
+			if (err != nil) != tt.expectError {
+				t.Errorf("parseUserFilter() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestParsePaginationParamsDefaultPageSize(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		defaultPageSize int
+		expectedSize    int
+	}{
+		{"route default used when omitted", "page=2", 25, 25},
+		{"route default used when malformed", "page_size=lots", 25, 25},
+		{"client size wins over route default", "page_size=7", 25, 7},
+		{"route default below minimum clamped", "", 2, db.MinPageSize},
+		{"route default above maximum clamped", "", 500, db.MaxPageSize},
+		{"zero route default falls back to package default", "", 0, db.DefaultPageSize},
+		{"client size still clamped", "page_size=1000", 25, db.MaxPageSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/users/paginated?"+tt.query, nil)
+			params, err := parsePaginationParams(req, tt.defaultPageSize, 0)
+			if err != nil {
+				t.Fatalf("parsePaginationParams() unexpected error: %v", err)
+			}
+			if params.PageSize != tt.expectedSize {
+				t.Errorf("PageSize = %d, expected %d", params.PageSize, tt.expectedSize)
+			}
+		})
+	}
+}
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"text/html", false},
+		{"application/json", true},
+		{"text/html, Application/JSON;q=0.9", true},
+		{"application/jsonp", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if got := wantsJSON(req); got != tt.expected {
+				t.Errorf("wantsJSON(%q) = %v, expected %v", tt.accept, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPaginationLinks(t *testing.T) {
+	h := newTestHandlers(t, 0)
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/api/users/paginated?page=2&page_size=5&sort=name", nil)
+
+	links := h.paginationLinks(req, 2, 3, true, true)
+
+	expected := PaginationLinks{
+		First: "http://example.com/api/users/paginated?page=1&page_size=5&sort=name",
+		Last:  "http://example.com/api/users/paginated?page=3&page_size=5&sort=name",
+		Prev:  "http://example.com/api/users/paginated?page=1&page_size=5&sort=name",
+		Next:  "http://example.com/api/users/paginated?page=3&page_size=5&sort=name",
+	}
+	if links != expected {
+		t.Errorf("paginationLinks() = %+v, expected %+v", links, expected)
+	}
+
+	edge := h.paginationLinks(req, 1, 1, false, false)
+	if edge.Prev != "" || edge.Next != "" {
+		t.Errorf("expected no prev/next on a single page, got %+v", edge)
+	}
+
+	empty := h.paginationLinks(req, 1, 0, false, false)
+	if empty.Last != empty.First {
+		t.Errorf("last link for an empty collection = %q, expected the first page %q", empty.Last, empty.First)
+	}
+}
+
+func TestAbsoluteURLScheme(t *testing.T) {
+	h := newTestHandlers(t, 0)
+	h.clientIPs = middleware.NewClientIPResolver([]string{"10.0.0.1"})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		expected   string
+	}{
+		{"direct", "192.0.2.1:1234", "", "http://example.com/api/users?page=1"},
+		{"tls-terminating proxy", "10.0.0.1:1234", "https", "https://example.com/api/users?page=1"},
+		{"untrusted proxy header", "192.0.2.1:1234", "https", "http://example.com/api/users?page=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/api/users", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+
+			if got := h.absoluteURL(req, "/api/users", url.Values{"page": {"1"}}); got != tt.expected {
+				t.Errorf("absoluteURL() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSetHXTrigger(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	setHXTrigger(rec, "userCreated", map[string]int{"id": 7})
+	setHXTrigger(rec, "showToast", "Saved")
+
+	var events map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(rec.Header().Get("HX-Trigger")), &events); err != nil {
+		t.Fatalf("HX-Trigger is not a JSON object: %v", err)
+	}
+	if got := string(events["userCreated"]); got != `{"id":7}` {
+		t.Errorf("userCreated detail = %s, expected {\"id\":7}", got)
+	}
+	if got := string(events["showToast"]); got != `"Saved"` {
+		t.Errorf("showToast detail = %s, expected \"Saved\"", got)
+	}
+}
+
+func TestIsHTMX(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected bool
+	}{
+		{"plain request", nil, false},
+		{"htmx request", map[string]string{"HX-Request": "true"}, true},
+		{"boosted request", map[string]string{"HX-Boosted": "true"}, true},
+		{"header not true", map[string]string{"HX-Request": "false"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if got := isHTMX(req); got != tt.expected {
+				t.Errorf("isHTMX() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHXNavigationHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		navigate func(w http.ResponseWriter)
+		header   string
+		expected string
+	}{
+		{"redirect", func(w http.ResponseWriter) { hxRedirect(w, "/dynamic") }, "HX-Redirect", "/dynamic"},
+		{"location by path", func(w http.ResponseWriter) { hxLocation(w, hxLocationOptions{Path: "/counter"}) }, "HX-Location", "/counter"},
+		{
+			name: "location with target",
+			navigate: func(w http.ResponseWriter) {
+				hxLocation(w, hxLocationOptions{Path: "/api/users/paginated", Target: "#users-list", Values: map[string]string{"page": "2"}})
+			},
+			header:   "HX-Location",
+			expected: `{"path":"/api/users/paginated","target":"#users-list","values":{"page":"2"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.navigate(rec)
+
+			if got := rec.Header().Get(tt.header); got != tt.expected {
+				t.Errorf("%s = %q, expected %q", tt.header, got, tt.expected)
+			}
+			if rec.Code != http.StatusOK || rec.Header().Get("Location") != "" {
+				t.Errorf("status %d with Location %q, expected no HTTP redirect", rec.Code, rec.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestCurrentPage(t *testing.T) {
+	tests := []struct {
+		currentURL string
+		expected   string
+	}{
+		{"http://example.com/dynamic?page=2", "/dynamic?page=2"},
+		{"http://example.com/counter", "/counter"},
+		{"", "/"},
+		{"https://evil.example//evil.example/path", "/"},
+		{"javascript:alert(1)", "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currentURL, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/counter/increment", nil)
+			req.Header.Set("HX-Current-URL", tt.currentURL)
+			if got := currentPage(req); got != tt.expected {
+				t.Errorf("currentPage() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
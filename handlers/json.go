@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"htmx-learn/templates/components"
+	"htmx-learn/validation"
+)
+
+// maxJSONBodySize bounds JSON request bodies; a user is a name and an email
+const maxJSONBodySize = 64 << 10
+
+// createUserRequest is the body of a JSON create-user request
+type createUserRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// hasJSONBody reports whether r declares its body as JSON
+func hasJSONBody(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// createUserJSON is CreateUser for clients posting {"name":"...","email":"..."}. It
+// runs the same sanitizing and validation as the form and always answers in JSON,
+// with the created user and 201 on success.
+func (h *Handlers) createUserJSON(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		if isClientAbort(r, err) {
+			slog.InfoContext(r.Context(), "Client aborted request body", "method", r.Method, "path", r.URL.Path, "error", err)
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	input := validation.UserInput{
+		Name:  validation.NormalizeName(req.Name),
+		Email: validation.SanitizeInput(req.Email),
+	}
+	if err := validation.ValidateUser(input); err != nil {
+		var errs validation.ValidationErrors
+		if errors.As(err, &errs) {
+			writeJSONFieldErrors(w, errs)
+			return
+		}
+		writeJSONErrors(w, http.StatusBadRequest, CodeInvalidRequest, validationMessages(err))
+		return
+	}
+
+	user, err := h.userStore.Add(r.Context(), input.Name, input.Email)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("creating user: %w", err))
+		return
+	}
+
+	h.publishUsers(r.Context(), components.UserAdded(convertToTemplateUser(user)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// decodeJSONBody decodes a single JSON object from r's body into dst, rejecting fields
+// dst doesn't have. Its errors are AppErrors phrased for the client: a 413 for a body
+// over maxJSONBodySize and otherwise a 400. A body cut short keeps io.ErrUnexpectedEOF
+// as its cause, so isClientAbort can tell it from malformed JSON like parseForm does.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			return &AppError{
+				Status:  http.StatusRequestEntityTooLarge,
+				Code:    CodeRequestTooLarge,
+				Message: fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit),
+				Err:     err,
+			}
+		case errors.Is(err, io.EOF):
+			return badRequest("request body must not be empty")
+		case errors.As(err, &syntaxErr):
+			return badRequest(fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset))
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return &AppError{
+				Status:  http.StatusBadRequest,
+				Code:    CodeInvalidRequest,
+				Message: "malformed JSON: unexpected end of body",
+				Err:     err,
+			}
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			return badRequest(fmt.Sprintf("field %q must be a %s", typeErr.Field, typeErr.Type))
+		case errors.As(err, &typeErr):
+			return badRequest("request body must be a JSON object")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return badRequest("unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field "))
+		default:
+			return &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "Invalid request body", Err: err}
+		}
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return badRequest("request body must contain a single JSON object")
+	}
+	return nil
+}
+
+// writeJSONErrors answers with status and the errorBody envelope holding code and
+// messages
+func writeJSONErrors(w http.ResponseWriter, status int, code string, messages []string) {
+	writeJSONErrorBody(w, status, errorBody{Code: code, Errors: messages})
+}
+
+// writeJSONErrorBody answers with status and body
+func writeJSONErrorBody(w http.ResponseWriter, status int, body errorBody) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeJSONFieldErrors answers 400 with {"code": "invalid_request", "errors": {"field":
+// "message"}}. It is the one error response whose errors aren't a list: they are keyed
+// by field so API clients can attach each message to its input.
+func writeJSONFieldErrors(w http.ResponseWriter, errs validation.ValidationErrors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{"code": CodeInvalidRequest, "errors": errs.ToMap()})
+}
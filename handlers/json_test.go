@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"htmx-learn/db"
+)
+
+func TestCreateUserJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentType  string
+		body         string
+		expectedCode int
+		expectInBody string
+	}{
+		{"created", "application/json", `{"name":"  Ada   Lovelace ","email":"ada@example.com"}`, http.StatusCreated, `"name":"Ada Lovelace"`},
+		{"charset parameter", "application/json; charset=utf-8", `{"name":"Grace Hopper","email":"grace@example.com"}`, http.StatusCreated, `"email":"grace@example.com"`},
+		{"malformed", "application/json", `{"name":"Ada",}`, http.StatusBadRequest, "malformed JSON at offset"},
+		{"unknown field", "application/json", `{"name":"Ada","email":"ada@example.com","admin":true}`, http.StatusBadRequest, `unknown field \"admin\"`},
+		{"wrong type", "application/json", `{"name":42,"email":"ada@example.com"}`, http.StatusBadRequest, `field \"name\" must be a string`},
+		{"not an object", "application/json", `["Ada"]`, http.StatusBadRequest, "must be a JSON object"},
+		{"empty body", "application/json", ``, http.StatusBadRequest, "must not be empty"},
+		{"trailing data", "application/json", `{"name":"Ada","email":"ada@example.com"}{}`, http.StatusBadRequest, "single JSON object"},
+		{"invalid fields", "application/json", `{"name":"","email":"not-an-email"}`, http.StatusBadRequest, `"email":`},
+		{"duplicate email", "application/json", `{"name":"Someone Else","email":"user0@example.com"}`, http.StatusConflict, "already exists"},
+		{"too large", "application/json", `{"name":"` + strings.Repeat("a", maxJSONBodySize) + `"}`, http.StatusRequestEntityTooLarge, `"code":"request_too_large"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, 1)
+			req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			h.CreateUser(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Errorf("status = %d, expected %d (body %q)", rec.Code, tt.expectedCode, rec.Body.String())
+			}
+			if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Content-Type = %q, expected application/json", contentType)
+			}
+			if !strings.Contains(rec.Body.String(), tt.expectInBody) {
+				t.Errorf("body %q does not contain %q", rec.Body.String(), tt.expectInBody)
+			}
+		})
+	}
+}
+
+func TestCreateUserJSONTruncatedBodyIsClientAbort(t *testing.T) {
+	h := newTestHandlers(t, 0)
+	req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"name":"Ada"`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.CreateUser(rec, req)
+
+	// Like a form cut short, nobody is left to read an error
+	if rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "" {
+		t.Errorf("got %d %q with body %q, expected no response", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	if count, _ := h.userStore.Count(req.Context()); count != 0 {
+		t.Errorf("store has %d users, expected none", count)
+	}
+}
+
+func TestCreateUserJSONReturnsStoredUser(t *testing.T) {
+	h := newTestHandlers(t, 0)
+	req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{"name":"Ada Lovelace","email":"ada@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.CreateUser(rec, req)
+
+	var user db.User
+	if err := json.NewDecoder(rec.Body).Decode(&user); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if user.ID == 0 || user.Name != "Ada Lovelace" || user.Email != "ada@example.com" {
+		t.Errorf("response user = %+v, expected the stored user", user)
+	}
+	if count, _ := h.userStore.Count(req.Context()); count != 1 {
+		t.Errorf("store has %d users, expected 1", count)
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"htmx-learn/config"
+)
+
+// RenderOptions controls how renderTemplate post-processes templ output
+type RenderOptions struct {
+	// Minify strips comments and formatting whitespace from rendered HTML
+	Minify bool
+}
+
+// RenderOptionsFor returns the render options cfg asks for. MINIFY_HTML defaults to
+// minifying in production and leaving output readable elsewhere.
+func RenderOptionsFor(cfg *config.Config) RenderOptions {
+	return RenderOptions{Minify: cfg.MinifyHTML}
+}
+
+// rawTextElements keep their content byte for byte, since whitespace inside them is
+// significant or they aren't HTML at all
+var rawTextElements = []string{"pre", "textarea", "script", "style"}
+
+// blockElements are laid out on their own, so whitespace next to their tags never
+// renders and can be dropped. Around anything else, such as inline elements, a run of
+// whitespace renders as one space and is only collapsed.
+var blockElements = []string{
+	"html", "head", "body", "meta", "link", "title", "script", "style", "noscript",
+	"main", "header", "footer", "nav", "section", "article", "aside", "div", "p",
+	"ul", "ol", "li", "table", "thead", "tbody", "tr", "td", "th", "form", "fieldset",
+	"h1", "h2", "h3", "h4", "h5", "h6", "hr", "br", "template",
+}
+
+// minifyHTML removes comments and whitespace that doesn't change how src renders.
+// Attribute values, including HTMX attributes, and the content of raw text elements
+// such as <pre> are copied unchanged.
+func minifyHTML(src []byte) []byte {
+	out := make([]byte, 0, len(src))
+	previousTag := ""
+	for i := 0; i < len(src); {
+		switch {
+		case bytes.HasPrefix(src[i:], []byte("<!--")):
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if end < 0 {
+				return append(out, src[i:]...)
+			}
+			i += 4 + end + 3
+
+		case src[i] == '<':
+			end := tagEnd(src, i)
+			if end < 0 {
+				return append(out, src[i:]...)
+			}
+			name := tagName(src[i:end])
+			out = append(out, src[i:end]...)
+			i = end
+			previousTag = name
+
+			// Copy a raw text element's content verbatim up to its closing tag
+			if !strings.HasPrefix(name, "/") && slices.Contains(rawTextElements, name) {
+				closing := indexClosingTag(src[i:], name)
+				if closing < 0 {
+					return append(out, src[i:]...)
+				}
+				out = append(out, src[i:i+closing]...)
+				i += closing
+			}
+
+		default:
+			next := bytes.IndexByte(src[i:], '<')
+			if next < 0 {
+				next = len(src) - i
+			}
+			text := src[i : i+next]
+			i += next
+
+			if len(bytes.TrimSpace(text)) > 0 {
+				out = append(out, text...)
+				continue
+			}
+			nextTag := ""
+			if i < len(src) {
+				if end := tagEnd(src, i); end > 0 {
+					nextTag = tagName(src[i:end])
+				}
+			}
+			if !isBlockTag(previousTag) && !isBlockTag(nextTag) {
+				out = append(out, ' ')
+			}
+		}
+	}
+	return out
+}
+
+// tagEnd returns the index just past the tag starting at src[start], skipping any '>'
+// inside quoted attribute values, or -1 if the tag isn't terminated
+func tagEnd(src []byte, start int) int {
+	var quote byte
+	for i := start + 1; i < len(src); i++ {
+		switch c := src[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// tagName returns the lowercase name of tag, prefixed with "/" for a closing tag. The
+// names of doctypes and other declarations start with "!".
+func tagName(tag []byte) string {
+	name := tag[1:]
+	end := bytes.IndexAny(name, " \t\r\n/>")
+	if end == 0 && len(name) > 0 && name[0] == '/' {
+		end = bytes.IndexAny(name[1:], " \t\r\n>")
+		if end >= 0 {
+			end++
+		}
+	}
+	if end >= 0 {
+		name = name[:end]
+	}
+	return strings.ToLower(string(name))
+}
+
+// indexClosingTag returns the index in src of the closing tag for name, matched
+// case-insensitively, or -1 if there is none
+func indexClosingTag(src []byte, name string) int {
+	for offset := 0; ; {
+		i := bytes.Index(src[offset:], []byte("</"))
+		if i < 0 {
+			return -1
+		}
+		start := offset + i
+		rest := src[start+2:]
+		if len(rest) >= len(name) && strings.EqualFold(string(rest[:len(name)]), name) {
+			return start
+		}
+		offset = start + 2
+	}
+}
+
+// isBlockTag reports whether name, opening or closing, is a block-level element or
+// a declaration such as the doctype
+func isBlockTag(name string) bool {
+	name = strings.TrimPrefix(name, "/")
+	return strings.HasPrefix(name, "!") || slices.Contains(blockElements, name)
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/a-h/templ"
+
+	"htmx-learn/config"
+	"htmx-learn/db"
+	"htmx-learn/templates/components"
+	"htmx-learn/templates/pages"
+)
+
+func TestMinifyHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "comments removed",
+			input:    "<div><!-- note --><p>Hi</p></div>",
+			expected: "<div><p>Hi</p></div>",
+		},
+		{
+			name:     "formatting between block tags dropped",
+			input:    "<ul>\n  <li>One</li>\n  <li>Two</li>\n</ul>",
+			expected: "<ul><li>One</li><li>Two</li></ul>",
+		},
+		{
+			name:     "whitespace between inline tags collapsed to one space",
+			input:    "<b>bold</b>\n   <i>italic</i>",
+			expected: "<b>bold</b> <i>italic</i>",
+		},
+		{
+			name:     "text whitespace untouched",
+			input:    "<p>Hello,   world</p>",
+			expected: "<p>Hello,   world</p>",
+		},
+		{
+			name:     "pre content preserved",
+			input:    "<div>\n<pre>  line 1\n\n  <b>line 2</b>\n</pre>\n</div>",
+			expected: "<div><pre>  line 1\n\n  <b>line 2</b>\n</pre></div>",
+		},
+		{
+			name:     "script content preserved",
+			input:    "<script>\n  if (a < b) { go() } // <!-- not a comment -->\n</script>",
+			expected: "<script>\n  if (a < b) { go() } // <!-- not a comment -->\n</script>",
+		},
+		{
+			name:     "htmx attributes untouched",
+			input:    `<button hx-post="/api/counter"  hx-on::after-request="if (n > 1) reset()"   hx-target="#count">+</button>`,
+			expected: `<button hx-post="/api/counter"  hx-on::after-request="if (n > 1) reset()"   hx-target="#count">+</button>`,
+		},
+		{
+			name:     "doctype",
+			input:    "<!doctype html>\n<html>\n<head></head></html>",
+			expected: "<!doctype html><html><head></head></html>",
+		},
+		{
+			name:     "unterminated comment kept",
+			input:    "<p>a</p><!-- oops",
+			expected: "<p>a</p><!-- oops",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := string(minifyHTML([]byte(tt.input))); result != tt.expected {
+				t.Errorf("minifyHTML() = %q, expected %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateMinifies(t *testing.T) {
+	render := func(minify bool, htmx bool) string {
+		h := newTestHandlers(t, 20)
+		h.render = RenderOptions{Minify: minify}
+		req := httptest.NewRequest(http.MethodGet, "/api/users/paginated?page_size=20", nil)
+		if htmx {
+			req.Header.Set("HX-Request", "true")
+		}
+		rec := httptest.NewRecorder()
+		h.GetUsersPaginated(rec, req)
+		return rec.Body.String()
+	}
+
+	for _, tt := range []struct {
+		name string
+		htmx bool
+	}{
+		{"user list fragment", true},
+		{"full page", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, minified := render(false, tt.htmx), render(true, tt.htmx)
+			if len(minified) >= len(raw) {
+				t.Errorf("minified output is %d bytes, expected fewer than the raw %d", len(minified), len(raw))
+			}
+			t.Logf("%d bytes raw, %d minified, %d saved", len(raw), len(minified), len(raw)-len(minified))
+		})
+	}
+}
+
+func TestRenderTemplateLogsBytesSaved(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	render := func(minify bool) string {
+		h := newTestHandlers(t, 20)
+		h.render = RenderOptions{Minify: minify}
+		req := httptest.NewRequest(http.MethodGet, "/api/users/paginated?page_size=20", nil)
+		req.Header.Set("HX-Request", "true")
+		rec := httptest.NewRecorder()
+		h.GetUsersPaginated(rec, req)
+		return rec.Body.String()
+	}
+	raw := render(false)
+	logs.Reset()
+	minified := render(true)
+
+	if !strings.Contains(minified, `hx-confirm="Are you sure you want to delete this user?"`) {
+		t.Errorf("minified cards lost their HTMX attributes: %s", minified)
+	}
+
+	var bytesTotal, saved int
+	dec := json.NewDecoder(&logs)
+	for {
+		var entry struct {
+			Msg   string `json:"msg"`
+			Path  string `json:"path"`
+			Bytes int    `json:"bytes"`
+			Saved int    `json:"saved"`
+		}
+		if err := dec.Decode(&entry); err != nil {
+			break
+		}
+		if entry.Msg == "Minified HTML" && entry.Path == "/api/users/paginated" {
+			bytesTotal += entry.Bytes
+			saved += entry.Saved
+		}
+	}
+	if bytesTotal != len(raw) || saved != len(raw)-len(minified) {
+		t.Errorf("logged %d bytes with %d saved, expected %d with %d saved", bytesTotal, saved, len(raw), len(raw)-len(minified))
+	}
+}
+
+func TestRenderOptionsFor(t *testing.T) {
+	for _, minify := range []bool{true, false} {
+		if opts := RenderOptionsFor(&config.Config{MinifyHTML: minify}); opts.Minify != minify {
+			t.Errorf("RenderOptionsFor(MinifyHTML: %v).Minify = %v, expected %v", minify, opts.Minify, minify)
+		}
+	}
+}
+
+// htmxResponseRule is one entry of the layout's htmx responseHandling config
+type htmxResponseRule struct {
+	Code  string `json:"code"`
+	Swap  bool   `json:"swap"`
+	Error *bool  `json:"error"`
+}
+
+// htmxResponseHandling renders page and returns the responseHandling rules from its
+// htmx-config meta tag
+func htmxResponseHandling(t *testing.T, page templ.Component) []htmxResponseRule {
+	t.Helper()
+
+	h := newTestHandlers(t, 0)
+	rec := httptest.NewRecorder()
+	h.renderTemplate(rec, httptest.NewRequest(http.MethodGet, "/dynamic", nil), page)
+
+	match := regexp.MustCompile(`<meta name="htmx-config" content='([^']*)'`).FindStringSubmatch(rec.Body.String())
+	if match == nil {
+		t.Fatal("rendered page has no htmx-config meta tag")
+	}
+	var config struct {
+		ResponseHandling []htmxResponseRule `json:"responseHandling"`
+	}
+	if err := json.Unmarshal([]byte(html.UnescapeString(match[1])), &config); err != nil {
+		t.Fatalf("decoding htmx-config: %v", err)
+	}
+	return config.ResponseHandling
+}
+
+// htmxRuleFor returns the rule htmx applies to status: the first whose code pattern
+// matches the status digits
+func htmxRuleFor(t *testing.T, rules []htmxResponseRule, status int) htmxResponseRule {
+	t.Helper()
+
+	for _, rule := range rules {
+		if regexp.MustCompile(rule.Code).MatchString(strconv.Itoa(status)) {
+			return rule
+		}
+	}
+	t.Fatalf("no responseHandling rule matches %d", status)
+	return htmxResponseRule{}
+}
+
+func TestLayoutResponseHandling(t *testing.T) {
+	rules := htmxResponseHandling(t, pages.DynamicPage())
+
+	tests := []struct {
+		status      int
+		expectSwap  bool
+		expectError bool
+	}{
+		{http.StatusOK, true, false},
+		{http.StatusNoContent, false, false},
+		{http.StatusBadRequest, false, true},
+		{http.StatusConflict, false, true},
+		{http.StatusNotFound, false, true},
+		{http.StatusInternalServerError, false, true},
+	}
+
+	for _, tt := range tests {
+		rule := htmxRuleFor(t, rules, tt.status)
+		if rule.Swap != tt.expectSwap || (rule.Error != nil && *rule.Error) != tt.expectError {
+			t.Errorf("%d: rule %+v, expected swap %v and error %v", tt.status, rule, tt.expectSwap, tt.expectError)
+		}
+	}
+}
+
+func TestLayoutSwapsRetargetedErrors(t *testing.T) {
+	h := newTestHandlers(t, 0)
+	rec := httptest.NewRecorder()
+	h.renderTemplate(rec, httptest.NewRequest(http.MethodGet, "/dynamic", nil), pages.DynamicPage())
+
+	body := rec.Body.String()
+	for _, want := range []string{`id="errors"`, "htmx:beforeSwap", `getResponseHeader("HX-Retarget")`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("layout does not contain %q", want)
+		}
+	}
+}
+
+func TestAddUserKeepsInputsOnFormErrors(t *testing.T) {
+	// Retargeted form errors count as successful once swapped, so the inputs may only be
+	// cleared on a 2xx
+	var buf bytes.Buffer
+	if err := components.DynamicContent().Render(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if body := buf.String(); strings.Contains(body, "event.detail.successful") || !strings.Contains(body, "event.detail.xhr.status < 300") {
+		t.Errorf("add user after-request handler does not check for a 2xx status: %s", body)
+	}
+}
+
+func TestReadOnlyFormErrorsSwap(t *testing.T) {
+	h := newTestHandlers(t, 0)
+	h.userStore = db.NewReadOnlyUserRepository(h.userStore)
+
+	createForm := url.Values{"user-name": {"New User"}, "user-email": {"new@example.com"}}.Encode()
+	var upload bytes.Buffer
+	writer := multipart.NewWriter(&upload)
+	part, err := writer.CreateFormFile("users-csv", "users.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("name,email\nNew User,new@example.com\n"))
+	writer.Close()
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		serve       http.HandlerFunc
+		target      string
+	}{
+		{"create", createForm, "application/x-www-form-urlencoded", h.CreateUser, "#form-errors"},
+		{"import", upload.String(), writer.FormDataContentType(), h.ImportUsers, "#import-result"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("HX-Request", "true")
+			rec := httptest.NewRecorder()
+
+			tt.serve(rec, req)
+
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, expected 503 like any other refused write", rec.Code)
+			}
+			// The layout swaps error responses in only when they carry HX-Retarget
+			if got := rec.Header().Get("HX-Retarget"); got != tt.target {
+				t.Errorf("HX-Retarget = %q, expected %q", got, tt.target)
+			}
+			if !strings.Contains(html.UnescapeString(rec.Body.String()), db.ErrReadOnly.Error()) {
+				t.Errorf("body %q does not explain the site is read-only", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"htmx-learn/db"
+	"htmx-learn/middleware"
+)
+
+// searchCacheKey identifies one client's search. Queries are normalized first, so
+// "Ann" and "ann", which match the same users, share an entry.
+type searchCacheKey struct {
+	session string
+	query   string
+}
+
+// searchCacheEntry is a cached result, stored as the value of a searchCache element
+type searchCacheEntry struct {
+	key     searchCacheKey
+	users   []*db.User
+	expires time.Time
+}
+
+// searchCache remembers recent search results per client, so typeahead firing the
+// same query on every keystroke (or after a backspace) doesn't reach the database
+// each time. It holds at most size entries across all clients, evicting the least
+// recently used. A nil *searchCache caches nothing.
+type searchCache struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu         sync.Mutex
+	generation uint64
+	order      *list.List // most recently used at the front
+	entries    map[searchCacheKey]*list.Element
+}
+
+// newSearchCache returns a cache keeping up to size results for ttl, or nil when ttl
+// or size disables caching
+func newSearchCache(ttl time.Duration, size int) *searchCache {
+	if ttl <= 0 || size < 1 {
+		return nil
+	}
+	return &searchCache{
+		ttl:     ttl,
+		size:    size,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[searchCacheKey]*list.Element),
+	}
+}
+
+// newSearchCacheKey normalizes query into the key of session's search for it
+func newSearchCacheKey(session, query string) searchCacheKey {
+	// Search matches case-insensitively, so case doesn't change the result
+	return searchCacheKey{session: session, query: strings.ToLower(query)}
+}
+
+// get returns the unexpired result cached for key
+func (c *searchCache) get(key searchCacheKey) ([]*db.User, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*searchCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.users, true
+}
+
+// currentGeneration returns the generation to pass to put for a search about to run
+func (c *searchCache) currentGeneration() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put caches users for key, evicting the least recently used entry when full, unless
+// a purge since generation made the result stale already
+func (c *searchCache) put(key searchCacheKey, users []*db.User, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	expires := c.now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*searchCacheEntry)
+		entry.users, entry.expires = users, expires
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&searchCacheEntry{key: key, users: users, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*searchCacheEntry).key)
+	}
+}
+
+// purge drops every cached result, for when users change
+func (c *searchCache) purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.order.Init()
+	clear(c.entries)
+}
+
+// searchUsers runs the search for query, reusing the result the same client got
+// for it within the cache TTL. Typeahead repeats queries as the user types and
+// deletes, and those repeats needn't reach the database.
+func (h *Handlers) searchUsers(r *http.Request, query string) ([]*db.User, error) {
+	if h.searchCache == nil {
+		return h.userStore.Search(r.Context(), query)
+	}
+
+	key := newSearchCacheKey(h.searchSession(r), query)
+	if users, ok := h.searchCache.get(key); ok {
+		return users, nil
+	}
+	generation := h.searchCache.currentGeneration()
+	users, err := h.userStore.Search(r.Context(), query)
+	if err != nil {
+		return nil, err
+	}
+	h.searchCache.put(key, users, generation)
+	return users, nil
+}
+
+// searchSession identifies the client behind r for the search cache: the signed-in
+// user when there is one, and otherwise the client's address
+func (h *Handlers) searchSession(r *http.Request) string {
+	if id, ok := middleware.UserID(r.Context()); ok {
+		return "user:" + strconv.Itoa(id)
+	}
+	return "ip:" + h.clientIPs.ClientIP(r)
+}
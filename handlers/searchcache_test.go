@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"htmx-learn/db"
+	"htmx-learn/middleware"
+	"htmx-learn/templates/components"
+)
+
+// countingSearchRepository counts the searches that reach the underlying store
+type countingSearchRepository struct {
+	db.UserRepository
+	searches int
+}
+
+func (r *countingSearchRepository) Search(ctx context.Context, query string) ([]*db.User, error) {
+	r.searches++
+	return r.UserRepository.Search(ctx, query)
+}
+
+func TestSearchUsersCoalescesRepeatedQueries(t *testing.T) {
+	h := newTestHandlers(t, 5)
+	repo := &countingSearchRepository{UserRepository: h.userStore}
+	h.userStore = repo
+	h.searchCache = newSearchCache(time.Second, 10)
+	h.clientIPs = middleware.NewClientIPResolver(nil)
+	now := time.Now()
+	h.searchCache.now = func() time.Time { return now }
+
+	search := func(remoteAddr, query string) string {
+		req := httptest.NewRequest(http.MethodPost, "/api/search", strings.NewReader(url.Values{"search": {query}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("HX-Request", "true")
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		h.SearchUsers(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("search %q: status = %d, expected 200", query, rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	steps := []struct {
+		name       string
+		remoteAddr string
+		query      string
+		before     func()
+		searches   int
+	}{
+		{name: "first query searches", remoteAddr: "192.0.2.1:1234", query: "user 1", searches: 1},
+		{name: "repeat is cached", remoteAddr: "192.0.2.1:1234", query: "user 1", searches: 1},
+		{name: "case differences share the entry", remoteAddr: "192.0.2.1:5678", query: "USER 1", searches: 1},
+		{name: "another query searches", remoteAddr: "192.0.2.1:1234", query: "user 2", searches: 2},
+		{name: "another client searches", remoteAddr: "192.0.2.2:1234", query: "user 1", searches: 3},
+		{
+			name: "expired entry searches again", remoteAddr: "192.0.2.1:1234", query: "user 1", searches: 4,
+			before: func() { now = now.Add(time.Second) },
+		},
+		{
+			name: "user changes drop the cache", remoteAddr: "192.0.2.1:1234", query: "user 1", searches: 5,
+			before: func() { h.publishUsers(context.Background(), components.UserRemoved(0)) },
+		},
+	}
+
+	var cached string
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		body := search(step.remoteAddr, step.query)
+		if repo.searches != step.searches {
+			t.Errorf("%s: %d searches reached the store, expected %d", step.name, repo.searches, step.searches)
+		}
+		if step.name == "first query searches" {
+			cached = body
+		}
+		if step.name == "repeat is cached" && body != cached {
+			t.Errorf("%s: body = %q, expected the first response %q", step.name, body, cached)
+		}
+	}
+}
+
+func TestSearchCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newSearchCache(time.Minute, 2)
+	a, b, d := newSearchCacheKey("ip:a", "a"), newSearchCacheKey("ip:a", "b"), newSearchCacheKey("ip:a", "d")
+
+	c.put(a, nil, 0)
+	c.put(b, nil, 0)
+	c.get(a) // a is now more recent than b
+	c.put(d, nil, 0)
+
+	if _, ok := c.get(b); ok {
+		t.Error("least recently used entry b survived a full cache")
+	}
+	for _, key := range []searchCacheKey{a, d} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("entry %q was evicted, expected it kept", key.query)
+		}
+	}
+	if len(c.entries) != 2 || c.order.Len() != 2 {
+		t.Errorf("cache holds %d entries (%d in order), expected at most 2", len(c.entries), c.order.Len())
+	}
+}
+
+func TestNewSearchCacheDisabled(t *testing.T) {
+	if c := newSearchCache(0, 10); c != nil {
+		t.Error("newSearchCache(0, 10) returned a cache, expected nil for a zero TTL")
+	}
+	var c *searchCache
+	c.put(newSearchCacheKey("ip:a", "a"), nil, 0)
+	if _, ok := c.get(newSearchCacheKey("ip:a", "a")); ok {
+		t.Error("nil cache returned a hit")
+	}
+	c.purge()
+}
+
+// purgingSearchRepository purges the search cache while a search is running, as a
+// concurrent user change would
+type purgingSearchRepository struct {
+	db.UserRepository
+	cache *searchCache
+}
+
+func (r *purgingSearchRepository) Search(ctx context.Context, query string) ([]*db.User, error) {
+	users, err := r.UserRepository.Search(ctx, query)
+	r.cache.purge()
+	return users, err
+}
+
+func TestSearchUsersSkipsResultsPurgedMidSearch(t *testing.T) {
+	h := newTestHandlers(t, 5)
+	h.searchCache = newSearchCache(time.Second, 10)
+	h.userStore = &purgingSearchRepository{UserRepository: h.userStore, cache: h.searchCache}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/search", nil)
+	if _, err := h.searchUsers(req, "user 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.searchCache.get(newSearchCacheKey(h.searchSession(req), "user 1")); ok {
+		t.Error("result read before a purge was cached, expected it dropped as stale")
+	}
+}
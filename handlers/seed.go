@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"htmx-learn/validation"
+)
+
+const (
+	// defaultSeedCount is how many users a seed request creates without ?count
+	defaultSeedCount = 100
+	// maxSeedCount bounds a single seed request, like maxImportRows bounds an import
+	maxSeedCount = 10000
+)
+
+var (
+	seedFirstNames = []string{
+		"Olivia", "Liam", "Emma", "Noah", "Amelia", "Oliver", "Sophia", "Elijah", "Mia", "Lucas",
+		"Isabella", "Mateo", "Aiko", "Kenji", "Priya", "Arjun", "Fatima", "Omar", "Zoe", "Hugo",
+	}
+	seedLastNames = []string{
+		"Smith", "Johnson", "Garcia", "Martinez", "Brown", "Nguyen", "Kim", "Patel", "Schmidt", "Rossi",
+		"Dubois", "Tanaka", "Kowalski", "Silva", "Hansen", "Okafor", "Cohen", "Haddad", "Novak", "Larsen",
+	}
+)
+
+// AdminSeed fills the users table with ?count generated demo users (default 100, at
+// most 10000) for demos and load tests, and reports how many were created
+func (h *Handlers) AdminSeed(w http.ResponseWriter, r *http.Request) {
+	count := defaultSeedCount
+	if countStr := r.URL.Query().Get("count"); countStr != "" {
+		n, err := strconv.Atoi(countStr)
+		if err != nil || n < 1 || n > maxSeedCount {
+			writeError(w, r, badRequest(fmt.Sprintf("count must be between 1 and %d", maxSeedCount)))
+			return
+		}
+		count = n
+	}
+
+	users, err := h.userStore.AddMany(r.Context(), seedUsers(count, time.Now()))
+	if err != nil {
+		writeError(w, r, fmt.Errorf("seeding users: %w", err))
+		return
+	}
+	h.searchCache.purge()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"created": len(users)})
+}
+
+// seedUsers generates count users with realistic names. Emails are tagged with the
+// seeding time and an index so repeated seeding never collides with earlier runs.
+func seedUsers(count int, now time.Time) []validation.UserInput {
+	run := strconv.FormatInt(now.UnixNano(), 36)
+	inputs := make([]validation.UserInput, count)
+	for i := range inputs {
+		first := seedFirstNames[rand.IntN(len(seedFirstNames))]
+		last := seedLastNames[rand.IntN(len(seedLastNames))]
+		local := strings.ToLower(first + "." + last)
+		inputs[i] = validation.UserInput{
+			Name:  first + " " + last,
+			Email: fmt.Sprintf("%s.%s-%d@example.com", local, run, i),
+		}
+	}
+	return inputs
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"htmx-learn/validation"
+)
+
+func TestSeedUsersAreValidAndUnique(t *testing.T) {
+	now := time.Now()
+	inputs := append(seedUsers(500, now), seedUsers(500, now.Add(time.Nanosecond))...)
+
+	emails := make(map[string]bool, len(inputs))
+	for _, input := range inputs {
+		if err := validation.ValidateUser(input); err != nil {
+			t.Errorf("seeded user %+v is invalid: %v", input, err)
+		}
+		if emails[input.Email] {
+			t.Errorf("email %q seeded twice", input.Email)
+		}
+		emails[input.Email] = true
+	}
+}
+
+func TestAdminSeed(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedUsers  int
+	}{
+		{"default count", "", http.StatusOK, defaultSeedCount},
+		{"explicit count", "?count=25", http.StatusOK, 25},
+		{"zero", "?count=0", http.StatusBadRequest, 0},
+		{"not a number", "?count=lots", http.StatusBadRequest, 0},
+		{"over the cap", "?count=10001", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandlers(t, 0)
+			rec := httptest.NewRecorder()
+			h.AdminSeed(rec, httptest.NewRequest(http.MethodPost, "/admin/seed"+tt.query, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, expected %d: %s", rec.Code, tt.expectedStatus, rec.Body)
+			}
+			if count, _ := h.userStore.Count(context.Background()); count != tt.expectedUsers {
+				t.Errorf("store has %d users, expected %d", count, tt.expectedUsers)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var body map[string]int
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body["created"] != tt.expectedUsers {
+				t.Errorf("created = %d, expected %d", body["created"], tt.expectedUsers)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/a-h/templ"
+
+	"htmx-learn/templates/components"
+)
+
+const (
+	// subscriberBuffer is how many events a slow client may fall behind before it's dropped
+	subscriberBuffer = 8
+	// keepaliveInterval keeps idle streams open through proxies
+	keepaliveInterval = 30 * time.Second
+)
+
+// event is a single named Server-Sent Event
+type event struct {
+	name string
+	data []byte
+}
+
+// hub fans events out to SSE subscribers. Publishing never blocks: a subscriber
+// whose buffer is full is dropped so one stalled client can't hold up a mutation.
+type hub struct {
+	mu          sync.Mutex
+	subscribers map[chan event]struct{}
+}
+
+func newHub() *hub {
+	return &hub{subscribers: make(map[chan event]struct{})}
+}
+
+// subscribe registers a new subscriber channel
+func (hb *hub) subscribe() chan event {
+	ch := make(chan event, subscriberBuffer)
+
+	hb.mu.Lock()
+	hb.subscribers[ch] = struct{}{}
+	hb.mu.Unlock()
+
+	return ch
+}
+
+// unsubscribe removes ch and closes it; calling it for a dropped subscriber is a no-op
+func (hb *hub) unsubscribe(ch chan event) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	if _, ok := hb.subscribers[ch]; ok {
+		delete(hb.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish delivers e to every subscriber without blocking
+func (hb *hub) publish(e event) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+
+	for ch := range hb.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(hb.subscribers, ch)
+			close(ch)
+			slog.Warn("Dropping slow SSE subscriber", "event", e.name)
+		}
+	}
+}
+
+// len returns the number of active subscribers
+func (hb *hub) len() int {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	return len(hb.subscribers)
+}
+
+// serveEvents streams events from hb to the client until it disconnects, is dropped, or
+// stop is closed. initial events are sent immediately so a new client doesn't wait for
+// the next change.
+func serveEvents(w http.ResponseWriter, r *http.Request, hb *hub, stop <-chan struct{}, initial ...event) {
+	rc := http.NewResponseController(w)
+
+	// Streams outlive the server's WriteTimeout, so lift the deadline for this response
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.Error("Error clearing SSE write deadline", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	ch := hb.subscribe()
+	defer hb.unsubscribe(ch)
+
+	for _, e := range initial {
+		writeEvent(w, e)
+	}
+	if err := rc.Flush(); err != nil {
+		slog.Error("SSE streaming unsupported", "error", err)
+		return
+	}
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.DebugContext(r.Context(), "SSE client disconnected", "path", r.URL.Path)
+			return
+		case <-stop:
+			// EventSource reconnects on its own once the stream ends
+			slog.DebugContext(r.Context(), "Closing SSE stream for shutdown", "path", r.URL.Path)
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			slog.DebugContext(r.Context(), "SSE stream write failed", "path", r.URL.Path, "error", err)
+			return
+		}
+	}
+}
+
+// writeEvent encodes e in the text/event-stream format; multi-line data is split
+// across data fields as the spec requires
+func writeEvent(w http.ResponseWriter, e event) {
+	fmt.Fprintf(w, "event: %s\n", e.name)
+	for line := range bytes.Lines(e.data) {
+		fmt.Fprintf(w, "data: %s\n", bytes.TrimRight(line, "\r\n"))
+	}
+	if len(e.data) == 0 {
+		fmt.Fprint(w, "data: \n")
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// renderEvent renders component as the data of a named event
+func renderEvent(ctx context.Context, name string, component templ.Component) (event, error) {
+	var buf bytes.Buffer
+	if err := component.Render(ctx, &buf); err != nil {
+		return event{}, err
+	}
+	return event{name: name, data: buf.Bytes()}, nil
+}
+
+// countEvent renders the counter display as a "count" event
+func countEvent(ctx context.Context, count int) (event, error) {
+	return renderEvent(ctx, "count", components.CountDisplay(count))
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHubDropsSlowSubscriber(t *testing.T) {
+	hb := newHub()
+	slow := hb.subscribe()
+	fast := hb.subscribe()
+
+	for range subscriberBuffer + 1 {
+		hb.publish(event{name: "count", data: []byte("1")})
+		// Drain the fast subscriber so only the slow one falls behind
+		<-fast
+	}
+
+	if _, ok := <-drain(slow); ok {
+		t.Fatal("slow subscriber still open, expected it to be dropped")
+	}
+	if got := hb.len(); got != 1 {
+		t.Errorf("hub has %d subscribers, expected 1", got)
+	}
+
+	hb.unsubscribe(fast)
+	hb.unsubscribe(slow) // already dropped; must not panic
+	if got := hb.len(); got != 0 {
+		t.Errorf("hub has %d subscribers after unsubscribe, expected 0", got)
+	}
+}
+
+// drain discards buffered events and returns ch positioned at its close, if any
+func drain(ch chan event) chan event {
+	for range subscriberBuffer {
+		<-ch
+	}
+	return ch
+}
+
+func TestWriteEvent(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeEvent(rec, event{name: "count", data: []byte("<b>1</b>\n<i>2</i>")})
+
+	expected := "event: count\ndata: <b>1</b>\ndata: <i>2</i>\n\n"
+	if rec.Body.String() != expected {
+		t.Errorf("writeEvent() = %q, expected %q", rec.Body.String(), expected)
+	}
+}
+
+func TestCounterEventsStreamsUpdates(t *testing.T) {
+	h := newTestHandlers(t, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/counter/events", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		h.CounterEvents(rec, req)
+		close(done)
+	}()
+
+	waitFor(t, func() bool { return h.counterHub.len() == 1 })
+	h.CounterIncrement(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/counter/increment", nil))
+
+	// Disconnecting must end the stream and release the subscription
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream did not stop after client disconnect")
+	}
+
+	if got := h.counterHub.len(); got != 0 {
+		t.Errorf("hub has %d subscribers after disconnect, expected 0", got)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, expected text/event-stream", ct)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "event: count\ndata: 0\n\n") {
+		t.Errorf("missing initial count event in %q", body)
+	}
+	if !strings.Contains(body, "event: count\ndata: 1\n\n") {
+		t.Errorf("missing increment event in %q", body)
+	}
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 1s")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUserEventsStreamsAddsAndDeletes(t *testing.T) {
+	h := newTestHandlers(t, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/api/users/events", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		h.UserEvents(rec, req)
+		close(done)
+	}()
+	waitFor(t, func() bool { return h.userHub.len() == 1 })
+
+	form := strings.NewReader("user-name=Ada+Lovelace&user-email=ada%40example.com")
+	create := httptest.NewRequest(http.MethodPost, "/api/users", form)
+	create.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	createRec := httptest.NewRecorder()
+	h.CreateUser(createRec, create)
+	if createRec.Code != http.StatusOK {
+		t.Fatalf("CreateUser status = %d: %s", createRec.Code, createRec.Body.String())
+	}
+
+	if trigger := createRec.Header().Get("HX-Trigger"); trigger != `{"userCreated":{"id":1}}` {
+		t.Errorf("CreateUser HX-Trigger = %q", trigger)
+	}
+
+	del := httptest.NewRequest(http.MethodDelete, "/api/users/1", nil)
+	del.SetPathValue("id", "1")
+	delRec := httptest.NewRecorder()
+	h.DeleteUser(delRec, del)
+	if trigger := delRec.Header().Get("HX-Trigger"); trigger != `{"userDeleted":{"id":1}}` {
+		t.Errorf("DeleteUser HX-Trigger = %q", trigger)
+	}
+
+	// A failed write must not publish anything
+	missing := httptest.NewRequest(http.MethodDelete, "/api/users/99", nil)
+	missing.SetPathValue("id", "99")
+	h.DeleteUser(httptest.NewRecorder(), missing)
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	body := rec.Body.String()
+	if got := strings.Count(body, "event: users\n"); got != 2 {
+		t.Errorf("got %d users events, expected 2: %q", got, body)
+	}
+	if !strings.Contains(body, `hx-swap-oob="beforeend:#users-list"`) || !strings.Contains(body, "Ada Lovelace") {
+		t.Errorf("missing add directive in %q", body)
+	}
+	if !strings.Contains(body, `hx-swap-oob="delete:[data-user-id=&#39;1&#39;]"`) {
+		t.Errorf("missing delete directive in %q", body)
+	}
+}
+
+func TestCounterEventsStopsOnShutdown(t *testing.T) {
+	h := newTestHandlers(t, 0)
+	srv := httptest.NewServer(http.HandlerFunc(h.CounterEvents))
+	defer srv.Close()
+	srv.Config.RegisterOnShutdown(h.Drain)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("opening stream: %v", err)
+	}
+	defer resp.Body.Close()
+	waitFor(t, func() bool { return h.counterHub.len() == 1 })
+
+	// Without Drain the open stream would keep Shutdown waiting for the full deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := srv.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = %v, expected the stream to end before the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown took %v waiting for the stream", elapsed)
+	}
+
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("stream ended with %v, expected a clean end of stream", err)
+	}
+	if got := h.counterHub.len(); got != 0 {
+		t.Errorf("hub has %d subscribers after shutdown, expected 0", got)
+	}
+	if !h.Draining() {
+		t.Error("Draining() = false after shutdown")
+	}
+}
@@ -0,0 +1,105 @@
+// Package logging correlates log records with the request they were emitted for.
+// Middleware records request-scoped attributes such as the request ID in the request's
+// context, and Handler adds them to every record logged with that context, so code
+// handling a request only has to call slog.InfoContext(r.Context(), ...).
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+type requestAttrsKey struct{}
+
+// requestAttrs holds a request's attributes. Middleware and the router fill them in
+// as the request passes through, so they are shared and guarded by a mutex.
+type requestAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// NewContext returns a copy of ctx that can carry request-scoped attributes. Call it
+// once, as early in the middleware chain as possible; ctx is returned as is if it
+// already can.
+func NewContext(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(requestAttrsKey{}).(*requestAttrs); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, requestAttrsKey{}, &requestAttrs{})
+}
+
+// SetAttr records key=value for every later record logged with ctx, or any context
+// derived from it, replacing an earlier value for key. It does nothing unless ctx came
+// from NewContext.
+func SetAttr(ctx context.Context, key, value string) {
+	ra, ok := ctx.Value(requestAttrsKey{}).(*requestAttrs)
+	if !ok || value == "" {
+		return
+	}
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+
+	for i := range ra.attrs {
+		if ra.attrs[i].Key == key {
+			ra.attrs[i].Value = slog.StringValue(value)
+			return
+		}
+	}
+	ra.attrs = append(ra.attrs, slog.String(key, value))
+}
+
+// attrsFrom returns a copy of the attributes recorded in ctx
+func attrsFrom(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	ra, ok := ctx.Value(requestAttrsKey{}).(*requestAttrs)
+	if !ok {
+		return nil
+	}
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	return append([]slog.Attr(nil), ra.attrs...)
+}
+
+// Handler wraps another slog.Handler, adding the request-scoped attributes of each
+// record's context. Attributes the call passes explicitly win over recorded ones with
+// the same key, so existing calls that already log e.g. request_id aren't duplicated.
+type Handler struct {
+	slog.Handler
+}
+
+// NewHandler wraps next
+func NewHandler(next slog.Handler) *Handler {
+	return &Handler{Handler: next}
+}
+
+// Handle adds ctx's request attributes to r and passes it on
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := attrsFrom(ctx); len(attrs) > 0 {
+		explicit := make(map[string]bool, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			explicit[a.Key] = true
+			return true
+		})
+		r = r.Clone()
+		for _, attr := range attrs {
+			if !explicit[attr.Key] {
+				r.AddAttrs(attr)
+			}
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs keeps the wrapper around the derived handler
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps the wrapper around the derived handler. Request attributes are then
+// logged inside the group, like any other attribute of the record.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func decodeEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var entry map[string]any
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("decoding log entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestHandlerAddsRequestAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(slog.NewJSONHandler(&buf, nil)))
+
+	ctx := NewContext(context.Background())
+	SetAttr(ctx, "request_id", "req-1")
+	SetAttr(ctx, "route", "GET /old")
+	SetAttr(ctx, "route", "GET /api/users/{id}")
+	SetAttr(ctx, "client_ip", "")
+
+	logger.InfoContext(ctx, "with context")
+	logger.InfoContext(ctx, "explicit wins", "request_id", "explicit")
+	logger.With("component", "test").InfoContext(context.WithValue(ctx, struct{}{}, 1), "derived")
+	logger.Info("without context")
+
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 4 {
+		t.Fatalf("logged %d entries, expected 4", len(entries))
+	}
+
+	tests := []struct {
+		name      string
+		entry     map[string]any
+		requestID any
+		route     any
+	}{
+		{"with context", entries[0], "req-1", "GET /api/users/{id}"},
+		{"explicit wins", entries[1], "explicit", "GET /api/users/{id}"},
+		{"derived logger and context", entries[2], "req-1", "GET /api/users/{id}"},
+		{"without context", entries[3], nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.entry["request_id"] != tt.requestID || tt.entry["route"] != tt.route {
+				t.Errorf("entry = %v, expected request_id %v and route %v", tt.entry, tt.requestID, tt.route)
+			}
+			if _, ok := tt.entry["client_ip"]; ok {
+				t.Errorf("entry = %v, expected the empty client_ip skipped", tt.entry)
+			}
+		})
+	}
+}
+
+func TestSetAttrWithoutNewContext(t *testing.T) {
+	ctx := context.Background()
+	SetAttr(ctx, "request_id", "ignored")
+	if attrs := attrsFrom(ctx); attrs != nil {
+		t.Errorf("attrsFrom() = %v, expected nothing without NewContext", attrs)
+	}
+
+	outer := NewContext(ctx)
+	if inner := NewContext(outer); inner != outer {
+		t.Error("NewContext() replaced the attributes an outer middleware installed")
+	}
+}
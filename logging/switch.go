@@ -0,0 +1,156 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+)
+
+// Log formats a Switch can write
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Switch writes logs whose level and format can change while the server runs, e.g.
+// to turn on debug logging during an incident without a restart. The level is a
+// slog.LevelVar and the formatting handler sits behind an atomic pointer, so changes
+// take effect for every logger at once, including ones derived with With, without
+// locking on the logging path.
+type Switch struct {
+	w     io.Writer
+	level slog.LevelVar
+	base  atomic.Pointer[formatHandler]
+}
+
+// formatHandler is the handler writing one format
+type formatHandler struct {
+	format  string
+	handler slog.Handler
+}
+
+// NewSwitch returns a Switch writing to w at level, as JSON when format is "json"
+// and as text otherwise
+func NewSwitch(w io.Writer, format string, level slog.Level) *Switch {
+	s := &Switch{w: w}
+	s.level.Set(level)
+	if format != FormatJSON {
+		format = FormatText
+	}
+	s.SetFormat(format)
+	return s
+}
+
+// Level returns the minimum level currently logged
+func (s *Switch) Level() slog.Level {
+	return s.level.Level()
+}
+
+// SetLevel changes the minimum level logged
+func (s *Switch) SetLevel(level slog.Level) {
+	s.level.Set(level)
+}
+
+// CycleLevel moves to the next of debug, info, warn and error, wrapping back to
+// debug, and returns the new level
+func (s *Switch) CycleLevel() slog.Level {
+	next := slog.LevelDebug
+	switch level := s.Level(); {
+	case level < slog.LevelInfo:
+		next = slog.LevelInfo
+	case level < slog.LevelWarn:
+		next = slog.LevelWarn
+	case level < slog.LevelError:
+		next = slog.LevelError
+	}
+	s.SetLevel(next)
+	return next
+}
+
+// Format returns the format currently written, "json" or "text"
+func (s *Switch) Format() string {
+	return s.base.Load().format
+}
+
+// SetFormat switches to writing format, which must be "json" or "text"
+func (s *Switch) SetFormat(format string) error {
+	opts := &slog.HandlerOptions{Level: &s.level}
+	var handler slog.Handler
+	switch format {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(s.w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(s.w, opts)
+	default:
+		return fmt.Errorf("unknown log format %q, expected json or text", format)
+	}
+	s.base.Store(&formatHandler{format: format, handler: handler})
+	return nil
+}
+
+// Handler returns a slog.Handler writing through s
+func (s *Switch) Handler() slog.Handler {
+	return &switchHandler{s: s}
+}
+
+// switchHandler is the slog.Handler side of a Switch. Handlers derived with WithAttrs
+// or WithGroup remember the calls, so they can be replayed on the new formatting
+// handler after a switch; the result is cached until the format changes again.
+type switchHandler struct {
+	s       *Switch
+	derive  []func(slog.Handler) slog.Handler
+	derived atomic.Pointer[derivedHandler]
+}
+
+// derivedHandler is a switchHandler's calls applied to one formatting handler
+type derivedHandler struct {
+	base    *formatHandler
+	handler slog.Handler
+}
+
+func (h *switchHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.s.level.Level()
+}
+
+func (h *switchHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.current().Handle(ctx, r)
+}
+
+func (h *switchHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *switchHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+// with returns a handler applying derive after h's own calls
+func (h *switchHandler) with(derive func(slog.Handler) slog.Handler) *switchHandler {
+	calls := make([]func(slog.Handler) slog.Handler, 0, len(h.derive)+1)
+	return &switchHandler{s: h.s, derive: append(append(calls, h.derive...), derive)}
+}
+
+// current returns the formatting handler in use with h's calls applied
+func (h *switchHandler) current() slog.Handler {
+	base := h.s.base.Load()
+	if len(h.derive) == 0 {
+		return base.handler
+	}
+	if derived := h.derived.Load(); derived != nil && derived.base == base {
+		return derived.handler
+	}
+	handler := base.handler
+	for _, derive := range h.derive {
+		handler = derive(handler)
+	}
+	h.derived.Store(&derivedHandler{base: base, handler: handler})
+	return handler
+}
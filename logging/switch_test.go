@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSwitchLevelAtRuntime(t *testing.T) {
+	var buf bytes.Buffer
+	logs := NewSwitch(&buf, FormatJSON, slog.LevelInfo)
+	logger := slog.New(NewHandler(logs.Handler()))
+
+	logger.Debug("suppressed")
+	if buf.Len() != 0 {
+		t.Fatalf("debug line logged at info level: %s", buf.String())
+	}
+
+	logs.SetLevel(slog.LevelDebug)
+	logger.Debug("now visible", "answer", 42)
+	entries := decodeEntries(t, &buf)
+	if len(entries) != 1 || entries[0]["msg"] != "now visible" || entries[0]["answer"] != float64(42) {
+		t.Errorf("entries = %v, expected the debug line once the level was lowered", entries)
+	}
+}
+
+func TestSwitchFormatAtRuntime(t *testing.T) {
+	var buf bytes.Buffer
+	logs := NewSwitch(&buf, FormatJSON, slog.LevelInfo)
+	// Derived before the switch, it must follow it while keeping its attributes
+	logger := slog.New(NewHandler(logs.Handler())).WithGroup("req").With("id", "r1")
+
+	logger.Info("as json")
+	if err := logs.SetFormat(FormatText); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("as text")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, expected 2: %q", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "{") || !strings.Contains(lines[0], `"req":{"id":"r1"}`) {
+		t.Errorf("first line = %q, expected JSON with the group", lines[0])
+	}
+	if !strings.Contains(lines[1], "msg=\"as text\"") || !strings.Contains(lines[1], "req.id=r1") {
+		t.Errorf("second line = %q, expected text with the group", lines[1])
+	}
+	if logs.Format() != FormatText {
+		t.Errorf("Format() = %q, expected text", logs.Format())
+	}
+	if err := logs.SetFormat("xml"); err == nil || logs.Format() != FormatText {
+		t.Errorf("SetFormat(xml) = %v with format %q, expected an error leaving text", err, logs.Format())
+	}
+}
+
+func TestSwitchCycleLevel(t *testing.T) {
+	logs := NewSwitch(&bytes.Buffer{}, FormatText, slog.LevelInfo)
+	expected := []slog.Level{slog.LevelWarn, slog.LevelError, slog.LevelDebug, slog.LevelInfo}
+	for _, want := range expected {
+		if got := logs.CycleLevel(); got != want || logs.Level() != want {
+			t.Fatalf("CycleLevel() = %v with level %v, expected %v", got, logs.Level(), want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPResolver determines the address of the client behind any trusted reverse
+// proxies. Forwarding headers are only believed when the request arrives from a
+// trusted proxy, since any client can send them.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver trusts the given proxies, each an IP address or a CIDR range
+// such as "10.0.0.0/8". Invalid entries are skipped with a warning; config.Validate
+// rejects them at startup.
+func NewClientIPResolver(proxies []string) *ClientIPResolver {
+	resolver := &ClientIPResolver{}
+	for _, proxy := range proxies {
+		prefix, err := parseTrustedProxy(proxy)
+		if err != nil {
+			slog.Warn("Ignoring invalid trusted proxy", "proxy", proxy, "error", err)
+			continue
+		}
+		resolver.trusted = append(resolver.trusted, prefix)
+	}
+	return resolver
+}
+
+// parseTrustedProxy parses an IP address or CIDR range into a prefix
+func parseTrustedProxy(proxy string) (netip.Prefix, error) {
+	proxy = strings.TrimSpace(proxy)
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ClientIP returns the IP address of the client that sent r. When the connection comes
+// from a trusted proxy, X-Forwarded-For is walked from the right, skipping further
+// trusted hops, and the first untrusted address is the client; X-Real-IP is used when
+// there is no X-Forwarded-For. Otherwise the peer itself is the client.
+func (c *ClientIPResolver) ClientIP(r *http.Request) string {
+	peer, ok := remoteAddr(r)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !c.isTrusted(peer) {
+		return peer.String()
+	}
+
+	if hops := r.Header.Values("X-Forwarded-For"); len(hops) > 0 {
+		// Each proxy appends the address it received the request from, so the
+		// rightmost entries are the most trustworthy
+		addrs := strings.Split(strings.Join(hops, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(addrs[i]))
+			if err != nil {
+				// Whatever sent a malformed entry can't be trusted, so neither can
+				// anything to its left
+				break
+			}
+			if addr = addr.Unmap(); !c.isTrusted(addr) {
+				return addr.String()
+			}
+			peer = addr
+		}
+		return peer.String()
+	}
+
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap().String()
+	}
+	return peer.String()
+}
+
+// Proto returns the scheme the client used: X-Forwarded-Proto when a trusted proxy
+// terminated the connection, and otherwise the scheme of the connection itself
+func (c *ClientIPResolver) Proto(r *http.Request) string {
+	if peer, ok := remoteAddr(r); ok && c.isTrusted(peer) {
+		if proto := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+			return proto
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// isTrusted reports whether addr belongs to a trusted proxy
+func (c *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range c.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteAddr parses the address of the request's immediate peer
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	if addr, err := netip.ParseAddr(r.RemoteAddr); err == nil {
+		return addr.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
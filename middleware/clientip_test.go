@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"htmx-learn/config"
+)
+
+func TestClientIP(t *testing.T) {
+	resolver := NewClientIPResolver([]string{"10.0.0.1", "192.168.0.0/16", "::1"})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer spoofing X-Forwarded-For", "203.0.113.7:5000", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.7"},
+		{"untrusted peer spoofing X-Real-IP", "203.0.113.7:5000", map[string]string{"X-Real-IP": "1.2.3.4"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+		{"trusted proxy chain", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.9, 192.168.1.20"}, "198.51.100.9"},
+		{"spoofed entry left of the real client", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.9"}, "198.51.100.9"},
+		{"malformed entry stops the walk", "10.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.9, garbage"}, "10.0.0.1"},
+		{"trusted proxy with X-Real-IP", "10.0.0.1:5000", map[string]string{"X-Real-IP": "198.51.100.9"}, "198.51.100.9"},
+		{"trusted proxy without headers", "10.0.0.1:5000", nil, "10.0.0.1"},
+		{"ipv6 trusted proxy", "[::1]:5000", map[string]string{"X-Forwarded-For": "2001:db8::5"}, "2001:db8::5"},
+		{"ipv4-mapped peer", "[::ffff:10.0.0.1]:5000", map[string]string{"X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			if got := resolver.ClientIP(req); got != tt.expected {
+				t.Errorf("ClientIP() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProto(t *testing.T) {
+	resolver := NewClientIPResolver([]string{"10.0.0.1"})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		tls        bool
+		expected   string
+	}{
+		{"plain connection", "203.0.113.7:5000", "", false, "http"},
+		{"tls connection", "203.0.113.7:5000", "", true, "https"},
+		{"trusted proxy terminated tls", "10.0.0.1:5000", "https", false, "https"},
+		{"untrusted peer claiming https", "203.0.113.7:5000", "https", false, "http"},
+		{"trusted proxy with bogus value", "10.0.0.1:5000", "gopher", false, "http"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.forwarded)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if got := resolver.Proto(req); got != tt.expected {
+				t.Errorf("Proto() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoggerLogsClientIP(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	handler := Logger(&config.Config{TrustedProxies: []string{"10.0.0.1"}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name             string
+		remoteAddr       string
+		expectedClientIP string
+		expectedProto    string
+	}{
+		{"trusted source", "10.0.0.1:5000", "198.51.100.9", "https"},
+		{"untrusted source", "203.0.113.7:5000", "203.0.113.7", "http"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "198.51.100.9")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("decoding log entry %q: %v", buf.String(), err)
+			}
+			if entry["remote_addr"] != tt.remoteAddr {
+				t.Errorf("remote_addr = %v, expected %s", entry["remote_addr"], tt.remoteAddr)
+			}
+			if entry["client_ip"] != tt.expectedClientIP {
+				t.Errorf("client_ip = %v, expected %s", entry["client_ip"], tt.expectedClientIP)
+			}
+			if entry["proto"] != tt.expectedProto {
+				t.Errorf("proto = %v, expected %s", entry["proto"], tt.expectedProto)
+			}
+		})
+	}
+}
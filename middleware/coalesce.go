@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"htmx-learn/config"
+)
+
+// coalescedResponse is a buffered response shared between coalesced callers
+type coalescedResponse struct {
+	header     http.Header
+	statusCode int
+	body       []byte
+	expires    time.Time
+}
+
+// bufferedWriter captures a response so it can be replayed to every waiting caller
+type bufferedWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (bw *bufferedWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	return bw.body.Write(b)
+}
+
+func (bw *bufferedWriter) WriteHeader(code int) {
+	bw.statusCode = code
+}
+
+// coalescer shares in-flight (and, within the window, just-finished) GET responses
+type coalescer struct {
+	group  singleflight.Group
+	window time.Duration
+
+	mu     sync.Mutex
+	recent map[string]*coalescedResponse
+}
+
+// Coalesce makes concurrent identical GET requests to the configured paths share a
+// single execution of next, so a thundering herd of pollers triggers one DB query.
+// With a non-zero window a finished response is also reused for that long.
+// Every caller receives its own copy of the headers and body. Conditional requests
+// are never coalesced, since their 304 would be replayed to callers that have
+// nothing cached, and neither are requests carrying cookies or credentials, whose
+// responses may belong to one user.
+func Coalesce(cfg *config.Config, next http.Handler) http.Handler {
+	if len(cfg.CoalescePaths) == 0 {
+		return next
+	}
+
+	paths := make(map[string]bool, len(cfg.CoalescePaths))
+	for _, path := range cfg.CoalescePaths {
+		paths[path] = true
+	}
+
+	c := &coalescer{
+		window: cfg.CoalesceWindow,
+		recent: make(map[string]*coalescedResponse),
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !paths[r.URL.Path] || isConditional(r) || hasCredentials(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := coalesceKey(r)
+		resp := c.lookup(key)
+		if resp == nil {
+			v, _, _ := c.group.Do(key, func() (interface{}, error) {
+				return c.execute(key, next, r), nil
+			})
+			resp = v.(*coalescedResponse)
+		}
+
+		for name, values := range resp.header.Clone() {
+			// Outer middleware such as CORS may already vary the response on other
+			// request headers, which must survive alongside the handler's
+			if name == "Vary" {
+				w.Header()[name] = append(w.Header()[name], values...)
+				continue
+			}
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.statusCode)
+		w.Write(resp.body)
+	})
+}
+
+// execute runs next once on behalf of every caller sharing key
+func (c *coalescer) execute(key string, next http.Handler, r *http.Request) *coalescedResponse {
+	// Detach from the leader's cancellation so one client disconnecting
+	// doesn't fail the response for everyone else waiting on it
+	shared := r.WithContext(context.WithoutCancel(r.Context()))
+
+	bw := &bufferedWriter{header: make(http.Header), statusCode: http.StatusOK}
+	next.ServeHTTP(bw, shared)
+
+	resp := &coalescedResponse{
+		header:     bw.header,
+		statusCode: bw.statusCode,
+		body:       bw.body.Bytes(),
+	}
+
+	if c.window > 0 {
+		now := time.Now()
+		resp.expires = now.Add(c.window)
+
+		c.mu.Lock()
+		for k, v := range c.recent {
+			if now.After(v.expires) {
+				delete(c.recent, k)
+			}
+		}
+		c.recent[key] = resp
+		c.mu.Unlock()
+	}
+
+	return resp
+}
+
+// lookup returns a response finished within the coalescing window, if any
+func (c *coalescer) lookup(key string) *coalescedResponse {
+	if c.window <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resp, ok := c.recent[key]
+	if !ok || time.Now().After(resp.expires) {
+		return nil
+	}
+	return resp
+}
+
+// isConditional reports whether r carries a validator the handler may answer with 304
+func isConditional(r *http.Request) bool {
+	return r.Header.Get("If-Modified-Since") != "" || r.Header.Get("If-None-Match") != ""
+}
+
+// hasCredentials reports whether r identifies its user with a cookie or credentials
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("Cookie") != "" || r.Header.Get("Authorization") != ""
+}
+
+// coalesceKey identifies requests that are guaranteed to produce the same response.
+// The host is part of it since handlers build absolute links from it.
+func coalesceKey(r *http.Request) string {
+	return r.Host + r.URL.RequestURI() +
+		"|" + r.Header.Get("HX-Request") +
+		"|" + r.Header.Get("HX-Boosted") +
+		"|" + r.Header.Get("X-Pagination-Mode") +
+		"|" + r.Header.Get("Accept")
+}
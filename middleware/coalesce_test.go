@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"htmx-learn/config"
+)
+
+func TestCoalesceConcurrentReads(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	// Simulates a store read that is slow enough for the herd to pile up behind it
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("X-Users", "3")
+		w.Write([]byte("users"))
+	})
+
+	cfg := &config.Config{CoalescePaths: []string{"/api/users"}}
+	coalesced := Coalesce(cfg, handler)
+
+	const clients = 20
+	recorders := make([]*httptest.ResponseRecorder, clients)
+	var wg sync.WaitGroup
+	for i := range clients {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			coalesced.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+		}(recorders[i])
+	}
+
+	// Give every client time to join the in-flight call before it completes
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("store called %d times, expected 1", got)
+	}
+
+	for i, rec := range recorders {
+		if rec.Code != http.StatusOK {
+			t.Errorf("client %d: status = %d, expected 200", i, rec.Code)
+		}
+		if rec.Body.String() != "users" {
+			t.Errorf("client %d: body = %q, expected %q", i, rec.Body.String(), "users")
+		}
+		if rec.Header().Get("X-Users") != "3" {
+			t.Errorf("client %d: missing copied header", i)
+		}
+	}
+
+	// Mutating one caller's headers must not leak into another's
+	recorders[0].Header().Set("X-Users", "changed")
+	if recorders[1].Header().Get("X-Users") != "3" {
+		t.Error("callers share a header map, expected independent copies")
+	}
+}
+
+func TestCoalesceSkipsUnconfiguredRequests(t *testing.T) {
+	var calls atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	})
+
+	cfg := &config.Config{CoalescePaths: []string{"/api/users"}, CoalesceWindow: time.Minute}
+	coalesced := Coalesce(cfg, handler)
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/time", nil),
+		httptest.NewRequest(http.MethodGet, "/api/time", nil),
+		httptest.NewRequest(http.MethodPost, "/api/users", nil),
+		httptest.NewRequest(http.MethodPost, "/api/users", nil),
+	}
+	for _, req := range requests {
+		coalesced.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if got := calls.Load(); got != int32(len(requests)) {
+		t.Errorf("handler called %d times, expected %d", got, len(requests))
+	}
+}
+
+func TestCoalesceWindow(t *testing.T) {
+	var calls atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	})
+
+	cfg := &config.Config{CoalescePaths: []string{"/api/users"}, CoalesceWindow: time.Minute}
+	coalesced := Coalesce(cfg, handler)
+
+	for range 3 {
+		coalesced.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/users", nil))
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("handler called %d times within the window, expected 1", got)
+	}
+
+	// A different query string is a different response
+	coalesced.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/users?page=2", nil))
+	if got := calls.Load(); got != 2 {
+		t.Errorf("handler called %d times, expected 2", got)
+	}
+}
+
+func TestCoalesceSkipsConditionalRequests(t *testing.T) {
+	var calls atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("time"))
+	})
+
+	cfg := &config.Config{CoalescePaths: []string{"/api/time"}, CoalesceWindow: time.Minute}
+	coalesced := Coalesce(cfg, handler)
+
+	conditional := httptest.NewRequest(http.MethodGet, "/api/time", nil)
+	conditional.Header.Set("If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+	rec := httptest.NewRecorder()
+	coalesced.ServeHTTP(rec, conditional)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("conditional request: status = %d, expected 304", rec.Code)
+	}
+
+	// The 304 above must not be replayed to a client that has nothing cached
+	rec = httptest.NewRecorder()
+	coalesced.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/time", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "time" {
+		t.Errorf("unconditional request: status = %d, body = %q, expected 200 with the body", rec.Code, rec.Body.String())
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("handler called %d times, expected 2", got)
+	}
+}
+
+func TestCoalesceKeyIncludesHost(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("http://" + r.Host + "/api/users?page=2"))
+	})
+
+	cfg := &config.Config{CoalescePaths: []string{"/api/users"}, CoalesceWindow: time.Minute}
+	coalesced := Coalesce(cfg, handler)
+
+	for _, host := range []string{"a.example.com", "b.example.com"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		coalesced.ServeHTTP(rec, req)
+
+		if want := "http://" + host + "/api/users?page=2"; rec.Body.String() != want {
+			t.Errorf("host %s: body = %q, expected %q", host, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestCoalesceSkipsRequestsWithCredentials(t *testing.T) {
+	var calls atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	})
+
+	cfg := &config.Config{CoalescePaths: []string{"/api/users"}, CoalesceWindow: time.Minute}
+	coalesced := Coalesce(cfg, handler)
+
+	for _, header := range []string{"Cookie", "Authorization"} {
+		for range 2 {
+			req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+			req.Header.Set(header, "secret")
+			coalesced.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+
+	if got := calls.Load(); got != 4 {
+		t.Errorf("handler called %d times, expected every request with credentials to run", got)
+	}
+}
+
+func TestCoalesceKeepsOuterVary(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+	})
+
+	cfg := &config.Config{
+		CoalescePaths:  []string{"/api/users"},
+		CoalesceWindow: time.Minute,
+		AllowedOrigins: []string{"https://app.example.com"},
+	}
+	wrapped := ConfigurableCORS(cfg, Coalesce(cfg, handler))
+
+	// The second request is answered from the coalescing window
+	for i := range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		rec := httptest.NewRecorder()
+		wrapped.ServeHTTP(rec, req)
+
+		vary := rec.Header().Values("Vary")
+		if !slices.Contains(vary, "Origin") || !slices.Contains(vary, "Accept") {
+			t.Errorf("request %d: Vary = %v, expected both Origin and Accept", i, vary)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"strings"
+)
+
+// originMatcher decides which request origins CORS responses are allowed for. It is
+// built once at startup from ALLOWED_ORIGINS entries, which may be exact origins,
+// subdomain patterns like "https://*.example.com", or "*" to allow any origin.
+type originMatcher struct {
+	any   bool
+	exact map[string]bool
+	// subdomains holds "scheme://" prefixes paired with ".domain[:port]" suffixes
+	subdomains []subdomainPattern
+}
+
+type subdomainPattern struct {
+	prefix string
+	suffix string
+}
+
+// parseOrigins compiles allowed origin entries into an originMatcher
+func parseOrigins(origins []string) *originMatcher {
+	m := &originMatcher{exact: make(map[string]bool)}
+	for _, origin := range origins {
+		origin = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+		switch {
+		case origin == "":
+		case origin == "*":
+			m.any = true
+		case strings.Contains(origin, "://*."):
+			scheme, domain, _ := strings.Cut(origin, "://*.")
+			m.subdomains = append(m.subdomains, subdomainPattern{prefix: scheme + "://", suffix: "." + domain})
+		default:
+			m.exact[origin] = true
+		}
+	}
+	return m
+}
+
+// allows reports whether origin may make cross-origin requests
+func (m *originMatcher) allows(origin string) bool {
+	return origin != "" && (m.any || m.lists(origin))
+}
+
+// lists reports whether origin matches an exact or subdomain entry. Only those origins
+// may send credentials; one allowed just by "*" may not.
+func (m *originMatcher) lists(origin string) bool {
+	origin = strings.ToLower(origin)
+	if m.exact[origin] {
+		return true
+	}
+	for _, pattern := range m.subdomains {
+		if !strings.HasPrefix(origin, pattern.prefix) || !strings.HasSuffix(origin, pattern.suffix) {
+			continue
+		}
+		subdomain := origin[len(pattern.prefix) : len(origin)-len(pattern.suffix)]
+		if validSubdomain(subdomain) {
+			return true
+		}
+	}
+	return false
+}
+
+// validSubdomain reports whether s is one or more DNS labels, so a pattern can't be
+// satisfied by an origin smuggling a port, path or credentials before the domain
+func validSubdomain(s string) bool {
+	if s == "" || strings.HasPrefix(s, ".") || strings.HasSuffix(s, ".") {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenSet is a case-normalized set of methods or header names, keeping the
+// configured order for response headers
+type tokenSet struct {
+	normalize func(string) string
+	order     []string
+	members   map[string]bool
+}
+
+func newTokenSet(tokens []string, normalize func(string) string) *tokenSet {
+	set := &tokenSet{normalize: normalize, members: make(map[string]bool)}
+	for _, token := range tokens {
+		token = normalize(strings.TrimSpace(token))
+		if token == "" || set.members[token] {
+			continue
+		}
+		set.members[token] = true
+		set.order = append(set.order, token)
+	}
+	return set
+}
+
+func (s *tokenSet) contains(token string) bool {
+	return s.members[s.normalize(token)]
+}
+
+func (s *tokenSet) containsAll(tokens []string) bool {
+	for _, token := range tokens {
+		if !s.contains(token) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *tokenSet) String() string {
+	return strings.Join(s.order, ", ")
+}
+
+// parseHeaderList splits Access-Control-Request-Headers values into header names
+func parseHeaderList(values []string) []string {
+	var names []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"htmx-learn/config"
+)
+
+func TestOriginMatcher(t *testing.T) {
+	m := parseOrigins([]string{"http://localhost:8080", "https://*.example.com", "https://*.ports.test:8443"})
+
+	tests := []struct {
+		origin   string
+		expected bool
+	}{
+		{"http://localhost:8080", true},
+		{"https://app.example.com", true},
+		{"https://staging.eu.example.com", true},
+		{"https://APP.Example.com", true},
+		{"https://api.ports.test:8443", true},
+		{"https://example.com", false},
+		{"http://app.example.com", false},
+		{"https://evilexample.com", false},
+		{"https://app.example.com.evil.net", false},
+		{"https://evil.net/.example.com", false},
+		{"https://api.ports.test", false},
+		{"http://localhost:3000", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if got := m.allows(tt.origin); got != tt.expected {
+				t.Errorf("allows(%q) = %v, expected %v", tt.origin, got, tt.expected)
+			}
+		})
+	}
+
+	if !parseOrigins([]string{"*"}).allows("http://anything.test") {
+		t.Error("* should allow any origin")
+	}
+}
+
+func TestConfigurableCORSDoesNotReflectDisallowedOrigins(t *testing.T) {
+	cfg := &config.Config{AllowedOrigins: []string{"https://*.example.com"}}
+	handler := ConfigurableCORS(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		origin       string
+		expectedACAO string
+	}{
+		{"https://app.example.com", "https://app.example.com"},
+		{"https://evil.test", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedACAO {
+				t.Errorf("Access-Control-Allow-Origin = %q, expected %q", got, tt.expectedACAO)
+			}
+			if tt.expectedACAO == "" && rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+				t.Error("credentials allowed for a disallowed origin")
+			}
+		})
+	}
+}
+
+func TestConfigurableCORSWildcardWithoutCredentials(t *testing.T) {
+	cfg := &config.Config{AllowedOrigins: []string{"https://app.example.com", "*"}, CORSAllowedMethods: []string{"GET"}}
+	handler := ConfigurableCORS(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		origin              string
+		expectedACAO        string
+		expectedCredentials string
+	}{
+		{"https://app.example.com", "https://app.example.com", "true"},
+		{"https://anything.test", "*", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			for _, method := range []string{http.MethodGet, http.MethodOptions} {
+				req := httptest.NewRequest(method, "/api/users", nil)
+				req.Header.Set("Origin", tt.origin)
+				if method == http.MethodOptions {
+					req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedACAO {
+					t.Errorf("%s: Access-Control-Allow-Origin = %q, expected %q", method, got, tt.expectedACAO)
+				}
+				if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.expectedCredentials {
+					t.Errorf("%s: Access-Control-Allow-Credentials = %q, expected %q", method, got, tt.expectedCredentials)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigurableCORSPreflight(t *testing.T) {
+	cfg := &config.Config{
+		AllowedOrigins:     []string{"https://app.example.com"},
+		CORSAllowedMethods: []string{"GET", "POST", "DELETE"},
+		CORSAllowedHeaders: []string{"Content-Type", "X-Request-ID", "Idempotency-Key"},
+	}
+	called := false
+	handler := ConfigurableCORS(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	tests := []struct {
+		name            string
+		origin          string
+		method          string
+		headers         string
+		expectedStatus  int
+		expectedHeaders string
+	}{
+		{"custom header allowed", "https://app.example.com", "POST", "x-request-id, content-type", http.StatusNoContent, "x-request-id, content-type"},
+		{"no requested headers", "https://app.example.com", "delete", "", http.StatusNoContent, ""},
+		{"method not allowed", "https://app.example.com", "PATCH", "", http.StatusForbidden, ""},
+		{"header not allowed", "https://app.example.com", "POST", "X-Request-ID, X-Secret", http.StatusForbidden, ""},
+		{"origin not allowed", "https://evil.test", "POST", "", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "/api/users", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expectedStatus)
+			}
+			acao := rec.Header().Get("Access-Control-Allow-Origin")
+			if tt.expectedStatus == http.StatusForbidden {
+				if acao != "" || rec.Header().Get("Access-Control-Allow-Methods") != "" {
+					t.Error("rejected preflight must not carry CORS headers")
+				}
+				return
+			}
+			if acao != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, expected %q", acao, tt.origin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST, DELETE" {
+				t.Errorf("Access-Control-Allow-Methods = %q", got)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Headers"); got != tt.expectedHeaders {
+				t.Errorf("Access-Control-Allow-Headers = %q, expected %q", got, tt.expectedHeaders)
+			}
+		})
+	}
+
+	if called {
+		t.Error("preflight requests must not reach the wrapped handler")
+	}
+}
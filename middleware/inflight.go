@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// RequestTracker counts the requests currently being served, so shutdown can report
+// what it is still waiting for. The zero value is ready to use.
+type RequestTracker struct {
+	active atomic.Int64
+}
+
+// Track counts requests for the duration of next
+func (t *RequestTracker) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.active.Add(1)
+		defer t.active.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Active returns the number of requests being served right now
+func (t *RequestTracker) Active() int64 {
+	return t.active.Load()
+}
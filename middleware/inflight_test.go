@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestRequestTracker(t *testing.T) {
+	var tracker RequestTracker
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	handler := tracker.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started.Done()
+		<-release
+	}))
+
+	var done sync.WaitGroup
+	for range 3 {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+	}
+	started.Wait()
+
+	if active := tracker.Active(); active != 3 {
+		t.Errorf("Active() = %d while serving, expected 3", active)
+	}
+
+	close(release)
+	done.Wait()
+	if active := tracker.Active(); active != 0 {
+		t.Errorf("Active() = %d after serving, expected 0", active)
+	}
+}
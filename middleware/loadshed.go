@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// LoadShed answers 503 while usage, the percentage of database connections in use,
+// is at or above threshold. Queueing more requests on an exhausted pool only makes
+// them all wait out their timeouts, and a thundering herd keeps the database pinned;
+// shedding early lets the requests already holding connections finish. Paths under
+// the exempt prefixes, such as health checks, are always served. A threshold of 0
+// disables shedding.
+func LoadShed(usage func() int, threshold int, exempt []string, next http.Handler) http.Handler {
+	if threshold <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if matchesPathPrefix(r.URL.Path, exempt) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if used := usage(); used >= threshold {
+			slog.WarnContext(r.Context(), "Shedding request, database pool near exhaustion",
+				"pool_usage_percent", used,
+				"method", r.Method,
+				"path", r.URL.Path,
+			)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Service temporarily overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
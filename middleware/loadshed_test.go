@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLoadShedUnderPoolSaturation(t *testing.T) {
+	// A simulated pool of four connections, held by requests to /hold until released
+	const maxConns = 4
+	var acquired atomic.Int32
+	usage := func() int { return int(acquired.Load()) * 100 / maxConns }
+	release := make(chan struct{})
+	holding := make(chan struct{})
+
+	handler := LoadShed(usage, 75, []string{"/health"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hold" {
+			acquired.Add(1)
+			defer acquired.Add(-1)
+			holding <- struct{}{}
+			<-release
+		}
+	}))
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	// Saturate three of the four connections, reaching the 75% high-water mark
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve("/hold")
+		}()
+		<-holding
+	}
+
+	rec := serve("/api/users")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("saturated pool: status = %d, expected 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("shed response has no Retry-After header")
+	}
+	if rec := serve("/health/ready"); rec.Code != http.StatusOK {
+		t.Errorf("saturated pool: health check status = %d, expected 200", rec.Code)
+	}
+
+	close(release)
+	wg.Wait()
+	if rec := serve("/api/users"); rec.Code != http.StatusOK {
+		t.Errorf("drained pool: status = %d, expected 200", rec.Code)
+	}
+}
+
+func TestLoadShedDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := LoadShed(func() int { return 100 }, 0, nil, next)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d with shedding disabled, expected 200", rec.Code)
+	}
+}
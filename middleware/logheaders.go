@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// redacted replaces the value of a header that must never reach the logs
+const redacted = "[REDACTED]"
+
+// credentialHeaders carry credentials by definition, so they are redacted even when
+// LOG_HEADERS lists them
+var credentialHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// credentialNameParts mark other header names as credential-bearing, e.g. X-Api-Key
+// or X-CSRF-Token
+var credentialNameParts = []string{"token", "secret", "password", "api-key", "apikey", "session"}
+
+// credentialSchemes are value prefixes that identify an auth token in any header
+var credentialSchemes = []string{"bearer ", "basic ", "digest ", "token "}
+
+// headerLogger renders the configured request headers as a log attribute
+type headerLogger struct {
+	names []string
+}
+
+// newHeaderLogger logs the named headers; it returns nil, which logs nothing, when
+// names is empty
+func newHeaderLogger(names []string) *headerLogger {
+	var canonical []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			canonical = append(canonical, http.CanonicalHeaderKey(name))
+		}
+	}
+	if len(canonical) == 0 {
+		return nil
+	}
+	return &headerLogger{names: canonical}
+}
+
+// attr returns a "headers" group holding each configured header r carries, with any
+// credential redacted, and false when there is nothing to log
+func (hl *headerLogger) attr(r *http.Request) (slog.Attr, bool) {
+	if hl == nil {
+		return slog.Attr{}, false
+	}
+	var attrs []any
+	for _, name := range hl.names {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		value := strings.Join(values, ", ")
+		if isCredential(name, value) {
+			value = redacted
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	if len(attrs) == 0 {
+		return slog.Attr{}, false
+	}
+	return slog.Group("headers", attrs...), true
+}
+
+// isCredential reports whether the header looks like it carries an auth token, going
+// by its name or by a scheme prefix on its value
+func isCredential(name, value string) bool {
+	if credentialHeaders[name] {
+		return true
+	}
+	lowerName := strings.ToLower(name)
+	for _, part := range credentialNameParts {
+		if strings.Contains(lowerName, part) {
+			return true
+		}
+	}
+	lowerValue := strings.ToLower(strings.TrimSpace(value))
+	for _, scheme := range credentialSchemes {
+		if strings.HasPrefix(lowerValue, scheme) {
+			return true
+		}
+	}
+	return false
+}
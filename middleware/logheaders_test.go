@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"htmx-learn/config"
+)
+
+func TestLoggerLogsConfiguredHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	cfg := &config.Config{LogHeaders: []string{"hx-request", "HX-Target", "Origin", "Authorization", "X-CSRF-Token", "X-Forwarded-Auth"}}
+	handler := Logger(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/counter", nil)
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("HX-Target", "#count")
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Referer", "https://app.example.com/counter")
+	req.Header.Set("Authorization", "Bearer s3cr3t-admin-token")
+	req.Header.Set("X-CSRF-Token", "csrf-value")
+	req.Header.Set("X-Forwarded-Auth", "Basic dXNlcjpwYXNz")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	for _, secret := range []string{"s3cr3t-admin-token", "csrf-value", "dXNlcjpwYXNz"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("log entry %q contains the credential %q", buf.String(), secret)
+		}
+	}
+
+	var entry struct {
+		Headers map[string]string `json:"headers"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decoding log entry %q: %v", buf.String(), err)
+	}
+	expected := map[string]string{
+		"Hx-Request":       "true",
+		"Hx-Target":        "#count",
+		"Origin":           "https://app.example.com",
+		"Authorization":    redacted,
+		"X-Csrf-Token":     redacted,
+		"X-Forwarded-Auth": redacted,
+	}
+	if !maps.Equal(entry.Headers, expected) {
+		t.Errorf("headers = %v, expected %v", entry.Headers, expected)
+	}
+}
+
+func TestLoggerLogsNoHeadersByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("HX-Request", "true")
+	Logger(&config.Config{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+
+	if strings.Contains(buf.String(), `"headers"`) {
+		t.Errorf("log entry %q has headers, expected none without LOG_HEADERS", buf.String())
+	}
+}
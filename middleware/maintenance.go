@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Maintenance answers every request with unavailable while enabled reports true,
+// except paths under the exempt prefixes, which keep health checks and the admin
+// endpoints that turn maintenance off again reachable
+func Maintenance(enabled func() bool, exempt []string, unavailable http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if enabled() && !matchesPathPrefix(r.URL.Path, exempt) {
+			unavailable.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireToken only lets requests carrying "Authorization: Bearer <token>" through.
+// An empty token rejects everything, so a missing ADMIN_TOKEN can't open admin routes.
+func RequireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMaintenanceBypassList(t *testing.T) {
+	enabled := true
+	unavailable := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	handler := Maintenance(func() bool { return enabled }, []string{"/health", "/admin"}, unavailable,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		path     string
+		enabled  bool
+		expected int
+	}{
+		{"/health/live", true, http.StatusOK},
+		{"/health/ready", true, http.StatusOK},
+		{"/admin/maintenance", true, http.StatusOK},
+		{"/", true, http.StatusServiceUnavailable},
+		{"/api/users", true, http.StatusServiceUnavailable},
+		{"/healthz-lookalike", true, http.StatusServiceUnavailable},
+		{"/api/users", false, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			enabled = tt.enabled
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.expected {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		name       string
+		configured string
+		header     string
+		expected   int
+	}{
+		{"valid token", token, "Bearer " + token, http.StatusOK},
+		{"wrong token", token, "Bearer nope", http.StatusUnauthorized},
+		{"missing header", token, "", http.StatusUnauthorized},
+		{"wrong scheme", token, "Basic " + token, http.StatusUnauthorized},
+		{"no token configured", "", "Bearer ", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireToken(tt.configured, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req := httptest.NewRequest(http.MethodPost, "/admin/maintenance", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expected)
+			}
+		})
+	}
+}
@@ -3,13 +3,20 @@
 package middleware
 
 import (
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 	"golang.org/x/time/rate"
 
 	"htmx-learn/config"
+	"htmx-learn/logging"
+	"htmx-learn/validation"
 )
 
 type ResponseWriter struct {
@@ -22,9 +29,23 @@ func (rw *ResponseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-func Logger(next http.Handler) http.Handler {
+// Unwrap exposes the underlying writer so http.ResponseController can reach
+// Flush and deadline controls through the logging wrapper
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Logger logs every request once it completes. client_ip is the client behind any
+// trusted proxies, while remote_addr is the immediate peer. Request headers listed in
+// cfg.LogHeaders are added under "headers", with credentials redacted.
+func Logger(cfg *config.Config, next http.Handler) http.Handler {
+	resolver := NewClientIPResolver(cfg.TrustedProxies)
+	headers := newHeaderLogger(cfg.LogHeaders)
+	
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		clientIP := resolver.ClientIP(r)
+		logging.SetAttr(r.Context(), "client_ip", clientIP)
 		
 		wrapped := &ResponseWriter{
 			ResponseWriter: w,
@@ -33,74 +54,192 @@ func Logger(next http.Handler) http.Handler {
 		
 		next.ServeHTTP(wrapped, r)
 		
-		slog.Info("HTTP Request",
+		attrs := []any{
+			"request_id", RequestIDFrom(r.Context()),
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", wrapped.statusCode,
 			"duration", time.Since(start),
 			"remote_addr", r.RemoteAddr,
+			"client_ip", clientIP,
+			"proto", resolver.Proto(r),
 			"user_agent", r.UserAgent(),
-		)
+		}
+		if attr, ok := headers.attr(r); ok {
+			attrs = append(attrs, attr)
+		}
+		slog.InfoContext(r.Context(), "HTTP Request", attrs...)
 	})
 }
 
+// ErrBadRequest may be panicked with, usually wrapped with details, to abort a request
+// as the client's fault: Recovery answers 400 instead of 500
+var ErrBadRequest = errors.New("bad request")
+
+// panicStatus returns the status Recovery answers a panic with, and the error code
+// JSON clients get. Only these recovered values map to a 4xx:
+//   - an error wrapping ErrBadRequest: 400 "invalid_request"
+//   - an error wrapping validation.ValidationErrors: 400 "invalid_request"
+//
+// Anything else, including non-error values, is a 500 "internal". This is an escape
+// hatch for code deep in a call stack, not a substitute for returning errors.
+func panicStatus(recovered any) (int, string) {
+	if err, ok := recovered.(error); ok {
+		var validationErrs validation.ValidationErrors
+		if errors.Is(err, ErrBadRequest) || errors.As(err, &validationErrs) {
+			return http.StatusBadRequest, "invalid_request"
+		}
+	}
+	return http.StatusInternalServerError, "internal"
+}
 
+// Recovery turns a panic in next into an error response, a 500 unless panicStatus maps
+// the recovered value to a 4xx. The request ID is logged with the panic, and with its
+// stack when it's a 500; the response stays generic so nothing internal leaks, and
+// gives JSON clients the handlers' error envelope, {"code": "internal", "errors":
+// [...]}, with a request_id to quote to support.
 func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				slog.Error("Panic recovered",
-					"error", err,
-					"method", r.Method,
-					"path", r.URL.Path,
-					"remote_addr", r.RemoteAddr,
-				)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				// net/http aborts the response quietly for this one, so let it through
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				requestID := RequestIDFrom(r.Context())
+				status, code := panicStatus(err)
+				if status == http.StatusInternalServerError {
+					slog.ErrorContext(r.Context(), "Panic recovered",
+						"error", err,
+						"request_id", requestID,
+						"method", r.Method,
+						"path", r.URL.Path,
+						"remote_addr", r.RemoteAddr,
+						"stack", string(debug.Stack()),
+					)
+				} else {
+					slog.WarnContext(r.Context(), "Panic recovered as client error",
+						"error", err,
+						"status", status,
+						"request_id", requestID,
+						"method", r.Method,
+						"path", r.URL.Path,
+						"remote_addr", r.RemoteAddr,
+					)
+				}
+
+				if acceptsJSON(r) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(status)
+					json.NewEncoder(w).Encode(map[string]any{
+						"code":       code,
+						"errors":     []string{http.StatusText(status)},
+						"request_id": requestID,
+					})
+					return
+				}
+				http.Error(w, http.StatusText(status), status)
 			}
 		}()
 		next.ServeHTTP(w, r)
 	})
 }
 
-// SecurityHeaders adds security-related HTTP headers
-func SecurityHeaders(next http.Handler) http.Handler {
+// acceptsJSON reports whether r's Accept header lists application/json
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, _ := strings.Cut(mediaRange, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), "application/json") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SecurityHeaders adds security-related HTTP headers. Paths under the slim prefixes,
+// such as /metrics or JSON-only endpoints, only get nosniff and the referrer policy:
+// CSP, framing and XSS protection only mean something for documents a browser
+// renders, and HSTS is already remembered from the pages.
+func SecurityHeaders(slim []string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		if matchesPathPrefix(r.URL.Path, slim) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		
 		w.Header().Set("X-Frame-Options", "DENY")
 		w.Header().Set("X-XSS-Protection", "1; mode=block")
 		w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
 		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline' https://unpkg.com; style-src 'self' 'unsafe-inline'; img-src 'self' data:; connect-src 'self'")
-		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
 		w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
 		
 		next.ServeHTTP(w, r)
 	})
 }
 
-// ConfigurableCORS provides configurable CORS middleware
-func ConfigurableCORS(allowedOrigins []string, next http.Handler) http.Handler {
+// ConfigurableCORS provides configurable CORS middleware. Allowed origins may be exact,
+// subdomain patterns such as "https://*.example.com", or "*" (development only).
+// Listed origins may send credentials; any other origin "*" lets in gets a wildcard
+// without them. Disallowed origins get no CORS headers, so browsers block their requests.
+// Preflights are checked against the allowed methods and headers and refused with
+// 403 when they ask for anything else.
+func ConfigurableCORS(cfg *config.Config, next http.Handler) http.Handler {
+	origins := parseOrigins(cfg.AllowedOrigins)
+	methods := newTokenSet(cfg.CORSAllowedMethods, strings.ToUpper)
+	headers := newTokenSet(cfg.CORSAllowedHeaders, http.CanonicalHeaderKey)
+	
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
+		allowed := origins.allows(origin)
 		
-		// Check if origin is allowed
-		allowed := false
-		for _, allowedOrigin := range allowedOrigins {
-			if origin == allowedOrigin {
-				allowed = true
-				break
+		// Credentialed requests need the origin echoed; "*" alone never allows them, so
+		// no site can ride on a user's cookies just because the wildcard is configured
+		allowOrigin := func() {
+			if origins.lists(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				return
 			}
+			w.Header().Set("Access-Control-Allow-Origin", "*")
 		}
 		
-		if allowed {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-		} else if len(allowedOrigins) > 0 {
-			w.Header().Set("Access-Control-Allow-Origin", allowedOrigins[0])
+		// The response depends on the origin, so shared caches must key on it
+		w.Header().Add("Vary", "Origin")
+		
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			
+			requestedMethod := r.Header.Get("Access-Control-Request-Method")
+			requestedHeaders := parseHeaderList(r.Header.Values("Access-Control-Request-Headers"))
+			if !allowed || !methods.contains(strings.ToUpper(requestedMethod)) || !headers.containsAll(requestedHeaders) {
+				slog.Debug("CORS preflight rejected",
+					"origin", origin,
+					"method", requestedMethod,
+					"headers", requestedHeaders,
+				)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			
+			allowOrigin()
+			w.Header().Set("Access-Control-Allow-Methods", methods.String())
+			if len(requestedHeaders) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+			}
+			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
 		}
 		
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Max-Age", "86400")
+		if allowed {
+			allowOrigin()
+		}
 		
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -128,7 +267,7 @@ func NewRateLimitStore(r rate.Limit, b int) *RateLimitStore {
 	}
 }
 
-// GetLimiter returns the rate limiter for a given key (usually IP address)
+// GetLimiter returns the rate limiter for a given key (a user or an IP address)
 func (s *RateLimitStore) GetLimiter(key string) *rate.Limiter {
 	s.mu.RLock()
 	limiter, exists := s.limiters[key]
@@ -146,19 +285,68 @@ func (s *RateLimitStore) GetLimiter(key string) *rate.Limiter {
 
 // RateLimit provides rate limiting middleware
 func RateLimit(cfg *config.Config, next http.Handler) http.Handler {
-	// Convert requests per minute to requests per second
-	limitRate := rate.Limit(float64(cfg.RateLimit) / cfg.RateLimitWindow.Minutes())
+	// Convert requests per window to requests per second. config.Validate rejects a
+	// zero window; should one get through anyway, dividing by it would yield an
+	// infinite rate and silently disable limiting, so use the default window instead.
+	window := cfg.RateLimitWindow
+	if window <= 0 {
+		slog.Warn("Invalid rate limit window, using one minute", "window", window)
+		window = time.Minute
+	}
+	limitRate := rate.Limit(float64(cfg.RateLimit) / window.Seconds())
 	store := NewRateLimitStore(limitRate, cfg.RateLimitBurst)
+	resolver := NewClientIPResolver(cfg.TrustedProxies)
+	
+	// The global bucket caps aggregate traffic across all IPs; a burst of one
+	// second's worth of requests absorbs normal jitter
+	var global *rate.Limiter
+	if cfg.RateLimitGlobal > 0 {
+		global = rate.NewLimiter(rate.Limit(cfg.RateLimitGlobal), cfg.RateLimitGlobal)
+	}
 	
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get client IP (handle X-Forwarded-For and X-Real-IP headers)
-		clientIP := getClientIP(r)
+		// Probes and static assets must never be throttled
+		if matchesPathPrefix(r.URL.Path, cfg.RateLimitExemptPaths) {
+			next.ServeHTTP(w, r)
+			return
+		}
 		
-		limiter := store.GetLimiter(clientIP)
+		// Forwarding headers only count when a trusted proxy sent them, so clients
+		// can't dodge their limit by spoofing X-Forwarded-For
+		clientIP := resolver.ClientIP(r)
 		
-		if !limiter.Allow() {
+		key := rateLimitKey(cfg, r, clientIP)
+		limiter := store.GetLimiter(key)
+		
+		// An exhausted global budget means the server as a whole is overloaded, which
+		// is reported as unavailability rather than the client's fault, whatever is
+		// left of the client's own budget. Both checks use one instant: a reservation
+		// cancelled after the time it was granted for gives no tokens back.
+		now := time.Now()
+		var globalReservation *rate.Reservation
+		if global != nil {
+			globalReservation = global.ReserveN(now, 1)
+			if globalReservation.DelayFrom(now) > 0 {
+				globalReservation.CancelAt(now)
+				slog.Warn("Global rate limit exceeded",
+					"method", r.Method,
+					"path", r.URL.Path,
+				)
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "Service temporarily overloaded", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		
+		// A client over its own limit gets the global token back, so it can't drain
+		// the budget everyone shares
+		if !limiter.AllowN(now, 1) {
+			if globalReservation != nil {
+				globalReservation.CancelAt(now)
+			}
 			slog.Warn("Rate limit exceeded",
 				"client_ip", clientIP,
+				"key", key,
 				"method", r.Method,
 				"path", r.URL.Path,
 			)
@@ -171,24 +359,30 @@ func RateLimit(cfg *config.Config, next http.Handler) http.Handler {
 	})
 }
 
-// getClientIP extracts the client IP address from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// X-Forwarded-For can contain multiple IPs, get the first one
-		for i, char := range xff {
-			if char == ',' {
-				return xff[:i]
-			}
+// rateLimitKey picks the budget a request draws from: the authenticated user's own when
+// keying by user is enabled, and otherwise the client IP's. The prefixes keep a user ID
+// from ever sharing a budget with an IP.
+func rateLimitKey(cfg *config.Config, r *http.Request, clientIP string) string {
+	if cfg.RateLimitByUser {
+		if id, ok := UserID(r.Context()); ok {
+			return "user:" + strconv.Itoa(id)
 		}
-		return xff
 	}
-	
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+	return "ip:" + clientIP
+}
+
+// matchesPathPrefix reports whether path is, or is under, one of the prefixes.
+// Prefixes match whole path segments, so "/health" covers "/health/ready" but not
+// "/healthcheck-spam".
+func matchesPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" {
+			continue
+		}
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
 	}
-	
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
-}
\ No newline at end of file
+	return false
+}
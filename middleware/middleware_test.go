@@ -0,0 +1,482 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"htmx-learn/config"
+	"htmx-learn/logging"
+	"htmx-learn/router"
+	"htmx-learn/validation"
+)
+
+func TestMatchesPathPrefix(t *testing.T) {
+	prefixes := []string{"/health", "/static/"}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/health", true},
+		{"/health/ready", true},
+		{"/static/css/output.css", true},
+		{"/static", true},
+		{"/healthcheck-spam", false},
+		{"/api/users", false},
+		{"/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := matchesPathPrefix(tt.path, prefixes); got != tt.expected {
+				t.Errorf("matchesPathPrefix(%q) = %v, expected %v", tt.path, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRateLimitSkipsExemptPathsUnderLoad(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit:            1,
+		RateLimitWindow:      time.Minute,
+		RateLimitBurst:       1,
+		RateLimitExemptPaths: []string{"/health", "/static"},
+	}
+	handler := RateLimit(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	counts := func(path string) (ok, limited int) {
+		for range 500 {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			switch rec.Code {
+			case http.StatusOK:
+				ok++
+			case http.StatusTooManyRequests:
+				limited++
+			}
+		}
+		return ok, limited
+	}
+
+	for _, path := range []string{"/health/live", "/health/ready", "/static/css/output.css"} {
+		if ok, limited := counts(path); limited != 0 {
+			t.Errorf("%s: %d of %d requests throttled, expected none", path, limited, ok+limited)
+		}
+	}
+
+	if _, limited := counts("/api/users"); limited == 0 {
+		t.Error("/api/users was never throttled, expected the limit to apply")
+	}
+}
+
+func TestRateLimitGlobalAcrossIPs(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit:       1000,
+		RateLimitWindow: time.Minute,
+		RateLimitBurst:  1000,
+		RateLimitGlobal: 10,
+	}
+	handler := RateLimit(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	ok, unavailable := 0, 0
+	for i := range 100 {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		switch rec.Code {
+		case http.StatusOK:
+			ok++
+		case http.StatusServiceUnavailable:
+			unavailable++
+			if rec.Header().Get("Retry-After") == "" {
+				t.Error("503 response is missing Retry-After")
+			}
+		default:
+			t.Fatalf("unexpected status %d", rec.Code)
+		}
+	}
+
+	// Each IP is well within its own budget, so only the global bucket can refuse
+	if ok > 11 || unavailable == 0 {
+		t.Errorf("%d allowed and %d refused, expected about 10 allowed before the global limit", ok, unavailable)
+	}
+}
+
+func TestRateLimitAbusiveIPDoesNotDrainGlobal(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit:       2,
+		RateLimitWindow: time.Minute,
+		RateLimitBurst:  2,
+		RateLimitGlobal: 10,
+	}
+	handler := RateLimit(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	send := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Beyond its burst the abuser is refused by its own limiter, without spending
+	// global tokens
+	for range 100 {
+		send("203.0.113.7:1234")
+	}
+	for i := range 5 {
+		if code := send(fmt.Sprintf("10.0.0.%d:1234", i)); code != http.StatusOK {
+			t.Fatalf("well-behaved client %d: status %d, expected 200", i, code)
+		}
+	}
+}
+
+func TestRateLimitOverBothLimitsIsUnavailable(t *testing.T) {
+	cfg := &config.Config{
+		RateLimit:       1,
+		RateLimitWindow: time.Minute,
+		RateLimitBurst:  1,
+		RateLimitGlobal: 1,
+	}
+	handler := RateLimit(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var codes []int
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	// The second request is over both the client's and the global limit; the global
+	// check runs first, so it is refused as an overload
+	if codes[0] != http.StatusOK || codes[1] != http.StatusServiceUnavailable {
+		t.Errorf("statuses = %v, expected [200 503]", codes)
+	}
+}
+
+func TestRateLimitGlobalDisabled(t *testing.T) {
+	cfg := &config.Config{RateLimit: 1000, RateLimitWindow: time.Minute, RateLimitBurst: 1000}
+	handler := RateLimit(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := range 100 {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, expected 200 with no global limit", i, rec.Code)
+		}
+	}
+}
+
+func TestRateLimitByUser(t *testing.T) {
+	cfg := &config.Config{RateLimit: 1, RateLimitWindow: time.Minute, RateLimitBurst: 2, RateLimitByUser: true}
+	handler := RateLimit(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Every request comes from the same NAT address
+	send := func(userID int, authenticated bool) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		if authenticated {
+			req = req.WithContext(WithUserID(req.Context(), userID))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// User 1 exhausts their budget; user 2 and anonymous visitors on the same IP keep theirs
+	for range cfg.RateLimitBurst {
+		if code := send(1, true); code != http.StatusOK {
+			t.Fatalf("user 1 within budget: status %d, expected 200", code)
+		}
+	}
+	if code := send(1, true); code != http.StatusTooManyRequests {
+		t.Errorf("user 1 over budget: status %d, expected 429", code)
+	}
+	if code := send(2, true); code != http.StatusOK {
+		t.Errorf("user 2 on the same IP: status %d, expected 200", code)
+	}
+	if code := send(0, false); code != http.StatusOK {
+		t.Errorf("anonymous request on the same IP: status %d, expected 200", code)
+	}
+}
+
+func TestRateLimitByUserDisabled(t *testing.T) {
+	cfg := &config.Config{RateLimit: 1, RateLimitWindow: time.Minute, RateLimitBurst: 1}
+	handler := RateLimit(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	codes := make([]int, 0, 2)
+	for _, userID := range []int{1, 2} {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		req = req.WithContext(WithUserID(req.Context(), userID))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	// Keyed by IP, the second user shares the first user's exhausted budget
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, expected [200 429]", codes)
+	}
+}
+
+func TestRateLimitZeroWindowStillLimits(t *testing.T) {
+	cfg := &config.Config{RateLimit: 1, RateLimitBurst: 1}
+	handler := RateLimit(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	codes := make([]int, 0, 2)
+	for range 2 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, expected [200 429]", codes)
+	}
+}
+
+func TestRateLimitRefillsOverWindow(t *testing.T) {
+	const limit, burst = 2, 1
+	window := 200 * time.Millisecond
+	cfg := &config.Config{RateLimit: limit, RateLimitWindow: window, RateLimitBurst: burst}
+	handler := RateLimit(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Spread over the window, the burst plus the limit get through, and no more
+	allowed, refused := 0, 0
+	for start := time.Now(); time.Since(start) < window; time.Sleep(window / 20) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+		switch rec.Code {
+		case http.StatusOK:
+			allowed++
+		case http.StatusTooManyRequests:
+			refused++
+		}
+	}
+	if allowed > limit+burst || refused == 0 {
+		t.Errorf("%d requests allowed and %d refused within the window, expected at most %d allowed", allowed, refused, limit+burst)
+	}
+}
+
+func TestRecoveryLogsPanicWithStack(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	handler := RequestID(Recovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("database password is hunter2")
+	})))
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{"JSON client", "application/json", "application/json"},
+		{"browser", "text/html", "text/plain; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/boom", nil)
+			req.Header.Set("Accept", tt.accept)
+			req.Header.Set(RequestIDHeader, "req-123")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, expected 500", rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, expected %q", got, tt.contentType)
+			}
+			if strings.Contains(rec.Body.String(), "hunter2") || strings.Contains(rec.Body.String(), "goroutine") {
+				t.Errorf("body %q leaks the panic", rec.Body.String())
+			}
+			if tt.contentType == "application/json" {
+				var body struct {
+					Code      string   `json:"code"`
+					Errors    []string `json:"errors"`
+					RequestID string   `json:"request_id"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("decoding body %q: %v", rec.Body.String(), err)
+				}
+				if body.Code != "internal" || len(body.Errors) != 1 || body.RequestID != "req-123" {
+					t.Errorf("body = %+v, expected code internal, one message and request_id req-123", body)
+				}
+			}
+
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("decoding log entry %q: %v", buf.String(), err)
+			}
+			if entry["request_id"] != "req-123" {
+				t.Errorf("logged request_id = %v, expected req-123", entry["request_id"])
+			}
+			if stack, _ := entry["stack"].(string); !strings.Contains(stack, "TestRecoveryLogsPanicWithStack") {
+				t.Errorf("logged stack %q does not include the panicking handler", stack)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFrom(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"generated when absent", "", false},
+		{"incoming kept", "lb-7f3a.1_x", true},
+		{"unsafe incoming replaced", "abc\" level=ERROR", false},
+		{"overlong incoming replaced", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			header := rec.Header().Get(RequestIDHeader)
+			if header == "" || header != seen {
+				t.Fatalf("response ID %q, context ID %q: expected the same non-empty ID", header, seen)
+			}
+			if kept := header == tt.incoming; kept != tt.keep {
+				t.Errorf("ID = %q for incoming %q, expected kept = %v", header, tt.incoming, tt.keep)
+			}
+		})
+	}
+}
+
+func TestRecoveryMapsTypedPanics(t *testing.T) {
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	tests := []struct {
+		name           string
+		panicWith      any
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"bad request sentinel", fmt.Errorf("page %q: %w", "x", ErrBadRequest), http.StatusBadRequest, "invalid_request"},
+		{"validation errors", validation.ValidationErrors{{Field: "name", Message: "is required"}}, http.StatusBadRequest, "invalid_request"},
+		{"arbitrary error", fmt.Errorf("connection reset"), http.StatusInternalServerError, "internal"},
+		{"non-error value", "nil map", http.StatusInternalServerError, "internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Recovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic(tt.panicWith)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expectedStatus)
+			}
+			var body struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding body %q: %v", rec.Body.String(), err)
+			}
+			if body.Code != tt.expectedCode {
+				t.Errorf("code = %q, expected %q", body.Code, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestRequestAttrsReachHandlerLogs(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(slog.NewJSONHandler(&buf, nil))))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	rt := router.New()
+	rt.HandleFunc("GET /api/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		// No correlation attributes passed explicitly
+		slog.InfoContext(r.Context(), "loading user")
+	})
+	handler := RequestID(Logger(&config.Config{}, rt))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/7", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
+	req.Header.Set(RequestIDHeader, "req-42")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	if err := json.NewDecoder(&buf).Decode(&entry); err != nil {
+		t.Fatalf("decoding log entry: %v", err)
+	}
+	expected := map[string]string{
+		"msg":        "loading user",
+		"request_id": "req-42",
+		"client_ip":  "203.0.113.7",
+		"route":      "GET /api/users/{id}",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("%s = %v, expected %q", key, entry[key], value)
+		}
+	}
+}
+
+func TestSecurityHeadersSlimPaths(t *testing.T) {
+	handler := SecurityHeaders([]string{"/health", "/metrics"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		path       string
+		expectFull bool
+	}{
+		{"/", true},
+		{"/api/users/paginated", true},
+		{"/metrics", false},
+		{"/health/ready", false},
+		{"/healthz", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			for _, header := range []string{"Content-Security-Policy", "Strict-Transport-Security", "X-Frame-Options"} {
+				if got := rec.Header().Get(header) != ""; got != tt.expectFull {
+					t.Errorf("%s present = %v, expected %v", header, got, tt.expectFull)
+				}
+			}
+			if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q, expected nosniff on every path", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLoggedValueLength bounds each logged form value, in characters, so a pasted
+// document or a probe payload doesn't flood the logs
+const maxLoggedValueLength = 64
+
+// FormRedactor prepares form values for logging: fields whose names contain any of its
+// sensitive words are masked, and long values are truncated. A nil *FormRedactor masks
+// every value, so forgetting to configure one never leaks a secret.
+type FormRedactor struct {
+	words []string
+}
+
+// NewFormRedactor masks fields whose names contain any of words, case-insensitively,
+// so "password" also covers "new_password" and "token" covers "csrf_token"
+func NewFormRedactor(words []string) *FormRedactor {
+	fr := &FormRedactor{}
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			fr.words = append(fr.words, word)
+		}
+	}
+	return fr
+}
+
+// Redact returns a copy of form that is safe to log
+func (fr *FormRedactor) Redact(form url.Values) url.Values {
+	redactedForm := make(url.Values, len(form))
+	for field, values := range form {
+		masked := fr.sensitive(field)
+		copied := make([]string, len(values))
+		for i, value := range values {
+			if masked {
+				copied[i] = redacted
+			} else {
+				copied[i] = truncateForLog(value)
+			}
+		}
+		redactedForm[field] = copied
+	}
+	return redactedForm
+}
+
+// Form returns a log value for form that is redacted only if the record is actually
+// written, e.g. slog.Debug("...", "form", fr.Form(r.PostForm))
+func (fr *FormRedactor) Form(form url.Values) slog.LogValuer {
+	return redactedForm{redactor: fr, form: form}
+}
+
+// sensitive reports whether field must be masked
+func (fr *FormRedactor) sensitive(field string) bool {
+	if fr == nil {
+		return true
+	}
+	field = strings.ToLower(field)
+	for _, word := range fr.words {
+		if strings.Contains(field, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedForm defers redaction until slog resolves the value
+type redactedForm struct {
+	redactor *FormRedactor
+	form     url.Values
+}
+
+func (f redactedForm) LogValue() slog.Value {
+	form := f.redactor.Redact(f.form)
+	fields := make([]string, 0, len(form))
+	for field := range form {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, field := range fields {
+		attrs = append(attrs, slog.String(field, strings.Join(form[field], ", ")))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// truncateForLog shortens value to maxLoggedValueLength characters, noting how much
+// was dropped
+func truncateForLog(value string) string {
+	if utf8.RuneCountInString(value) <= maxLoggedValueLength {
+		return value
+	}
+	runes := []rune(value)
+	return string(runes[:maxLoggedValueLength]) + "…(" + strconv.Itoa(len(runes)-maxLoggedValueLength) + " more)"
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormRedactorRedact(t *testing.T) {
+	fr := NewFormRedactor([]string{"password", " Token ", "secret", ""})
+	long := strings.Repeat("é", maxLoggedValueLength+10)
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		expected url.Values
+	}{
+		{
+			name:     "ordinary fields kept",
+			form:     url.Values{"name": {"Ada"}, "email": {"ada@example.com"}},
+			expected: url.Values{"name": {"Ada"}, "email": {"ada@example.com"}},
+		},
+		{
+			name:     "listed fields masked",
+			form:     url.Values{"password": {"hunter2"}, "admin_secret": {"s3"}},
+			expected: url.Values{"password": {redacted}, "admin_secret": {redacted}},
+		},
+		{
+			name:     "names match case-insensitively and by substring",
+			form:     url.Values{"New_Password": {"a", "b"}, "csrf_token": {"abc"}},
+			expected: url.Values{"New_Password": {redacted, redacted}, "csrf_token": {redacted}},
+		},
+		{
+			name:     "long values truncated by character",
+			form:     url.Values{"bio": {long}},
+			expected: url.Values{"bio": {strings.Repeat("é", maxLoggedValueLength) + "…(10 more)"}},
+		},
+		{
+			name:     "empty form",
+			form:     url.Values{},
+			expected: url.Values{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := url.Values{}
+			for k, v := range tt.form {
+				original[k] = append([]string(nil), v...)
+			}
+			if result := fr.Redact(tt.form); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Redact() = %v, expected %v", result, tt.expected)
+			}
+			if !reflect.DeepEqual(tt.form, original) {
+				t.Errorf("Redact() modified its input to %v", tt.form)
+			}
+		})
+	}
+}
+
+func TestNilFormRedactorMasksEverything(t *testing.T) {
+	var fr *FormRedactor
+	result := fr.Redact(url.Values{"name": {"Ada"}})
+	if result.Get("name") != redacted {
+		t.Errorf("nil redactor logged name = %q, expected it masked", result.Get("name"))
+	}
+}
+
+func TestFormRedactorLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	fr := NewFormRedactor([]string{"password"})
+
+	logger.Info("login failed", "form", fr.Form(url.Values{"user": {"ada"}, "password": {"hunter2"}}))
+
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("log line %q contains the password", buf.String())
+	}
+	if !strings.Contains(buf.String(), "form.user=ada") || !strings.Contains(buf.String(), "form.password="+redacted) {
+		t.Errorf("log line %q, expected form.user and a masked form.password", buf.String())
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Trailing slash modes accepted by TrailingSlash
+const (
+	// TrailingSlashRedirect redirects to the path without its trailing slash
+	TrailingSlashRedirect = "redirect"
+	// TrailingSlashRewrite routes the request as if it had no trailing slash
+	TrailingSlashRewrite = "rewrite"
+	// TrailingSlashOff leaves paths alone
+	TrailingSlashOff = "off"
+)
+
+// TrailingSlash makes "/counter/" reach the same route as "/counter". In redirect mode
+// the client is sent to the canonical path, with 301 for GET and HEAD and 308 for
+// everything else so the method and body survive; in rewrite mode the request is
+// routed as if it had no trailing slash. The root path and paths under the exempt
+// prefixes, such as the /static/ file server, are passed through unchanged.
+func TrailingSlash(mode string, exempt []string, next http.Handler) http.Handler {
+	if mode != TrailingSlashRedirect && mode != TrailingSlashRewrite {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		// Paths starting with "//" are left for ServeMux to clean, since redirecting
+		// to one would send the client to another host
+		if path == "/" || !strings.HasSuffix(path, "/") || strings.HasPrefix(path, "//") || matchesPathPrefix(path, exempt) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		canonical := strings.TrimRight(path, "/")
+
+		if mode == TrailingSlashRedirect {
+			target := strings.TrimRight(r.URL.EscapedPath(), "/")
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			status := http.StatusPermanentRedirect
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				status = http.StatusMovedPermanently
+			}
+			http.Redirect(w, r, target, status)
+			return
+		}
+
+		// Shallow copies, as http.StripPrefix makes, leave the caller's request intact
+		rewritten := new(http.Request)
+		*rewritten = *r
+		rewritten.URL = new(url.URL)
+		*rewritten.URL = *r.URL
+		rewritten.URL.Path = canonical
+		rewritten.URL.RawPath = strings.TrimRight(r.URL.RawPath, "/")
+		next.ServeHTTP(w, rewritten)
+	})
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrailingSlash(t *testing.T) {
+	exempt := []string{"/static"}
+
+	tests := []struct {
+		name             string
+		mode             string
+		method           string
+		target           string
+		expectedStatus   int
+		expectedLocation string
+		expectedPath     string
+	}{
+		{"redirect get", TrailingSlashRedirect, http.MethodGet, "/counter/", http.StatusMovedPermanently, "/counter", ""},
+		{"redirect keeps query", TrailingSlashRedirect, http.MethodGet, "/api/users/?page=2", http.StatusMovedPermanently, "/api/users?page=2", ""},
+		{"redirect post keeps method", TrailingSlashRedirect, http.MethodPost, "/counter/increment/", http.StatusPermanentRedirect, "/counter/increment", ""},
+		{"redirect keeps escaping", TrailingSlashRedirect, http.MethodGet, "/a%20b/", http.StatusMovedPermanently, "/a%20b", ""},
+		{"redirect collapses repeated slashes", TrailingSlashRedirect, http.MethodGet, "/counter//", http.StatusMovedPermanently, "/counter", ""},
+		{"rewrite", TrailingSlashRewrite, http.MethodGet, "/counter/", http.StatusOK, "", "/counter"},
+		{"canonical path untouched", TrailingSlashRedirect, http.MethodGet, "/counter", http.StatusOK, "", "/counter"},
+		{"root untouched", TrailingSlashRedirect, http.MethodGet, "/", http.StatusOK, "", "/"},
+		{"static file untouched", TrailingSlashRedirect, http.MethodGet, "/static/foo", http.StatusOK, "", "/static/foo"},
+		{"static directory untouched", TrailingSlashRewrite, http.MethodGet, "/static/css/", http.StatusOK, "", "/static/css/"},
+		{"protocol-relative path left to the mux", TrailingSlashRedirect, http.MethodGet, "//evil.example/", http.StatusOK, "", "//evil.example/"},
+		{"off", TrailingSlashOff, http.MethodGet, "/counter/", http.StatusOK, "", "/counter/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var routedPath string
+			handler := TrailingSlash(tt.mode, exempt, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				routedPath = r.URL.Path
+			}))
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expectedStatus)
+			}
+			if location := rec.Header().Get("Location"); location != tt.expectedLocation {
+				t.Errorf("Location = %q, expected %q", location, tt.expectedLocation)
+			}
+			if routedPath != tt.expectedPath {
+				t.Errorf("routed path = %q, expected %q", routedPath, tt.expectedPath)
+			}
+		})
+	}
+}
+
+func TestTrailingSlashRewriteLeavesRequestIntact(t *testing.T) {
+	handler := TrailingSlash(TrailingSlashRewrite, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/counter/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if req.URL.Path != "/counter/" {
+		t.Errorf("caller's request path changed to %q", req.URL.Path)
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import "context"
+
+type userIDKey struct{}
+
+// WithUserID returns a copy of ctx identifying the authenticated user. Authentication
+// middleware calls it once it has verified a session, so later middleware such as
+// RateLimit can tell users apart.
+func WithUserID(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, userIDKey{}, id)
+}
+
+// UserID returns the authenticated user's ID, or false for an anonymous request
+func UserID(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(userIDKey{}).(int)
+	return id, ok
+}
@@ -0,0 +1,136 @@
+// Package router wraps http.ServeMux so every registered route is recorded and can be
+// introspected at runtime, e.g. by the debug routes endpoint.
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"htmx-learn/logging"
+)
+
+// Route describes a single registered route
+type Route struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Pattern string `json:"pattern"`
+}
+
+// Router records route registrations while delegating matching to http.ServeMux
+type Router struct {
+	// NotFound, if set, answers requests that match no route in place of ServeMux's
+	// plain text 404. Routes that match and then 404 themselves, such as a file server
+	// missing a file, are unaffected. Set it before serving.
+	NotFound http.Handler
+	// MethodNotAllowed, if set, answers requests for a known path with a method none of
+	// its routes accept, in place of ServeMux's plain text 405. The Allow header listing
+	// the path's methods is already set when it runs. Set it before serving.
+	MethodNotAllowed http.Handler
+
+	mux    *http.ServeMux
+	mu     sync.RWMutex
+	routes []Route
+}
+
+// New creates an empty router
+func New() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+// Handle registers the handler for the given ServeMux pattern and records the route.
+// The pattern is logged as "route" with everything logged for the requests it serves.
+func (rt *Router) Handle(pattern string, handler http.Handler) {
+	rt.mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.SetAttr(r.Context(), "route", pattern)
+		handler.ServeHTTP(w, r)
+	}))
+
+	rt.mu.Lock()
+	rt.routes = append(rt.routes, parsePattern(pattern))
+	rt.mu.Unlock()
+}
+
+// HandleFunc registers the handler function for the given ServeMux pattern
+func (rt *Router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	rt.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// Routes returns the registered routes sorted by path and method
+func (rt *Router) Routes() []Route {
+	rt.mu.RLock()
+	routes := make([]Route, len(rt.routes))
+	copy(routes, rt.routes)
+	rt.mu.RUnlock()
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// ServeHTTP dispatches the request to the matching registered handler, or to NotFound
+// or MethodNotAllowed when no route matches
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rt.NotFound != nil || rt.MethodNotAllowed != nil {
+		// ServeMux reports no pattern for both unknown paths and known paths requested
+		// with the wrong method; its own response tells the two apart
+		if handler, pattern := rt.mux.Handler(r); pattern == "" {
+			probe := probeResponse(handler, r)
+			switch {
+			case probe.status == http.StatusNotFound && rt.NotFound != nil:
+				rt.NotFound.ServeHTTP(w, r)
+				return
+			case probe.status == http.StatusMethodNotAllowed && rt.MethodNotAllowed != nil:
+				w.Header().Set("Allow", probe.header.Get("Allow"))
+				rt.MethodNotAllowed.ServeHTTP(w, r)
+				return
+			}
+		}
+	}
+	rt.mux.ServeHTTP(w, r)
+}
+
+// probeResponse runs one of ServeMux's own error handlers against a discarding writer
+// and returns the status and headers it answered with
+func probeResponse(handler http.Handler, r *http.Request) *statusProbe {
+	probe := &statusProbe{header: make(http.Header), status: http.StatusOK}
+	handler.ServeHTTP(probe, r)
+	return probe
+}
+
+// statusProbe is a ResponseWriter that records the status code and headers and
+// discards the body
+type statusProbe struct {
+	header http.Header
+	status int
+	wrote  bool
+}
+
+func (p *statusProbe) Header() http.Header { return p.header }
+
+func (p *statusProbe) Write(b []byte) (int, error) {
+	p.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
+
+func (p *statusProbe) WriteHeader(status int) {
+	if !p.wrote {
+		p.status, p.wrote = status, true
+	}
+}
+
+// parsePattern splits a "[METHOD ][HOST]/PATH" pattern into its parts.
+// An empty method means the route matches every method.
+func parsePattern(pattern string) Route {
+	route := Route{Pattern: pattern, Path: pattern}
+	if method, path, found := strings.Cut(pattern, " "); found {
+		route.Method = method
+		route.Path = strings.TrimLeft(path, " \t")
+	}
+	return route
+}
@@ -0,0 +1,125 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		method  string
+		path    string
+	}{
+		{pattern: "GET /api/users", method: "GET", path: "/api/users"},
+		{pattern: "DELETE   /api/users/{id}", method: "DELETE", path: "/api/users/{id}"},
+		{pattern: "/static/", method: "", path: "/static/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			route := parsePattern(tt.pattern)
+			if route.Method != tt.method {
+				t.Errorf("Method = %q, expected %q", route.Method, tt.method)
+			}
+			if route.Path != tt.path {
+				t.Errorf("Path = %q, expected %q", route.Path, tt.path)
+			}
+			if route.Pattern != tt.pattern {
+				t.Errorf("Pattern = %q, expected %q", route.Pattern, tt.pattern)
+			}
+		})
+	}
+}
+
+func TestRouterRecordsRoutes(t *testing.T) {
+	rt := New()
+	rt.HandleFunc("POST /b", func(w http.ResponseWriter, r *http.Request) {})
+	rt.HandleFunc("GET /b", func(w http.ResponseWriter, r *http.Request) {})
+	rt.HandleFunc("GET /a", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	routes := rt.Routes()
+	expected := []string{"GET /a", "GET /b", "POST /b"}
+	if len(routes) != len(expected) {
+		t.Fatalf("got %d routes, expected %d", len(routes), len(expected))
+	}
+	for i, pattern := range expected {
+		if routes[i].Pattern != pattern {
+			t.Errorf("routes[%d] = %q, expected %q", i, routes[i].Pattern, pattern)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	rt.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/a", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("status = %d, expected routed handler to answer", rec.Code)
+	}
+}
+
+func TestRouterNotFound(t *testing.T) {
+	rt := New()
+	rt.HandleFunc("GET /known", func(w http.ResponseWriter, r *http.Request) {})
+	rt.HandleFunc("GET /files/", http.NotFound)
+	rt.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		expected int
+	}{
+		{"unknown path", http.MethodGet, "/bogus", http.StatusTeapot},
+		{"known path", http.MethodGet, "/known", http.StatusOK},
+		{"wrong method is not a 404", http.MethodPost, "/known", http.StatusMethodNotAllowed},
+		{"matched route's own 404", http.MethodGet, "/files/missing.txt", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rt.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.expected {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	rt := New()
+	rt.HandleFunc("GET /items", func(w http.ResponseWriter, r *http.Request) {})
+	rt.HandleFunc("POST /items", func(w http.ResponseWriter, r *http.Request) {})
+	rt.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		expected      int
+		expectedAllow string
+	}{
+		{"wrong method", http.MethodDelete, "/items", http.StatusTeapot, "GET, HEAD, POST"},
+		{"allowed method", http.MethodPost, "/items", http.StatusOK, ""},
+		{"unknown path without NotFound", http.MethodDelete, "/other", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rt.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.expected {
+				t.Errorf("status = %d, expected %d", rec.Code, tt.expected)
+			}
+			if allow := rec.Header().Get("Allow"); allow != tt.expectedAllow {
+				t.Errorf("Allow = %q, expected %q", allow, tt.expectedAllow)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Package static holds the application's static assets. They are embedded in the
+// binary so deployments are self-contained, and can be served from disk instead
+// while developing so edited assets show up without a rebuild.
+package static
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:embed css favicon.ico
+var embedded embed.FS
+
+// Favicon is the site icon served at /favicon.ico
+//
+//go:embed favicon.ico
+var Favicon []byte
+
+// FS returns the embedded assets, or the on-disk directory dir when fromDisk is set
+func FS(fromDisk bool, dir string) fs.FS {
+	if fromDisk {
+		return os.DirFS(dir)
+	}
+	return embedded
+}
+
+// handler serves files with caching headers and content-hash ETags
+type handler struct {
+	fsys         fs.FS
+	files        http.Handler
+	cacheControl string
+	// etags holds precomputed hashes for immutable assets; nil means hash per request
+	etags map[string]string
+}
+
+// Handler serves fsys with a strong ETag derived from each file's content, so
+// http.FileServer answers matching If-None-Match requests with 304. Immutable
+// assets (the embedded ones) are hashed once up front and cached for maxAge;
+// otherwise files are hashed per request and must be revalidated, so edits on
+// disk are picked up immediately. Mount it under /static/ with http.StripPrefix.
+func Handler(fsys fs.FS, maxAge time.Duration, immutable bool) http.Handler {
+	h := &handler{
+		fsys:         fsys,
+		files:        http.FileServerFS(fsys),
+		cacheControl: "no-cache",
+	}
+
+	if immutable {
+		h.cacheControl = fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+		h.etags = make(map[string]string)
+		fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if etag, err := hashFile(fsys, name); err == nil {
+				h.etags[name] = etag
+			}
+			return nil
+		})
+	}
+
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+	etag, ok := h.etags[name]
+	if !ok {
+		// Directories and missing files fail to hash and are left to the file server
+		etag, _ = hashFile(h.fsys, name)
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", h.cacheControl)
+	}
+
+	h.files.ServeHTTP(w, r)
+}
+
+// hashFile returns a strong ETag for the named file's content
+func hashFile(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", name)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return `"` + base64.RawURLEncoding.EncodeToString(hash.Sum(nil)) + `"`, nil
+}
+
+// IndexFile is the page served for unknown paths when the SPA fallback is enabled
+const IndexFile = "index.html"
+
+// IndexFallback serves IndexFile from fsys regardless of the request path, so
+// client-side routes survive a refresh or deep link. The file is read on every
+// request and always revalidated, keeping on-disk edits visible.
+func IndexFallback(fsys fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, err := fs.ReadFile(fsys, IndexFile)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(page)
+	})
+}
@@ -0,0 +1,117 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeAsset creates css/input.css with content under dir
+func writeAsset(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, "css"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "css", "input.css"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func serve(h http.Handler, target, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	http.StripPrefix("/static/", h).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerServesEmbeddedOrDisk(t *testing.T) {
+	dir := t.TempDir()
+	writeAsset(t, dir, "/* edited */")
+
+	embedded := serve(Handler(FS(false, dir), time.Hour, true), "/static/css/input.css", "")
+	if embedded.Code != http.StatusOK || embedded.Body.Len() == 0 || embedded.Body.String() == "/* edited */" {
+		t.Errorf("embedded: status %d, body %q", embedded.Code, embedded.Body.String())
+	}
+
+	disk := serve(Handler(FS(true, dir), time.Hour, false), "/static/css/input.css", "")
+	if disk.Code != http.StatusOK || disk.Body.String() != "/* edited */" {
+		t.Errorf("disk: status %d, body %q", disk.Code, disk.Body.String())
+	}
+}
+
+func TestHandlerCaching(t *testing.T) {
+	t.Run("immutable assets", func(t *testing.T) {
+		h := Handler(FS(false, ""), 24*time.Hour, true)
+
+		first := serve(h, "/static/css/input.css", "")
+		etag := first.Header().Get("ETag")
+		if etag == "" {
+			t.Fatal("missing ETag")
+		}
+		if cc := first.Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+			t.Errorf("Cache-Control = %q", cc)
+		}
+
+		revalidated := serve(h, "/static/css/input.css", etag)
+		if revalidated.Code != http.StatusNotModified {
+			t.Errorf("status = %d with matching If-None-Match, expected 304", revalidated.Code)
+		}
+
+		stale := serve(h, "/static/css/input.css", `"stale"`)
+		if stale.Code != http.StatusOK {
+			t.Errorf("status = %d with stale If-None-Match, expected 200", stale.Code)
+		}
+	})
+
+	t.Run("disk assets are rehashed on change", func(t *testing.T) {
+		dir := t.TempDir()
+		writeAsset(t, dir, "a {}")
+		h := Handler(FS(true, dir), time.Hour, false)
+
+		first := serve(h, "/static/css/input.css", "")
+		if cc := first.Header().Get("Cache-Control"); cc != "no-cache" {
+			t.Errorf("Cache-Control = %q, expected no-cache", cc)
+		}
+
+		writeAsset(t, dir, "b {}")
+		second := serve(h, "/static/css/input.css", first.Header().Get("ETag"))
+		if second.Code != http.StatusOK || second.Body.String() != "b {}" {
+			t.Errorf("status = %d, body %q after edit, expected fresh content", second.Code, second.Body.String())
+		}
+	})
+
+	t.Run("missing files get no ETag", func(t *testing.T) {
+		rec := serve(Handler(FS(false, ""), time.Hour, true), "/static/css/missing.css", "")
+		if rec.Code != http.StatusNotFound || rec.Header().Get("ETag") != "" {
+			t.Errorf("status = %d, ETag %q", rec.Code, rec.Header().Get("ETag"))
+		}
+	})
+}
+
+func TestIndexFallback(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, IndexFile), []byte("<main id=app></main>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	IndexFallback(FS(true, dir)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/some/client/route", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "<main id=app></main>" {
+		t.Errorf("status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control = %q, expected no-cache", got)
+	}
+
+	missing := httptest.NewRecorder()
+	IndexFallback(FS(true, t.TempDir())).ServeHTTP(missing, httptest.NewRequest(http.MethodGet, "/anything", nil))
+	if missing.Code != http.StatusNotFound {
+		t.Errorf("missing index: status %d, expected 404", missing.Code)
+	}
+}
@@ -0,0 +1,86 @@
+package validation
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// fuzzSeeds are the inputs of the hand-written table tests, plus a few of the
+// multibyte and control character edge cases the fuzzers start mutating from
+var fuzzSeeds = []string{
+	"John Doe",
+	"",
+	"   ",
+	"John<script>",
+	"Hello\x00World",
+	"Jose\u0301",
+	"Ad\u200dmin\u200b",
+	"علی\u200cرضا",
+	"क्\u200dष",
+	"\u202eevil\x07",
+	"John\tDoe",
+	"山田 太郎",
+	"Jean\u00a0Luc",
+	"P\u0430ypal",
+	strings.Repeat("a", 101),
+	"\xff\xfe",
+}
+
+func FuzzSanitizeInput(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		result := SanitizeInput(input)
+
+		if strings.Contains(result, "\x00") {
+			t.Errorf("SanitizeInput(%q) = %q contains a null byte", input, result)
+		}
+		if strings.TrimSpace(result) != result {
+			t.Errorf("SanitizeInput(%q) = %q has surrounding whitespace", input, result)
+		}
+		if containsInvisible(result) {
+			t.Errorf("SanitizeInput(%q) = %q contains invisible characters", input, result)
+		}
+		if again := SanitizeInput(result); again != result {
+			t.Errorf("SanitizeInput is not idempotent: %q became %q, then %q", input, result, again)
+		}
+	})
+}
+
+func FuzzValidateUser(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed, "john@example.com")
+	}
+	f.Add("John Doe", "not-an-email")
+	f.Add("John Doe", strings.Repeat("a", 250)+"@example.com")
+	f.Add("John Doe", "a\x00b@example.com")
+
+	f.Fuzz(func(t *testing.T, name, email string) {
+		if err := ValidateUser(UserInput{Name: name, Email: email}); err != nil {
+			return
+		}
+
+		name = strings.TrimSpace(name)
+		if strings.ContainsAny(name, "<>\"'&") || containsInvisible(name) {
+			t.Errorf("accepted name %q contains forbidden characters", name)
+		}
+		if n := utf8.RuneCountInString(name); n < minNameLength || n > maxNameLength {
+			t.Errorf("accepted name %q has %d characters", name, n)
+		}
+		if mixesConfusableScripts(name) {
+			t.Errorf("accepted name %q mixes confusable scripts", name)
+		}
+
+		email = strings.TrimSpace(email)
+		if len(email) > maxEmailLength {
+			t.Errorf("accepted email %q is %d bytes", email, len(email))
+		}
+		if _, err := mail.ParseAddress(email); err != nil {
+			t.Errorf("accepted email %q doesn't parse: %v", email, err)
+		}
+	})
+}
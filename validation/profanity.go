@@ -0,0 +1,123 @@
+package validation
+
+import (
+	_ "embed"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+//go:embed profanity.txt
+var defaultProfanityList string
+
+var (
+	profanityFilterEnabled atomic.Bool
+
+	profanityMu        sync.RWMutex
+	profanityWords     = map[string]bool{}
+	profanityCollapsed = map[string]bool{}
+)
+
+func init() {
+	SetProfanityWords(ParseWordList(defaultProfanityList))
+}
+
+// leetReplacer undoes the most common character substitutions used to dodge filters
+var leetReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "!", "i", "3", "e", "4", "a",
+	"@", "a", "5", "s", "$", "s", "7", "t", "8", "b",
+)
+
+// EnableProfanityFilter toggles rejection of offensive user names in ValidateUser
+func EnableProfanityFilter(enabled bool) {
+	profanityFilterEnabled.Store(enabled)
+}
+
+// ParseWordList parses a newline-separated word list, ignoring blank lines and # comments
+func ParseWordList(list string) []string {
+	var words []string
+	for _, line := range strings.Split(list, "\n") {
+		word := strings.ToLower(strings.TrimSpace(line))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words = append(words, word)
+	}
+	return words
+}
+
+// SetProfanityWords replaces the word list used by the profanity filter
+func SetProfanityWords(words []string) {
+	exact := make(map[string]bool, len(words))
+	collapsed := make(map[string]bool, len(words))
+	for _, word := range words {
+		word = strings.ToLower(word)
+		exact[word] = true
+		collapsed[collapseRepeats(word)] = true
+	}
+
+	profanityMu.Lock()
+	profanityWords = exact
+	profanityCollapsed = collapsed
+	profanityMu.Unlock()
+}
+
+// validateProfanity rejects names containing a listed word, including lightly
+// obfuscated forms such as "sh1t", "shiiit" or "s.h.i.t"
+func validateProfanity(name string) error {
+	profanityMu.RLock()
+	defer profanityMu.RUnlock()
+
+	normalized := leetReplacer.Replace(strings.ToLower(name))
+	tokens := strings.FieldsFunc(normalized, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	// Letters spelled out one at a time ("f u c k", "f.u.c.k") are joined back together
+	var spelled strings.Builder
+	for _, token := range tokens {
+		if len([]rune(token)) == 1 {
+			spelled.WriteString(token)
+			continue
+		}
+		if isProfane(spelled.String()) || isProfane(token) {
+			return errors.New("name contains inappropriate language")
+		}
+		spelled.Reset()
+	}
+	if isProfane(spelled.String()) {
+		return errors.New("name contains inappropriate language")
+	}
+
+	return nil
+}
+
+// isProfane reports whether a single normalized token is on the word list. Collapsed
+// matching only applies to tokens with repeated letters so short legitimate names
+// aren't flagged by a word that merely collapses to them.
+func isProfane(token string) bool {
+	if token == "" {
+		return false
+	}
+	if profanityWords[token] {
+		return true
+	}
+	collapsed := collapseRepeats(token)
+	return collapsed != token && profanityCollapsed[collapsed]
+}
+
+// collapseRepeats squashes runs of the same letter, turning "shiiit" into "shit"
+func collapseRepeats(s string) string {
+	var sb strings.Builder
+	var last rune
+	for i, r := range s {
+		if i > 0 && r == last {
+			continue
+		}
+		sb.WriteRune(r)
+		last = r
+	}
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package validation
+
+import (
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeUnicode composes text into NFC, so visually identical names built from
+// precomposed or combining characters are stored the same way, and strips invisible
+// characters that could hide differences between otherwise identical names
+func normalizeUnicode(input string) string {
+	runes := []rune(input)
+	kept := runes[:0:0]
+	for i, r := range runes {
+		if !invisibleAt(runes, i) {
+			kept = append(kept, r)
+		}
+	}
+	return norm.NFC.String(string(kept))
+}
+
+// isInvisible reports control characters other than whitespace, and formatting
+// characters such as zero-width spaces and joiners or bidirectional overrides
+func isInvisible(r rune) bool {
+	return (unicode.IsControl(r) && !unicode.IsSpace(r)) || unicode.Is(unicode.Cf, r)
+}
+
+// The zero-width non-joiner and joiner
+const (
+	zwnj = '\u200c'
+	zwj  = '\u200d'
+)
+
+// joiningScripts are scripts whose spelling uses ZWNJ and ZWJ between letters, such
+// as the ZWNJ in Persian "می‌خواهم" or a ZWJ selecting a Devanagari half form
+var joiningScripts = []*unicode.RangeTable{
+	unicode.Arabic, unicode.Devanagari, unicode.Bengali, unicode.Gurmukhi, unicode.Gujarati,
+	unicode.Oriya, unicode.Tamil, unicode.Telugu, unicode.Kannada, unicode.Malayalam, unicode.Sinhala,
+}
+
+// invisibleAt reports whether runes[i] is invisible. A ZWNJ or ZWJ between two letters
+// (or marks, such as a virama) of a joining script is part of the spelling and is not;
+// anywhere else, including between Latin letters, it only hides differences.
+func invisibleAt(runes []rune, i int) bool {
+	r := runes[i]
+	if !isInvisible(r) {
+		return false
+	}
+	if r != zwnj && r != zwj {
+		return true
+	}
+	return i == 0 || i == len(runes)-1 || !isJoiningLetter(runes[i-1]) || !isJoiningLetter(runes[i+1])
+}
+
+// isJoiningLetter reports whether r is a letter or mark of a joining script
+func isJoiningLetter(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsMark(r)) && unicode.In(r, joiningScripts...)
+}
+
+// containsInvisible reports whether s has a character normalizeUnicode would strip
+func containsInvisible(s string) bool {
+	runes := []rune(s)
+	for i := range runes {
+		if invisibleAt(runes, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// confusableScripts are scripts with many letters that look alike, such as Latin "a"
+// and Cyrillic "а". A single name should never need letters from more than one.
+var confusableScripts = []*unicode.RangeTable{unicode.Latin, unicode.Cyrillic, unicode.Greek}
+
+// mixesConfusableScripts reports whether name combines letters from more than one
+// confusable script, the usual sign of homoglyph spoofing. Other combinations, such
+// as Han with Hiragana or Latin with Hangul, are left alone.
+func mixesConfusableScripts(name string) bool {
+	var seen *unicode.RangeTable
+	for _, r := range name {
+		for _, script := range confusableScripts {
+			if !unicode.Is(script, r) {
+				continue
+			}
+			if seen != nil && seen != script {
+				return true
+			}
+			seen = script
+		}
+	}
+	return false
+}
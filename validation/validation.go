@@ -2,9 +2,9 @@
 package validation
 
 import (
-	"errors"
 	"net/mail"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -12,6 +12,9 @@ const (
 	maxNameLength  = 100
 	maxEmailLength = 254
 	minNameLength  = 1
+
+	// MaxSearchLength bounds search queries, in characters
+	MaxSearchLength = 256
 )
 
 // ValidationError represents a validation error with field-specific information
@@ -35,25 +38,32 @@ func (ve ValidationErrors) Error() string {
 	return strings.Join(messages, "; ")
 }
 
+// ToMap returns the messages keyed by field so clients can show each one next to its
+// input. A field with several errors gets its messages joined with "; ".
+func (ve ValidationErrors) ToMap() map[string]string {
+	fields := make(map[string]string, len(ve))
+	for _, err := range ve {
+		if existing, ok := fields[err.Field]; ok {
+			fields[err.Field] = existing + "; " + err.Message
+			continue
+		}
+		fields[err.Field] = err.Message
+	}
+	return fields
+}
+
 // UserInput represents user input data for validation
 type UserInput struct {
 	Name  string
 	Email string
 }
 
-// ValidateUser validates user input and returns any validation errors
+// ValidateUser validates user input and returns every failing rule, so a field can
+// appear more than once in the returned ValidationErrors
 func ValidateUser(input UserInput) error {
 	var errors ValidationErrors
-
-	// Validate name
-	if nameErr := validateName(input.Name); nameErr != nil {
-		errors = append(errors, ValidationError{Field: "name", Message: nameErr.Error()})
-	}
-
-	// Validate email
-	if emailErr := validateEmail(input.Email); emailErr != nil {
-		errors = append(errors, ValidationError{Field: "email", Message: emailErr.Error()})
-	}
+	errors = append(errors, validateName(input.Name)...)
+	errors = append(errors, validateEmail(input.Email)...)
 
 	if len(errors) > 0 {
 		return errors
@@ -62,55 +72,114 @@ func ValidateUser(input UserInput) error {
 	return nil
 }
 
-// validateName validates the name field
-func validateName(name string) error {
+// validateName validates the name field. A missing name is reported alone; otherwise
+// each failing rule adds its own error.
+func validateName(name string) ValidationErrors {
 	name = strings.TrimSpace(name)
 
 	if len(name) == 0 {
-		return errors.New("name is required")
+		return ValidationErrors{{Field: "name", Message: "name is required"}}
+	}
+
+	var errs ValidationErrors
+	fail := func(message string) {
+		errs = append(errs, ValidationError{Field: "name", Message: message})
 	}
 
 	if utf8.RuneCountInString(name) < minNameLength {
-		return errors.New("name is too short")
+		fail("name is too short")
 	}
 
 	if utf8.RuneCountInString(name) > maxNameLength {
-		return errors.New("name is too long (max 100 characters)")
+		fail("name is too long (max 100 characters)")
 	}
 
-	// Check for potentially harmful characters (basic XSS prevention)
-	if strings.ContainsAny(name, "<>\"'&") {
-		return errors.New("name contains invalid characters")
+	// Check for potentially harmful characters (basic XSS prevention) and invisible
+	// ones that survive when the input wasn't sanitized
+	if strings.ContainsAny(name, "<>\"'&") || containsInvisible(name) {
+		fail("name contains invalid characters")
 	}
 
-	return nil
+	if mixesConfusableScripts(name) {
+		fail("name mixes letters from different alphabets")
+	}
+
+	if profanityFilterEnabled.Load() {
+		if err := validateProfanity(name); err != nil {
+			fail(err.Error())
+		}
+	}
+
+	return errs
 }
 
-// validateEmail validates the email field
-func validateEmail(email string) error {
+// validateEmail validates the email field. A missing email is reported alone;
+// otherwise each failing rule adds its own error.
+func validateEmail(email string) ValidationErrors {
 	email = strings.TrimSpace(email)
 
 	if len(email) == 0 {
-		return errors.New("email is required")
+		return ValidationErrors{{Field: "email", Message: "email is required"}}
+	}
+
+	var errs ValidationErrors
+	fail := func(message string) {
+		errs = append(errs, ValidationError{Field: "email", Message: message})
 	}
 
 	if len(email) > maxEmailLength {
-		return errors.New("email is too long (max 254 characters)")
+		fail("email is too long (max 254 characters)")
 	}
 
 	// Use Go's built-in email validation
 	if _, err := mail.ParseAddress(email); err != nil {
-		return errors.New("email format is invalid")
+		fail("email format is invalid")
 	}
 
-	return nil
+	return errs
 }
 
-// SanitizeInput sanitizes string input by trimming whitespace and removing null bytes
+// SanitizeInput sanitizes string input by trimming whitespace, removing null bytes
+// and invisible characters, and normalizing Unicode to NFC
 func SanitizeInput(input string) string {
 	// Remove null bytes that could cause issues
 	input = strings.ReplaceAll(input, "\x00", "")
+	input = normalizeUnicode(input)
 	// Trim whitespace
 	return strings.TrimSpace(input)
 }
 
+// NormalizeName sanitizes a display name and collapses each internal run of
+// whitespace, such as repeated spaces, tabs or newlines, into a single space.
+// Non-breaking spaces are kept since they deliberately join parts of a name.
+func NormalizeName(name string) string {
+	var b strings.Builder
+	inSpace := false
+	for _, r := range SanitizeInput(name) {
+		if unicode.IsSpace(r) && !isNonBreakingSpace(r) {
+			inSpace = true
+			continue
+		}
+		if inSpace {
+			b.WriteByte(' ')
+			inSpace = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isNonBreakingSpace reports the no-break spaces, which are whitespace to unicode.IsSpace
+func isNonBreakingSpace(r rune) bool {
+	return r == '\u00a0' || r == '\u2007' || r == '\u202f'
+}
+
+// SanitizeSearchQuery sanitizes a search query and truncates it to MaxSearchLength
+// characters, so an oversized query can't be sent to the database as a pattern
+func SanitizeSearchQuery(query string) string {
+	query = SanitizeInput(query)
+	if utf8.RuneCountInString(query) <= MaxSearchLength {
+		return query
+	}
+	return strings.TrimSpace(string([]rune(query)[:MaxSearchLength]))
+}
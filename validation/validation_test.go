@@ -76,6 +76,184 @@ func TestValidateUser(t *testing.T) {
 	}
 }
 
+func TestValidateUserReportsEveryFailure(t *testing.T) {
+	EnableProfanityFilter(true)
+	t.Cleanup(func() { EnableProfanityFilter(false) })
+
+	tests := []struct {
+		name     string
+		input    UserInput
+		expected []ValidationError
+	}{
+		{
+			name:  "name too long with invalid characters",
+			input: UserInput{Name: strings.Repeat("a", 101) + "<b>", Email: "john@example.com"},
+			expected: []ValidationError{
+				{Field: "name", Message: "name is too long (max 100 characters)"},
+				{Field: "name", Message: "name contains invalid characters"},
+			},
+		},
+		{
+			name:  "invalid characters and profanity",
+			input: UserInput{Name: "sh1t <head>", Email: "john@example.com"},
+			expected: []ValidationError{
+				{Field: "name", Message: "name contains invalid characters"},
+				{Field: "name", Message: "name contains inappropriate language"},
+			},
+		},
+		{
+			name:  "email too long and malformed",
+			input: UserInput{Name: "John Doe", Email: strings.Repeat("a", 260)},
+			expected: []ValidationError{
+				{Field: "email", Message: "email is too long (max 254 characters)"},
+				{Field: "email", Message: "email format is invalid"},
+			},
+		},
+		{
+			name:  "both fields with several problems",
+			input: UserInput{Name: "<" + strings.Repeat("a", 100), Email: strings.Repeat("a", 260)},
+			expected: []ValidationError{
+				{Field: "name", Message: "name is too long (max 100 characters)"},
+				{Field: "name", Message: "name contains invalid characters"},
+				{Field: "email", Message: "email is too long (max 254 characters)"},
+				{Field: "email", Message: "email format is invalid"},
+			},
+		},
+		{
+			name:  "missing fields are reported once each",
+			input: UserInput{Name: " ", Email: ""},
+			expected: []ValidationError{
+				{Field: "name", Message: "name is required"},
+				{Field: "email", Message: "email is required"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateUser(tt.input)
+
+			errs, ok := err.(ValidationErrors)
+			if !ok {
+				t.Fatalf("ValidateUser() error = %v, expected ValidationErrors", err)
+			}
+			if len(errs) != len(tt.expected) {
+				t.Fatalf("ValidateUser() = %v, expected %v", errs, tt.expected)
+			}
+			for i, want := range tt.expected {
+				if errs[i] != want {
+					t.Errorf("error %d = %+v, expected %+v", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"already tidy", "John Doe", "John Doe"},
+		{"multiple spaces", "John    Doe", "John Doe"},
+		{"tabs", "John\t\tDoe", "John Doe"},
+		{"newlines", "John\r\n\nDoe", "John Doe"},
+		{"mixed whitespace", " Mary \t Ann\n Smith ", "Mary Ann Smith"},
+		{"non-breaking space kept", "Jean\u00a0Paul  Sartre", "Jean\u00a0Paul Sartre"},
+		{"narrow non-breaking space kept", "Dr.\u202fWho", "Dr.\u202fWho"},
+		{"still sanitized", "\x00 Jose\u0301 ", "Jos\u00e9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeName(tt.input); got != tt.expected {
+				t.Errorf("NormalizeName(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSanitizeSearchQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"short query", "  john ", "john"},
+		{"exactly the limit", strings.Repeat("a", MaxSearchLength), strings.Repeat("a", MaxSearchLength)},
+		{"over the limit", strings.Repeat("a", MaxSearchLength+10), strings.Repeat("a", MaxSearchLength)},
+		{"multibyte characters counted as one", strings.Repeat("é", MaxSearchLength+1), strings.Repeat("é", MaxSearchLength)},
+		{"wildcards kept for the store to escape", "50%", "50%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeSearchQuery(tt.input); got != tt.expected {
+				t.Errorf("SanitizeSearchQuery() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateNameUnicode(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantError string
+	}{
+		{name: "accented latin", input: "Zoë Ångström"},
+		{name: "cyrillic", input: "Анна Каренина"},
+		{name: "greek", input: "Νίκος"},
+		{name: "japanese mixing kanji and kana", input: "やまだ 太郎"},
+		{name: "korean with latin initial", input: "J. 김민준"},
+		{name: "latin with cyrillic homoglyph", input: "P\u0430ypal", wantError: "different alphabets"},
+		{name: "greek omicron in latin name", input: "J\u03bfhn", wantError: "different alphabets"},
+		{name: "unsanitized zero-width joiner", input: "Jo\u200dhn", wantError: "invalid characters"},
+		{name: "persian with zero-width non-joiner", input: "علی\u200cرضا"},
+		{name: "devanagari half form with zero-width joiner", input: "क्\u200dष"},
+		{name: "trailing zero-width non-joiner", input: "علی\u200c", wantError: "invalid characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateName(tt.input)
+			if tt.wantError == "" {
+				if len(errs) > 0 {
+					t.Errorf("validateName(%q) unexpected error: %v", tt.input, errs)
+				}
+				return
+			}
+			if !strings.Contains(errs.Error(), tt.wantError) {
+				t.Errorf("validateName(%q) = %v, expected error containing %q", tt.input, errs, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestValidationErrorsToMap(t *testing.T) {
+	errs := ValidationErrors{
+		{Field: "name", Message: "name is required"},
+		{Field: "email", Message: "email is too long"},
+		{Field: "email", Message: "email format is invalid"},
+	}
+
+	got := errs.ToMap()
+
+	expected := map[string]string{
+		"name":  "name is required",
+		"email": "email is too long; email format is invalid",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("ToMap() = %v, expected %v", got, expected)
+	}
+	for field, message := range expected {
+		if got[field] != message {
+			t.Errorf("ToMap()[%q] = %q, expected %q", field, got[field], message)
+		}
+	}
+}
+
 func TestSanitizeInput(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -107,6 +285,51 @@ func TestSanitizeInput(t *testing.T) {
 			input:    "   ",
 			expected: "",
 		},
+		{
+			name:     "combining accent composed to NFC",
+			input:    "Jose\u0301",
+			expected: "Jos\u00e9",
+		},
+		{
+			name:     "zero-width joiner and space removed",
+			input:    "Ad\u200dmin\u200b",
+			expected: "Admin",
+		},
+		{
+			name:     "zero-width non-joiner kept inside a persian word",
+			input:    "می\u200cخواهم",
+			expected: "می\u200cخواهم",
+		},
+		{
+			name:     "zero-width joiner kept after a devanagari virama",
+			input:    "क्\u200dष",
+			expected: "क्\u200dष",
+		},
+		{
+			name:     "joiners removed at the edges of a persian word",
+			input:    "\u200cعلی\u200d",
+			expected: "علی",
+		},
+		{
+			name:     "joiner removed between persian and latin letters",
+			input:    "علی\u200cAli",
+			expected: "علیAli",
+		},
+		{
+			name:     "bidi override and control characters removed",
+			input:    "\u202eevil\x07",
+			expected: "evil",
+		},
+		{
+			name:     "internal whitespace preserved",
+			input:    "John\tDoe",
+			expected: "John\tDoe",
+		},
+		{
+			name:     "CJK untouched",
+			input:    "山田 太郎",
+			expected: "山田 太郎",
+		},
 	}
 
 	for _, tt := range tests {
@@ -117,4 +340,50 @@ func TestSanitizeInput(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestValidateProfanity(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantError bool
+	}{
+		{name: "benign name", input: "John Doe", wantError: false},
+		{name: "benign name containing a listed word", input: "Cassandra Bassett", wantError: false},
+		{name: "short benign name", input: "As Li", wantError: false},
+		{name: "initials", input: "J. R. Smith", wantError: false},
+		{name: "listed word", input: "Shit Happens", wantError: true},
+		{name: "mixed case", input: "DaMn Fine", wantError: true},
+		{name: "leetspeak", input: "sh1t head", wantError: true},
+		{name: "repeated letters", input: "shiiiit", wantError: true},
+		{name: "spelled out with separators", input: "f.u.c.k you", wantError: true},
+		{name: "spelled out with symbols", input: "$ h ! t", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateProfanity(tt.input)
+			if tt.wantError && err == nil {
+				t.Errorf("validateProfanity(%q) expected error, got nil", tt.input)
+			}
+			if !tt.wantError && err != nil {
+				t.Errorf("validateProfanity(%q) unexpected error: %v", tt.input, err)
+			}
+		})
+	}
+}
+
+func TestValidateUserProfanityFilter(t *testing.T) {
+	input := UserInput{Name: "sh1t head", Email: "john@example.com"}
+
+	if err := ValidateUser(input); err != nil {
+		t.Errorf("ValidateUser() with filter disabled unexpected error: %v", err)
+	}
+
+	EnableProfanityFilter(true)
+	t.Cleanup(func() { EnableProfanityFilter(false) })
+
+	err := ValidateUser(input)
+	if err == nil || !strings.Contains(err.Error(), "inappropriate language") {
+		t.Errorf("ValidateUser() with filter enabled error = %v, expected profanity error", err)
+	}
+}
@@ -0,0 +1,52 @@
+// Package version reports which build of the application is running. The values are
+// injected at build time, e.g.
+//
+//	go build -ldflags "-X htmx-learn/version.Version=v1.2.0 \
+//		-X htmx-learn/version.Commit=$(git rev-parse --short HEAD) \
+//		-X htmx-learn/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/htmx-learn
+//
+// as the Taskfile and Dockerfile do. Builds without them report "dev".
+package version
+
+import "runtime/debug"
+
+// Set with -ldflags -X at build time
+var (
+	// Version is the release tag, or "dev" for local builds
+	Version = "dev"
+	// Commit is the git commit the binary was built from
+	Commit = ""
+	// BuildDate is when the binary was built, in RFC 3339
+	BuildDate = ""
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the running build's version information. A commit that wasn't injected
+// is taken from the VCS stamp Go embeds when building inside a git checkout.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildDate: BuildDate}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.GoVersion = build.GoVersion
+		if info.Commit == "" {
+			info.Commit = vcsRevision(build)
+		}
+	}
+	return info
+}
+
+// vcsRevision returns the commit recorded in build, shortened like git rev-parse --short
+func vcsRevision(build *debug.BuildInfo) string {
+	for _, setting := range build.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value[:min(len(setting.Value), 7)]
+		}
+	}
+	return ""
+}
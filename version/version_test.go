@@ -0,0 +1,42 @@
+package version
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestGetDefaultsToDev(t *testing.T) {
+	if info := Get(); info.Version != "dev" {
+		t.Errorf("Version = %q without ldflags, expected dev", info.Version)
+	}
+}
+
+func TestGetPrefersInjectedValues(t *testing.T) {
+	defer func(version, commit, date string) { Version, Commit, BuildDate = version, commit, date }(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "v1.2.0", "abc1234", "2026-01-02T03:04:05Z"
+
+	info := Get()
+	if info.Version != "v1.2.0" || info.Commit != "abc1234" || info.BuildDate != "2026-01-02T03:04:05Z" {
+		t.Errorf("Get() = %+v, expected the injected values", info)
+	}
+}
+
+func TestVCSRevision(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings []debug.BuildSetting
+		expected string
+	}{
+		{"full hash shortened", []debug.BuildSetting{{Key: "vcs.revision", Value: "0123456789abcdef"}}, "0123456"},
+		{"short hash kept", []debug.BuildSetting{{Key: "vcs.revision", Value: "abc"}}, "abc"},
+		{"no vcs stamp", []debug.BuildSetting{{Key: "GOOS", Value: "linux"}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := vcsRevision(&debug.BuildInfo{Settings: tt.settings}); got != tt.expected {
+				t.Errorf("vcsRevision() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}